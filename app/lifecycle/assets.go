@@ -0,0 +1,35 @@
+package lifecycle
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UpdateAsset is the download for one platform in an update response
+type UpdateAsset struct {
+	URL      string `json:"url"`
+	Checksum string `json:"sha256,omitempty"`
+}
+
+// selectUpdateAsset points resp at the asset for goos/goarch, when the
+// response lists assets per platform. Responses without assets are left
+// alone, using their flat UpdateURL.
+func selectUpdateAsset(resp *UpdateResponse, goos, goarch string) error {
+	if len(resp.Assets) == 0 {
+		return nil
+	}
+	platform := goos + "/" + goarch
+	asset, ok := resp.Assets[platform]
+	if !ok || asset.URL == "" {
+		platforms := make([]string, 0, len(resp.Assets))
+		for p := range resp.Assets {
+			platforms = append(platforms, p)
+		}
+		sort.Strings(platforms)
+		return fmt.Errorf("no update asset for %s, only %s", platform, strings.Join(platforms, ", "))
+	}
+	resp.UpdateURL = asset.URL
+	resp.Checksum = asset.Checksum
+	return nil
+}
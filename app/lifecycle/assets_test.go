@@ -0,0 +1,60 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectUpdateAsset(t *testing.T) {
+	assets := map[string]UpdateAsset{
+		"windows/amd64": {URL: "https://example.com/download/v0.1.30/OllamaSetup.exe", Checksum: "aaaa"},
+		"darwin/arm64":  {URL: "https://example.com/download/v0.1.30/Ollama-darwin.zip", Checksum: "bbbb"},
+	}
+
+	resp := UpdateResponse{Assets: assets}
+	require.NoError(t, selectUpdateAsset(&resp, "darwin", "arm64"))
+	assert.Equal(t, "https://example.com/download/v0.1.30/Ollama-darwin.zip", resp.UpdateURL)
+	assert.Equal(t, "bbbb", resp.Checksum)
+
+	resp = UpdateResponse{Assets: assets}
+	err := selectUpdateAsset(&resp, "linux", "amd64")
+	require.ErrorContains(t, err, "no update asset for linux/amd64")
+	assert.ErrorContains(t, err, "darwin/arm64, windows/amd64")
+	assert.Empty(t, resp.UpdateURL)
+
+	// Without assets the flat URL is used
+	resp = UpdateResponse{UpdateURL: "https://example.com/download/v0.1.30/OllamaSetup.exe", Checksum: "cccc"}
+	require.NoError(t, selectUpdateAsset(&resp, "linux", "amd64"))
+	assert.Equal(t, "https://example.com/download/v0.1.30/OllamaSetup.exe", resp.UpdateURL)
+	assert.Equal(t, "cccc", resp.Checksum)
+}
+
+func TestIsNewReleaseAvailableAssets(t *testing.T) {
+	setupTestKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"url":"https://example.com/download/v0.1.29/OllamaSetup.exe","assets":{` + //nolint:errcheck
+			`"windows/amd64":{"url":"https://example.com/download/v0.1.30/OllamaSetup.exe","sha256":"aaaa"},` +
+			`"windows/arm64":{"url":"https://example.com/download/v0.1.30/OllamaSetup-arm64.exe","sha256":"bbbb"}}}`))
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+	origOS, origArch := UpdateOS, UpdateArch
+	t.Cleanup(func() { UpdateOS, UpdateArch = origOS, origArch })
+
+	UpdateOS, UpdateArch = "windows", "arm64"
+	available, resp := IsNewReleaseAvailable(context.Background())
+	require.True(t, available)
+	assert.Equal(t, "https://example.com/download/v0.1.30/OllamaSetup-arm64.exe", resp.UpdateURL)
+	assert.Equal(t, "bbbb", resp.Checksum)
+	assert.Equal(t, "v0.1.30", resp.UpdateVersion)
+
+	UpdateOS, UpdateArch = "linux", "amd64"
+	available, _ = IsNewReleaseAvailable(context.Background())
+	assert.False(t, available)
+}
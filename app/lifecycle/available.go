@@ -0,0 +1,88 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/jmorganca/ollama/app/tray/commontray"
+	"github.com/jmorganca/ollama/version"
+)
+
+// The last update found is kept in the store, so a restart before it's acted
+// on doesn't hide it until the next check comes around.
+
+var (
+	// overridden in tests
+	availableUpdateSetting = store.GetAvailableUpdate
+	saveAvailableUpdate    = store.SetAvailableUpdate
+)
+
+// rememberAvailableUpdate records resp as the available update, keeping
+// when it was first found
+func rememberAvailableUpdate(resp UpdateResponse) {
+	found := time.Now()
+	if prev := availableUpdateSetting(); prev.Version == resp.UpdateVersion && !prev.Found.IsZero() {
+		found = prev.Found
+	}
+	saveAvailableUpdate(store.AvailableUpdate{
+		Version:   resp.UpdateVersion,
+		URL:       resp.UpdateURL,
+		Checksum:  resp.Checksum,
+		Found:     found,
+		Mandatory: resp.required(),
+	})
+}
+
+// RestoreAvailableUpdate offers the update found in a previous session
+// again by calling pending with its version, which the tray only shows as
+// staged once CurrentUpdateState reports it downloaded. The record is
+// dropped once the running version has caught up with it, or the machine is
+// pinned elsewhere.
+func RestoreAvailableUpdate(pending func(ver string) error) bool {
+	if UpdatesDisabled() {
+		return false
+	}
+	available := availableUpdateSetting()
+	if available.Version == "" {
+		return false
+	}
+	if cmp, ok := compareVersions(available.Version, version.Version); !ok || cmp <= 0 {
+		slog.Debug(fmt.Sprintf("available update %s is no longer newer than %s, forgetting it", available.Version, version.Version))
+		saveAvailableUpdate(store.AvailableUpdate{})
+		return false
+	}
+	if !pinAllows(available.Version) {
+		slog.Debug(fmt.Sprintf("available update %s isn't the pinned version, forgetting it", available.Version))
+		saveAvailableUpdate(store.AvailableUpdate{})
+		return false
+	}
+	if err := pending(available.Version); err != nil {
+		slog.Warn(fmt.Sprintf("failed to restore available update %s: %s", available.Version, err))
+	}
+	return true
+}
+
+// CurrentUpdateState reports what the updater knows about updates right now,
+// for the tray to lay out its menu. It's safe to call from any goroutine.
+func CurrentUpdateState() commontray.UpdateState {
+	if UpdatesDisabled() {
+		return commontray.UpdateState{Disabled: true}
+	}
+	state := commontray.UpdateState{
+		Downloaded:  IsUpdateDownloaded(),
+		Downloading: downloadActive(),
+		Paused:      DownloadPaused(),
+		Mode:        currentUpdateMode(),
+	}
+	available := availableUpdateSetting()
+	if available.Version == "" || !pinAllows(available.Version) {
+		return state
+	}
+	if cmp, ok := compareVersions(available.Version, version.Version); ok && cmp > 0 {
+		state.Version = available.Version
+		state.Mandatory = available.Mandatory
+	}
+	return state
+}
@@ -0,0 +1,124 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/jmorganca/ollama/app/tray/commontray"
+	"github.com/jmorganca/ollama/version"
+)
+
+// stubAvailableUpdate keeps the available update in memory instead of the
+// store
+func stubAvailableUpdate(t *testing.T) *store.AvailableUpdate {
+	t.Helper()
+	origGet, origSave := availableUpdateSetting, saveAvailableUpdate
+	t.Cleanup(func() { availableUpdateSetting, saveAvailableUpdate = origGet, origSave })
+	var saved store.AvailableUpdate
+	availableUpdateSetting = func() store.AvailableUpdate { return saved }
+	saveAvailableUpdate = func(u store.AvailableUpdate) { saved = u }
+	return &saved
+}
+
+func TestRestoreAvailableUpdate(t *testing.T) {
+	setUpdatesDisabled(t, false)
+	stubPinnedVersion(t, "")
+	orig := version.Version
+	t.Cleanup(func() { version.Version = orig })
+	version.Version = "0.1.29"
+
+	var restored []string
+	pending := func(ver string) error {
+		restored = append(restored, ver)
+		return nil
+	}
+
+	t.Run("restored", func(t *testing.T) {
+		restored = nil
+		saved := stubAvailableUpdate(t)
+		assert.False(t, RestoreAvailableUpdate(pending), "nothing found yet")
+
+		rememberAvailableUpdate(UpdateResponse{
+			UpdateURL:     "https://example.com/download/v0.1.30/OllamaSetup.exe",
+			UpdateVersion: "v0.1.30",
+			Checksum:      "abcd",
+		})
+		require.Equal(t, "v0.1.30", saved.Version)
+		assert.Equal(t, "https://example.com/download/v0.1.30/OllamaSetup.exe", saved.URL)
+		assert.Equal(t, "abcd", saved.Checksum)
+		assert.False(t, saved.Found.IsZero())
+
+		assert.True(t, RestoreAvailableUpdate(pending))
+		assert.Equal(t, []string{"v0.1.30"}, restored)
+		assert.Equal(t, "v0.1.30", saved.Version, "kept until it's installed")
+	})
+
+	for _, running := range []string{"0.1.30", "0.1.31"} {
+		running := running
+		t.Run("invalidated by "+running, func(t *testing.T) {
+			restored = nil
+			saved := stubAvailableUpdate(t)
+			*saved = store.AvailableUpdate{Version: "v0.1.30"}
+			version.Version = running
+			t.Cleanup(func() { version.Version = "0.1.29" })
+			assert.False(t, RestoreAvailableUpdate(pending))
+			assert.Empty(t, restored)
+			assert.Empty(t, saved.Version)
+		})
+	}
+
+	t.Run("not the pinned version", func(t *testing.T) {
+		restored = nil
+		saved := stubAvailableUpdate(t)
+		*saved = store.AvailableUpdate{Version: "v0.1.30"}
+		stubPinnedVersion(t, "0.1.29")
+		assert.False(t, RestoreAvailableUpdate(pending))
+		assert.Empty(t, restored)
+		assert.Empty(t, saved.Version)
+	})
+
+	t.Run("updates disabled", func(t *testing.T) {
+		restored = nil
+		saved := stubAvailableUpdate(t)
+		*saved = store.AvailableUpdate{Version: "v0.1.30"}
+		setUpdatesDisabled(t, true)
+		assert.False(t, RestoreAvailableUpdate(pending))
+		assert.Empty(t, restored)
+	})
+}
+
+func TestCurrentUpdateState(t *testing.T) {
+	setUpdatesDisabled(t, false)
+	stubPinnedVersion(t, "")
+	saved := stubAvailableUpdate(t)
+	stubUpdateMode(t, true, false)
+	orig := version.Version
+	t.Cleanup(func() { version.Version = orig })
+	version.Version = "0.1.29"
+	t.Cleanup(func() { SetUpdateDownloaded(false) })
+
+	assert.Equal(t, commontray.UpdateState{}, CurrentUpdateState(), "no update yet")
+
+	*saved = store.AvailableUpdate{Version: "0.1.30"}
+	assert.Equal(t, commontray.UpdateState{Version: "0.1.30"}, CurrentUpdateState())
+
+	SetUpdateDownloaded(true)
+	saved.Mandatory = true
+	assert.Equal(t, commontray.UpdateState{Version: "0.1.30", Downloaded: true, Mandatory: true}, CurrentUpdateState())
+
+	SetUpdateMode(commontray.UpdateManual)
+	assert.Equal(t, commontray.UpdateManual, CurrentUpdateState().Mode)
+
+	version.Version = "0.1.30"
+	assert.Empty(t, CurrentUpdateState().Version, "already running it")
+
+	version.Version = "0.1.29"
+	stubPinnedVersion(t, "0.1.29")
+	assert.Empty(t, CurrentUpdateState().Version, "pinned elsewhere")
+
+	setUpdatesDisabled(t, true)
+	assert.Equal(t, commontray.UpdateState{Disabled: true}, CurrentUpdateState())
+}
@@ -0,0 +1,60 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// UpdateRequirements are hardware capabilities a release needs, so builds
+// that won't run on this machine aren't offered
+type UpdateRequirements struct {
+	RequiresAVX2 bool `json:"requires_avx2,omitempty"`
+	// MinCUDA is the oldest CUDA driver version supported, such as "11.3".
+	// Machines without a CUDA driver aren't held back, since they run on the
+	// CPU instead.
+	MinCUDA string `json:"min_cuda,omitempty"`
+}
+
+// Capabilities describes the hardware of this machine
+type Capabilities struct {
+	AVX2 bool
+	// CUDAVersion is the version of the installed CUDA driver, or empty if
+	// there is none
+	CUDAVersion string
+}
+
+type capabilityDetector interface {
+	Capabilities() (Capabilities, error)
+}
+
+// overridden in tests
+var systemCapabilities capabilityDetector = platformCapabilities{}
+
+// requirementsMet reports whether this machine meets req. As with the OS
+// version, capabilities that can't be determined don't block the update.
+func requirementsMet(detector capabilityDetector, req *UpdateRequirements) bool {
+	if req == nil || (!req.RequiresAVX2 && req.MinCUDA == "") {
+		return true
+	}
+	caps, err := detector.Capabilities()
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to detect system capabilities, skipping requirements check: %s", err))
+		return true
+	}
+	if req.RequiresAVX2 && !caps.AVX2 {
+		slog.Warn("update requires a CPU with AVX2 support, which this system lacks, skipping update")
+		return false
+	}
+	if req.MinCUDA != "" && caps.CUDAVersion != "" {
+		cmp, ok := compareVersions(caps.CUDAVersion, req.MinCUDA)
+		if !ok {
+			slog.Debug(fmt.Sprintf("unable to compare CUDA version %q with minimum %q", caps.CUDAVersion, req.MinCUDA))
+			return true
+		}
+		if cmp < 0 {
+			slog.Warn(fmt.Sprintf("update requires CUDA %s or newer, but this system has CUDA %s, skipping update", req.MinCUDA, caps.CUDAVersion))
+			return false
+		}
+	}
+	return true
+}
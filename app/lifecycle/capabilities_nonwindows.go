@@ -0,0 +1,12 @@
+//go:build !windows
+
+package lifecycle
+
+import "golang.org/x/sys/cpu"
+
+type platformCapabilities struct{}
+
+// CUDA detection isn't implemented, which leaves CUDA requirements unchecked
+func (platformCapabilities) Capabilities() (Capabilities, error) {
+	return Capabilities{AVX2: cpu.X86.HasAVX2}, nil
+}
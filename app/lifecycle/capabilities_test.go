@@ -0,0 +1,66 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCapabilities struct {
+	caps Capabilities
+	err  error
+}
+
+func (f fakeCapabilities) Capabilities() (Capabilities, error) {
+	return f.caps, f.err
+}
+
+func TestRequirementsMet(t *testing.T) {
+	gpu := fakeCapabilities{caps: Capabilities{AVX2: true, CUDAVersion: "11.8"}}
+	old := fakeCapabilities{caps: Capabilities{AVX2: false, CUDAVersion: "11.2"}}
+	cpuOnly := fakeCapabilities{caps: Capabilities{AVX2: true}}
+
+	cases := []struct {
+		name     string
+		detector capabilityDetector
+		req      *UpdateRequirements
+		expect   bool
+	}{
+		{"no requirements", old, nil, true},
+		{"empty requirements", old, &UpdateRequirements{}, true},
+		{"avx2 met", gpu, &UpdateRequirements{RequiresAVX2: true}, true},
+		{"avx2 unmet", old, &UpdateRequirements{RequiresAVX2: true}, false},
+		{"cuda met", gpu, &UpdateRequirements{MinCUDA: "11.3"}, true},
+		{"cuda unmet", old, &UpdateRequirements{MinCUDA: "11.3"}, false},
+		{"no cuda driver", cpuOnly, &UpdateRequirements{MinCUDA: "11.3"}, true},
+		{"both met", gpu, &UpdateRequirements{RequiresAVX2: true, MinCUDA: "11.8"}, true},
+		{"unknown capabilities", fakeCapabilities{err: errors.New("boom")}, &UpdateRequirements{RequiresAVX2: true}, true},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.expect, requirementsMet(tc.detector, tc.req), tc.name)
+	}
+}
+
+func TestIsNewReleaseAvailableRequirements(t *testing.T) {
+	setupTestKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"url":"https://example.com/download/v0.1.30/OllamaSetup.exe","requirements":{"requires_avx2":true,"min_cuda":"11.3"}}`)) //nolint:errcheck
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+	t.Cleanup(func() { systemCapabilities = platformCapabilities{} })
+
+	systemCapabilities = fakeCapabilities{caps: Capabilities{AVX2: true, CUDAVersion: "12.2"}}
+	available, resp := IsNewReleaseAvailable(context.Background())
+	assert.True(t, available)
+	assert.Equal(t, &UpdateRequirements{RequiresAVX2: true, MinCUDA: "11.3"}, resp.Requirements)
+
+	systemCapabilities = fakeCapabilities{caps: Capabilities{AVX2: false}}
+	available, _ = IsNewReleaseAvailable(context.Background())
+	assert.False(t, available)
+}
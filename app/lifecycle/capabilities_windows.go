@@ -0,0 +1,29 @@
+package lifecycle
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/cpu"
+	"golang.org/x/sys/windows"
+)
+
+var pCuDriverGetVersion = windows.NewLazySystemDLL("nvcuda.dll").NewProc("cuDriverGetVersion")
+
+type platformCapabilities struct{}
+
+func (platformCapabilities) Capabilities() (Capabilities, error) {
+	caps := Capabilities{AVX2: cpu.X86.HasAVX2}
+	// nvcuda.dll ships with the NVIDIA driver, so its absence just means
+	// there's no CUDA capable GPU
+	if pCuDriverGetVersion.Find() != nil {
+		return caps, nil
+	}
+	var v int32
+	if res, _, _ := pCuDriverGetVersion.Call(uintptr(unsafe.Pointer(&v))); res != 0 {
+		return caps, fmt.Errorf("cuDriverGetVersion failed with %d", res)
+	}
+	// Encoded as 1000 * major + 10 * minor
+	caps.CUDAVersion = fmt.Sprintf("%d.%d", v/1000, (v%1000)/10)
+	return caps, nil
+}
@@ -0,0 +1,30 @@
+package lifecycle
+
+import (
+	"os"
+	"strings"
+)
+
+// updateCheckURLBases returns where to check for updates, in the order
+// they're tried. OLLAMA_UPDATE_CHECK_URLS lists a primary and its mirrors,
+// comma separated, and the test server replaces them all.
+func updateCheckURLBases() []string {
+	if u, ok := updateTestServer(); ok {
+		return []string{u.JoinPath("api", "update").String()}
+	}
+	var bases []string
+	for _, base := range strings.Split(os.Getenv("OLLAMA_UPDATE_CHECK_URLS"), ",") {
+		if base = strings.TrimSpace(base); base != "" {
+			bases = append(bases, base)
+		}
+	}
+	if len(bases) == 0 {
+		return []string{UpdateCheckURLBase}
+	}
+	return bases
+}
+
+// updateCheckURLBase returns the primary place to check for updates
+func updateCheckURLBase() string {
+	return updateCheckURLBases()[0]
+}
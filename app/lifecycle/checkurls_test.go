@@ -0,0 +1,77 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateCheckURLBases(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+	t.Setenv("OLLAMA_UPDATE_CHECK_URLS", "")
+	UpdateCheckURLBase = "https://ollama.com/api/update"
+	assert.Equal(t, []string{"https://ollama.com/api/update"}, updateCheckURLBases())
+
+	t.Setenv("OLLAMA_UPDATE_CHECK_URLS", "https://primary.example.com/api/update, ,https://mirror.example.com/api/update")
+	assert.Equal(t, []string{"https://primary.example.com/api/update", "https://mirror.example.com/api/update"}, updateCheckURLBases())
+	assert.Equal(t, "https://primary.example.com/api/update", updateCheckURLBase())
+
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "http://127.0.0.1:8080")
+	assert.Equal(t, []string{"http://127.0.0.1:8080/api/update"}, updateCheckURLBases())
+}
+
+func TestIsNewReleaseAvailableFailover(t *testing.T) {
+	setupTestKey(t)
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+
+	var hits []string
+	handler := func(name string, h http.HandlerFunc) *httptest.Server {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits = append(hits, name)
+			h(w, r)
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	down := handler("down", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	})
+	portal := handler("portal", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>")) //nolint:errcheck
+	})
+	good := handler("good", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"url":"https://example.com/download/v0.1.30/OllamaSetup.exe"}`)) //nolint:errcheck
+	})
+	upToDate := handler("up to date", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	never := handler("never", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	t.Setenv("OLLAMA_UPDATE_CHECK_URLS", down.URL+","+portal.URL+","+good.URL+","+never.URL)
+	available, resp := IsNewReleaseAvailable(context.Background())
+	require.True(t, available)
+	assert.Equal(t, "v0.1.30", resp.UpdateVersion)
+	assert.Equal(t, []string{"down", "portal", "good"}, hits, "stops at the first success")
+
+	// Being told there's nothing newer is a success too
+	hits = nil
+	t.Setenv("OLLAMA_UPDATE_CHECK_URLS", down.URL+","+upToDate.URL+","+good.URL)
+	available, _ = IsNewReleaseAvailable(context.Background())
+	assert.False(t, available)
+	assert.Equal(t, []string{"down", "up to date"}, hits)
+
+	hits = nil
+	t.Setenv("OLLAMA_UPDATE_CHECK_URLS", down.URL+","+portal.URL)
+	available, resp = IsNewReleaseAvailable(context.Background())
+	assert.False(t, available)
+	assert.Equal(t, UpdateResponse{}, resp)
+	assert.Equal(t, []string{"down", "portal"}, hits)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package lifecycle
+
+import "fmt"
+
+func SetClipboardText(text string) error {
+	return fmt.Errorf("SetClipboardText not implemented")
+}
@@ -0,0 +1,65 @@
+package lifecycle
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	u32 = windows.NewLazySystemDLL("User32.dll")
+	k32 = windows.NewLazySystemDLL("Kernel32.dll")
+
+	pOpenClipboard    = u32.NewProc("OpenClipboard")
+	pCloseClipboard   = u32.NewProc("CloseClipboard")
+	pEmptyClipboard   = u32.NewProc("EmptyClipboard")
+	pSetClipboardData = u32.NewProc("SetClipboardData")
+	pGlobalAlloc      = k32.NewProc("GlobalAlloc")
+	pGlobalFree       = k32.NewProc("GlobalFree")
+	pGlobalLock       = k32.NewProc("GlobalLock")
+	pGlobalUnlock     = k32.NewProc("GlobalUnlock")
+	pLstrcpyW         = k32.NewProc("lstrcpyW")
+)
+
+// SetClipboardText replaces the clipboard contents with text
+// https://learn.microsoft.com/en-us/windows/win32/dataxchg/using-the-clipboard
+func SetClipboardText(text string) error {
+	const (
+		CF_UNICODETEXT = 13
+		GMEM_MOVEABLE  = 0x0002
+	)
+	data, err := windows.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+
+	if res, _, err := pOpenClipboard.Call(0); res == 0 {
+		return fmt.Errorf("failed to open clipboard: %w", err)
+	}
+	defer pCloseClipboard.Call() //nolint:errcheck
+
+	if res, _, err := pEmptyClipboard.Call(); res == 0 {
+		return fmt.Errorf("failed to empty clipboard: %w", err)
+	}
+
+	size := uintptr(len(data)) * unsafe.Sizeof(data[0])
+	h, _, err := pGlobalAlloc.Call(GMEM_MOVEABLE, size)
+	if h == 0 {
+		return fmt.Errorf("failed to allocate clipboard memory: %w", err)
+	}
+	p, _, err := pGlobalLock.Call(h)
+	if p == 0 {
+		pGlobalFree.Call(h) //nolint:errcheck
+		return fmt.Errorf("failed to lock clipboard memory: %w", err)
+	}
+	pLstrcpyW.Call(p, uintptr(unsafe.Pointer(&data[0]))) //nolint:errcheck
+	pGlobalUnlock.Call(h)                                //nolint:errcheck
+
+	// On success the system owns the memory
+	if res, _, err := pSetClipboardData.Call(CF_UNICODETEXT, h); res == 0 {
+		pGlobalFree.Call(h) //nolint:errcheck
+		return fmt.Errorf("failed to set clipboard data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// A machine whose clock is wildly wrong misjudges snoozed notifications and
+// maintenance windows. Each update check compares the response's Date header
+// to the local clock, and while they're further apart than
+// ClockSkewThreshold those time based holds are relaxed, so updates aren't
+// held back by a clock that can't be trusted. Anyone between the app and the
+// server could fake the header to get around the holds, so only signed
+// responses are trusted with it, the rest just log the skew.
+
+// ClockSkewThreshold is how far the local clock may be off the update
+// server's before it's distrusted, overridden by
+// OLLAMA_UPDATE_CLOCK_SKEW_THRESHOLD
+var ClockSkewThreshold = time.Hour
+
+// The local clock's offset from the update server's at the last check
+var clockSkew atomic.Int64
+
+// checkClockSkew reports how far now is off date, the Date header of an
+// update check response, warning when the clock is distrusted. It's recorded
+// only when the response was signed. Responses without a usable Date header
+// are ignored.
+func checkClockSkew(date string, now time.Time, signed bool) time.Duration {
+	if date == "" {
+		return time.Duration(clockSkew.Load())
+	}
+	server, err := http.ParseTime(date)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("ignoring invalid Date header %q: %s", date, err))
+		return time.Duration(clockSkew.Load())
+	}
+	skew := now.Sub(server)
+	if !signed {
+		if skewed(skew) {
+			slog.Warn(fmt.Sprintf("local clock is %s off the unsigned update response's Date header", skew.Round(time.Second)))
+		}
+		return skew
+	}
+	clockSkew.Store(int64(skew))
+	if skewed(skew) {
+		slog.Warn(fmt.Sprintf("local clock is %s off the update server's, ignoring snoozed notifications and maintenance windows", skew.Round(time.Second)))
+	}
+	return skew
+}
+
+func skewed(skew time.Duration) bool {
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew > envDuration("OLLAMA_UPDATE_CLOCK_SKEW_THRESHOLD", ClockSkewThreshold)
+}
+
+// clockSkewed reports whether the local clock was too far off the update
+// server's at the last check to rely on
+func clockSkewed() bool {
+	return skewed(time.Duration(clockSkew.Load()))
+}
@@ -0,0 +1,89 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// resetClockSkew forgets the measured skew once the test is done
+func resetClockSkew(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() { clockSkew.Store(0) })
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	resetClockSkew(t)
+	t.Setenv("OLLAMA_UPDATE_CLOCK_SKEW_THRESHOLD", "")
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), checkClockSkew(now.Format(http.TimeFormat), now, true))
+	assert.False(t, clockSkewed())
+
+	assert.Equal(t, -30*time.Minute, checkClockSkew(now.Add(30*time.Minute).Format(http.TimeFormat), now, true))
+	assert.False(t, clockSkewed(), "within the threshold")
+
+	assert.Equal(t, 3*time.Hour, checkClockSkew(now.Add(-3*time.Hour).Format(http.TimeFormat), now, true))
+	assert.True(t, clockSkewed(), "local clock ahead")
+	checkClockSkew("", now, true)
+	checkClockSkew("yesterday", now, true)
+	assert.True(t, clockSkewed(), "kept without a usable Date header")
+
+	checkClockSkew(now.Add(48*time.Hour).Format(http.TimeFormat), now, true)
+	assert.True(t, clockSkewed(), "local clock behind")
+	clockSkew.Store(0)
+	assert.Equal(t, 48*time.Hour, checkClockSkew(now.Add(-48*time.Hour).Format(http.TimeFormat), now, false))
+	assert.False(t, clockSkewed(), "unsigned responses aren't trusted")
+	checkClockSkew(now.Add(48*time.Hour).Format(http.TimeFormat), now, true)
+
+	t.Setenv("OLLAMA_UPDATE_CLOCK_SKEW_THRESHOLD", "72h")
+	assert.False(t, clockSkewed())
+}
+
+func TestClockSkewFromUpdateCheck(t *testing.T) {
+	resetClockSkew(t)
+	setupTestKey(t)
+	key := setTestPublicKey(t)
+	var signed atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-24*time.Hour).UTC().Format(http.TimeFormat))
+		if !signed.Load() {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jose")
+		w.Write([]byte(signJWS(t, key, "EdDSA", `{"version":"0.0.1"}`))) //nolint:errcheck
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+	t.Setenv("OLLAMA_UPDATE_CHECK_URLS", "")
+
+	IsNewReleaseAvailable(context.Background())
+	assert.False(t, clockSkewed(), "unsigned response")
+
+	signed.Store(true)
+	IsNewReleaseAvailable(context.Background())
+	assert.True(t, clockSkewed(), "signed response")
+}
+
+func TestInstallWhenIdleSkewedClock(t *testing.T) {
+	resetClockSkew(t)
+	IdlePollInterval = time.Millisecond
+	now := time.Now()
+	m := now.Hour()*60 + now.Minute()
+	closed := &maintenanceWindow{start: (m + 120) % (24 * 60), end: (m + 180) % (24 * 60)}
+
+	checkClockSkew(now.Add(12*time.Hour).Format(http.TimeFormat), now, true)
+	installed := false
+	err := installWhenIdle(context.Background(), &fakeIdle{idle: time.Hour}, closed, func() error {
+		installed = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, installed, "the maintenance window is ignored")
+}
@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseVersion splits a version like "v0.1.30-rc1" into its numeric parts
+// and pre-release suffix
+func parseVersion(v string) ([]int, string, bool) {
+	v = strings.TrimPrefix(v, "v")
+	v, pre, _ := strings.Cut(v, "-")
+	if v == "" {
+		return nil, "", false
+	}
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, "", false
+		}
+		parts = append(parts, n)
+	}
+	return parts, pre, true
+}
+
+// compareVersions returns -1, 0, or 1 as a is older than, the same as, or
+// newer than b. Pre-releases sort before the release. ok is false if either
+// version can't be parsed.
+func compareVersions(a, b string) (cmp int, ok bool) {
+	pa, prea, oka := parseVersion(a)
+	pb, preb, okb := parseVersion(b)
+	if !oka || !okb {
+		return 0, false
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	switch {
+	case prea == preb:
+		return 0, true
+	case prea == "":
+		return 1, true
+	case preb == "":
+		return -1, true
+	case prea < preb:
+		return -1, true
+	default:
+		return 1, true
+	}
+}
+
+// isOlderVersion reports whether a is a known version older than b
+func isOlderVersion(a, b string) bool {
+	cmp, ok := compareVersions(a, b)
+	return ok && cmp < 0
+}
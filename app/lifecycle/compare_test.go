@@ -0,0 +1,29 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		expect int
+		ok     bool
+	}{
+		{"0.1.29", "0.1.30", -1, true},
+		{"v0.1.30", "0.1.30", 0, true},
+		{"0.1.30", "0.1.9", 1, true},
+		{"0.2", "0.1.30", 1, true},
+		{"0.1.30-rc1", "0.1.30", -1, true},
+		{"0.1.30-rc2", "0.1.30-rc1", 1, true},
+		{"0.1.30", "", 0, false},
+		{"unknown", "0.1.30", 0, false},
+	}
+	for _, tc := range cases {
+		cmp, ok := compareVersions(tc.a, tc.b)
+		assert.Equal(t, tc.ok, ok, "%s vs %s", tc.a, tc.b)
+		assert.Equal(t, tc.expect, cmp, "%s vs %s", tc.a, tc.b)
+	}
+}
@@ -0,0 +1,183 @@
+package lifecycle
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Setting OLLAMA_UPDATE_COMPRESS keeps the staged installer gzipped, trading
+// some CPU after the download and before the install for disk space. The
+// metadata still describes the installer itself, so verification always
+// applies to the decompressed form.
+
+// Suffix of a staged installer kept compressed
+const compressedSuffix = ".gz"
+
+func compressStagedUpdates() bool {
+	return os.Getenv("OLLAMA_UPDATE_COMPRESS") != ""
+}
+
+// storeStagedInstaller compresses the freshly staged installer when
+// OLLAMA_UPDATE_COMPRESS is set. It's kept as is if that fails.
+func storeStagedInstaller(installer string) {
+	if !compressStagedUpdates() {
+		return
+	}
+	if err := compressStagedInstaller(installer); err != nil {
+		slog.Warn(fmt.Sprintf("failed to compress staged update %s, keeping it uncompressed: %s", installer, err))
+		return
+	}
+	slog.Debug("compressed staged update " + installer)
+}
+
+// compressStagedInstaller replaces installer with a gzipped copy
+func compressStagedInstaller(installer string) error {
+	in, err := os.Open(installer)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	partial := installer + compressedSuffix + ".part"
+	out, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(partial, installer+compressedSuffix)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	in.Close()
+	return os.Remove(installer)
+}
+
+// stagedInstallerExists reports whether installer is staged, compressed or
+// not
+func stagedInstallerExists(installer string) bool {
+	for _, file := range []string{installer, installer + compressedSuffix} {
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// removeStagedInstaller removes installer in either form
+func removeStagedInstaller(installer string) {
+	os.Remove(installer)
+	os.Remove(installer + compressedSuffix)
+}
+
+// stagedSHA256 returns the checksum of installer, decompressing it on the
+// fly when only the compressed copy is staged
+func stagedSHA256(installer string) (string, error) {
+	if _, err := os.Stat(installer + compressedSuffix); err != nil {
+		return fileSHA256(installer)
+	}
+	if _, err := os.Stat(installer); err == nil {
+		return fileSHA256(installer)
+	}
+	f, err := os.Open(installer + compressedSuffix)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("corrupt staged update %s: %w", installer, err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, zr); err != nil {
+		return "", fmt.Errorf("corrupt staged update %s: %w", installer, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// decompressStagedInstaller writes out installer from its compressed copy,
+// checked against its metadata, so it can be run. The decompressed copy is
+// only needed for the install and is dropped again by
+// dropDecompressedInstaller. An installer staged uncompressed is left alone.
+func decompressStagedInstaller(installer string) error {
+	if _, err := os.Stat(installer); err == nil {
+		return nil
+	}
+	staged, err := readStagedMetadata(installer)
+	if err != nil {
+		return fmt.Errorf("unable to read staged update metadata: %w", err)
+	}
+	if staged.SHA256 == "" {
+		return fmt.Errorf("staged update metadata has no checksum")
+	}
+	in, err := os.Open(installer + compressedSuffix)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("corrupt staged update %s: %w", installer, err)
+	}
+
+	partial := installer + ".part"
+	out, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), zr)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, staged.SHA256) {
+			err = fmt.Errorf("checksum mismatch for %s: expected %s, got %s", installer, staged.SHA256, sum)
+		}
+	}
+	if err == nil {
+		err = os.Rename(partial, installer)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	slog.Debug("decompressed staged update " + installer)
+	return nil
+}
+
+// dropDecompressedInstaller removes the copy of installer written out for
+// an install when its compressed copy is still staged
+func dropDecompressedInstaller(installer string) {
+	if _, err := os.Stat(installer + compressedSuffix); err == nil {
+		os.Remove(installer)
+	}
+}
+
+// dropDecompressedCopies removes every installer under dir that was written
+// out next to its compressed copy, such as one left by an install that
+// failed, or moved along with it into the retained updates
+func dropDecompressedCopies(dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error { //nolint:errcheck
+		if err == nil && d.Type().IsRegular() && strings.HasSuffix(path, compressedSuffix) {
+			dropDecompressedInstaller(strings.TrimSuffix(path, compressedSuffix))
+		}
+		return nil
+	})
+}
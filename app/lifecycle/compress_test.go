@@ -0,0 +1,89 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressedInstallerRoundTrip(t *testing.T) {
+	contents := strings.Repeat("installer payload ", 1024)
+	installer := stageTestInstaller(t, contents)
+	sum, err := fileSHA256(installer)
+	require.NoError(t, err)
+
+	require.NoError(t, compressStagedInstaller(installer))
+	assert.NoFileExists(t, installer)
+	info, err := os.Stat(installer + compressedSuffix)
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), int64(len(contents)))
+
+	found, err := findStagedInstaller()
+	require.NoError(t, err)
+	assert.Equal(t, installer, found)
+	staged, err := verifyStagedInstaller(installer)
+	require.NoError(t, err, "verified as decompressed")
+	assert.Equal(t, "0.1.2", staged.Version)
+
+	require.NoError(t, decompressStagedInstaller(installer))
+	got, err := fileSHA256(installer)
+	require.NoError(t, err)
+	assert.Equal(t, sum, got)
+	assert.NoFileExists(t, installer+".part")
+
+	_, ok := VerifyStagedUpdate()
+	assert.True(t, ok)
+	assert.NoFileExists(t, installer, "only needed for the install")
+	assert.FileExists(t, installer+compressedSuffix)
+}
+
+func TestCleanupDropsDecompressedCopies(t *testing.T) {
+	installer := stageTestInstaller(t, "installer")
+	require.NoError(t, compressStagedInstaller(installer))
+	require.NoError(t, decompressStagedInstaller(installer))
+	retained := filepath.Join(retainedDir(), "0.1.1", Installer)
+	require.NoError(t, os.MkdirAll(filepath.Dir(retained), 0o755))
+	require.NoError(t, os.WriteFile(retained, []byte("installer"), 0o755))
+	require.NoError(t, os.WriteFile(retained+compressedSuffix, []byte("compressed"), 0o644))
+	uncompressed := filepath.Join(retainedDir(), "0.1.0", Installer)
+	require.NoError(t, os.MkdirAll(filepath.Dir(uncompressed), 0o755))
+	require.NoError(t, os.WriteFile(uncompressed, []byte("installer"), 0o755))
+
+	cleanupOldDownloadsExcept(filepath.Base(filepath.Dir(installer)))
+	assert.NoFileExists(t, installer, "left over from an install")
+	assert.FileExists(t, installer+compressedSuffix)
+	assert.NoFileExists(t, retained)
+	assert.FileExists(t, retained+compressedSuffix)
+	assert.FileExists(t, uncompressed, "retained uncompressed")
+}
+
+func TestDecompressTamperedInstaller(t *testing.T) {
+	installer := stageTestInstaller(t, "installer")
+	require.NoError(t, compressStagedInstaller(installer))
+	require.NoError(t, writeStagedMetadata(installer, StagedUpdate{Version: "0.1.2", SHA256: sha256Hex([]byte("other"))}))
+
+	_, err := verifyStagedInstaller(installer)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.ErrorContains(t, decompressStagedInstaller(installer), "checksum mismatch")
+	assert.NoFileExists(t, installer)
+	assert.NoFileExists(t, installer+".part")
+
+	require.NoError(t, os.WriteFile(installer+compressedSuffix, []byte("not gzip"), 0o644))
+	assert.ErrorContains(t, decompressStagedInstaller(installer), "corrupt staged update")
+}
+
+func TestStoreStagedInstaller(t *testing.T) {
+	installer := stageTestInstaller(t, "installer")
+	t.Setenv("OLLAMA_UPDATE_COMPRESS", "")
+	storeStagedInstaller(installer)
+	assert.FileExists(t, installer, "off by default")
+
+	t.Setenv("OLLAMA_UPDATE_COMPRESS", "1")
+	storeStagedInstaller(installer)
+	assert.NoFileExists(t, installer)
+	assert.True(t, stagedInstallerExists(installer))
+}
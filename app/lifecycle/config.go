@@ -0,0 +1,39 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envDuration parses a duration like "30s" from the environment, falling back
+// to def when unset or invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		slog.Warn(fmt.Sprintf("invalid %s=%q, using default %s", key, val, def))
+		return def
+	}
+	return d
+}
+
+// envInt parses an integer from the environment, falling back to def when
+// unset or invalid
+func envInt(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		slog.Warn(fmt.Sprintf("invalid %s=%q, using default %d", key, val, def))
+		return def
+	}
+	return i
+}
@@ -0,0 +1,146 @@
+package lifecycle
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+// The control listener lets local tools, like the CLI, drive the running
+// app. It only listens on loopback, and every request must carry the token
+// written to the store alongside the port.
+var (
+	// ControlPort is the loopback port to listen on, 0 picks a free one.
+	// Overridden by OLLAMA_APP_CONTROL_PORT
+	ControlPort = 0
+
+	// ControlShutdownTimeout bounds how long in-flight control requests may
+	// hold up quitting
+	ControlShutdownTimeout = 2 * time.Second
+
+	// overridden in tests
+	saveControlEndpoint = store.SetControlEndpoint
+)
+
+// newControlToken returns a random token for authenticating control requests
+func newControlToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// trayDiagnosisReport is the tray diagnosis as sent to the CLI, with the
+// summary shown to users alongside the individual checks
+type trayDiagnosisReport struct {
+	commontray.TrayDiagnosis
+	Summary string `json:"summary"`
+}
+
+// controlHandler maps control requests onto the tray callbacks, so they're
+// handled exactly like the matching menu items. Queries, which only report
+// on the app, are answered with JSON instead.
+func controlHandler(token string, callbacks commontray.Callbacks, diagnose func() commontray.TrayDiagnosis) http.Handler {
+	actions := map[string]chan struct{}{
+		"/update/check": callbacks.CheckUpdates,
+		"/logs/show":    callbacks.ShowLogs,
+		"/quit":         callbacks.Quit,
+	}
+	queries := map[string]func() any{
+		"/tray/diagnose": func() any {
+			d := diagnose()
+			return trayDiagnosisReport{TrayDiagnosis: d, Summary: d.Summary()}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ch, isAction := actions[r.URL.Path]
+		query, isQuery := queries[r.URL.Path]
+		if !isAction && !isQuery {
+			http.NotFound(w, r)
+			return
+		}
+		method := http.MethodPost
+		if isQuery {
+			method = http.MethodGet
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if isQuery {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(query()); err != nil {
+				slog.Debug(fmt.Sprintf("failed to answer control query %s: %s", r.URL.Path, err))
+			}
+			return
+		}
+		select {
+		case ch <- struct{}{}:
+			w.WriteHeader(http.StatusNoContent)
+		case <-r.Context().Done():
+		}
+	})
+}
+
+// StartControlServer listens on loopback for control requests, recording
+// the port and a fresh token in the store, with diagnose answering tray
+// diagnosis queries. The listener is shut down once ctx is done, clearing
+// the stored endpoint, and the returned channel is closed when that's
+// finished.
+func StartControlServer(ctx context.Context, callbacks commontray.Callbacks, diagnose func() commontray.TrayDiagnosis) (<-chan struct{}, error) {
+	token, err := newControlToken()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate control token: %w", err)
+	}
+	port := envInt("OLLAMA_APP_CONTROL_PORT", ControlPort)
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(port)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for control requests: %w", err)
+	}
+	port = l.Addr().(*net.TCPAddr).Port
+	saveControlEndpoint(port, token)
+	slog.Debug(fmt.Sprintf("listening for control requests on %s", l.Addr()))
+
+	srv := &http.Server{
+		Handler:           controlHandler(token, callbacks, diagnose),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			slog.Warn(fmt.Sprintf("control listener stopped: %s", err))
+		}
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ControlShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Debug(fmt.Sprintf("control listener didn't shut down cleanly: %s", err))
+			srv.Close()
+		}
+		saveControlEndpoint(0, "")
+		slog.Debug("stopped listening for control requests")
+	}()
+	return stopped, nil
+}
@@ -0,0 +1,116 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newControlCallbacks() commontray.Callbacks {
+	return commontray.Callbacks{
+		CheckUpdates: make(chan struct{}, 1),
+		ShowLogs:     make(chan struct{}, 1),
+		Quit:         make(chan struct{}, 1),
+	}
+}
+
+func TestControlHandler(t *testing.T) {
+	callbacks := newControlCallbacks()
+	handler := controlHandler("secret", callbacks, func() commontray.TrayDiagnosis {
+		return commontray.TrayDiagnosis{Supported: true, ShellRunning: true, WindowCreated: true, IconLoaded: true}
+	})
+	serve := func(method, path, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	do := func(method, path, auth string) int {
+		return serve(method, path, auth).Code
+	}
+
+	for path, ch := range map[string]chan struct{}{
+		"/update/check": callbacks.CheckUpdates,
+		"/logs/show":    callbacks.ShowLogs,
+		"/quit":         callbacks.Quit,
+	} {
+		assert.Equal(t, http.StatusNoContent, do(http.MethodPost, path, "Bearer secret"), path)
+		select {
+		case <-ch:
+		default:
+			t.Errorf("%s should trigger its callback", path)
+		}
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/quit", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/quit", "Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/quit", "secret"))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodGet, "/quit", "Bearer secret"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/restart", "Bearer secret"))
+	assert.Empty(t, callbacks.Quit, "rejected requests should not trigger callbacks")
+
+	w := serve(http.MethodGet, "/tray/diagnose", "Bearer secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var report map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, true, report["window_created"])
+	assert.Equal(t, false, report["icon_added"])
+	assert.Contains(t, report["summary"], "The icon couldn't be added to the notification area")
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/tray/diagnose", ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPost, "/tray/diagnose", "Bearer secret"))
+}
+
+func TestStartControlServer(t *testing.T) {
+	orig := saveControlEndpoint
+	t.Cleanup(func() { saveControlEndpoint = orig })
+	var port int
+	var token string
+	saveControlEndpoint = func(p int, tok string) { port, token = p, tok }
+	t.Setenv("OLLAMA_APP_CONTROL_PORT", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	callbacks := newControlCallbacks()
+	stopped, err := StartControlServer(ctx, callbacks, func() commontray.TrayDiagnosis { return commontray.TrayDiagnosis{} })
+	require.NoError(t, err)
+	require.NotZero(t, port)
+	assert.Len(t, token, 64)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/logs/show", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	select {
+	case <-callbacks.ShowLogs:
+	case <-time.After(time.Second):
+		t.Fatal("show logs was not triggered")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("control listener did not stop")
+	}
+	assert.Zero(t, port)
+	assert.Empty(t, token)
+	_, err = net.DialTimeout("tcp", addr, time.Second)
+	assert.Error(t, err, "the control port should be released")
+}
@@ -0,0 +1,141 @@
+package lifecycle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+var (
+	// DiagnosticsDir is where CollectDiagnostics saves its zip files
+	DiagnosticsDir = ""
+
+	// How much of the end of each log file to include in the zip
+	diagnosticsBundleLogTail = 1024 * 1024
+)
+
+// diagnosticsEnvVars are included in the config summary, besides OLLAMA_*
+var diagnosticsEnvVars = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"}
+
+// CollectDiagnostics writes a zip of recent logs, version and system
+// details, update history and configuration for support requests, and
+// returns its path. Secrets are redacted throughout.
+func CollectDiagnostics() (string, error) {
+	dir := DiagnosticsDir
+	if dir == "" {
+		dir = AppDataDir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create diagnostics dir %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("ollama-diagnostics-%s.zip", time.Now().Format("20060102-150405")))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("create diagnostics %s: %w", path, err)
+	}
+	err = writeDiagnosticsZip(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("write diagnostics %s: %w", path, err)
+	}
+	return path, nil
+}
+
+func writeDiagnosticsZip(f *os.File) error {
+	zw := zip.NewWriter(f)
+	add := func(name, content string) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(redactSecrets(content)))
+		return err
+	}
+
+	if err := add("version.txt", FullVersion()+"\n"); err != nil {
+		return err
+	}
+	if err := add("system.txt", systemSummary()); err != nil {
+		return err
+	}
+	if err := add("config.txt", configSummary()); err != nil {
+		return err
+	}
+	history, err := json.MarshalIndent(store.GetUpdateHistory(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add("update-history.json", string(history)); err != nil {
+		return err
+	}
+	for _, log := range []string{ServerLogFile, AppLogFile, UpgradeLogFile} {
+		tail, err := readTail(log, int64(diagnosticsBundleLogTail))
+		if err != nil {
+			// Not every log exists, the upgrade log in particular
+			continue
+		}
+		if err := add("logs/"+filepath.Base(log), tail); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func systemSummary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "OS: %s\n", runtime.GOOS)
+	if v, err := systemOSVersion.OSVersion(); err == nil {
+		fmt.Fprintf(&b, "OS version: %s\n", v)
+	}
+	fmt.Fprintf(&b, "Architecture: %s\n", runtime.GOARCH)
+	fmt.Fprintf(&b, "CPUs: %d\n", runtime.NumCPU())
+	fmt.Fprintf(&b, "GPU: %s\n", gpuDescription())
+	if caps, err := systemCapabilities.Capabilities(); err == nil {
+		fmt.Fprintf(&b, "AVX2: %t\n", caps.AVX2)
+		if caps.CUDAVersion != "" {
+			fmt.Fprintf(&b, "CUDA: %s\n", caps.CUDAVersion)
+		}
+	}
+	return b.String()
+}
+
+func configSummary() string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, "OLLAMA_") {
+			env = append(env, kv)
+		}
+	}
+	for _, key := range diagnosticsEnvVars {
+		if val, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+val)
+		}
+	}
+	sort.Strings(env)
+
+	var b strings.Builder
+	b.WriteString("Environment:\n")
+	for _, kv := range env {
+		fmt.Fprintf(&b, "  %s\n", kv)
+	}
+	b.WriteString("\nSettings:\n")
+	fmt.Fprintf(&b, "  auto download: %t\n", store.GetAutoDownload())
+	fmt.Fprintf(&b, "  auto install when idle: %t\n", store.GetAutoInstallWhenIdle())
+	fmt.Fprintf(&b, "  updates disabled: %t\n", UpdatesDisabled())
+	fmt.Fprintf(&b, "  update verification: %s\n", updateVerifyLevel())
+	fmt.Fprintf(&b, "  active model: %s\n", store.GetActiveModel())
+	return b.String()
+}
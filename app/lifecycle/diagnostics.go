@@ -0,0 +1,109 @@
+package lifecycle
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+var (
+	// MaxDiagnosticsSize caps the size of the diagnostics text
+	MaxDiagnosticsSize = 64 * 1024
+
+	// How much of the end of a log file to include
+	diagnosticsLogTail = 32 * 1024
+
+	// overridden in tests
+	gpuDescription = getGPUDescription
+)
+
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)((?:proxy-)?authorization)(["']?\s*[:=]\s*)\S+(?:\s+[^\s"',]+)?`), "${1}${2}[REDACTED]"},
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`), "Bearer [REDACTED]"},
+	{regexp.MustCompile(`(?i)\b(token|password|passwd|secret|api[_-]?key)=[^\s&"']+`), "${1}=[REDACTED]"},
+	{regexp.MustCompile(`://[^/\s:@]+:[^/\s@]+@`), "://[REDACTED]@"},
+	{regexp.MustCompile(`\b(ssh-ed25519|ssh-rsa) [A-Za-z0-9+/=]+`), "${1} [REDACTED]"},
+}
+
+// redactSecrets masks values that look like credentials
+func redactSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// readTail returns up to the last n bytes of a file
+func readTail(filename string, n int64) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > n {
+		if _, err := f.Seek(-n, io.SeekEnd); err != nil {
+			return "", err
+		}
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	tail := string(b)
+	if info.Size() > n {
+		// Drop the partial first line
+		if i := strings.IndexByte(tail, '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+	}
+	return tail, nil
+}
+
+// GatherDiagnostics assembles version, system, and recent log details for
+// support requests. Secrets are redacted and the result is capped at
+// MaxDiagnosticsSize.
+func GatherDiagnostics() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Ollama version: %s\n", version.Version)
+	fmt.Fprintf(&b, "OS: %s\n", runtime.GOOS)
+	fmt.Fprintf(&b, "Architecture: %s\n", runtime.GOARCH)
+	fmt.Fprintf(&b, "CPUs: %d\n", runtime.NumCPU())
+	fmt.Fprintf(&b, "GPU: %s\n", gpuDescription())
+
+	for _, log := range []struct{ name, path string }{
+		{"Server log", ServerLogFile},
+		{"App log", AppLogFile},
+	} {
+		fmt.Fprintf(&b, "\n=== %s (%s) ===\n", log.name, log.path)
+		tail, err := readTail(log.path, int64(diagnosticsLogTail))
+		if err != nil {
+			fmt.Fprintf(&b, "unavailable: %s\n", err)
+			continue
+		}
+		b.WriteString(tail)
+	}
+
+	diag := redactSecrets(b.String())
+	if len(diag) > MaxDiagnosticsSize {
+		const truncated = "\n... truncated\n"
+		diag = diag[:MaxDiagnosticsSize-len(truncated)] + truncated
+	}
+	return diag
+}
+
+// CopyDiagnostics places the diagnostics on the clipboard
+func CopyDiagnostics() error {
+	return SetClipboardText(GatherDiagnostics())
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package lifecycle
+
+func getGPUDescription() string {
+	return "unknown"
+}
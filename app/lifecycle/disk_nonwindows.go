@@ -0,0 +1,13 @@
+//go:build !windows
+
+package lifecycle
+
+import "syscall"
+
+func freeDiskSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil //nolint:unconvert
+}
@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// downloadInfo is what a HEAD request reveals about a download
+type downloadInfo struct {
+	// -1 when unknown
+	Size         int64
+	AcceptRanges bool
+	// As sent, quotes included, "" when there's none
+	ETag     string
+	Filename string
+	// Where the download ends up after any redirects
+	URL string
+}
+
+// overridden in tests
+var diskFree = freeDiskSpace
+
+// probeDownload issues a HEAD request for url. Servers that don't support
+// HEAD yield defaults rather than an error.
+func probeDownload(ctx context.Context, url string) (downloadInfo, error) {
+	info := downloadInfo{Size: -1, Filename: Installer, URL: url}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return info, err
+	}
+
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return info, fmt.Errorf("error checking update: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		slog.Debug(fmt.Sprintf("HEAD not supported for %s, skipping download precheck", url))
+		return info, nil
+	default:
+		return info, fmt.Errorf("unexpected status attempting to download update %d", resp.StatusCode)
+	}
+
+	info.URL = resp.Request.URL.String()
+	info.Size = resp.ContentLength
+	info.AcceptRanges = strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes")
+	if info.ETag = resp.Header.Get("etag"); info.ETag == "" {
+		slog.Debug("no etag detected, falling back to URL based dedup")
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("content-disposition")); err == nil && params["filename"] != "" {
+		info.Filename = params["filename"]
+	}
+	return info, nil
+}
+
+// stageDirName is the directory under UpdateStageDir a download with etag
+// is staged in. Downloads without one are keyed by a hash of rawURL
+// instead, so different releases never share a directory.
+func stageDirName(etag, rawURL string) string {
+	if etag = strings.Trim(etag, "\""); etag == "" {
+		sum := sha256.Sum256([]byte(rawURL))
+		return "url-" + hex.EncodeToString(sum[:8])
+	}
+	return sanitizeStageName(etag)
+}
+
+// stageFileName is the name a download of rawURL, called filename by the
+// server, is staged as. A short hash of the URL keeps downloads from
+// different URLs apart even when their names sanitize to the same thing.
+func stageFileName(filename, rawURL string) string {
+	// The server may send a path, only the last element is wanted
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	name := sanitizeStageName(filename)
+	if name == "_" {
+		name = Installer
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + hex.EncodeToString(sum[:4]) + ext
+}
+
+// sanitizeStageName makes name safe to use as a single path element,
+// replacing anything but letters, digits, '.', '-' and '_'
+func sanitizeStageName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	if strings.Trim(name, ".") == "" {
+		return "_"
+	}
+	return name
+}
+
+// partialSize returns the size of an interrupted download of dest
+func partialSize(dest string) int64 {
+	fi, err := os.Stat(dest + ".part")
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// checkDiskSpace ensures there is room for needed more bytes under dir,
+// which may not exist yet
+func checkDiskSpace(dir string, needed int64) error {
+	if needed <= 0 {
+		return nil
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	free, err := diskFree(dir)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to determine free disk space for %s: %s", dir, err))
+		return nil
+	}
+	if free < uint64(needed) {
+		return fmt.Errorf("insufficient disk space for update: need %d bytes, %d available", needed, free)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rangeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	ranges   []string
+	ifRanges []string
+}
+
+func newRangeServer(t *testing.T, payload []byte, allowHead bool) *rangeServer {
+	t.Helper()
+	rs := &rangeServer{}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && !allowHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		rs.mu.Lock()
+		rs.ranges = append(rs.ranges, r.Header.Get("Range"))
+		rs.ifRanges = append(rs.ifRanges, r.Header.Get("If-Range"))
+		rs.mu.Unlock()
+		w.Header().Set("ETag", `"abc"`)
+		http.ServeContent(w, r, Installer, time.Time{}, bytes.NewReader(payload))
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func TestDownloadWithoutHead(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	UpdateStageDir = t.TempDir()
+	payload := []byte("installer payload")
+	ts := newRangeServer(t, payload, false)
+
+	resp := UpdateResponse{UpdateURL: ts.URL + "/download/v0.1.30/OllamaSetup.exe", Checksum: sha256Hex(payload)}
+	require.NoError(t, DownloadNewRelease(context.Background(), resp))
+
+	b, err := os.ReadFile(filepath.Join(UpdateStageDir, stageDirName("", resp.UpdateURL), stageFileName(Installer, resp.UpdateURL)))
+	require.NoError(t, err)
+	assert.Equal(t, payload, b)
+}
+
+func TestDownloadResume(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	UpdateStageDir = t.TempDir()
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	ts := newRangeServer(t, payload, true)
+
+	resp := UpdateResponse{UpdateURL: ts.URL + "/download/v0.1.30/OllamaSetup.exe", Checksum: sha256Hex(payload)}
+	stageDir := filepath.Join(UpdateStageDir, "abc")
+	staged := filepath.Join(stageDir, stageFileName(Installer, resp.UpdateURL))
+	require.NoError(t, os.MkdirAll(stageDir, 0o755))
+	require.NoError(t, os.WriteFile(staged+".part", payload[:4000], 0o644))
+	// stale download of an older release
+	require.NoError(t, os.MkdirAll(filepath.Join(UpdateStageDir, "old"), 0o755))
+
+	require.NoError(t, DownloadNewRelease(context.Background(), resp))
+
+	b, err := os.ReadFile(staged)
+	require.NoError(t, err)
+	assert.Equal(t, payload, b)
+	assert.Equal(t, []string{"", "bytes=4000-"}, ts.ranges, "should HEAD then resume from the partial")
+	assert.Equal(t, []string{"", `"abc"`}, ts.ifRanges, "only if the download hasn't changed")
+	_, err = os.Stat(filepath.Join(UpdateStageDir, "old"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDownloadResumeStartsOver(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+
+	t.Run("partial too big", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		ts := newRangeServer(t, payload, true)
+		resp := UpdateResponse{UpdateURL: ts.URL + "/download/v0.1.30/OllamaSetup.exe", Checksum: sha256Hex(payload)}
+		staged := filepath.Join(UpdateStageDir, "abc", stageFileName(Installer, resp.UpdateURL))
+		require.NoError(t, os.MkdirAll(filepath.Dir(staged), 0o755))
+		require.NoError(t, os.WriteFile(staged+".part", append(payload, "trailing"...), 0o644))
+
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+		assert.Equal(t, []string{"", ""}, ts.ranges)
+		b, err := os.ReadFile(staged)
+		require.NoError(t, err)
+		assert.Equal(t, payload, b)
+	})
+
+	t.Run("no etag", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		var ranges []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			http.ServeContent(w, r, Installer, time.Time{}, bytes.NewReader(payload))
+		}))
+		defer ts.Close()
+		resp := UpdateResponse{UpdateURL: ts.URL + "/download/v0.1.30/OllamaSetup.exe", Checksum: sha256Hex(payload)}
+		staged := filepath.Join(UpdateStageDir, stageDirName("", resp.UpdateURL), stageFileName(Installer, resp.UpdateURL))
+		require.NoError(t, os.MkdirAll(filepath.Dir(staged), 0o755))
+		require.NoError(t, os.WriteFile(staged+".part", []byte("not this release"), 0o644))
+
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+		assert.Equal(t, []string{"", ""}, ranges, "can't tell the partial is of the same download")
+	})
+
+	t.Run("range not satisfiable", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), Installer)
+		var ranges []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if r.Header.Get("Range") != "" {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Write(payload) //nolint:errcheck
+		}))
+		defer ts.Close()
+		require.NoError(t, os.WriteFile(dest+".part", payload[:4000], 0o644))
+
+		sum, err := downloadFile(context.Background(), ts.URL, dest, sha256Hex(payload), `"abc"`)
+		require.NoError(t, err)
+		assert.Equal(t, sha256Hex(payload), sum)
+		assert.Equal(t, []string{"bytes=4000-", ""}, ranges)
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), Installer)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+		require.NoError(t, os.WriteFile(dest+".part", payload[:4000], 0o644))
+
+		_, err := downloadFile(context.Background(), ts.URL, dest, "", `"abc"`)
+		assert.ErrorContains(t, err, "unexpected status")
+		_, err = os.Stat(dest + ".part")
+		assert.ErrorIs(t, err, os.ErrNotExist, "the next attempt starts over")
+	})
+}
+
+func TestDownloadDiskSpace(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	UpdateStageDir = filepath.Join(t.TempDir(), "updates")
+	payload := bytes.Repeat([]byte("x"), 1000)
+	ts := newRangeServer(t, payload, true)
+
+	diskFree = func(string) (uint64, error) { return 100, nil }
+	t.Cleanup(func() { diskFree = freeDiskSpace })
+
+	err := DownloadNewRelease(context.Background(), UpdateResponse{UpdateURL: ts.URL + "/download/v0.1.30/OllamaSetup.exe"})
+	assert.ErrorContains(t, err, "insufficient disk space")
+	assert.Equal(t, []string{""}, ts.ranges, "should not start downloading")
+}
+
+func TestForceRedownload(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	UpdateStageDir = t.TempDir()
+	payload := []byte("installer payload")
+	ts := newRangeServer(t, payload, true)
+	resp := UpdateResponse{UpdateURL: ts.URL + "/download/v0.1.30/OllamaSetup.exe"}
+	require.NoError(t, DownloadNewRelease(context.Background(), resp))
+
+	// A second download short circuits on the staged copy
+	staged := filepath.Join(UpdateStageDir, "abc", stageFileName(Installer, resp.UpdateURL))
+	require.NoError(t, DownloadNewRelease(context.Background(), resp))
+	assert.Equal(t, []string{"", "", ""}, ts.ranges, "expected HEAD, GET, HEAD")
+
+	// Mark the staged copy so we can tell it was replaced
+	require.NoError(t, os.Chtimes(staged, time.Time{}, time.Unix(0, 0)))
+	require.NoError(t, ForceRedownload(context.Background(), resp))
+	assert.Len(t, ts.ranges, 5, "expected another HEAD and GET")
+
+	info, err := os.Stat(staged)
+	require.NoError(t, err)
+	assert.NotEqual(t, time.Unix(0, 0), info.ModTime())
+	b, err := os.ReadFile(staged)
+	require.NoError(t, err)
+	assert.Equal(t, payload, b)
+	assert.True(t, IsUpdateDownloaded())
+}
+
+func TestStageFileName(t *testing.T) {
+	a := stageFileName(Installer, "https://example.com/download/v0.1.30/OllamaSetup.exe")
+	b := stageFileName(Installer, "https://mirror.example.com/download/v0.1.30/OllamaSetup.exe")
+	assert.NotEqual(t, a, b, "different URLs should not collide")
+	assert.Equal(t, a, stageFileName(Installer, "https://example.com/download/v0.1.30/OllamaSetup.exe"), "names should be stable")
+	assert.Regexp(t, `^OllamaSetup-[0-9a-f]{8}\.exe$`, a)
+
+	for _, name := range []string{"../../evil.exe", `..\..\evil.exe`, "/etc/evil.exe", "C:evil.exe", "dir/evil.exe"} {
+		got := stageFileName(name, "https://example.com/x")
+		assert.Equal(t, filepath.Base(got), got, name)
+		assert.NotContains(t, got, "..", name)
+	}
+	assert.Regexp(t, `^OllamaSetup-[0-9a-f]{8}\.exe$`, stageFileName("..", "https://example.com/x"))
+	assert.Regexp(t, `^OllamaSetup-[0-9a-f]{8}\.exe$`, stageFileName("", "https://example.com/x"))
+}
+
+func TestStageDirName(t *testing.T) {
+	assert.Equal(t, "abc", stageDirName("abc", ""))
+	assert.Equal(t, "W_abc-1", stageDirName("W/abc-1", ""))
+	assert.Equal(t, "_", stageDirName("..", ""))
+	assert.Equal(t, ".._.._x", stageDirName(`../..\x`, ""))
+
+	// Without an ETag, releases are kept apart by their URL
+	a := stageDirName("", "https://ollama.com/download/v0.1.30/OllamaSetup.exe")
+	assert.Regexp(t, `^url-[0-9a-f]{16}$`, a)
+	assert.NotEqual(t, a, stageDirName("", "https://ollama.com/download/v0.1.31/OllamaSetup.exe"))
+}
+
+func TestDownloadUntrustedNames(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	UpdateStageDir = filepath.Join(t.TempDir(), "updates")
+	payload := []byte("installer payload")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"../../escape"`)
+		w.Header().Set("Content-Disposition", `attachment; filename="../evil.exe"`)
+		w.Write(payload) //nolint:errcheck
+	}))
+	defer ts.Close()
+
+	require.NoError(t, DownloadNewRelease(context.Background(), UpdateResponse{UpdateURL: ts.URL + "/OllamaSetup.exe"}))
+	files, err := filepath.Glob(filepath.Join(UpdateStageDir, "*", "*.exe"))
+	require.NoError(t, err)
+	require.Len(t, files, 1, "should stage inside UpdateStageDir")
+	assert.Equal(t, ".._.._escape", filepath.Base(filepath.Dir(files[0])))
+}
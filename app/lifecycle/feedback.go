@@ -0,0 +1,71 @@
+package lifecycle
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+var (
+	// ReportIssueURLTemplate is opened by the tray's report issue action,
+	// with %s replaced by the query escaped issue body
+	ReportIssueURLTemplate = "https://github.com/jmorganca/ollama/issues/new?body=%s"
+
+	TroubleshootingURL = "https://github.com/jmorganca/ollama/blob/main/docs/troubleshooting.md"
+
+	// ReleaseNotesURLTemplate is opened from the post update notification,
+	// with %s replaced by the version
+	ReleaseNotesURLTemplate = "https://github.com/jmorganca/ollama/releases/tag/v%s"
+
+	// overridden in tests
+	readBuildInfo = debug.ReadBuildInfo
+)
+
+const reportIssueBody = `### What is the issue?
+
+
+
+### Environment
+
+- Ollama version: %s
+- OS: %s
+- Architecture: %s
+
+Please attach the app and server logs, see %s for where to find them.
+`
+
+// GetReportIssueURL returns a new issue URL pre-filled with details about
+// this installation
+func GetReportIssueURL() string {
+	body := fmt.Sprintf(reportIssueBody, version.Version, runtime.GOOS, runtime.GOARCH, TroubleshootingURL)
+	return fmt.Sprintf(ReportIssueURLTemplate, url.QueryEscape(body))
+}
+
+// FullVersion describes the running build for bug reports, including the
+// commit it was built from when known
+func FullVersion() string {
+	details := []string{}
+	if info, ok := readBuildInfo(); ok {
+		settings := map[string]string{}
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+		if rev := settings["vcs.revision"]; rev != "" {
+			details = append(details, "commit "+rev)
+			if settings["vcs.modified"] == "true" {
+				details = append(details, "modified")
+			}
+		}
+	}
+	details = append(details, runtime.GOOS+"/"+runtime.GOARCH)
+	return fmt.Sprintf("ollama version %s (%s)", version.Version, strings.Join(details, ", "))
+}
+
+// GetReleaseNotesURL returns the release notes for the running version
+func GetReleaseNotesURL() string {
+	return fmt.Sprintf(ReleaseNotesURLTemplate, strings.TrimPrefix(version.Version, "v"))
+}
@@ -0,0 +1,51 @@
+package lifecycle
+
+import (
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+func TestGetReportIssueURL(t *testing.T) {
+	orig := version.Version
+	t.Cleanup(func() { version.Version = orig })
+	version.Version = "0.1.30"
+
+	u, err := url.Parse(GetReportIssueURL())
+	require.NoError(t, err)
+	assert.Equal(t, "github.com", u.Host)
+	assert.Equal(t, "/jmorganca/ollama/issues/new", u.Path)
+
+	body := u.Query().Get("body")
+	assert.Contains(t, body, "Ollama version: 0.1.30")
+	assert.Contains(t, body, "OS: "+runtime.GOOS)
+	assert.Contains(t, body, "Architecture: "+runtime.GOARCH)
+	assert.Contains(t, body, TroubleshootingURL)
+}
+
+func TestFullVersion(t *testing.T) {
+	orig := version.Version
+	t.Cleanup(func() {
+		version.Version = orig
+		readBuildInfo = debug.ReadBuildInfo
+	})
+	version.Version = "0.1.30"
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "4b6e0e206b13d5270627db0aa4d76d06a6ee5f46"},
+			{Key: "vcs.modified", Value: "true"},
+		}}, true
+	}
+	assert.Equal(t, "ollama version 0.1.30 (commit 4b6e0e206b13d5270627db0aa4d76d06a6ee5f46, modified, "+platform+")", FullVersion())
+
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+	assert.Equal(t, "ollama version 0.1.30 ("+platform+")", FullVersion())
+}
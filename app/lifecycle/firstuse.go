@@ -0,0 +1,28 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+var (
+	// overridden in tests
+	firstTimeRunSetting = store.GetFirstTimeRun
+	saveFirstTimeRun    = store.SetFirstTimeRun
+)
+
+// firstUse calls display on the very first run only. The Get started menu
+// item replays the first use flow through DoFirstUse whenever it's clicked.
+func firstUse(display func() error) {
+	if firstTimeRunSetting() {
+		slog.Debug("Not first time, skipping first run notification")
+		return
+	}
+	slog.Debug("First time run")
+	if err := display(); err != nil {
+		slog.Debug(fmt.Sprintf("XXX failed to display first use notification %v", err))
+	}
+	saveFirstTimeRun(true)
+}
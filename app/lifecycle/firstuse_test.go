@@ -0,0 +1,28 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstUse(t *testing.T) {
+	origGet, origSave := firstTimeRunSetting, saveFirstTimeRun
+	t.Cleanup(func() { firstTimeRunSetting, saveFirstTimeRun = origGet, origSave })
+	ran := false
+	firstTimeRunSetting = func() bool { return ran }
+	saveFirstTimeRun = func(val bool) { ran = val }
+
+	shown := 0
+	display := func() error {
+		shown++
+		return nil
+	}
+	firstUse(display)
+	assert.Equal(t, 1, shown)
+	assert.True(t, ran)
+
+	// Only the Get started menu item brings it back after that
+	firstUse(display)
+	assert.Equal(t, 1, shown)
+}
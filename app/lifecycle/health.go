@@ -0,0 +1,75 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+var (
+	// ServerHealthInterval is how often the tray icon checks on the server
+	ServerHealthInterval = 10 * time.Second
+	// ServerHealthTimeout bounds each heartbeat
+	ServerHealthTimeout = 5 * time.Second
+
+	// overridden in tests
+	serverHealthy = serverAnswering
+)
+
+// serverAnswering is a quiet IsServerRunning, suitable for polling
+func serverAnswering(ctx context.Context) bool {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, ServerHealthTimeout)
+	defer cancel()
+	return client.Heartbeat(ctx) == nil
+}
+
+// trayStatus picks the tray icon, an unreachable server taking precedence
+// over a staged update
+func trayStatus(healthy, updateStaged bool) commontray.TrayStatus {
+	switch {
+	case !healthy:
+		return commontray.StatusServerUnreachable
+	case updateStaged:
+		return commontray.StatusUpdateStaged
+	default:
+		return commontray.StatusNormal
+	}
+}
+
+// MonitorServerHealth polls the server every ServerHealthInterval until ctx
+// is done, calling setStatus whenever the tray icon should change
+func MonitorServerHealth(ctx context.Context, setStatus func(commontray.TrayStatus) error) {
+	current := commontray.StatusNormal
+	ticker := time.NewTicker(ServerHealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		healthy := serverHealthy(ctx)
+		status := trayStatus(healthy, IsUpdateDownloaded() && !UpdatesDisabled())
+		if status == current {
+			continue
+		}
+		if healthy && current == commontray.StatusServerUnreachable {
+			slog.Info("server is answering again")
+		} else if !healthy {
+			slog.Warn("server isn't answering")
+		}
+		if err := setStatus(status); err != nil {
+			slog.Warn(fmt.Sprintf("failed to update tray icon: %s", err))
+			continue
+		}
+		current = status
+	}
+}
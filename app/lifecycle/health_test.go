@@ -0,0 +1,67 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrayStatus(t *testing.T) {
+	assert.Equal(t, commontray.StatusNormal, trayStatus(true, false))
+	assert.Equal(t, commontray.StatusUpdateStaged, trayStatus(true, true))
+	assert.Equal(t, commontray.StatusServerUnreachable, trayStatus(false, false))
+	assert.Equal(t, commontray.StatusServerUnreachable, trayStatus(false, true), "an unreachable server should take precedence")
+}
+
+func TestMonitorServerHealth(t *testing.T) {
+	setUpdatesDisabled(t, false)
+	SetUpdateDownloaded(false)
+	t.Cleanup(func() { SetUpdateDownloaded(false) })
+	origInterval, origHealthy := ServerHealthInterval, serverHealthy
+	t.Cleanup(func() { ServerHealthInterval, serverHealthy = origInterval, origHealthy })
+	ServerHealthInterval = time.Millisecond
+
+	var healthy atomic.Bool
+	serverHealthy = func(context.Context) bool { return healthy.Load() }
+
+	var mu sync.Mutex
+	var got []commontray.TrayStatus
+	last := func() []commontray.TrayStatus {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]commontray.TrayStatus(nil), got...)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		MonitorServerHealth(ctx, func(s commontray.TrayStatus) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, s)
+			return nil
+		})
+	}()
+
+	waitFor := func(want ...commontray.TrayStatus) {
+		t.Helper()
+		assert.Eventually(t, func() bool { return assert.ObjectsAreEqual(want, last()) }, time.Second, time.Millisecond)
+	}
+	waitFor(commontray.StatusServerUnreachable)
+	healthy.Store(true)
+	waitFor(commontray.StatusServerUnreachable, commontray.StatusNormal)
+	SetUpdateDownloaded(true)
+	waitFor(commontray.StatusServerUnreachable, commontray.StatusNormal, commontray.StatusUpdateStaged)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(t, last(), 3, "should only update the icon when the status changes")
+
+	cancel()
+	<-stopped
+}
@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+var (
+	// InstallHookTimeout bounds each install hook, overridden by
+	// OLLAMA_UPDATE_HOOK_TIMEOUT
+	InstallHookTimeout = 5 * time.Minute
+	// How long to wait for a hook's output once it has exited or been
+	// killed, in case something it started in the background is still
+	// holding on to it
+	InstallHookWaitDelay = 5 * time.Second
+
+	// How much of a hook's output is logged
+	installHookOutputLimit = 4096
+
+	// overridden in tests
+	installHookSetting = store.GetInstallHooks
+
+	errPreInstallHook = errors.New("pre-install hook failed")
+)
+
+// installHookCommands returns the commands run before and after the
+// installer. OLLAMA_UPDATE_PRE_INSTALL and OLLAMA_UPDATE_POST_INSTALL
+// override the stored preferences.
+func installHookCommands() (pre, post string) {
+	pre, post = installHookSetting()
+	if cmd := os.Getenv("OLLAMA_UPDATE_PRE_INSTALL"); cmd != "" {
+		pre = cmd
+	}
+	if cmd := os.Getenv("OLLAMA_UPDATE_POST_INSTALL"); cmd != "" {
+		post = cmd
+	}
+	return pre, post
+}
+
+// runInstallHook runs command, telling it about the update through the
+// environment, and logs its output
+func runInstallHook(name, command, ver, installer string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("OLLAMA_UPDATE_HOOK_TIMEOUT", InstallHookTimeout))
+	defer cancel()
+
+	slog.Info(fmt.Sprintf("running %s hook %s", name, command))
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Env = append(os.Environ(), "OLLAMA_UPDATE_VERSION="+ver, "OLLAMA_UPDATE_INSTALLER="+installer)
+	cmd.WaitDelay = InstallHookWaitDelay
+	out, err := cmd.CombinedOutput()
+	if output := strings.TrimSpace(string(out)); output != "" {
+		if len(output) > installHookOutputLimit {
+			output = output[len(output)-installHookOutputLimit:]
+		}
+		slog.Info(fmt.Sprintf("%s hook output:\n%s", name, output))
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s hook timed out", name)
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The hook itself succeeded
+		slog.Warn(fmt.Sprintf("%s hook left processes running in the background", name))
+		return nil
+	}
+	return err
+}
+
+// runPreInstallHook runs the pre-install hook, if configured. The upgrade
+// must not go ahead if it fails.
+func runPreInstallHook(ver, installer string) error {
+	pre, _ := installHookCommands()
+	if pre == "" {
+		return nil
+	}
+	if err := runInstallHook("pre-install", pre, ver, installer); err != nil {
+		return fmt.Errorf("%w: %s", errPreInstallHook, err)
+	}
+	return nil
+}
+
+// runPostInstallHook runs the post-install hook, if configured, once the
+// installer is running. The installer is already underway, so failures are
+// only logged.
+func runPostInstallHook(ver, installer string) {
+	_, post := installHookCommands()
+	if post == "" {
+		return
+	}
+	if err := runInstallHook("post-install", post, ver, installer); err != nil {
+		slog.Warn(fmt.Sprintf("post-install hook failed: %s", err))
+	}
+}
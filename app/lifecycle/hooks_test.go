@@ -0,0 +1,120 @@
+package lifecycle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeHookScript creates a script that records the update version it was
+// given in marker, then exits with code
+func writeHookScript(t *testing.T, code int, marker string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if runtime.GOOS == "windows" {
+		script := filepath.Join(dir, "hook.bat")
+		body := fmt.Sprintf("@echo off\r\necho hook ran\r\necho %%OLLAMA_UPDATE_VERSION%%> \"%s\"\r\nexit /b %d\r\n", marker, code)
+		require.NoError(t, os.WriteFile(script, []byte(body), 0o755))
+		return script
+	}
+	script := filepath.Join(dir, "hook.sh")
+	body := fmt.Sprintf("#!/bin/sh\necho hook ran\necho \"$OLLAMA_UPDATE_VERSION\" > '%s'\nexit %d\n", marker, code)
+	require.NoError(t, os.WriteFile(script, []byte(body), 0o755))
+	return script
+}
+
+func stubInstallHooks(t *testing.T, pre, post string) {
+	t.Helper()
+	orig := installHookSetting
+	t.Cleanup(func() { installHookSetting = orig })
+	installHookSetting = func() (string, string) { return pre, post }
+	t.Setenv("OLLAMA_UPDATE_PRE_INSTALL", "")
+	t.Setenv("OLLAMA_UPDATE_POST_INSTALL", "")
+}
+
+func TestInstallHookCommands(t *testing.T) {
+	stubInstallHooks(t, "stored-pre", "stored-post")
+	pre, post := installHookCommands()
+	assert.Equal(t, "stored-pre", pre)
+	assert.Equal(t, "stored-post", post)
+
+	t.Setenv("OLLAMA_UPDATE_PRE_INSTALL", "env-pre")
+	pre, post = installHookCommands()
+	assert.Equal(t, "env-pre", pre, "env should override the store")
+	assert.Equal(t, "stored-post", post)
+}
+
+func TestRunPreInstallHook(t *testing.T) {
+	stubInstallHooks(t, "", "")
+	assert.NoError(t, runPreInstallHook("0.1.30", "OllamaSetup.exe"), "no hook configured")
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	stubInstallHooks(t, writeHookScript(t, 0, marker), "")
+	require.NoError(t, runPreInstallHook("0.1.30", "OllamaSetup.exe"))
+	b, err := os.ReadFile(marker)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "0.1.30")
+
+	stubInstallHooks(t, writeHookScript(t, 3, marker), "")
+	err = runPreInstallHook("0.1.30", "OllamaSetup.exe")
+	assert.ErrorIs(t, err, errPreInstallHook, "a failing pre-install hook should abort the upgrade")
+
+	stubInstallHooks(t, filepath.Join(t.TempDir(), "missing"), "")
+	assert.ErrorIs(t, runPreInstallHook("0.1.30", "OllamaSetup.exe"), errPreInstallHook)
+}
+
+func TestRunInstallHookTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	script := filepath.Join(t.TempDir(), "slow.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 10\n"), 0o755))
+	t.Setenv("OLLAMA_UPDATE_HOOK_TIMEOUT", "50ms")
+
+	start := time.Now()
+	err := runInstallHook("pre-install", script, "0.1.30", "OllamaSetup.exe")
+	assert.ErrorContains(t, err, "timed out")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRunInstallHookBackgroundProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	orig := InstallHookWaitDelay
+	t.Cleanup(func() { InstallHookWaitDelay = orig })
+	InstallHookWaitDelay = 50 * time.Millisecond
+	// The grandchild inherits the hook's output, which stays open after the
+	// hook exits
+	script := filepath.Join(t.TempDir(), "background.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nsleep 10 &\necho started\n"), 0o755))
+
+	start := time.Now()
+	assert.NoError(t, runInstallHook("pre-install", script, "0.1.30", "OllamaSetup.exe"))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	t.Run("timed out", func(t *testing.T) {
+		script := filepath.Join(t.TempDir(), "background.sh")
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nsleep 10 &\nexec sleep 10\n"), 0o755))
+		t.Setenv("OLLAMA_UPDATE_HOOK_TIMEOUT", "50ms")
+
+		start := time.Now()
+		assert.ErrorContains(t, runInstallHook("pre-install", script, "0.1.30", "OllamaSetup.exe"), "timed out")
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+}
+
+func TestRunPostInstallHook(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	stubInstallHooks(t, "", writeHookScript(t, 1, marker))
+	// Failures are only logged, the installer is already running
+	runPostInstallHook("0.1.30", "OllamaSetup.exe")
+	_, err := os.Stat(marker)
+	assert.NoError(t, err)
+}
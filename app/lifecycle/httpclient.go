@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	UpdateConnectTimeout        = 30 * time.Second
+	UpdateResponseHeaderTimeout = 30 * time.Second
+	// Downloads are aborted if no data arrives for this long, however long
+	// the download takes overall. Overridden by OLLAMA_UPDATE_STALL_TIMEOUT
+	UpdateStallTimeout = 60 * time.Second
+
+	// Update checks are small, so the whole request must finish within
+	// UpdateCheckTimeout, overridden by OLLAMA_UPDATE_CHECK_TIMEOUT
+	UpdateCheckTimeout = 30 * time.Second
+	// Downloads have no overall deadline by default, so a huge update on a
+	// slow link isn't killed while it's still making progress. Setting
+	// OLLAMA_UPDATE_DOWNLOAD_TIMEOUT imposes one anyway.
+	UpdateDownloadTimeout time.Duration = 0
+
+	// How long a dual-stack connection attempt may take before retrying over
+	// IPv4 only, for networks where IPv6 is advertised but broken
+	UpdateIPv4FallbackDelay = 10 * time.Second
+
+	// Caps on the connections the updater keeps to each host and idle
+	// overall, however many files download at once. Overridden by
+	// OLLAMA_UPDATE_MAX_CONNS_PER_HOST and OLLAMA_UPDATE_MAX_IDLE_CONNS, read
+	// when the client is created at startup, where 0 means no limit
+	UpdateMaxConnsPerHost = 4
+	UpdateMaxIdleConns    = 4
+
+	// Shared by all updater requests, with short timeouts for establishing
+	// connections but none on reading the body, which is left to the stall
+	// detector
+	updateClient = newUpdateClient()
+
+	errDownloadStalled = errors.New("download stalled")
+)
+
+func newUpdateClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   UpdateConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	maxConns := envInt("OLLAMA_UPDATE_MAX_CONNS_PER_HOST", UpdateMaxConnsPerHost)
+	return &http.Client{
+		Transport: proxyAuthTransport{next: &http.Transport{
+			Proxy:                 updateProxy,
+			DialContext:           ipv4FallbackDialer{dial: dialer.DialContext}.DialContext,
+			TLSHandshakeTimeout:   UpdateConnectTimeout,
+			ResponseHeaderTimeout: UpdateResponseHeaderTimeout,
+			IdleConnTimeout:       90 * time.Second,
+			MaxConnsPerHost:       maxConns,
+			MaxIdleConnsPerHost:   maxConns,
+			MaxIdleConns:          envInt("OLLAMA_UPDATE_MAX_IDLE_CONNS", UpdateMaxIdleConns),
+			ForceAttemptHTTP2:     true,
+		}},
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// checkRedirect keeps redirects on the host that was asked, or on trusted
+// hosts, so a redirect can't take a download somewhere checkTrustedHost
+// would have refused
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if strings.EqualFold(req.URL.Host, via[0].URL.Host) && req.URL.Scheme == via[0].URL.Scheme {
+		return nil
+	}
+	return checkTrustedHost(req.URL.String())
+}
+
+// ipv4FallbackDialer retries a failed or slow connection over IPv4, so update
+// checks still work on networks with broken IPv6
+type ipv4FallbackDialer struct {
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func (d ipv4FallbackDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" {
+		return d.dial(ctx, network, addr)
+	}
+	firstCtx, cancel := context.WithTimeout(ctx, UpdateIPv4FallbackDelay)
+	conn, err := d.dial(firstCtx, network, addr)
+	cancel()
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+	slog.Debug(fmt.Sprintf("connecting to %s failed, retrying over IPv4: %s", addr, err))
+	return d.dial(ctx, "tcp4", addr)
+}
+
+// downloadContext applies the overall download deadline, if there is one
+func downloadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := envDuration("OLLAMA_UPDATE_DOWNLOAD_TIMEOUT", UpdateDownloadTimeout); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// stallReader cancels a request when no data has been read for timeout
+type stallReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+func newStallReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *stallReader {
+	s := &stallReader{r: r, timeout: timeout}
+	s.timer = time.AfterFunc(timeout, func() {
+		s.stalled.Store(true)
+		cancel()
+	})
+	return s
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 && !s.stalled.Load() {
+		s.timer.Reset(s.timeout)
+	}
+	if err != nil && s.stalled.Load() {
+		return n, fmt.Errorf("%w: no data received for %s", errDownloadStalled, s.timeout)
+	}
+	return n, err
+}
+
+// Stop disarms the stall detector
+func (s *stallReader) Stop() {
+	s.timer.Stop()
+}
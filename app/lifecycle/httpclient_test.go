@@ -0,0 +1,181 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadStalled(t *testing.T) {
+	UpdateStageDir = t.TempDir()
+	t.Setenv("OLLAMA_UPDATE_STALL_TIMEOUT", "100ms")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		w.Write(make([]byte, 1024)) //nolint:errcheck
+		w.(http.Flusher).Flush()
+		// Stop sending data without closing the connection
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	dest := filepath.Join(UpdateStageDir, "abc", Installer)
+	start := time.Now()
+	_, err := downloadFile(context.Background(), ts.URL, dest, "", `"abc"`)
+	assert.ErrorIs(t, err, errDownloadStalled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// The partial download is kept so it can be resumed
+	info, err := os.Stat(dest + ".part")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024), info.Size())
+}
+
+func TestStallReaderKeepsFlowingData(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Slow overall, but never idle for longer than the stall timeout
+		for i := 0; i < 10; i++ {
+			w.Write([]byte("chunk")) //nolint:errcheck
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	t.Setenv("OLLAMA_UPDATE_STALL_TIMEOUT", "100ms")
+	dest := filepath.Join(t.TempDir(), Installer)
+	_, err := downloadFile(context.Background(), ts.URL, dest, "", "")
+	require.NoError(t, err)
+	b, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Len(t, b, 50)
+}
+
+func TestDownloadTimeoutRegimes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 10; i++ {
+			w.Write([]byte("chunk")) //nolint:errcheck
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+	t.Setenv("OLLAMA_UPDATE_STALL_TIMEOUT", "100ms")
+
+	// A short check timeout doesn't apply to downloads, which by default
+	// have no overall deadline
+	t.Setenv("OLLAMA_UPDATE_CHECK_TIMEOUT", "50ms")
+	t.Setenv("OLLAMA_UPDATE_DOWNLOAD_TIMEOUT", "")
+	_, err := downloadFile(context.Background(), ts.URL, filepath.Join(t.TempDir(), Installer), "", "")
+	require.NoError(t, err)
+
+	t.Setenv("OLLAMA_UPDATE_DOWNLOAD_TIMEOUT", "50ms")
+	_, err = downloadFile(context.Background(), ts.URL, filepath.Join(t.TempDir(), Installer), "", "")
+	assert.ErrorContains(t, err, "deadline exceeded")
+}
+
+func TestUpdateCheckTimeout(t *testing.T) {
+	setupTestKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+	t.Setenv("OLLAMA_UPDATE_CHECK_TIMEOUT", "50ms")
+
+	start := time.Now()
+	available, _ := IsNewReleaseAvailable(context.Background())
+	assert.False(t, available)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestIPv4FallbackDialer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	var networks []string
+	var dialer net.Dialer
+	d := ipv4FallbackDialer{dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		networks = append(networks, network)
+		if network == "tcp" {
+			return nil, &net.OpError{Op: "dial", Net: "tcp6", Err: errors.New("network is unreachable")}
+		}
+		return dialer.DialContext(ctx, network, ts.Listener.Addr().String())
+	}}
+	client := &http.Client{Transport: &http.Transport{DialContext: d.DialContext}}
+	resp, err := client.Get("http://ollama.com/api/update")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, []string{"tcp", "tcp4"}, networks)
+
+	// A hung attempt falls back once the delay passes
+	orig := UpdateIPv4FallbackDelay
+	t.Cleanup(func() { UpdateIPv4FallbackDelay = orig })
+	UpdateIPv4FallbackDelay = 50 * time.Millisecond
+	networks = nil
+	d.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		networks = append(networks, network)
+		if network == "tcp" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return dialer.DialContext(ctx, network, ts.Listener.Addr().String())
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", "ollama.com:80")
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{"tcp", "tcp4"}, networks)
+
+	// Cancellation isn't retried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	networks = nil
+	_, err = d.DialContext(ctx, "tcp", "ollama.com:80")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"tcp"}, networks)
+}
+
+func TestUpdateClientConnectionLimits(t *testing.T) {
+	transport := func() *http.Transport {
+		t.Helper()
+		tr, ok := newUpdateClient().Transport.(proxyAuthTransport).next.(*http.Transport)
+		require.True(t, ok)
+		return tr
+	}
+
+	t.Setenv("OLLAMA_UPDATE_MAX_CONNS_PER_HOST", "")
+	t.Setenv("OLLAMA_UPDATE_MAX_IDLE_CONNS", "")
+	tr := transport()
+	assert.Equal(t, UpdateMaxConnsPerHost, tr.MaxConnsPerHost)
+	assert.Equal(t, UpdateMaxConnsPerHost, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, UpdateMaxIdleConns, tr.MaxIdleConns)
+
+	t.Setenv("OLLAMA_UPDATE_MAX_CONNS_PER_HOST", "2")
+	t.Setenv("OLLAMA_UPDATE_MAX_IDLE_CONNS", "8")
+	tr = transport()
+	assert.Equal(t, 2, tr.MaxConnsPerHost)
+	assert.Equal(t, 2, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 8, tr.MaxIdleConns)
+
+	// Invalid values fall back to the defaults
+	t.Setenv("OLLAMA_UPDATE_MAX_CONNS_PER_HOST", "-1")
+	assert.Equal(t, UpdateMaxConnsPerHost, transport().MaxConnsPerHost)
+}
@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+type idleDetector interface {
+	// IdleTime reports how long since the last user input
+	IdleTime() (time.Duration, error)
+}
+
+var (
+	// How long the system must be idle before an update is installed
+	// automatically, overridden by OLLAMA_UPDATE_IDLE_THRESHOLD
+	AutoInstallIdleThreshold = 15 * time.Minute
+	IdlePollInterval         = 30 * time.Second
+
+	// overridden in tests
+	systemIdle         idleDetector = platformIdle{}
+	autoInstallEnabled              = store.GetAutoInstallWhenIdle
+
+	autoInstallPending atomic.Bool
+)
+
+// installWhenIdle waits until there has been no user input for the idle
+// threshold and then runs install, unless the server vetoes it. With a
+// maintenance window, it also waits for the window to open, unless the clock
+// is too far off to tell.
+func installWhenIdle(ctx context.Context, idle idleDetector, window *maintenanceWindow, install func() error) error {
+	threshold := envDuration("OLLAMA_UPDATE_IDLE_THRESHOLD", AutoInstallIdleThreshold)
+	vetoed := ""
+	for {
+		if window != nil && !clockSkewed() {
+			if wait := window.until(time.Now()); wait > 0 {
+				slog.Info(fmt.Sprintf("outside the maintenance window %s, waiting %s to install update", window, wait.Round(time.Minute)))
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+				continue
+			}
+		}
+		d, err := idle.IdleTime()
+		if err != nil {
+			return fmt.Errorf("unable to determine idle time: %w", err)
+		}
+		if d >= threshold {
+			ok, reason := canInstallNow()
+			if ok {
+				slog.Info(fmt.Sprintf("system idle for %s, installing update", d.Round(time.Second)))
+				return install()
+			}
+			if reason != vetoed {
+				slog.Info(fmt.Sprintf("server asked to hold off installing the update: %s", reason))
+				vetoed = reason
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(IdlePollInterval):
+		}
+	}
+}
+
+// scheduleAutoInstall starts waiting for the system to go idle, unless
+// already waiting
+func scheduleAutoInstall(ctx context.Context, install func() error) {
+	if !autoInstallPending.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer autoInstallPending.Store(false)
+		if err := installWhenIdle(ctx, systemIdle, currentMaintenanceWindow(), install); err != nil {
+			slog.Warn(fmt.Sprintf("automatic update install failed: %s", err))
+		}
+	}()
+}
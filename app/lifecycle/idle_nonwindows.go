@@ -0,0 +1,14 @@
+//go:build !windows
+
+package lifecycle
+
+import (
+	"fmt"
+	"time"
+)
+
+type platformIdle struct{}
+
+func (platformIdle) IdleTime() (time.Duration, error) {
+	return 0, fmt.Errorf("idle detection not implemented")
+}
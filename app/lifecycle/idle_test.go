@@ -0,0 +1,93 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeIdle struct {
+	mu    sync.Mutex
+	idle  time.Duration
+	step  time.Duration
+	calls int
+}
+
+// IdleTime grows by step on each call
+func (f *fakeIdle) IdleTime() (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	d := f.idle
+	f.idle += f.step
+	return d, nil
+}
+
+func TestInstallWhenIdle(t *testing.T) {
+	IdlePollInterval = time.Millisecond
+	t.Setenv("OLLAMA_UPDATE_IDLE_THRESHOLD", "10m")
+
+	idle := &fakeIdle{step: 3 * time.Minute}
+	installed := false
+	err := installWhenIdle(context.Background(), idle, nil, func() error {
+		installed = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, installed)
+	// idle for 0, 3, 6, 9 then 12 minutes
+	assert.Equal(t, 5, idle.calls, "should install only after the idle threshold")
+
+	errInstall := errors.New("install failed")
+	err = installWhenIdle(context.Background(), &fakeIdle{idle: time.Hour}, nil, func() error { return errInstall })
+	assert.ErrorIs(t, err, errInstall)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = installWhenIdle(ctx, &fakeIdle{}, nil, func() error {
+		t.Error("should not install while the user is active")
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestInstallWhenIdleVeto(t *testing.T) {
+	IdlePollInterval = time.Millisecond
+	t.Setenv("OLLAMA_UPDATE_IDLE_THRESHOLD", "10m")
+	t.Cleanup(func() { RegisterInstallVeto(nil) })
+
+	asked := 0
+	RegisterInstallVeto(func() (bool, string) {
+		asked++
+		if asked < 3 {
+			return false, "generating a response"
+		}
+		return true, ""
+	})
+	installed := false
+	err := installWhenIdle(context.Background(), &fakeIdle{idle: time.Hour}, nil, func() error {
+		installed = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, installed)
+	assert.Equal(t, 3, asked, "a veto should defer the install until the server allows it")
+
+	// A veto that never lifts keeps the install waiting
+	RegisterInstallVeto(func() (bool, string) { return false, "busy" })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = installWhenIdle(ctx, &fakeIdle{idle: time.Hour}, nil, func() error {
+		t.Error("should not install while the server vetoes it")
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	RegisterInstallVeto(nil)
+	ok, _ := canInstallNow()
+	assert.True(t, ok, "installs are allowed without a hook")
+}
@@ -0,0 +1,30 @@
+package lifecycle
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+var (
+	pGetLastInputInfo = u32.NewProc("GetLastInputInfo")
+	pGetTickCount     = k32.NewProc("GetTickCount")
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-lastinputinfo
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+type platformIdle struct{}
+
+func (platformIdle) IdleTime() (time.Duration, error) {
+	info := lastInputInfo{cbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	if res, _, err := pGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info))); res == 0 {
+		return 0, fmt.Errorf("GetLastInputInfo failed: %w", err)
+	}
+	now, _, _ := pGetTickCount.Call()
+	// Tick counts wrap every ~49 days, unsigned subtraction handles that
+	return time.Duration(uint32(now)-info.dwTime) * time.Millisecond, nil
+}
@@ -0,0 +1,27 @@
+package lifecycle
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// InstallerMutexName is the SetupMutex in ollama.iss, which the installer
+// holds while it runs, however it was started
+const InstallerMutexName = "OllamaSetupMutex"
+
+var (
+	errInstallInProgress = errors.New("another Ollama installer is already running")
+
+	// overridden in tests
+	installerRunning = platformInstallerRunning
+)
+
+// checkNoInstallInProgress makes sure an installer started some other way,
+// such as by an admin, isn't already running before starting our own
+func checkNoInstallInProgress() error {
+	if installerRunning() {
+		slog.Warn("an Ollama installer is already running, leaving the update staged until it's done")
+		return errInstallInProgress
+	}
+	return nil
+}
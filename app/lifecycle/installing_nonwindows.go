@@ -0,0 +1,7 @@
+//go:build !windows
+
+package lifecycle
+
+func platformInstallerRunning() bool {
+	return false
+}
@@ -0,0 +1,42 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stubInstallerRunning(t *testing.T, running bool) {
+	t.Helper()
+	orig := installerRunning
+	t.Cleanup(func() { installerRunning = orig })
+	installerRunning = func() bool { return running }
+}
+
+func TestCheckNoInstallInProgress(t *testing.T) {
+	stubInstallerRunning(t, false)
+	assert.NoError(t, checkNoInstallInProgress())
+
+	stubInstallerRunning(t, true)
+	assert.ErrorIs(t, checkNoInstallInProgress(), errInstallInProgress)
+}
+
+func TestUpdateInProgress(t *testing.T) {
+	stubInstallerRunning(t, false)
+	assert.False(t, UpdateInProgress())
+
+	muDownload.Lock()
+	cancelDownload = func() {}
+	muDownload.Unlock()
+	assert.True(t, UpdateInProgress(), "downloading")
+	muDownload.Lock()
+	cancelDownload = nil
+	muDownload.Unlock()
+
+	installPreparing.Store(true)
+	assert.True(t, UpdateInProgress(), "preparing an install")
+	installPreparing.Store(false)
+
+	stubInstallerRunning(t, true)
+	assert.False(t, UpdateInProgress(), "the installer finishes on its own")
+}
@@ -0,0 +1,28 @@
+package lifecycle
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// platformInstallerRunning checks for the installer's mutex in this session
+// and globally
+func platformInstallerRunning() bool {
+	for _, name := range []string{InstallerMutexName, `Global\` + InstallerMutexName} {
+		namePtr, err := windows.UTF16PtrFromString(name)
+		if err != nil {
+			continue
+		}
+		h, err := windows.OpenMutex(windows.SYNCHRONIZE, false, namePtr)
+		if err == nil {
+			windows.CloseHandle(h) //nolint:errcheck
+			return true
+		}
+		// An elevated installer's mutex exists, but can't be opened
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+			return true
+		}
+	}
+	return false
+}
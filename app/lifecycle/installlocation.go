@@ -0,0 +1,96 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Automatic installs run the installer silently, so they only work when it
+// can replace the app without asking, or at most with an elevation prompt.
+
+type installLocationChecker interface {
+	// Writable reports whether files in dir can be replaced
+	Writable(dir string) (bool, error)
+	// CanElevate reports whether the user is, or can become, an
+	// administrator
+	CanElevate() (bool, error)
+}
+
+var (
+	// overridden in tests
+	systemInstallLocation installLocationChecker = platformInstallLocation{}
+
+	errInstallLocationReadOnly = errors.New("the app can't be updated where it's installed")
+
+	// The version the user was last asked to install manually
+	muManualInstall       sync.Mutex
+	manualInstallNotified string
+)
+
+// installLocation returns the directory the running app was installed to
+func installLocation() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return AppDir
+	}
+	return filepath.Dir(exe)
+}
+
+// dirWritable checks dir by creating and removing a file in it
+func dirWritable(dir string) (bool, error) {
+	f, err := os.CreateTemp(dir, ".ollama-write-check-*")
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return false, nil
+		}
+		return false, err
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true, nil
+}
+
+// checkInstallLocation refuses automatic installs when dir isn't writable
+// and the user can't elevate. A location that can't be checked doesn't
+// block the install.
+func checkInstallLocation(checker installLocationChecker, dir string) error {
+	writable, err := checker.Writable(dir)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to check whether %s is writable: %s", dir, err))
+		return nil
+	}
+	if writable {
+		return nil
+	}
+	elevate, err := checker.CanElevate()
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to check for elevation: %s", err))
+		return nil
+	}
+	if elevate {
+		return nil
+	}
+	return fmt.Errorf("%w: %s isn't writable and elevation isn't available", errInstallLocationReadOnly, dir)
+}
+
+// autoInstallPossible reports whether ver can install automatically, asking
+// the user once per version to install it themselves when it can't
+func autoInstallPossible(ver string) bool {
+	err := checkInstallLocation(systemInstallLocation, installLocation())
+	if err == nil {
+		return true
+	}
+	slog.Warn(fmt.Sprintf("not installing update automatically: %s", err))
+	muManualInstall.Lock()
+	notify := manualInstallNotified != ver
+	manualInstallNotified = ver
+	muManualInstall.Unlock()
+	if notify {
+		notifyManualInstall(ver)
+	}
+	return false
+}
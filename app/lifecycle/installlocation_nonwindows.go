@@ -0,0 +1,16 @@
+//go:build !windows
+
+package lifecycle
+
+import "os"
+
+type platformInstallLocation struct{}
+
+func (platformInstallLocation) Writable(dir string) (bool, error) {
+	return dirWritable(dir)
+}
+
+// CanElevate only reports root, the installer can't prompt for sudo
+func (platformInstallLocation) CanElevate() (bool, error) {
+	return os.Geteuid() == 0, nil
+}
@@ -0,0 +1,74 @@
+package lifecycle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInstallLocation struct {
+	writable, elevate       bool
+	writableErr, elevateErr error
+}
+
+func (f fakeInstallLocation) Writable(string) (bool, error) { return f.writable, f.writableErr }
+func (f fakeInstallLocation) CanElevate() (bool, error)     { return f.elevate, f.elevateErr }
+
+func stubInstallLocation(t *testing.T, f fakeInstallLocation) {
+	t.Helper()
+	orig := systemInstallLocation
+	t.Cleanup(func() { systemInstallLocation = orig })
+	systemInstallLocation = f
+}
+
+func TestCheckInstallLocation(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, checkInstallLocation(fakeInstallLocation{writable: true}, dir))
+	assert.NoError(t, checkInstallLocation(fakeInstallLocation{elevate: true}, dir), "the installer can prompt for elevation")
+	assert.ErrorIs(t, checkInstallLocation(fakeInstallLocation{}, dir), errInstallLocationReadOnly)
+
+	// Unknowns don't block the install
+	assert.NoError(t, checkInstallLocation(fakeInstallLocation{writableErr: errors.New("boom")}, dir))
+	assert.NoError(t, checkInstallLocation(fakeInstallLocation{elevateErr: errors.New("boom")}, dir))
+}
+
+func TestDirWritable(t *testing.T) {
+	dir := t.TempDir()
+	writable, err := dirWritable(dir)
+	require.NoError(t, err)
+	assert.True(t, writable)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the check cleans up after itself")
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("permissions can't make a directory read-only here")
+	}
+	readOnly := filepath.Join(dir, "ro")
+	require.NoError(t, os.Mkdir(readOnly, 0o555))
+	writable, err = dirWritable(readOnly)
+	require.NoError(t, err)
+	assert.False(t, writable)
+}
+
+func TestAutoInstallPossible(t *testing.T) {
+	custom := &recordingNotifier{}
+	stubNotifiers(t, nil, custom)
+	t.Cleanup(func() { manualInstallNotified = "" })
+
+	stubInstallLocation(t, fakeInstallLocation{writable: true})
+	assert.True(t, autoInstallPossible("v0.1.30"))
+	assert.Empty(t, custom.events)
+
+	stubInstallLocation(t, fakeInstallLocation{})
+	assert.False(t, autoInstallPossible("v0.1.30"))
+	assert.False(t, autoInstallPossible("v0.1.30"))
+	assert.Equal(t, []string{
+		"warning Install the update yourself: Ollama can't update itself where it's installed, download and run the installer for version v0.1.30",
+	}, custom.events, "the user is only asked once per version")
+}
@@ -0,0 +1,30 @@
+package lifecycle
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// TOKEN_ELEVATION_TYPE of an administrator running with a filtered token,
+// who gets a UAC prompt rather than a password request
+// https://learn.microsoft.com/en-us/windows/win32/api/winnt/ne-winnt-token_elevation_type
+const tokenElevationTypeLimited = 3
+
+type platformInstallLocation struct{}
+
+func (platformInstallLocation) Writable(dir string) (bool, error) {
+	return dirWritable(dir)
+}
+
+func (platformInstallLocation) CanElevate() (bool, error) {
+	token := windows.GetCurrentProcessToken()
+	if token.IsElevated() {
+		return true, nil
+	}
+	var elevationType, n uint32
+	if err := windows.GetTokenInformation(token, windows.TokenElevationType, (*byte)(unsafe.Pointer(&elevationType)), uint32(unsafe.Sizeof(elevationType)), &n); err != nil {
+		return false, err
+	}
+	return elevationType == tokenElevationTypeLimited, nil
+}
@@ -0,0 +1,49 @@
+package lifecycle
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+// Clients all check roughly every UpdateCheckInterval after startup, so
+// checks are spread out to avoid synchronized spikes on the update server.
+// The jitter is seeded from the machine's ID, keeping each client's schedule
+// stable between runs.
+var (
+	// Each interval is offset by up to this fraction of UpdateCheckInterval,
+	// either way
+	UpdateCheckJitter = 0.1
+	// The first check waits up to this long on top of the startup delay
+	UpdateStartupJitter = time.Minute
+
+	// overridden in tests
+	machineID = store.GetID
+)
+
+// newJitterRand returns a random source seeded from id
+func newJitterRand(id string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(id)) //nolint:errcheck
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// jitteredInterval offsets interval by a random amount of up to fraction of
+// itself, in either direction
+func jitteredInterval(r *rand.Rand, interval time.Duration, fraction float64) time.Duration {
+	spread := time.Duration(float64(interval) * fraction)
+	if spread <= 0 {
+		return interval
+	}
+	return interval - spread + time.Duration(r.Int63n(int64(2*spread)+1))
+}
+
+// startupOffset returns a random delay of up to limit
+func startupOffset(r *rand.Rand, limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(r.Int63n(int64(limit) + 1))
+}
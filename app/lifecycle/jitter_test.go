@@ -0,0 +1,52 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitteredInterval(t *testing.T) {
+	r := newJitterRand("6f7e3c2a-machine")
+	interval := time.Hour
+	earliest, latest := interval, interval
+	for i := 0; i < 1000; i++ {
+		d := jitteredInterval(r, interval, 0.1)
+		assert.GreaterOrEqual(t, d, 54*time.Minute)
+		assert.LessOrEqual(t, d, 66*time.Minute)
+		if d < earliest {
+			earliest = d
+		}
+		if d > latest {
+			latest = d
+		}
+	}
+	assert.Less(t, earliest, interval, "should spread checks earlier")
+	assert.Greater(t, latest, interval, "should spread checks later")
+
+	assert.Equal(t, interval, jitteredInterval(r, interval, 0))
+}
+
+func TestStartupOffset(t *testing.T) {
+	r := newJitterRand("6f7e3c2a-machine")
+	for i := 0; i < 1000; i++ {
+		d := startupOffset(r, time.Minute)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, time.Minute)
+	}
+	assert.Zero(t, startupOffset(r, 0))
+}
+
+func TestJitterStablePerMachine(t *testing.T) {
+	schedule := func(id string) []time.Duration {
+		r := newJitterRand(id)
+		s := []time.Duration{startupOffset(r, time.Minute)}
+		for i := 0; i < 5; i++ {
+			s = append(s, jitteredInterval(r, time.Hour, 0.1))
+		}
+		return s
+	}
+	assert.Equal(t, schedule("machine-a"), schedule("machine-a"))
+	assert.NotEqual(t, schedule("machine-a"), schedule("machine-b"))
+}
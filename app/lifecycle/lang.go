@@ -0,0 +1,21 @@
+package lifecycle
+
+import "strings"
+
+// The user's UI language is sent with update checks, as a BCP 47 tag such
+// as "en-US", so the update server can localize the update description.
+
+// overridden in tests
+var uiLanguage = func() string { return normalizeLanguage(platformUILanguage()) }
+
+// normalizeLanguage turns a locale like "pt_BR.UTF-8" or "de_DE@euro" into a
+// BCP 47 tag. The "C" and "POSIX" locales carry no language and give "".
+func normalizeLanguage(locale string) string {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "C" || locale == "POSIX" {
+		return ""
+	}
+	return strings.ReplaceAll(locale, "_", "-")
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package lifecycle
+
+import "os"
+
+// platformUILanguage returns the locale used for messages, following the
+// usual POSIX precedence
+func platformUILanguage() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":            "",
+		"C":           "",
+		"POSIX.UTF-8": "",
+		"en_US.UTF-8": "en-US",
+		"de_DE@euro":  "de-DE",
+		"fr":          "fr",
+		"zh-Hans-CN":  "zh-Hans-CN",
+	}
+	for locale, want := range cases {
+		assert.Equal(t, want, normalizeLanguage(locale), locale)
+	}
+}
+
+func TestGetUpdateCheckURLLanguage(t *testing.T) {
+	orig := uiLanguage
+	t.Cleanup(func() { uiLanguage = orig })
+	UpdateCheckURLBase = "https://ollama.com/api/update"
+
+	uiLanguage = func() string { return "pt-BR" }
+	u, err := GetUpdateCheckURL(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, "pt-BR", u.Query().Get("lang"))
+
+	uiLanguage = func() string { return "" }
+	u, err = GetUpdateCheckURL(url.Values{})
+	require.NoError(t, err)
+	assert.False(t, u.Query().Has("lang"))
+}
+
+func TestIsNewReleaseAvailableDescription(t *testing.T) {
+	setupTestKey(t)
+	orig := uiLanguage
+	t.Cleanup(func() { uiLanguage = orig })
+	uiLanguage = func() string { return "de-DE" }
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		description := ""
+		if r.URL.Query().Get("lang") == "de-DE" {
+			description = "Ollama 0.1.30 ist bereit zur Installation"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+			"url":         "https://example.com/download/v0.1.30/OllamaSetup.exe",
+			"description": description,
+		})
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+
+	available, resp := IsNewReleaseAvailable(context.Background())
+	require.True(t, available)
+	assert.Equal(t, "Ollama 0.1.30 ist bereit zur Installation", resp.Description)
+}
@@ -0,0 +1,18 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+
+	"golang.org/x/sys/windows"
+)
+
+// platformUILanguage returns the user's most preferred display language
+func platformUILanguage() string {
+	langs, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
+	if err != nil || len(langs) == 0 {
+		slog.Debug(fmt.Sprintf("unable to detect UI language: %v", err))
+		return ""
+	}
+	return langs[0]
+}
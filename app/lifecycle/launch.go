@@ -0,0 +1,29 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var (
+	InstallerLaunchAttempts   = 5
+	InstallerLaunchRetryDelay = 500 * time.Millisecond
+)
+
+// launchWithRetry calls start until it succeeds, retrying only errors that
+// transient classifies as temporary, up to InstallerLaunchAttempts times
+func launchWithRetry(start func() error, transient func(error) bool) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = start()
+		if err == nil {
+			return nil
+		}
+		if !transient(err) || attempt >= InstallerLaunchAttempts {
+			return err
+		}
+		slog.Warn(fmt.Sprintf("installer launch attempt %d failed, retrying: %s", attempt, err))
+		time.Sleep(InstallerLaunchRetryDelay)
+	}
+}
@@ -0,0 +1,49 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLaunchWithRetry(t *testing.T) {
+	InstallerLaunchRetryDelay = time.Millisecond
+	errLocked := errors.New("locked")
+	errMissing := errors.New("missing")
+	transient := func(err error) bool { return errors.Is(err, errLocked) }
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		calls := 0
+		err := launchWithRetry(func() error {
+			calls++
+			if calls < 3 {
+				return errLocked
+			}
+			return nil
+		}, transient)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("fails immediately on other errors", func(t *testing.T) {
+		calls := 0
+		err := launchWithRetry(func() error {
+			calls++
+			return errMissing
+		}, transient)
+		assert.ErrorIs(t, err, errMissing)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		calls := 0
+		err := launchWithRetry(func() error {
+			calls++
+			return errLocked
+		}, transient)
+		assert.ErrorIs(t, err, errLocked)
+		assert.Equal(t, InstallerLaunchAttempts, calls)
+	})
+}
@@ -3,27 +3,36 @@ package lifecycle
 import (
 	"context"
 	"fmt"
-	"log"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
-	"github.com/jmorganca/ollama/app/store"
 	"github.com/jmorganca/ollama/app/tray"
+	"github.com/jmorganca/ollama/version"
 )
 
+// Title of the notification showing the tray diagnosis
+const trayDiagnosisTitle = "Tray icon check"
+
 func Run() {
 	InitLogging()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	var done chan int
+	WaitForReplacedInstance(ctx)
 
-	t, err := tray.NewTray()
-	if err != nil {
-		log.Fatalf("Failed to start: %s", err)
+	t, headless := tray.NewTrayOrHeadless()
+	if headless {
+		slog.Info("notifications will be written to the log")
 	}
 	callbacks := t.GetCallbacks()
+	t.SetModelLister(ListModels)
+	t.SetQuietHours(inQuietHours)
+	t.SetUpdateBusy(UpdateInProgress)
+	t.SetUpdateStateProvider(CurrentUpdateState)
+	setDefaultNotifier(trayNotifier{t})
+	updateFailures.setTooltipFunc(t.SetTooltip)
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
@@ -34,14 +43,116 @@ func Run() {
 			select {
 			case <-callbacks.Quit:
 				slog.Debug("quit called")
+				CancelDownload()
 				t.Quit()
 			case <-signals:
 				slog.Debug("shutting down due to signal")
 				t.Quit()
 			case <-callbacks.Update:
-				err := DoUpgrade(cancel, done)
+				go func() {
+					err := DeferUpgrade(ctx, t.SessionActive, func() error {
+						return DoUpgrade(cancel, done)
+					})
+					if err != nil {
+						slog.Warn(fmt.Sprintf("upgrade attempt failed: %s", err))
+						notifyUpdateFailed("", err)
+					}
+				}()
+			case <-callbacks.RestartApp:
+				err := RestartApp(func() {
+					CancelDownload()
+					t.Quit()
+				})
 				if err != nil {
-					slog.Warn(fmt.Sprintf("upgrade attempt failed: %s", err))
+					slog.Warn(fmt.Sprintf("failed to restart the app: %s", err))
+				}
+			case <-callbacks.RestartServer:
+				go func() {
+					if err := RestartServer(); err != nil {
+						slog.Warn(fmt.Sprintf("failed to restart server: %s", err))
+					}
+				}()
+			case ver := <-callbacks.Rollback:
+				go func() {
+					err := RollbackTo(ctx, ver, func() error {
+						return DoUpgrade(cancel, done)
+					})
+					if err != nil {
+						slog.Warn(fmt.Sprintf("roll back to %s failed: %s", ver, err))
+					}
+				}()
+			case <-callbacks.ReportIssue:
+				if err := OpenURL(GetReportIssueURL()); err != nil {
+					slog.Warn(fmt.Sprintf("failed to open issue report: %s", err))
+				}
+			case <-callbacks.CheckUpdates:
+				if !CheckNow() {
+					if err := t.DisplayPleaseWaitNotification(); err != nil {
+						slog.Debug(fmt.Sprintf("failed to display please wait notification %v", err))
+					}
+				}
+			case <-callbacks.DisableUpdates:
+				DisableUpdatesPermanently()
+				if err := t.DisableUpdates(); err != nil {
+					slog.Warn(fmt.Sprintf("failed to remove update menu: %s", err))
+				}
+			case model := <-callbacks.SetActiveModel:
+				go func() {
+					if err := SetActiveModel(ctx, model); err != nil {
+						slog.Warn(fmt.Sprintf("failed to load model %s: %s", model, err))
+					}
+				}()
+			case <-callbacks.ShowReleaseNotes:
+				if err := OpenURL(GetReleaseNotesURL()); err != nil {
+					slog.Warn(fmt.Sprintf("failed to open release notes: %s", err))
+				}
+			case <-callbacks.UpdateDeclined:
+				UpdateDeclined()
+			case <-callbacks.Resumed:
+				CheckAfterResume()
+			case <-callbacks.PinVersion:
+				PinCurrentVersion()
+			case mode := <-callbacks.SetUpdateMode:
+				SetUpdateMode(mode)
+			case <-callbacks.PauseDownload:
+				PauseDownload()
+			case <-callbacks.ResumeDownload:
+				go func() {
+					if err := ResumeDownload(ctx, t.UpdateAvailable); err != nil {
+						slog.Warn(fmt.Sprintf("failed to resume update download: %s", err))
+					}
+				}()
+			case <-callbacks.CopyUpdateURLs:
+				if err := CopyUpdateURLs(); err != nil {
+					slog.Warn(fmt.Sprintf("failed to copy update URLs: %s", err))
+				}
+			case <-callbacks.CopyVersion:
+				if err := SetClipboardText(FullVersion()); err != nil {
+					slog.Warn(fmt.Sprintf("failed to copy version: %s", err))
+				}
+			case <-callbacks.CopyDiagnostics:
+				go func() {
+					if err := CopyDiagnostics(); err != nil {
+						slog.Warn(fmt.Sprintf("failed to copy diagnostics: %s", err))
+					}
+				}()
+			case <-callbacks.SaveDiagnostics:
+				go func() {
+					path, err := CollectDiagnostics()
+					if err != nil {
+						slog.Warn(fmt.Sprintf("failed to save diagnostics: %s", err))
+						return
+					}
+					slog.Info("diagnostics saved to " + path)
+					if err := RevealFile(path); err != nil {
+						slog.Warn(fmt.Sprintf("failed to show diagnostics: %s", err))
+					}
+				}()
+			case <-callbacks.DiagnoseTray:
+				summary := t.Diagnose().Summary()
+				slog.Info("tray diagnosis: " + summary)
+				if err := t.DisplayNotification(trayDiagnosisTitle, summary); err != nil {
+					slog.Warn(fmt.Sprintf("failed to show tray diagnosis: %s", err))
 				}
 			case <-callbacks.ShowLogs:
 				ShowLogs()
@@ -54,23 +165,39 @@ func Run() {
 		}
 	}()
 
+	controlStopped, err := StartControlServer(ctx, callbacks, t.Diagnose)
+	if err != nil {
+		slog.Warn(err.Error())
+	}
+
 	// Are we first use?
-	if !store.GetFirstTimeRun() {
-		slog.Debug("First time run")
-		err = t.DisplayFirstUseNotification()
-		if err != nil {
-			slog.Debug(fmt.Sprintf("XXX failed to display first use notification %v", err))
+	firstUse(t.DisplayFirstUseNotification)
+
+	if CheckUpgraded() {
+		if err := t.DisplayUpgradedNotification(version.Version); err != nil {
+			slog.Debug(fmt.Sprintf("failed to display upgraded notification %v", err))
 		}
-		store.SetFirstTimeRun(true)
-	} else {
-		slog.Debug("Not first time, skipping first run notification")
 	}
+	// The installer that relaunched the app may still be finishing
+	go func() {
+		if err := CheckInstallerExit(ctx); err != nil {
+			slog.Warn(fmt.Sprintf("failed to check how the last install went: %s", err))
+		}
+		if ver, ok := RebootPending(); ok {
+			if err := t.DisplayRebootPendingNotification(ver); err != nil {
+				slog.Debug(fmt.Sprintf("failed to display reboot pending notification %v", err))
+			}
+		}
+	}()
 
 	if IsServerRunning(ctx) {
 		slog.Info("Detected another instance of ollama running, exiting")
 		os.Exit(1)
 	} else {
-		done, err = SpawnServer(ctx, CLIName)
+		var err error
+		done, err = SpawnServer(ctx, CLIName, ServerCallbacks{
+			RepeatedFailures: func(int) error { return t.DisplayServerFailedNotification() },
+		})
 		if err != nil {
 			// TODO - should we retry in a backoff loop?
 			// TODO - should we pop up a warning and maybe add a menu item to view application logs?
@@ -80,10 +207,61 @@ func Run() {
 		}
 	}
 
-	StartBackgroundUpdaterChecker(ctx, t.UpdateAvailable)
+	if UpdatesDisabled() {
+		if err := t.DisableUpdates(); err != nil {
+			slog.Warn(fmt.Sprintf("failed to remove update menu: %s", err))
+		}
+	}
+
+	ApplyUnpinOverride()
+	CheckPinDrift()
+
+	// Make sure an update staged in a prior session hasn't been tampered with
+	// before offering it again. Failing that, bring back one that was found
+	// but not yet downloaded.
+	PruneStore()
+	MigrateStageDir()
+	if !RestorePendingUpdate(t.UpdatePending) {
+		RestoreAvailableUpdate(t.UpdatePending)
+	}
+
+	StartBackgroundUpdaterChecker(ctx, UpdaterCallbacks{
+		UpdateAvailable: t.UpdateAvailable,
+		UpdateMandatory: t.UpdateMandatory,
+		UpToDate:        t.DisplayUpToDateNotification,
+		UpdatePending:   t.UpdatePending,
+		Install: func() error {
+			return DeferUpgrade(ctx, t.SessionActive, func() error { return DoUpgrade(cancel, done) })
+		},
+	})
+
+	go MonitorServerHealth(ctx, t.SetStatusIcon)
+
+	go func() {
+		if UpdatesDisabled() {
+			return
+		}
+		releases, err := ListReleases(ctx)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("unable to list releases for roll back: %s", err))
+			return
+		}
+		var versions []string
+		for _, r := range releases {
+			if r.Version != version.Version {
+				versions = append(versions, r.Version)
+			}
+		}
+		if err := t.SetRollbackVersions(versions); err != nil {
+			slog.Warn(fmt.Sprintf("failed to populate roll back menu: %s", err))
+		}
+	}()
 
 	t.Run()
 	cancel()
+	if controlStopped != nil {
+		<-controlStopped
+	}
 	slog.Info("Waiting for ollama server to shutdown...")
 	if done != nil {
 		<-done
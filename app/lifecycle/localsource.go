@@ -0,0 +1,150 @@
+package lifecycle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An update can be staged from the local filesystem rather than downloaded,
+// for air-gapped machines where an admin copies the installer over.
+// OLLAMA_UPDATE_FILE names the installer, as a path or file:// URL, to use in
+// place of whatever the response points at. The checksum from the update
+// response is verified just the same. A file:// URL from the update server
+// itself is refused like any other untrusted host, since it could name a UNC
+// path on any machine.
+
+// localUpdateSource returns the local path an update should be copied from,
+// if OLLAMA_UPDATE_FILE sets one
+func localUpdateSource() (string, bool) {
+	path := os.Getenv("OLLAMA_UPDATE_FILE")
+	if path == "" {
+		return "", false
+	}
+	if local, ok := fileURLPath(path); ok {
+		return local, true
+	}
+	return path, true
+}
+
+// fileURLPath returns the local path a file:// URL names
+func fileURLPath(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.EqualFold(u.Scheme, "file") {
+		return "", false
+	}
+	path := u.Path
+	if u.Host != "" && u.Host != "localhost" {
+		// A UNC path, file://server/share/OllamaSetup.exe
+		path = "//" + u.Host + path
+	} else if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		// file:///C:/path keeps a leading slash before the drive letter
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), true
+}
+
+// stageLocalRelease copies the installer at src into the stage dir
+func stageLocalRelease(ctx context.Context, src string, updateResp UpdateResponse) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("local update source: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("local update source %s is not a file", src)
+	}
+
+	stageFilename := filepath.Join(UpdateStageDir, "local", filepath.Base(src))
+	if stagedInstallerExists(stageFilename) {
+		if staged, err := verifyStagedInstaller(stageFilename); err == nil && strings.EqualFold(staged.SHA256, updateResp.Checksum) {
+			slog.Info("update already staged")
+			SetUpdateDownloaded(true)
+			return nil
+		}
+		removeStagedInstaller(stageFilename)
+	}
+	cleanupOldDownloads()
+	if err := checkDiskSpace(UpdateStageDir, fi.Size()); err != nil {
+		return err
+	}
+
+	checksum, err := copyLocalFile(ctx, src, stageFilename, updateResp.Checksum)
+	if err != nil {
+		return err
+	}
+	staged := StagedUpdate{
+		Version: updateResp.UpdateVersion,
+		URL:     updateResp.UpdateURL,
+		SHA256:  checksum,
+	}
+	if err := writeStagedMetadata(stageFilename, staged); err != nil {
+		return fmt.Errorf("write update metadata %s: %w", stageFilename, err)
+	}
+	slog.Info(fmt.Sprintf("new update staged from %s", src))
+	storeStagedInstaller(stageFilename)
+
+	SetUpdateDownloaded(true)
+	return nil
+}
+
+// copyLocalFile copies src to dest, verifying the expected checksum if
+// given, and returns the file's SHA-256
+func copyLocalFile(ctx context.Context, src, dest, checksum string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("local update source: %w", err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", fmt.Errorf("create ollama dir %s: %v", filepath.Dir(dest), err)
+	}
+	partial := dest + ".part"
+	fp, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return "", fmt.Errorf("write payload %s: %w", partial, err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(fp, h), &contextReader{ctx: ctx, r: in})
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(partial)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("write payload %s: %w", partial, err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if checksum != "" && !strings.EqualFold(checksum, sum) {
+		os.Remove(partial)
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", src, checksum, sum)
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("write payload %s: %w", dest, err)
+	}
+	return sum, nil
+}
+
+// contextReader stops reading once ctx is done, so a copy can be cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,123 @@
+package lifecycle
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fileURL(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+func TestLocalUpdateSource(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_FILE", "")
+	_, ok := localUpdateSource()
+	assert.False(t, ok)
+
+	cases := []struct {
+		url    string
+		expect string
+		ok     bool
+	}{
+		{"https://ollama.com/download/OllamaSetup.exe", "", false},
+		{"/media/usb/OllamaSetup.exe", "", false},
+		{"file:///srv/updates/OllamaSetup.exe", "/srv/updates/OllamaSetup.exe", true},
+		{"file://localhost/srv/updates/OllamaSetup.exe", "/srv/updates/OllamaSetup.exe", true},
+		{"file:///C:/updates/OllamaSetup.exe", "C:/updates/OllamaSetup.exe", true},
+		{"file://fileserver/share/OllamaSetup.exe", "//fileserver/share/OllamaSetup.exe", true},
+	}
+	for _, tc := range cases {
+		path, ok := fileURLPath(tc.url)
+		assert.Equal(t, tc.ok, ok, tc.url)
+		assert.Equal(t, filepath.FromSlash(tc.expect), path, tc.url)
+	}
+
+	t.Setenv("OLLAMA_UPDATE_FILE", "/media/usb/OllamaSetup.exe")
+	path, ok := localUpdateSource()
+	assert.True(t, ok)
+	assert.Equal(t, "/media/usb/OllamaSetup.exe", path)
+
+	t.Setenv("OLLAMA_UPDATE_FILE", "file:///media/usb/OllamaSetup.exe")
+	path, ok = localUpdateSource()
+	assert.True(t, ok)
+	assert.Equal(t, filepath.FromSlash("/media/usb/OllamaSetup.exe"), path)
+}
+
+func TestDownloadLocalRelease(t *testing.T) {
+	payload := []byte("installer payload")
+	src := filepath.Join(t.TempDir(), "OllamaSetup.exe")
+	require.NoError(t, os.WriteFile(src, payload, 0o644))
+
+	t.Run("valid", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		SetUpdateDownloaded(false)
+		t.Setenv("OLLAMA_UPDATE_FILE", fileURL(src))
+		resp := UpdateResponse{UpdateURL: "https://ollama.com/download/OllamaSetup.exe", UpdateVersion: "v0.1.30", Checksum: sha256Hex(payload)}
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+		assert.True(t, IsUpdateDownloaded())
+
+		staged := filepath.Join(UpdateStageDir, "local", "OllamaSetup.exe")
+		b, err := os.ReadFile(staged)
+		require.NoError(t, err)
+		assert.Equal(t, payload, b)
+		meta, err := verifyStagedInstaller(staged)
+		require.NoError(t, err)
+		assert.Equal(t, "v0.1.30", meta.Version)
+
+		// Staging again reuses the verified copy
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		SetUpdateDownloaded(false)
+		t.Setenv("OLLAMA_UPDATE_FILE", src)
+		resp := UpdateResponse{Checksum: sha256Hex([]byte("something else"))}
+		err := DownloadNewRelease(context.Background(), resp)
+		assert.ErrorContains(t, err, "checksum mismatch")
+		assert.False(t, IsUpdateDownloaded())
+		_, err = os.Stat(filepath.Join(UpdateStageDir, "local", "OllamaSetup.exe"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("from OLLAMA_UPDATE_FILE", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		t.Setenv("OLLAMA_UPDATE_FILE", src)
+		resp := UpdateResponse{UpdateURL: "https://127.0.0.1:0/OllamaSetup.exe", Checksum: sha256Hex(payload)}
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+		_, err := os.Stat(filepath.Join(UpdateStageDir, "local", "OllamaSetup.exe"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		t.Setenv("OLLAMA_UPDATE_FILE", filepath.Join(t.TempDir(), "missing.exe"))
+		assert.ErrorIs(t, DownloadNewRelease(context.Background(), UpdateResponse{}), os.ErrNotExist)
+	})
+
+	t.Run("file URL from the update server", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		t.Setenv("OLLAMA_UPDATE_FILE", "")
+		t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+		t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+		SetUpdateDownloaded(false)
+		for _, u := range []string{fileURL(src), "file://ollama.com/share/OllamaSetup.exe"} {
+			resp := UpdateResponse{UpdateURL: u, Checksum: sha256Hex(payload)}
+			assert.ErrorIs(t, DownloadNewRelease(context.Background(), resp), errUntrustedHost, u)
+		}
+		assert.False(t, IsUpdateDownloaded())
+		_, err := os.Stat(filepath.Join(UpdateStageDir, "local"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
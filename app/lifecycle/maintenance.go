@@ -0,0 +1,97 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+// overridden in tests
+var maintenanceWindowSetting = store.GetMaintenanceWindow
+
+// maintenanceWindow is a daily span of local time, in minutes since midnight,
+// during which updates may install automatically. A window whose end is
+// before its start crosses midnight.
+type maintenanceWindow struct {
+	start, end int
+}
+
+// parseMaintenanceWindow parses a window like "02:00-04:00"
+func parseMaintenanceWindow(s string) (*maintenanceWindow, error) {
+	return parseDailyWindow("maintenance window", s)
+}
+
+// parseDailyWindow parses a span of local time like "02:00-04:00", naming
+// it in errors
+func parseDailyWindow(name, s string) (*maintenanceWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("%s %q should look like 02:00-04:00", name, s)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s start %q", name, from)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s end %q", name, to)
+	}
+	w := &maintenanceWindow{
+		start: start.Hour()*60 + start.Minute(),
+		end:   end.Hour()*60 + end.Minute(),
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("%s %q is empty", name, s)
+	}
+	return w, nil
+}
+
+// currentMaintenanceWindow returns the configured window, or nil if updates
+// may install at any time. OLLAMA_UPDATE_MAINTENANCE_WINDOW overrides the
+// stored window.
+func currentMaintenanceWindow() *maintenanceWindow {
+	s := os.Getenv("OLLAMA_UPDATE_MAINTENANCE_WINDOW")
+	if s == "" {
+		s = maintenanceWindowSetting()
+	}
+	if s == "" {
+		return nil
+	}
+	w, err := parseMaintenanceWindow(s)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("ignoring maintenance window: %s", err))
+		return nil
+	}
+	return w
+}
+
+// contains reports whether t falls inside the window, including its start
+// but not its end
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// until returns how long from t until the window next opens, or 0 if it's
+// already open
+func (w *maintenanceWindow) until(t time.Time) time.Duration {
+	if w.contains(t) {
+		return 0
+	}
+	next := time.Date(t.Year(), t.Month(), t.Day(), w.start/60, w.start%60, 0, 0, t.Location())
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next.Sub(t)
+}
+
+func (w *maintenanceWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
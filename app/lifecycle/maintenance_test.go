@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func atLocal(hour, minute int) time.Time {
+	return time.Date(2024, 3, 1, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	w, err := parseMaintenanceWindow("02:00-04:30")
+	require.NoError(t, err)
+	assert.Equal(t, &maintenanceWindow{start: 120, end: 270}, w)
+	assert.Equal(t, "02:00-04:30", w.String())
+
+	w, err = parseMaintenanceWindow(" 22:00 - 01:00 ")
+	require.NoError(t, err)
+	assert.Equal(t, &maintenanceWindow{start: 1320, end: 60}, w)
+
+	for _, bad := range []string{"", "02:00", "2am-4am", "02:00-25:00", "03:00-03:00"} {
+		_, err := parseMaintenanceWindow(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	w := &maintenanceWindow{start: 120, end: 240}
+	assert.False(t, w.contains(atLocal(1, 59)))
+	assert.True(t, w.contains(atLocal(2, 0)), "start is inclusive")
+	assert.True(t, w.contains(atLocal(3, 59)))
+	assert.False(t, w.contains(atLocal(4, 0)), "end is exclusive")
+
+	midnight := &maintenanceWindow{start: 23 * 60, end: 60}
+	assert.False(t, midnight.contains(atLocal(22, 59)))
+	assert.True(t, midnight.contains(atLocal(23, 0)))
+	assert.True(t, midnight.contains(atLocal(0, 0)))
+	assert.True(t, midnight.contains(atLocal(0, 59)))
+	assert.False(t, midnight.contains(atLocal(1, 0)))
+	assert.False(t, midnight.contains(atLocal(12, 0)))
+}
+
+func TestMaintenanceWindowUntil(t *testing.T) {
+	w := &maintenanceWindow{start: 120, end: 240}
+	assert.Equal(t, time.Duration(0), w.until(atLocal(3, 0)))
+	assert.Equal(t, 30*time.Minute, w.until(atLocal(1, 30)))
+	assert.Equal(t, 22*time.Hour, w.until(atLocal(4, 0)), "should wait for tomorrow's window")
+
+	midnight := &maintenanceWindow{start: 23 * 60, end: 60}
+	assert.Equal(t, time.Duration(0), midnight.until(atLocal(0, 30)))
+	assert.Equal(t, 22*time.Hour, midnight.until(atLocal(1, 0)))
+	assert.Equal(t, time.Hour, midnight.until(atLocal(22, 0)))
+}
+
+func TestCurrentMaintenanceWindow(t *testing.T) {
+	orig := maintenanceWindowSetting
+	t.Cleanup(func() { maintenanceWindowSetting = orig })
+
+	maintenanceWindowSetting = func() string { return "" }
+	t.Setenv("OLLAMA_UPDATE_MAINTENANCE_WINDOW", "")
+	assert.Nil(t, currentMaintenanceWindow())
+
+	maintenanceWindowSetting = func() string { return "02:00-04:00" }
+	assert.Equal(t, &maintenanceWindow{start: 120, end: 240}, currentMaintenanceWindow())
+
+	t.Setenv("OLLAMA_UPDATE_MAINTENANCE_WINDOW", "22:00-01:00")
+	assert.Equal(t, &maintenanceWindow{start: 1320, end: 60}, currentMaintenanceWindow(), "env should override the store")
+
+	t.Setenv("OLLAMA_UPDATE_MAINTENANCE_WINDOW", "bogus")
+	assert.Nil(t, currentMaintenanceWindow(), "an invalid window should not block updates")
+}
+
+func TestInstallWhenIdleOutsideWindow(t *testing.T) {
+	IdlePollInterval = time.Millisecond
+	now := time.Now()
+	m := now.Hour()*60 + now.Minute()
+	closed := &maintenanceWindow{start: (m + 120) % (24 * 60), end: (m + 180) % (24 * 60)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := installWhenIdle(ctx, &fakeIdle{idle: time.Hour}, closed, func() error {
+		t.Error("should not install outside the maintenance window")
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	open := &maintenanceWindow{start: (m + 24*60 - 60) % (24 * 60), end: (m + 60) % (24 * 60)}
+	installed := false
+	err = installWhenIdle(context.Background(), &fakeIdle{idle: time.Hour}, open, func() error {
+		installed = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, installed)
+}
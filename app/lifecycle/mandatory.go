@@ -0,0 +1,54 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// MandatoryGracePeriod is how long after a mandatory update is found
+	// that it installs without waiting for the user, overridden by
+	// OLLAMA_UPDATE_MANDATORY_GRACE_PERIOD
+	MandatoryGracePeriod = 4 * time.Hour
+
+	// Set while a mandatory install is scheduled
+	mandatoryInstallPending atomic.Bool
+)
+
+// mandatoryInstallDelay returns how much of the grace period is left at now
+// for an update found at found
+func mandatoryInstallDelay(found, now time.Time) time.Duration {
+	grace := envDuration("OLLAMA_UPDATE_MANDATORY_GRACE_PERIOD", MandatoryGracePeriod)
+	if found.IsZero() {
+		return grace
+	}
+	if left := found.Add(grace).Sub(now); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// scheduleMandatoryInstall runs install once the grace period for an update
+// found at found is over, unless one is already scheduled
+func scheduleMandatoryInstall(ctx context.Context, found time.Time, install func() error) {
+	if !mandatoryInstallPending.CompareAndSwap(false, true) {
+		return
+	}
+	delay := mandatoryInstallDelay(found, time.Now())
+	slog.Info(fmt.Sprintf("mandatory update will install in %s", delay.Round(time.Minute)))
+	go func() {
+		defer mandatoryInstallPending.Store(false)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		slog.Info("grace period for mandatory update is over, installing it")
+		if err := install(); err != nil {
+			slog.Warn(fmt.Sprintf("mandatory update install failed: %s", err))
+		}
+	}()
+}
@@ -0,0 +1,158 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+func TestMandatoryInstallDelay(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_MANDATORY_GRACE_PERIOD", "2h")
+	now := time.Now()
+	assert.Equal(t, 2*time.Hour, mandatoryInstallDelay(time.Time{}, now))
+	assert.Equal(t, 30*time.Minute, mandatoryInstallDelay(now.Add(-90*time.Minute), now))
+	assert.Equal(t, time.Duration(0), mandatoryInstallDelay(now.Add(-3*time.Hour), now))
+}
+
+func TestScheduleMandatoryInstall(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_MANDATORY_GRACE_PERIOD", "1h")
+	installed := make(chan struct{}, 2)
+	install := func() error {
+		installed <- struct{}{}
+		return nil
+	}
+
+	// Found long enough ago that the grace period is already over
+	scheduleMandatoryInstall(context.Background(), time.Now().Add(-2*time.Hour), install)
+	select {
+	case <-installed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("mandatory update wasn't installed after the grace period")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduleMandatoryInstall(ctx, time.Now(), install)
+	cancel()
+	assert.Eventually(t, func() bool { return !mandatoryInstallPending.Load() }, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, installed)
+}
+
+func TestMandatoryUpdateIgnoresSnooze(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	setupTestKey(t)
+	key := setTestPublicKey(t)
+	setUpdatesDisabled(t, false)
+	stubPinnedVersion(t, "")
+	stubNotifiers(t, nil)
+	saved := stubAvailableUpdate(t)
+	UpdateStageDir = t.TempDir()
+	installer := []byte("installer payload")
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/api/update", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jose")
+		payload := fmt.Sprintf(`{"url":"%s/download/v0.1.30/OllamaSetup.exe","sha256":"%s","mandatory":true,"mandatory_message":"Fixes CVE-0000-0000"}`, ts.URL, sha256Hex(installer))
+		w.Write([]byte(signJWS(t, key, "EdDSA", payload))) //nolint:errcheck
+	})
+	mux.HandleFunc("/download/v0.1.30/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(installer) //nolint:errcheck
+	})
+	UpdateCheckURLBase = ts.URL + "/api/update"
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+
+	origNotice := store.GetUpdateNotice()
+	t.Cleanup(func() { store.SetUpdateNotice(origNotice) })
+
+	var mandatory []string
+	cb := UpdaterCallbacks{
+		UpdateAvailable: func(string, string) error {
+			t.Error("mandatory update notified as a regular one")
+			return nil
+		},
+		UpdateMandatory: func(ver, message string) error {
+			mandatory = append(mandatory, ver+": "+message)
+			return nil
+		},
+		UpdatePending: func(string) error {
+			t.Error("mandatory update notification was backed off")
+			return nil
+		},
+	}
+	checkForUpdate(context.Background(), false, cb)
+	require.True(t, saved.Mandatory)
+	found := saved.Found
+
+	// Dismissals are ignored, and every check notifies again
+	store.SetUpdateNotice(store.UpdateNotice{Version: "v0.1.30", LastNotified: time.Now()})
+	UpdateDeclined()
+	UpdateDeclined()
+	assert.Equal(t, 0, store.GetUpdateNotice().Declines)
+	checkForUpdate(context.Background(), false, cb)
+	assert.Equal(t, []string{"v0.1.30: Fixes CVE-0000-0000", "v0.1.30: Fixes CVE-0000-0000"}, mandatory)
+	assert.Equal(t, found, saved.Found, "the grace period starts when the update is first found")
+}
+
+func TestUnsignedMandatoryUpdate(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	setupTestKey(t)
+	t.Setenv("OLLAMA_UPDATE_PUBLIC_KEY", "")
+	setUpdatesDisabled(t, false)
+	stubPinnedVersion(t, "")
+	stubNotifiers(t, nil)
+	stubUpdateMode(t, true, false)
+	stubInstallLocation(t, fakeInstallLocation{writable: true})
+	saved := stubAvailableUpdate(t)
+	UpdateStageDir = t.TempDir()
+	payload := []byte("installer payload")
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/api/update", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"url":"%s/download/v0.1.30/OllamaSetup.exe","sha256":"%s","mandatory":true,"mandatory_message":"Fixes CVE-0000-0000"}`, ts.URL, sha256Hex(payload))
+	})
+	mux.HandleFunc("/download/v0.1.30/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload) //nolint:errcheck
+	})
+	UpdateCheckURLBase = ts.URL + "/api/update"
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+
+	origNotice := store.GetUpdateNotice()
+	t.Cleanup(func() { store.SetUpdateNotice(origNotice) })
+	store.SetUpdateNotice(store.UpdateNotice{})
+
+	var available []string
+	installs := 0
+	cb := UpdaterCallbacks{
+		UpdateAvailable: func(ver, description string) error {
+			available = append(available, ver+": "+description)
+			return nil
+		},
+		UpdateMandatory: func(string, string) error {
+			t.Error("unsigned update notified as mandatory")
+			return nil
+		},
+		UpdatePending: func(string) error { return nil },
+		Install: func() error {
+			installs++
+			return nil
+		},
+	}
+	checkForUpdate(context.Background(), false, cb)
+	assert.True(t, IsUpdateDownloaded())
+	assert.False(t, mandatoryInstallPending.Load(), "no install is scheduled")
+	assert.Zero(t, installs)
+	assert.False(t, saved.Mandatory)
+	assert.Equal(t, []string{"v0.1.30: Fixes CVE-0000-0000"}, available, "labeled with the mandatory message")
+}
@@ -0,0 +1,216 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Name of the manifest staged alongside the files of a multi-file update.
+// It is written last, so its presence marks a complete download.
+const stagedManifestName = "manifest.json"
+
+// How many files of a multi-file update download at once, overridden by
+// OLLAMA_UPDATE_DOWNLOAD_WORKERS
+var UpdateDownloadWorkers = 3
+
+// UpdateManifest lists the files of a multi-file update package
+type UpdateManifest struct {
+	Version string `json:"version"`
+	// Installer is the Name of the file DoUpgrade runs to apply the update
+	Installer string         `json:"installer"`
+	Files     []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	// Name is the slash separated path of the file within the package
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+func (m UpdateManifest) validate() error {
+	if len(m.Files) == 0 {
+		return fmt.Errorf("manifest has no files")
+	}
+	installerFound := false
+	for _, f := range m.Files {
+		if !filepath.IsLocal(filepath.FromSlash(f.Name)) {
+			return fmt.Errorf("manifest file %q is not a local path", f.Name)
+		}
+		if f.URL == "" || f.SHA256 == "" {
+			return fmt.Errorf("manifest file %q requires a url and checksum", f.Name)
+		}
+		if f.Name == m.Installer {
+			installerFound = true
+		}
+	}
+	if !installerFound {
+		return fmt.Errorf("manifest installer %q is not one of its files", m.Installer)
+	}
+	return nil
+}
+
+func fetchManifest(ctx context.Context, manifestURL string) (UpdateManifest, error) {
+	var manifest UpdateManifest
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return manifest, err
+	}
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return manifest, fmt.Errorf("error fetching update manifest: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return manifest, fmt.Errorf("unexpected status fetching update manifest %d", resp.StatusCode)
+	}
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read manifest response: %w", err)
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return manifest, fmt.Errorf("malformed update manifest: %w", err)
+	}
+	return manifest, manifest.validate()
+}
+
+func downloadManifestRelease(ctx context.Context, updateResp UpdateResponse) error {
+	manifest, err := fetchManifest(ctx, updateResp.ManifestURL)
+	if err != nil {
+		return err
+	}
+	if manifest.Version == "" {
+		manifest.Version = updateResp.UpdateVersion
+	}
+
+	dirName := "_"
+	if manifest.Version != "" {
+		dirName = url.PathEscape(manifest.Version)
+	}
+	stageDir := filepath.Join(UpdateStageDir, dirName)
+
+	if _, err := verifyStagedManifest(stageDir); err == nil {
+		slog.Info("update already downloaded")
+		SetUpdateDownloaded(true)
+		return nil
+	}
+
+	cleanupOldDownloads()
+
+	if err := downloadManifestFiles(ctx, stageDir, manifest.Files); err != nil {
+		cleanupOldDownloads()
+		return err
+	}
+
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(stageDir, stagedManifestName), payload, 0o644); err != nil {
+		return fmt.Errorf("write update manifest: %w", err)
+	}
+	slog.Info(fmt.Sprintf("new update downloaded to %s (%d files)", stageDir, len(manifest.Files)))
+
+	SetUpdateDownloaded(true)
+	return nil
+}
+
+// downloadManifestFiles fetches files into stageDir, up to
+// UpdateDownloadWorkers at a time. The first failure stops the rest, and
+// the errors of every file that failed are returned.
+func downloadManifestFiles(ctx context.Context, stageDir string, files []ManifestFile) error {
+	workers := envInt("OLLAMA_UPDATE_DOWNLOAD_WORKERS", UpdateDownloadWorkers)
+	if workers < 1 {
+		workers = 1
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+
+	var mu sync.Mutex
+	var errs []error
+	for _, f := range files {
+		f := f
+		g.Go(func() error {
+			fileURL, err := applyUpdateMirror(f.URL, f.SHA256)
+			if err == nil {
+				err = checkTrustedHost(fileURL)
+			}
+			if err == nil {
+				dest := filepath.Join(stageDir, filepath.FromSlash(f.Name))
+				if _, err = downloadFile(gctx, fileURL, dest, f.SHA256, ""); err == nil {
+					slog.Debug("downloaded update file " + dest)
+					return nil
+				}
+			}
+			// Files stopped because another failed aren't worth reporting
+			if !errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				err = fmt.Errorf("failed to download %s: %w", f.Name, err)
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		if len(errs) == 0 {
+			return err
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// findStagedManifest returns the directory of a staged multi-file update, if any
+func findStagedManifest() (string, error) {
+	files, err := filepath.Glob(filepath.Join(UpdateStageDir, "*", stagedManifestName))
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", os.ErrNotExist
+	}
+	return filepath.Dir(files[0]), nil
+}
+
+func readStagedManifest(stageDir string) (UpdateManifest, error) {
+	var manifest UpdateManifest
+	payload, err := os.ReadFile(filepath.Join(stageDir, stagedManifestName))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(payload, &manifest); err != nil {
+		return manifest, fmt.Errorf("malformed staged manifest: %w", err)
+	}
+	return manifest, manifest.validate()
+}
+
+// verifyStagedManifest checks every staged file against the manifest checksums
+func verifyStagedManifest(stageDir string) (UpdateManifest, error) {
+	manifest, err := readStagedManifest(stageDir)
+	if err != nil {
+		return manifest, err
+	}
+	for _, f := range manifest.Files {
+		sum, err := fileSHA256(filepath.Join(stageDir, filepath.FromSlash(f.Name)))
+		if err != nil {
+			return manifest, err
+		}
+		if !strings.EqualFold(sum, f.SHA256) {
+			return manifest, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", f.Name, f.SHA256, sum)
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,172 @@
+package lifecycle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func newManifestServer(t *testing.T, files map[string][]byte, manifest func(base string) UpdateManifest) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(manifest(ts.URL)) //nolint:errcheck
+	})
+	for name, data := range files {
+		data := data
+		mux.HandleFunc("/files/"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data) //nolint:errcheck
+		})
+	}
+	return ts
+}
+
+func TestDownloadManifestRelease(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	files := map[string][]byte{
+		"OllamaSetup.exe": []byte("installer"),
+		"lib/runner.dll":  []byte("library"),
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		SetUpdateDownloaded(false)
+		ts := newManifestServer(t, files, func(base string) UpdateManifest {
+			m := UpdateManifest{Version: "0.1.30", Installer: "OllamaSetup.exe"}
+			for name, data := range files {
+				m.Files = append(m.Files, ManifestFile{Name: name, URL: base + "/files/" + name, SHA256: sha256Hex(data)})
+			}
+			return m
+		})
+
+		err := DownloadNewRelease(context.Background(), UpdateResponse{ManifestURL: ts.URL + "/manifest.json"})
+		require.NoError(t, err)
+		assert.True(t, IsUpdateDownloaded())
+		for name, data := range files {
+			staged, err := os.ReadFile(filepath.Join(UpdateStageDir, "0.1.30", filepath.FromSlash(name)))
+			require.NoError(t, err)
+			assert.Equal(t, data, staged)
+		}
+
+		staged, ok := VerifyStagedUpdate()
+		assert.True(t, ok)
+		assert.Equal(t, "0.1.30", staged.Version)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		SetUpdateDownloaded(false)
+		ts := newManifestServer(t, files, func(base string) UpdateManifest {
+			return UpdateManifest{Version: "0.1.30", Installer: "OllamaSetup.exe", Files: []ManifestFile{
+				{Name: "OllamaSetup.exe", URL: base + "/files/OllamaSetup.exe", SHA256: sha256Hex([]byte("something else"))},
+			}}
+		})
+
+		err := DownloadNewRelease(context.Background(), UpdateResponse{ManifestURL: ts.URL + "/manifest.json"})
+		assert.ErrorContains(t, err, "checksum mismatch")
+		assert.False(t, IsUpdateDownloaded())
+		_, err = findStagedManifest()
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("path traversal", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		ts := newManifestServer(t, files, func(base string) UpdateManifest {
+			return UpdateManifest{Version: "0.1.30", Installer: "../evil.exe", Files: []ManifestFile{
+				{Name: "../evil.exe", URL: base + "/files/OllamaSetup.exe", SHA256: sha256Hex(files["OllamaSetup.exe"])},
+			}}
+		})
+
+		err := DownloadNewRelease(context.Background(), UpdateResponse{ManifestURL: ts.URL + "/manifest.json"})
+		assert.ErrorContains(t, err, "not a local path")
+	})
+}
+
+func TestDownloadManifestFilesConcurrently(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	t.Setenv("OLLAMA_UPDATE_DOWNLOAD_WORKERS", "2")
+
+	var mu sync.Mutex
+	active, peak := 0, 0
+	release := make(chan struct{})
+	started := make(chan struct{}, 6)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	var files []ManifestFile
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("lib/file%d.dll", i)
+		data := []byte("payload " + name)
+		files = append(files, ManifestFile{Name: name, URL: ts.URL + "/" + name, SHA256: sha256Hex(data)})
+		mux.HandleFunc("/"+name, func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			active++
+			if active > peak {
+				peak = active
+			}
+			mu.Unlock()
+			started <- struct{}{}
+			<-release
+			mu.Lock()
+			active--
+			mu.Unlock()
+			w.Write(data) //nolint:errcheck
+		})
+	}
+	go func() {
+		// Let the workers pile up before letting any finish
+		<-started
+		<-started
+		close(release)
+	}()
+
+	stageDir := t.TempDir()
+	require.NoError(t, downloadManifestFiles(context.Background(), stageDir, files))
+	assert.Equal(t, 2, peak, "should download up to the worker count at once")
+	for _, f := range files {
+		b, err := os.ReadFile(filepath.Join(stageDir, filepath.FromSlash(f.Name)))
+		require.NoError(t, err)
+		assert.Equal(t, f.SHA256, sha256Hex(b))
+	}
+}
+
+func TestDownloadManifestFilesFailure(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/good", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("good")) //nolint:errcheck
+	})
+	mux.HandleFunc("/bad", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered")) //nolint:errcheck
+	})
+
+	files := []ManifestFile{
+		{Name: "a.dll", URL: ts.URL + "/good", SHA256: sha256Hex([]byte("good"))},
+		{Name: "b.dll", URL: ts.URL + "/bad", SHA256: sha256Hex([]byte("bad"))},
+	}
+	err := downloadManifestFiles(context.Background(), t.TempDir(), files)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to download b.dll")
+	assert.Contains(t, err.Error(), "checksum mismatch")
+	assert.NotErrorIs(t, err, context.Canceled)
+}
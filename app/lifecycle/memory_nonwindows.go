@@ -0,0 +1,41 @@
+//go:build !windows
+
+package lifecycle
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// freeMemory reads MemAvailable from /proc/meminfo, so is only supported on
+// Linux
+func freeMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kb, ok := strings.CutPrefix(scanner.Text(), "MemAvailable:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(kb)
+		if len(fields) == 0 {
+			return 0, fmt.Errorf("malformed MemAvailable %q", kb)
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed MemAvailable %q", kb)
+		}
+		return n << 10, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemAvailable not found in /proc/meminfo")
+}
@@ -0,0 +1,29 @@
+package lifecycle
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+var pGlobalMemoryStatusEx = k32.NewProc("GlobalMemoryStatusEx")
+
+// https://learn.microsoft.com/en-us/windows/win32/api/sysinfoapi/ns-sysinfoapi-memorystatusex
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+func freeMemory() (uint64, error) {
+	status := memoryStatusEx{length: uint32(unsafe.Sizeof(memoryStatusEx{}))}
+	if res, _, err := pGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); res == 0 {
+		return 0, fmt.Errorf("GlobalMemoryStatusEx failed: %w", err)
+	}
+	return status.availPhys, nil
+}
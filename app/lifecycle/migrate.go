@@ -0,0 +1,160 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Older releases staged the installer as UpdateStageDir/<etag>/<filename>,
+// using the etag and filename exactly as the server sent them and without
+// metadata. An etag such as W/"abc" even nests the installer a level deeper.
+// Those installers can't be verified, so they're migrated at startup.
+
+// MigrateStageDir moves installers staged by an older release to the
+// current layout. An installer without metadata is kept only when it
+// matches the checksum of the remembered available update, which supplies
+// its metadata. Anything else that can't be verified is discarded.
+func MigrateStageDir() {
+	entries, err := os.ReadDir(UpdateStageDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		slog.Warn(fmt.Sprintf("failed to list stage dir: %s", err))
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == retainedDirName {
+			continue
+		}
+		dir := filepath.Join(UpdateStageDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, stagedManifestName)); err == nil {
+			continue
+		}
+		for _, installer := range legacyInstallers(dir) {
+			migrateStagedInstaller(installer)
+		}
+	}
+}
+
+// legacyInstallers returns the installers under dir that aren't staged the
+// way this release stages them, discarding interrupted downloads alongside
+// them, which can't be resumed once moved
+func legacyInstallers(dir string) []string {
+	var installers, partials []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(UpdateStageDir, path)
+		if err != nil {
+			return err
+		}
+		// A slash in the etag nests one level, nothing was staged deeper
+		if d.IsDir() && strings.Count(rel, string(filepath.Separator)) >= 2 {
+			return filepath.SkipDir
+		}
+		switch {
+		case !d.Type().IsRegular():
+		case strings.HasSuffix(path, ".part"):
+			partials = append(partials, path)
+		case filepath.Ext(path) != filepath.Ext(Installer):
+		case !currentStageLayout(rel):
+			installers = append(installers, path)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("failed to list staged files in %s: %s", dir, err))
+		return nil
+	}
+	for _, partial := range partials {
+		if rel, _ := filepath.Rel(UpdateStageDir, partial); !currentStageLayout(strings.TrimSuffix(rel, ".part")) {
+			slog.Info(fmt.Sprintf("discarding interrupted download %s staged by an older release", partial))
+			os.Remove(partial)
+		}
+	}
+	return installers
+}
+
+// currentStageLayout reports whether rel, relative to UpdateStageDir, is an
+// installer staged the way this release stages them
+func currentStageLayout(rel string) bool {
+	dir, name := filepath.Split(rel)
+	dir = filepath.Clean(dir)
+	if strings.ContainsRune(dir, filepath.Separator) || dir != sanitizeStageName(dir) || name != sanitizeStageName(name) {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(UpdateStageDir, rel) + stagedMetadataSuffix)
+	return err == nil
+}
+
+// migrateStagedInstaller moves installer to the current layout, writing its
+// metadata, or discards it when it can't be verified
+func migrateStagedInstaller(installer string) {
+	staged, err := legacyStagedUpdate(installer)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("discarding %s staged by an older release: %s", installer, err))
+		removeLegacyInstaller(installer)
+		return
+	}
+	rel, err := filepath.Rel(UpdateStageDir, filepath.Dir(installer))
+	if err != nil {
+		slog.Warn(fmt.Sprintf("discarding %s staged by an older release: %s", installer, err))
+		removeLegacyInstaller(installer)
+		return
+	}
+	dest := filepath.Join(UpdateStageDir, stageDirName(filepath.ToSlash(rel), staged.URL), stageFileName(filepath.Base(installer), staged.URL))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		slog.Warn(fmt.Sprintf("failed to migrate staged update %s: %s", installer, err))
+		return
+	}
+	if err := os.Rename(installer, dest); err != nil {
+		slog.Warn(fmt.Sprintf("failed to migrate staged update %s: %s", installer, err))
+		return
+	}
+	if err := writeStagedMetadata(dest, staged); err != nil {
+		slog.Warn(fmt.Sprintf("failed to write metadata for migrated update %s: %s", dest, err))
+		removeLegacyInstaller(dest)
+		return
+	}
+	if dest != installer {
+		removeLegacyInstaller(installer)
+	}
+	slog.Info(fmt.Sprintf("migrated staged update %s to %s", installer, dest))
+}
+
+// legacyStagedUpdate verifies installer against its metadata, if it has
+// any, or else against the remembered available update
+func legacyStagedUpdate(installer string) (StagedUpdate, error) {
+	if _, err := readStagedMetadata(installer); err == nil {
+		return verifyStagedInstaller(installer)
+	}
+	available := availableUpdateSetting()
+	if available.Version == "" || available.Checksum == "" {
+		return StagedUpdate{}, fmt.Errorf("no metadata to verify it with")
+	}
+	sum, err := fileSHA256(installer)
+	if err != nil {
+		return StagedUpdate{}, err
+	}
+	if !strings.EqualFold(sum, available.Checksum) {
+		return StagedUpdate{}, fmt.Errorf("it doesn't match the checksum of update %s", available.Version)
+	}
+	return StagedUpdate{Version: available.Version, URL: available.URL, SHA256: sum}, nil
+}
+
+// removeLegacyInstaller removes installer and its metadata, along with any
+// directories left empty under UpdateStageDir
+func removeLegacyInstaller(installer string) {
+	os.Remove(installer)
+	os.Remove(installer + stagedMetadataSuffix)
+	for dir := filepath.Dir(installer); dir != UpdateStageDir && strings.HasPrefix(dir, UpdateStageDir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
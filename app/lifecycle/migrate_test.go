@@ -0,0 +1,90 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLegacyInstaller(t *testing.T, rel, contents string) string {
+	t.Helper()
+	installer := filepath.Join(UpdateStageDir, rel)
+	require.NoError(t, os.MkdirAll(filepath.Dir(installer), 0o755))
+	require.NoError(t, os.WriteFile(installer, []byte(contents), 0o755))
+	return installer
+}
+
+func TestMigrateStageDir(t *testing.T) {
+	t.Run("legacy layout", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		available := stubAvailableUpdate(t)
+		legacy := writeLegacyInstaller(t, filepath.Join("W", `"abc`, Installer), "installer")
+		sum, err := fileSHA256(legacy)
+		require.NoError(t, err)
+		*available = store.AvailableUpdate{Version: "0.1.2", URL: "https://ollama.com/download/OllamaSetup.exe", Checksum: sum}
+
+		MigrateStageDir()
+
+		installer, err := findStagedInstaller()
+		require.NoError(t, err)
+		staged, err := verifyStagedInstaller(installer)
+		require.NoError(t, err)
+		assert.Equal(t, "0.1.2", staged.Version)
+		assert.Equal(t, available.URL, staged.URL)
+		assert.Equal(t, "W__abc", filepath.Base(filepath.Dir(installer)))
+		_, err = os.Stat(filepath.Join(UpdateStageDir, "W"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		restored, ok := VerifyStagedUpdate()
+		assert.True(t, ok)
+		assert.Equal(t, "0.1.2", restored.Version)
+	})
+
+	t.Run("unsafe name with metadata", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		stubAvailableUpdate(t)
+		legacy := writeLegacyInstaller(t, filepath.Join("abc", "Ollama Setup.exe"), "installer")
+		sum, err := fileSHA256(legacy)
+		require.NoError(t, err)
+		require.NoError(t, writeStagedMetadata(legacy, StagedUpdate{Version: "0.1.2", SHA256: sum}))
+
+		MigrateStageDir()
+
+		installer, err := findStagedInstaller()
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(UpdateStageDir, "abc", stageFileName("Ollama Setup.exe", "")), installer)
+		_, err = verifyStagedInstaller(installer)
+		assert.NoError(t, err)
+		assert.NoFileExists(t, legacy+stagedMetadataSuffix)
+	})
+
+	t.Run("unverifiable", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		available := stubAvailableUpdate(t)
+		*available = store.AvailableUpdate{Version: "0.1.2", Checksum: "0000"}
+		legacy := writeLegacyInstaller(t, filepath.Join("abc", Installer), "installer")
+		partial := writeLegacyInstaller(t, filepath.Join("def", Installer+".part"), "inst")
+
+		MigrateStageDir()
+
+		assert.NoFileExists(t, legacy)
+		assert.NoFileExists(t, partial)
+		_, err := findStagedInstaller()
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("current layout untouched", func(t *testing.T) {
+		stubAvailableUpdate(t)
+		installer := stageTestInstaller(t, "installer")
+		retainTestUpdates(t, "0.1.1")
+
+		MigrateStageDir()
+
+		assert.FileExists(t, installer)
+		assert.Equal(t, []string{"0.1.1"}, retainedNames(t))
+	})
+}
@@ -0,0 +1,46 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var errMirrorNeedsChecksum = errors.New("refusing to download from the update mirror without a checksum")
+
+// applyUpdateMirror rewrites the scheme and host of rawURL to those of
+// OLLAMA_UPDATE_MIRROR, or the test server, if set, preserving the path and
+// query. The mirror isn't trusted, so it's only used for files with a
+// checksum from the update server, which is what the mirror's copy is
+// checked against. Manifests aren't mirrored, since they supply those
+// checksums.
+func applyUpdateMirror(rawURL, checksum string) (string, error) {
+	mirror := os.Getenv("OLLAMA_UPDATE_MIRROR")
+	if u, ok := updateTestServer(); ok {
+		mirror = u.String()
+	} else if mirror != "" && rawURL != "" && checksum == "" {
+		return "", errMirrorNeedsChecksum
+	}
+	if mirror == "" || rawURL == "" {
+		return rawURL, nil
+	}
+	if !strings.Contains(mirror, "://") {
+		mirror = "https://" + mirror
+	}
+	mirrorURL, err := url.Parse(mirror)
+	if err != nil || mirrorURL.Host == "" {
+		return "", fmt.Errorf("invalid OLLAMA_UPDATE_MIRROR %q", mirror)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = mirrorURL.Scheme
+	u.Host = mirrorURL.Host
+	slog.Debug(fmt.Sprintf("using update mirror %s", u))
+	return u.String(), nil
+}
@@ -0,0 +1,68 @@
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyUpdateMirror(t *testing.T) {
+	const updateURL = "https://ollama.com/download/v0.1.30/OllamaSetup.exe?ts=123&sig=a%2Fb"
+
+	cases := map[string]struct {
+		mirror string
+		expect string
+	}{
+		"unset":       {"", updateURL},
+		"host only":   {"mirror.example.com", "https://mirror.example.com/download/v0.1.30/OllamaSetup.exe?ts=123&sig=a%2Fb"},
+		"with scheme": {"http://mirror.example.com:8080", "http://mirror.example.com:8080/download/v0.1.30/OllamaSetup.exe?ts=123&sig=a%2Fb"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("OLLAMA_UPDATE_MIRROR", tc.mirror)
+			got, err := applyUpdateMirror(updateURL, "abc")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, got)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("OLLAMA_UPDATE_MIRROR", "https://")
+		_, err := applyUpdateMirror(updateURL, "abc")
+		assert.Error(t, err)
+	})
+
+	t.Run("no checksum", func(t *testing.T) {
+		t.Setenv("OLLAMA_UPDATE_MIRROR", "mirror.example.com")
+		_, err := applyUpdateMirror(updateURL, "")
+		assert.ErrorIs(t, err, errMirrorNeedsChecksum)
+	})
+}
+
+func TestUntrustedMirror(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+	t.Setenv("OLLAMA_UPDATE_TRUSTED_HOSTS", "")
+	UpdateStageDir = t.TempDir()
+	genuine := []byte("installer payload")
+	mirror := newRangeServer(t, []byte("tampered payload"), true)
+	t.Setenv("OLLAMA_UPDATE_MIRROR", mirror.URL)
+
+	resp := UpdateResponse{UpdateURL: "https://ollama.com/download/v0.1.30/OllamaSetup.exe", Checksum: sha256Hex(genuine)}
+	err := DownloadNewRelease(context.Background(), resp)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	_, err = findStagedInstaller()
+	assert.ErrorIs(t, err, os.ErrNotExist, "the mirror's copy is never staged")
+
+	mirror.ranges = nil
+	resp.Checksum = ""
+	assert.ErrorIs(t, DownloadNewRelease(context.Background(), resp), errMirrorNeedsChecksum)
+	assert.Empty(t, mirror.ranges, "nothing is downloaded from the mirror")
+
+	// The manifest, which supplies the checksums, isn't taken from the mirror
+	resp.ManifestURL = "https://untrusted.example.com/manifest.json"
+	assert.ErrorContains(t, DownloadNewRelease(context.Background(), resp), "untrusted.example.com")
+	assert.Empty(t, mirror.ranges)
+}
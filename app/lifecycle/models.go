@@ -0,0 +1,50 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/app/store"
+)
+
+// How long listing models for the tray menu waits on the server, which the
+// tray does in the background
+var ListModelsTimeout = 2 * time.Second
+
+// ListModels returns the locally available models and the active one
+func ListModels() ([]string, string) {
+	active := store.GetActiveModel()
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to list models: %s", err))
+		return nil, active
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ListModelsTimeout)
+	defer cancel()
+	resp, err := client.List(ctx)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to list models: %s", err))
+		return nil, active
+	}
+	models := make([]string, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		models = append(models, m.Name)
+	}
+	return models, active
+}
+
+// SetActiveModel records the model picked in the tray and loads it so the
+// first request doesn't wait on it
+func SetActiveModel(ctx context.Context, model string) error {
+	store.SetActiveModel(model)
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+	slog.Info("loading active model " + model)
+	// A request without a prompt just loads the model
+	return client.Generate(ctx, &api.GenerateRequest{Model: model}, func(api.GenerateResponse) error { return nil })
+}
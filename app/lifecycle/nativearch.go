@@ -0,0 +1,30 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Under emulation, such as x64 builds on Windows ARM or Rosetta on Apple
+// Silicon, runtime.GOARCH is the arch the app was built for rather than the
+// one the machine runs best. The native arch is reported separately so the
+// update service can offer the better build.
+
+type nativeArchDetector interface {
+	// NativeArch returns the machine's arch, named as in GOARCH
+	NativeArch() (string, error)
+}
+
+// overridden in tests
+var systemNativeArch nativeArchDetector = platformNativeArch{}
+
+// nativeArch returns the machine's arch, or UpdateArch if it can't be
+// determined
+func nativeArch(detector nativeArchDetector) string {
+	arch, err := detector.NativeArch()
+	if err != nil || arch == "" {
+		slog.Debug(fmt.Sprintf("unable to detect native arch, assuming %s: %v", UpdateArch, err))
+		return UpdateArch
+	}
+	return arch
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package lifecycle
+
+import "fmt"
+
+type platformNativeArch struct{}
+
+func (platformNativeArch) NativeArch() (string, error) {
+	return "", fmt.Errorf("native arch detection not implemented")
+}
@@ -0,0 +1,47 @@
+package lifecycle
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNativeArch struct {
+	arch string
+	err  error
+}
+
+func (f fakeNativeArch) NativeArch() (string, error) {
+	return f.arch, f.err
+}
+
+func TestNativeArch(t *testing.T) {
+	origArch := UpdateArch
+	t.Cleanup(func() { UpdateArch = origArch })
+	UpdateArch = "amd64"
+
+	assert.Equal(t, "arm64", nativeArch(fakeNativeArch{arch: "arm64"}))
+	assert.Equal(t, "amd64", nativeArch(fakeNativeArch{err: errors.New("boom")}), "should fall back to the build arch")
+}
+
+func TestGetUpdateCheckURLNativeArch(t *testing.T) {
+	origArch, origDetector := UpdateArch, systemNativeArch
+	t.Cleanup(func() { UpdateArch, systemNativeArch = origArch, origDetector })
+	UpdateCheckURLBase = "https://ollama.com/api/update"
+
+	// An x64 build emulated on Windows ARM
+	UpdateArch = "amd64"
+	systemNativeArch = fakeNativeArch{arch: "arm64"}
+	u, err := GetUpdateCheckURL(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, "amd64", u.Query().Get("arch"))
+	assert.Equal(t, "arm64", u.Query().Get("native_arch"))
+
+	systemNativeArch = fakeNativeArch{err: errors.New("IsWow64Process2 not found")}
+	u, err = GetUpdateCheckURL(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, "amd64", u.Query().Get("native_arch"))
+}
@@ -0,0 +1,30 @@
+package lifecycle
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/sysinfo/image-file-machine-constants
+var imageFileMachineArch = map[uint16]string{
+	0x014c: "386",
+	0x01c4: "arm",
+	0x8664: "amd64",
+	0xaa64: "arm64",
+}
+
+type platformNativeArch struct{}
+
+func (platformNativeArch) NativeArch() (string, error) {
+	// Available from Windows 10 1709, older releases don't run on ARM anyway
+	var processMachine, nativeMachine uint16
+	if err := windows.IsWow64Process2(windows.CurrentProcess(), &processMachine, &nativeMachine); err != nil {
+		return "", err
+	}
+	arch, ok := imageFileMachineArch[nativeMachine]
+	if !ok {
+		return "", fmt.Errorf("unknown machine type 0x%x", nativeMachine)
+	}
+	return arch, nil
+}
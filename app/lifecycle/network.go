@@ -0,0 +1,38 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// NetworkCost describes whether the current connection is billed by use
+type NetworkCost int
+
+const (
+	NetworkCostUnknown NetworkCost = iota
+	NetworkUnmetered
+	NetworkMetered
+)
+
+type networkCoster interface {
+	NetworkCost() (NetworkCost, error)
+}
+
+// overridden in tests
+var systemNetwork networkCoster = platformNetwork{}
+
+// shouldDeferOnMetered reports whether the connection is metered, such as a
+// mobile hotspot. Setting OLLAMA_UPDATE_ALLOW_METERED downloads anyway, and
+// unknown costs never defer.
+func shouldDeferOnMetered(n networkCoster) bool {
+	if os.Getenv("OLLAMA_UPDATE_ALLOW_METERED") != "" {
+		return false
+	}
+	cost, err := n.NetworkCost()
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to determine network cost: %s", err))
+		return false
+	}
+	return cost == NetworkMetered
+}
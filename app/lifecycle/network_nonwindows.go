@@ -0,0 +1,9 @@
+//go:build !windows
+
+package lifecycle
+
+type platformNetwork struct{}
+
+func (platformNetwork) NetworkCost() (NetworkCost, error) {
+	return NetworkCostUnknown, nil
+}
@@ -0,0 +1,120 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNetwork struct {
+	mu    sync.Mutex
+	costs []NetworkCost
+	err   error
+}
+
+// NetworkCost returns each cost in turn, repeating the last one
+func (f *fakeNetwork) NetworkCost() (NetworkCost, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.costs[0]
+	if len(f.costs) > 1 {
+		f.costs = f.costs[1:]
+	}
+	return c, f.err
+}
+
+func stubNetwork(t *testing.T, n networkCoster) {
+	t.Helper()
+	orig := systemNetwork
+	t.Cleanup(func() { systemNetwork = orig })
+	systemNetwork = n
+}
+
+func TestShouldDeferOnMetered(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_ALLOW_METERED", "")
+	cases := []struct {
+		name   string
+		cost   NetworkCost
+		err    error
+		expect bool
+	}{
+		{"unmetered", NetworkUnmetered, nil, false},
+		{"metered", NetworkMetered, nil, true},
+		{"unknown", NetworkCostUnknown, nil, false},
+		{"query failed", NetworkMetered, errors.New("boom"), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := &fakeNetwork{costs: []NetworkCost{tc.cost}, err: tc.err}
+			assert.Equal(t, tc.expect, shouldDeferOnMetered(n))
+		})
+	}
+
+	t.Run("overridden", func(t *testing.T) {
+		t.Setenv("OLLAMA_UPDATE_ALLOW_METERED", "1")
+		assert.False(t, shouldDeferOnMetered(&fakeNetwork{costs: []NetworkCost{NetworkMetered}}))
+	})
+}
+
+func TestCheckForUpdateDefersOnMetered(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	setupTestKey(t)
+	setUpdatesDisabled(t, false)
+	stubPinnedVersion(t, "")
+	stubNotifiers(t, nil)
+	stubAvailableUpdate(t)
+	stubUpdateMode(t, true, false)
+	stubNetwork(t, &fakeNetwork{costs: []NetworkCost{NetworkMetered}})
+	t.Setenv("OLLAMA_UPDATE_ALLOW_METERED", "")
+	UpdateStageDir = t.TempDir()
+	var downloads atomic.Int32
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/api/update", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"url":"%s/download/v0.1.30/OllamaSetup.exe"}`, ts.URL)
+	})
+	mux.HandleFunc("/download/v0.1.30/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		http.NotFound(w, r)
+	})
+	UpdateCheckURLBase = ts.URL + "/api/update"
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+
+	var pending []string
+	cb := UpdaterCallbacks{
+		UpdateAvailable: func(string, string) error {
+			t.Error("notified about an update that wasn't downloaded")
+			return nil
+		},
+		UpdatePending: func(ver string) error {
+			pending = append(pending, ver)
+			return nil
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		checkForUpdate(context.Background(), false, cb)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the check waited for an unmetered connection")
+	}
+	assert.Zero(t, downloads.Load(), "the download waits for the next check")
+	assert.Equal(t, []string{"v0.1.30"}, pending, "shown in the menu meanwhile")
+
+	checkForUpdate(context.Background(), true, cb)
+	assert.NotZero(t, downloads.Load(), "checking from the menu downloads anyway")
+}
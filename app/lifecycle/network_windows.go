@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// The connection's cost comes from the Network List Manager, the COM API
+// behind Windows.Networking.Connectivity's NetworkCostType.
+
+var pCoCreateInstance = windows.NewLazySystemDLL("ole32.dll").NewProc("CoCreateInstance")
+
+var (
+	clsidNetworkListManager = windows.GUID{Data1: 0xdcb00c01, Data2: 0x570f, Data3: 0x4a9b, Data4: [8]byte{0x8d, 0x69, 0x19, 0x9f, 0xdb, 0xa5, 0x72, 0x3b}}
+	iidNetworkCostManager   = windows.GUID{Data1: 0xdcb00008, Data2: 0x570f, Data3: 0x4a9b, Data4: [8]byte{0x8d, 0x69, 0x19, 0x9f, 0xdb, 0xa5, 0x72, 0x3b}}
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/api/netlistmgr/ne-netlistmgr-nlm_connection_cost
+const (
+	NLM_CONNECTION_COST_UNRESTRICTED  = 0x1
+	NLM_CONNECTION_COST_FIXED         = 0x2
+	NLM_CONNECTION_COST_VARIABLE      = 0x4
+	NLM_CONNECTION_COST_OVERDATALIMIT = 0x10000
+	NLM_CONNECTION_COST_ROAMING       = 0x40000
+)
+
+// INetworkCostManager, as far as it's used
+type networkCostManager struct {
+	vtbl *struct {
+		QueryInterface, AddRef, Release uintptr
+		GetCost                         uintptr
+	}
+}
+
+// connectionCost maps NLM_CONNECTION_COST flags to a NetworkCost. Data
+// plans that are capped, billed by use or roaming are all metered.
+func connectionCost(flags uint32) NetworkCost {
+	switch {
+	case flags&(NLM_CONNECTION_COST_FIXED|NLM_CONNECTION_COST_VARIABLE|NLM_CONNECTION_COST_OVERDATALIMIT|NLM_CONNECTION_COST_ROAMING) != 0:
+		return NetworkMetered
+	case flags&NLM_CONNECTION_COST_UNRESTRICTED != 0:
+		return NetworkUnmetered
+	}
+	return NetworkCostUnknown
+}
+
+type platformNetwork struct{}
+
+// https://learn.microsoft.com/en-us/windows/win32/api/netlistmgr/nf-netlistmgr-inetworkcostmanager-getcost
+func (platformNetwork) NetworkCost() (NetworkCost, error) {
+	const (
+		CLSCTX_ALL = 0x17
+		S_FALSE    = syscall.Errno(1)
+	)
+	// COM is initialized per thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := windows.CoInitializeEx(0, windows.COINIT_MULTITHREADED); err == nil || err == S_FALSE {
+		defer windows.CoUninitialize()
+	}
+
+	var mgr *networkCostManager
+	hr, _, _ := pCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsidNetworkListManager)),
+		0,
+		CLSCTX_ALL,
+		uintptr(unsafe.Pointer(&iidNetworkCostManager)),
+		uintptr(unsafe.Pointer(&mgr)),
+	)
+	if hr != 0 { // S_OK
+		return NetworkCostUnknown, fmt.Errorf("unable to create network cost manager: 0x%x", hr)
+	}
+	defer syscall.SyscallN(mgr.vtbl.Release, uintptr(unsafe.Pointer(mgr))) //nolint:errcheck
+
+	var flags uint32
+	hr, _, _ = syscall.SyscallN(mgr.vtbl.GetCost, uintptr(unsafe.Pointer(mgr)), uintptr(unsafe.Pointer(&flags)), 0)
+	if hr != 0 {
+		return NetworkCostUnknown, fmt.Errorf("unable to query network cost: 0x%x", hr)
+	}
+	return connectionCost(flags), nil
+}
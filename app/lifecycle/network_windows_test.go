@@ -0,0 +1,16 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionCost(t *testing.T) {
+	assert.Equal(t, NetworkUnmetered, connectionCost(NLM_CONNECTION_COST_UNRESTRICTED))
+	assert.Equal(t, NetworkMetered, connectionCost(NLM_CONNECTION_COST_FIXED))
+	assert.Equal(t, NetworkMetered, connectionCost(NLM_CONNECTION_COST_VARIABLE))
+	assert.Equal(t, NetworkMetered, connectionCost(NLM_CONNECTION_COST_UNRESTRICTED|NLM_CONNECTION_COST_ROAMING))
+	assert.Equal(t, NetworkMetered, connectionCost(NLM_CONNECTION_COST_FIXED|NLM_CONNECTION_COST_OVERDATALIMIT))
+	assert.Equal(t, NetworkCostUnknown, connectionCost(0))
+}
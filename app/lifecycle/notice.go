@@ -0,0 +1,86 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/jmorganca/ollama/version"
+)
+
+// DeclineBackoff is how long to wait before notifying about the same update
+// again, indexed by how many times the notification was dismissed. The last
+// interval repeats.
+var DeclineBackoff = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+func renotifyInterval(declines int) time.Duration {
+	if declines >= len(DeclineBackoff) {
+		declines = len(DeclineBackoff) - 1
+	}
+	return DeclineBackoff[declines]
+}
+
+// shouldNotifyUpdate decides whether ver warrants a notification given the
+// previous notice. A new version always does.
+func shouldNotifyUpdate(notice store.UpdateNotice, ver string, now time.Time) bool {
+	if notice.Version != ver || notice.LastNotified.IsZero() {
+		return true
+	}
+	return now.Sub(notice.LastNotified) >= renotifyInterval(notice.Declines)
+}
+
+// notifyUpdate reports whether to notify about ver now, recording the
+// notification if so
+func notifyUpdate(ver string) bool {
+	notice := store.GetUpdateNotice()
+	now := time.Now()
+	if clockSkewed() {
+		slog.Debug(fmt.Sprintf("clock can't be trusted, notifying about update %s regardless of dismissals", ver))
+	} else if !shouldNotifyUpdate(notice, ver, now) {
+		slog.Debug(fmt.Sprintf("update %s dismissed %d times, not notifying again until %s", ver, notice.Declines,
+			notice.LastNotified.Add(renotifyInterval(notice.Declines)).Format(time.RFC3339)))
+		return false
+	}
+	if notice.Version != ver {
+		notice = store.UpdateNotice{Version: ver}
+	}
+	notice.LastNotified = now
+	store.SetUpdateNotice(notice)
+	return true
+}
+
+// UpdateDeclined records that the user put off the update notification
+func UpdateDeclined() {
+	notice := store.GetUpdateNotice()
+	if notice.Version == "" {
+		return
+	}
+	if available := availableUpdateSetting(); available.Mandatory && available.Version == notice.Version {
+		slog.Debug(fmt.Sprintf("update %s is mandatory, ignoring dismissal", notice.Version))
+		return
+	}
+	notice.Declines++
+	slog.Debug(fmt.Sprintf("update %s notification dismissed %d times", notice.Version, notice.Declines))
+	store.SetUpdateNotice(notice)
+}
+
+// justUpgraded reports whether the app moved to a newer version since it
+// last ran. The first run on record, and roll backs, don't count.
+func justUpgraded(previous, current string) bool {
+	return previous != "" && isOlderVersion(previous, current)
+}
+
+// CheckUpgraded records the running version and reports whether it was just
+// upgraded to
+func CheckUpgraded() bool {
+	previous := store.GetLastRunVersion()
+	store.SetLastRunVersion(version.Version)
+	if justUpgraded(previous, version.Version) {
+		slog.Info(fmt.Sprintf("upgraded from %s to %s", previous, version.Version))
+		recordUpdate(version.Version, "installed")
+		reportUpdateResult(previous, version.Version, "installed")
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+func TestShouldNotifyUpdate(t *testing.T) {
+	now := time.Now()
+	assert.True(t, shouldNotifyUpdate(store.UpdateNotice{}, "v0.1.30", now), "first notification")
+
+	cases := []struct {
+		declines int
+		interval time.Duration
+	}{
+		{0, time.Hour},
+		{1, 6 * time.Hour},
+		{2, 24 * time.Hour},
+		{5, 24 * time.Hour},
+	}
+	for _, tc := range cases {
+		notice := store.UpdateNotice{Version: "v0.1.30", Declines: tc.declines, LastNotified: now}
+		assert.False(t, shouldNotifyUpdate(notice, "v0.1.30", now.Add(tc.interval-time.Minute)), "declines %d", tc.declines)
+		assert.True(t, shouldNotifyUpdate(notice, "v0.1.30", now.Add(tc.interval)), "declines %d", tc.declines)
+		// A new version resets the backoff
+		assert.True(t, shouldNotifyUpdate(notice, "v0.1.31", now), "declines %d", tc.declines)
+	}
+}
+
+func TestJustUpgraded(t *testing.T) {
+	assert.False(t, justUpgraded("", "0.1.30"), "first install")
+	assert.False(t, justUpgraded("0.1.30", "0.1.30"), "same version")
+	assert.True(t, justUpgraded("0.1.29", "0.1.30"))
+	assert.True(t, justUpgraded("0.1.30-rc1", "0.1.30"))
+	assert.False(t, justUpgraded("0.1.30", "0.1.29"), "roll back")
+	assert.False(t, justUpgraded("0.1.29", "0.0.0-dev"), "unparseable versions")
+}
@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+// NotifyLevel is how important a notification is
+type NotifyLevel int
+
+const (
+	NotifyInfo NotifyLevel = iota
+	NotifyWarning
+	NotifyError
+)
+
+func (l NotifyLevel) String() string {
+	switch l {
+	case NotifyInfo:
+		return "info"
+	case NotifyWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// Notifier receives update events, so deployments can route them somewhere
+// other than the tray, like email or chat
+type Notifier interface {
+	Notify(level NotifyLevel, title, body string) error
+}
+
+var (
+	notifiersMu sync.Mutex
+	// Shows update failures, normally the tray, which only logs when
+	// headless. Available updates are shown by the tray itself, with a way
+	// to install them, so they only go to registered notifiers.
+	defaultNotifier Notifier
+	notifiers       []Notifier
+)
+
+// RegisterNotifier adds n to the notifiers told about update events
+func RegisterNotifier(n Notifier) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers = append(notifiers, n)
+}
+
+func setDefaultNotifier(n Notifier) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	defaultNotifier = n
+}
+
+// trayNotifier shows notifications from the tray
+type trayNotifier struct {
+	t commontray.OllamaTray
+}
+
+func (n trayNotifier) Notify(level NotifyLevel, title, body string) error {
+	if level == NotifyError {
+		return n.t.DisplayErrorNotification(title, body)
+	}
+	return n.t.DisplayNotification(title, body)
+}
+
+func sendNotification(withDefault bool, level NotifyLevel, title, body string) {
+	notifiersMu.Lock()
+	targets := append([]Notifier(nil), notifiers...)
+	if withDefault && defaultNotifier != nil {
+		targets = append([]Notifier{defaultNotifier}, targets...)
+	}
+	notifiersMu.Unlock()
+	for _, n := range targets {
+		if err := n.Notify(level, title, body); err != nil {
+			slog.Warn(fmt.Sprintf("failed to send %s notification %q: %s", level, title, err))
+		}
+	}
+}
+
+func notifyUpdateAvailable(ver string) {
+	sendNotification(false, NotifyInfo, "Update available", fmt.Sprintf("Ollama version %s is ready to install", ver))
+}
+
+func notifyUpdateFailed(ver string, err error) {
+	body := fmt.Sprintf("Updating Ollama failed: %s", err)
+	if ver != "" {
+		body = fmt.Sprintf("Updating Ollama to version %s failed: %s", ver, err)
+	}
+	sendNotification(true, NotifyError, "Update failed", body)
+}
+
+func notifyManualInstall(ver string) {
+	sendNotification(true, NotifyWarning, "Install the update yourself",
+		fmt.Sprintf("Ollama can't update itself where it's installed, download and run the installer for version %s", ver))
+}
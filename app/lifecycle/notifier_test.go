@@ -0,0 +1,86 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	events []string
+	err    error
+}
+
+func (r *recordingNotifier) Notify(level NotifyLevel, title, body string) error {
+	r.events = append(r.events, fmt.Sprintf("%s %s: %s", level, title, body))
+	return r.err
+}
+
+// stubNotifiers replaces the default and registered notifiers for a test
+func stubNotifiers(t *testing.T, def Notifier, registered ...Notifier) {
+	t.Helper()
+	notifiersMu.Lock()
+	origDefault, origRegistered := defaultNotifier, notifiers
+	defaultNotifier, notifiers = def, nil
+	notifiersMu.Unlock()
+	t.Cleanup(func() {
+		notifiersMu.Lock()
+		defaultNotifier, notifiers = origDefault, origRegistered
+		notifiersMu.Unlock()
+	})
+	for _, n := range registered {
+		RegisterNotifier(n)
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	def := &recordingNotifier{}
+	custom := &recordingNotifier{}
+	failing := &recordingNotifier{err: errors.New("smtp down")}
+	stubNotifiers(t, def, failing, custom)
+
+	notifyUpdateAvailable("0.1.30")
+	assert.Empty(t, def.events, "the tray shows available updates itself")
+	assert.Equal(t, []string{"info Update available: Ollama version 0.1.30 is ready to install"}, custom.events)
+
+	custom.events = nil
+	notifyUpdateFailed("0.1.30", errors.New("disk full"))
+	want := []string{"error Update failed: Updating Ollama to version 0.1.30 failed: disk full"}
+	assert.Equal(t, want, def.events)
+	assert.Equal(t, want, custom.events, "a failing notifier shouldn't stop the rest")
+}
+
+func TestCheckForUpdateNotifies(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	setupTestKey(t)
+	setUpdatesDisabled(t, false)
+	stubPinnedVersion(t, "")
+	UpdateStageDir = t.TempDir()
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/api/update", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"url":"%s/download/v0.1.30/OllamaSetup.exe"}`, ts.URL)
+	})
+	mux.HandleFunc("/download/v0.1.30/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	UpdateCheckURLBase = ts.URL + "/api/update"
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+
+	custom := &recordingNotifier{}
+	stubNotifiers(t, nil, custom)
+	checkForUpdate(context.Background(), false, UpdaterCallbacks{
+		UpdateAvailable: func(string, string) error { return nil },
+	})
+	assert.Equal(t, []string{
+		"error Update failed: Updating Ollama to version v0.1.30 failed: unexpected status attempting to download update 404",
+	}, custom.events, "a failed download isn't announced as ready")
+}
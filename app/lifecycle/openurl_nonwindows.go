@@ -0,0 +1,13 @@
+//go:build !windows
+
+package lifecycle
+
+import "fmt"
+
+func OpenURL(url string) error {
+	return fmt.Errorf("OpenURL not implemented")
+}
+
+func RevealFile(path string) error {
+	return fmt.Errorf("RevealFile not implemented")
+}
@@ -0,0 +1,28 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+)
+
+// OpenURL opens url in the user's default browser
+func OpenURL(url string) error {
+	slog.Debug(fmt.Sprintf("opening %s", url))
+	// Unlike "cmd /c start", this doesn't need & and friends escaped
+	cmd := exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open %s: %w", url, err)
+	}
+	return cmd.Process.Release()
+}
+
+// RevealFile opens a file explorer window with path selected
+func RevealFile(path string) error {
+	slog.Debug(fmt.Sprintf("revealing %s", path))
+	cmd := exec.Command("explorer", "/select,"+path)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to reveal %s: %w", path, err)
+	}
+	return cmd.Process.Release()
+}
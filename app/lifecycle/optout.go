@@ -0,0 +1,46 @@
+package lifecycle
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+// Updates can be turned off for good on machines that must never update
+// in-app, such as kiosks. Unlike deferring or dismissing an update this
+// persists across restarts, and is either chosen from the tray or
+// provisioned by an admin creating UpdatesDisabledFileName in the install
+// directory.
+
+const UpdatesDisabledFileName = "disable-updates"
+
+var (
+	errUpdatesDisabled = errors.New("updates are disabled on this machine")
+
+	// overridden in tests
+	updatesDisabledFlag = store.GetUpdatesDisabledPermanently
+	updatesDisabledFile = func() string { return filepath.Join(AppDir, UpdatesDisabledFileName) }
+)
+
+// UpdatesDisabled reports whether updates have been permanently disabled,
+// by the user or an admin
+func UpdatesDisabled() bool {
+	if updatesDisabledFlag() {
+		return true
+	}
+	_, err := os.Stat(updatesDisabledFile())
+	return err == nil
+}
+
+// DisableUpdatesPermanently turns off update checks, downloads and installs
+// on this machine, abandoning any download in progress
+func DisableUpdatesPermanently() {
+	slog.Info("permanently disabling updates on this machine")
+	store.SetUpdatesDisabledPermanently(true)
+	CancelDownload()
+	SetUpdateDownloaded(false)
+	cleanupOldDownloadsExcept("")
+}
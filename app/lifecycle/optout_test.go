@@ -0,0 +1,70 @@
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setUpdatesDisabled fakes the stored opt-out, and points the admin file at
+// a temp dir
+func setUpdatesDisabled(t *testing.T, disabled bool) string {
+	t.Helper()
+	origFlag, origFile := updatesDisabledFlag, updatesDisabledFile
+	t.Cleanup(func() { updatesDisabledFlag, updatesDisabledFile = origFlag, origFile })
+	file := filepath.Join(t.TempDir(), UpdatesDisabledFileName)
+	updatesDisabledFlag = func() bool { return disabled }
+	updatesDisabledFile = func() string { return file }
+	return file
+}
+
+func TestUpdatesDisabled(t *testing.T) {
+	file := setUpdatesDisabled(t, false)
+	assert.False(t, UpdatesDisabled())
+
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	assert.True(t, UpdatesDisabled(), "admin file should disable updates")
+
+	setUpdatesDisabled(t, true)
+	assert.True(t, UpdatesDisabled(), "stored flag should disable updates")
+}
+
+func TestUpdatesDisabledEnforced(t *testing.T) {
+	setUpdatesDisabled(t, true)
+	ctx := context.Background()
+
+	err := DownloadNewRelease(ctx, UpdateResponse{UpdateURL: "http://127.0.0.1:0/OllamaSetup.exe"})
+	assert.ErrorIs(t, err, errUpdatesDisabled)
+
+	called := false
+	err = DeferUpgrade(ctx, func() bool { return true }, func() error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, errUpdatesDisabled)
+	assert.False(t, called)
+
+	// Not even the launch check goes ahead
+	stubCheckOnLaunch(t, true)
+	t.Setenv("OLLAMA_UPDATE_STARTUP_DELAY", "1ms")
+	origJitter, origID := UpdateStartupJitter, machineID
+	t.Cleanup(func() { UpdateStartupJitter, machineID = origJitter, origID })
+	UpdateStartupJitter = 0
+	machineID = func() string { return "test" }
+	done := make(chan struct{})
+	go func() {
+		// nil callbacks would panic if a check were attempted
+		runUpdateChecker(ctx, UpdaterCallbacks{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("update checker kept running with updates disabled")
+	}
+}
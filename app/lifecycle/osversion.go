@@ -0,0 +1,37 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+type osVersionDetector interface {
+	// OSVersion returns a dotted version such as "10.0.19045"
+	OSVersion() (string, error)
+}
+
+// overridden in tests
+var systemOSVersion osVersionDetector = platformOSVersion{}
+
+// osSupported reports whether the running OS meets minVersion. If the OS
+// version can't be determined the update is allowed.
+func osSupported(detector osVersionDetector, minVersion string) bool {
+	if minVersion == "" {
+		return true
+	}
+	current, err := detector.OSVersion()
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to detect OS version, skipping minimum version check: %s", err))
+		return true
+	}
+	cmp, ok := compareVersions(current, minVersion)
+	if !ok {
+		slog.Debug(fmt.Sprintf("unable to compare OS version %q with minimum %q", current, minVersion))
+		return true
+	}
+	if cmp < 0 {
+		slog.Warn(fmt.Sprintf("update requires OS version %s or newer, but this system is running %s, skipping update", minVersion, current))
+		return false
+	}
+	return true
+}
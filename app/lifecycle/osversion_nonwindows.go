@@ -0,0 +1,11 @@
+//go:build !windows
+
+package lifecycle
+
+import "fmt"
+
+type platformOSVersion struct{}
+
+func (platformOSVersion) OSVersion() (string, error) {
+	return "", fmt.Errorf("OS version detection not implemented")
+}
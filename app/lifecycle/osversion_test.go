@@ -0,0 +1,49 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOSVersion struct {
+	version string
+	err     error
+}
+
+func (f fakeOSVersion) OSVersion() (string, error) {
+	return f.version, f.err
+}
+
+func TestOSSupported(t *testing.T) {
+	win10 := fakeOSVersion{version: "10.0.17763"}
+	assert.True(t, osSupported(win10, ""))
+	assert.True(t, osSupported(win10, "10.0.17763"))
+	assert.True(t, osSupported(win10, "6.1"))
+	assert.False(t, osSupported(win10, "10.0.19041"))
+	assert.True(t, osSupported(fakeOSVersion{err: errors.New("boom")}, "10.0.19041"), "unknown OS version should not block updates")
+}
+
+func TestIsNewReleaseAvailableMinOSVersion(t *testing.T) {
+	setupTestKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"url":"https://example.com/download/v0.1.30/OllamaSetup.exe","min_os_version":"10.0.19041"}`)) //nolint:errcheck
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+	t.Cleanup(func() { systemOSVersion = platformOSVersion{} })
+
+	systemOSVersion = fakeOSVersion{version: "10.0.22631"}
+	available, resp := IsNewReleaseAvailable(context.Background())
+	assert.True(t, available)
+	assert.Equal(t, "10.0.19041", resp.MinOSVersion)
+
+	systemOSVersion = fakeOSVersion{version: "10.0.17763"}
+	available, _ = IsNewReleaseAvailable(context.Background())
+	assert.False(t, available)
+}
@@ -0,0 +1,14 @@
+package lifecycle
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+type platformOSVersion struct{}
+
+func (platformOSVersion) OSVersion() (string, error) {
+	v := windows.RtlGetVersion()
+	return fmt.Sprintf("%d.%d.%d", v.MajorVersion, v.MinorVersion, v.BuildNumber), nil
+}
@@ -0,0 +1,565 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Proxy auto-config support for the updater. Rather than embedding a full
+// JavaScript engine, FindProxyForURL is interpreted for the subset of the
+// language PAC files typically use: if/else, return, !, && and ||, string
+// comparison, and the host matching helpers below. Scripts using anything
+// else, such as DNS lookups, are rejected and the environment proxy is used.
+
+var (
+	// Fetched at most this often after a failure, so a broken PAC server
+	// doesn't get hit on every request
+	PACRetryInterval = 5 * time.Minute
+	// How long a fetched PAC file is used before it's fetched again, so a
+	// changed script or network is picked up, overridden by
+	// OLLAMA_UPDATE_PAC_REFRESH_INTERVAL
+	PACRefreshInterval = time.Hour
+
+	pacMu       sync.Mutex
+	pacLoaded   *pacScript
+	pacFrom     string
+	pacLoadedAt time.Time
+	pacFailedAt time.Time
+	// closed once the fetch underway is done, nil when there's none
+	pacFetching chan struct{}
+)
+
+// updateProxy picks the proxy for an updater request. OLLAMA_UPDATE_PROXY
+// wins, then the PAC file at OLLAMA_UPDATE_PAC_URL, falling back to the
+// environment proxy when neither is set or the PAC file can't be used
+func updateProxy(req *http.Request) (*url.URL, error) {
+	if proxy, err := explicitUpdateProxy(); proxy != nil || err != nil {
+		return proxy, err
+	}
+	pacURL := os.Getenv("OLLAMA_UPDATE_PAC_URL")
+	if pacURL == "" {
+		return http.ProxyFromEnvironment(req)
+	}
+	script, err := loadPAC(req.Context(), pacURL)
+	if err != nil {
+		return http.ProxyFromEnvironment(req)
+	}
+	result := script.FindProxyForURL(req.URL.String(), req.URL.Hostname())
+	return pacProxyURL(result)
+}
+
+// loadPAC returns the script at pacURL, fetching it when it's not cached or
+// due a refresh. The fetch happens without pacMu held, so requests don't
+// queue up behind a slow PAC server: while one is underway, others use the
+// script it's refreshing, or wait for it when there's none.
+func loadPAC(ctx context.Context, pacURL string) (*pacScript, error) {
+	for {
+		pacMu.Lock()
+		cached := pacLoaded
+		if pacFrom != pacURL {
+			cached = nil
+		}
+		if cached != nil && time.Since(pacLoadedAt) < envDuration("OLLAMA_UPDATE_PAC_REFRESH_INTERVAL", PACRefreshInterval) {
+			pacMu.Unlock()
+			return cached, nil
+		}
+		if cached == nil && pacFrom == pacURL && time.Since(pacFailedAt) < PACRetryInterval {
+			pacMu.Unlock()
+			return nil, fmt.Errorf("PAC file %s unavailable", pacURL)
+		}
+		if fetching := pacFetching; fetching != nil {
+			pacMu.Unlock()
+			if cached != nil {
+				return cached, nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-fetching:
+			}
+			continue
+		}
+		done := make(chan struct{})
+		pacFetching = done
+		pacMu.Unlock()
+
+		script, err := fetchPAC(ctx, pacURL)
+
+		pacMu.Lock()
+		pacFetching = nil
+		close(done)
+		pacFrom = pacURL
+		pacLoaded = script
+		if err != nil {
+			pacFailedAt = time.Now()
+			pacMu.Unlock()
+			slog.Warn(fmt.Sprintf("unable to use PAC file %s, using environment proxy: %s", pacURL, err))
+			return nil, err
+		}
+		pacLoadedAt = time.Now()
+		pacMu.Unlock()
+		return script, nil
+	}
+}
+
+func fetchPAC(ctx context.Context, pacURL string) (*pacScript, error) {
+	ctx, cancel := context.WithTimeout(ctx, UpdateConnectTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pacURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The PAC file itself is always fetched directly, updateClient would
+	// recurse back into here
+	client := &http.Client{Transport: &http.Transport{Proxy: nil}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	src, err := io.ReadAll(io.LimitReader(resp.Body, MaxUpdateResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	return parsePAC(string(src))
+}
+
+// pacProxyURL converts the first usable entry of a FindProxyForURL result,
+// such as "PROXY proxy:8080; DIRECT", into a proxy URL, or nil for DIRECT
+func pacProxyURL(result string) (*url.URL, error) {
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		var scheme string
+		switch strings.ToUpper(fields[0]) {
+		case "DIRECT":
+			return nil, nil
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			continue
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		return &url.URL{Scheme: scheme, Host: fields[1]}, nil
+	}
+	return nil, nil
+}
+
+type pacScript struct {
+	body []pacStmt
+}
+
+// FindProxyForURL runs the script, returning "DIRECT" if it doesn't return
+func (p *pacScript) FindProxyForURL(rawURL, host string) string {
+	env := pacEnv{url: rawURL, host: host}
+	if result, ok := runPACStmts(p.body, env); ok {
+		return result
+	}
+	return "DIRECT"
+}
+
+type pacEnv struct {
+	url  string
+	host string
+}
+
+type pacValue struct {
+	str    string
+	isBool bool
+	b      bool
+}
+
+func (v pacValue) truthy() bool {
+	if v.isBool {
+		return v.b
+	}
+	return v.str != ""
+}
+
+type pacExpr func(pacEnv) pacValue
+
+// pacStmt returns the script's result and true if it executed a return
+type pacStmt func(pacEnv) (string, bool)
+
+func runPACStmts(stmts []pacStmt, env pacEnv) (string, bool) {
+	for _, stmt := range stmts {
+		if result, ok := stmt(env); ok {
+			return result, true
+		}
+	}
+	return "", false
+}
+
+type pacParser struct {
+	toks []string
+	pos  int
+	// the names FindProxyForURL gives its url and host parameters
+	urlParam, hostParam string
+}
+
+func parsePAC(src string) (*pacScript, error) {
+	toks, err := tokenizePAC(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &pacParser{toks: toks}
+	if p.peek() != "function" {
+		return nil, fmt.Errorf("PAC file has no FindProxyForURL function")
+	}
+	p.next()
+	name := p.next()
+	params, err := p.params()
+	if err != nil {
+		return nil, err
+	}
+	if name != "FindProxyForURL" {
+		return nil, fmt.Errorf("unsupported PAC function %q", name)
+	}
+	if len(params) != 2 {
+		return nil, fmt.Errorf("FindProxyForURL takes 2 parameters, got %d", len(params))
+	}
+	p.urlParam, p.hostParam = params[0], params[1]
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unsupported PAC statement %q", p.peek())
+	}
+	return &pacScript{body: body}, nil
+}
+
+func (p *pacParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *pacParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *pacParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q in PAC file, got %q", tok, got)
+	}
+	return nil
+}
+
+func (p *pacParser) params() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var params []string
+	for p.peek() != ")" {
+		if len(params) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		params = append(params, p.next())
+	}
+	p.next()
+	return params, nil
+}
+
+func (p *pacParser) block() ([]pacStmt, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var stmts []pacStmt
+	for p.peek() != "}" {
+		if p.peek() == "" {
+			return nil, fmt.Errorf("unterminated block in PAC file")
+		}
+		stmt, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	p.next()
+	return stmts, nil
+}
+
+func (p *pacParser) stmt() (pacStmt, error) {
+	switch p.peek() {
+	case "{":
+		stmts, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return func(env pacEnv) (string, bool) { return runPACStmts(stmts, env) }, nil
+	case ";":
+		p.next()
+		return func(pacEnv) (string, bool) { return "", false }, nil
+	case "return":
+		p.next()
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() == ";" {
+			p.next()
+		}
+		return func(env pacEnv) (string, bool) { return expr(env).str, true }, nil
+	case "if":
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		then, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		otherwise := func(pacEnv) (string, bool) { return "", false }
+		if p.peek() == "else" {
+			p.next()
+			if otherwise, err = p.stmt(); err != nil {
+				return nil, err
+			}
+		}
+		return func(env pacEnv) (string, bool) {
+			if cond(env).truthy() {
+				return then(env)
+			}
+			return otherwise(env)
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported PAC statement %q", p.peek())
+}
+
+func (p *pacParser) expr() (pacExpr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env pacEnv) pacValue { return pacBool(l(env).truthy() || right(env).truthy()) }
+	}
+	return left, nil
+}
+
+func (p *pacParser) and() (pacExpr, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env pacEnv) pacValue { return pacBool(l(env).truthy() && right(env).truthy()) }
+	}
+	return left, nil
+}
+
+func (p *pacParser) comparison() (pacExpr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "===", "!=", "!==":
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		equal := op == "==" || op == "==="
+		return func(env pacEnv) pacValue { return pacBool((left(env).str == right(env).str) == equal) }, nil
+	}
+	return left, nil
+}
+
+func (p *pacParser) unary() (pacExpr, error) {
+	switch tok := p.next(); {
+	case tok == "!":
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(env pacEnv) pacValue { return pacBool(!operand(env).truthy()) }, nil
+	case tok == "(":
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case strings.HasPrefix(tok, `"`):
+		s := pacString(tok[1:])
+		return func(pacEnv) pacValue { return s }, nil
+	case tok == "true" || tok == "false":
+		b := pacBool(tok == "true")
+		return func(pacEnv) pacValue { return b }, nil
+	case tok == p.urlParam:
+		return func(env pacEnv) pacValue { return pacString(env.url) }, nil
+	case tok == p.hostParam:
+		return func(env pacEnv) pacValue { return pacString(env.host) }, nil
+	case p.peek() == "(":
+		return p.call(tok)
+	default:
+		return nil, fmt.Errorf("unsupported PAC expression %q", tok)
+	}
+}
+
+// pacFuncs are the PAC helpers that can be evaluated without DNS lookups
+var pacFuncs = map[string]struct {
+	args int
+	fn   func(args []string) bool
+}{
+	"isPlainHostName": {1, func(a []string) bool { return !strings.Contains(a[0], ".") }},
+	"dnsDomainIs": {2, func(a []string) bool {
+		return strings.HasSuffix(strings.ToLower(a[0]), strings.ToLower(a[1]))
+	}},
+	"localHostOrDomainIs": {2, func(a []string) bool {
+		host, domain := strings.ToLower(a[0]), strings.ToLower(a[1])
+		return host == domain || (!strings.Contains(host, ".") && strings.HasPrefix(domain, host+"."))
+	}},
+	"shExpMatch":       {2, func(a []string) bool { return shExpMatch(a[0], a[1]) }},
+	"isValidIpAddress": {1, func(a []string) bool { return net.ParseIP(a[0]) != nil }},
+}
+
+func (p *pacParser) call(name string) (pacExpr, error) {
+	f, ok := pacFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported PAC function %q", name)
+	}
+	p.next()
+	var args []pacExpr
+	for p.peek() != ")" {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if len(args) != f.args {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name, f.args, len(args))
+	}
+	return func(env pacEnv) pacValue {
+		vals := make([]string, len(args))
+		for i, arg := range args {
+			vals[i] = arg(env).str
+		}
+		return pacBool(f.fn(vals))
+	}, nil
+}
+
+func pacBool(b bool) pacValue {
+	return pacValue{isBool: true, b: b}
+}
+
+func pacString(s string) pacValue {
+	return pacValue{str: s}
+}
+
+// shExpMatch matches s against a shell expression where * matches any run of
+// characters and ? matches a single one
+func shExpMatch(s, pattern string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	matched, err := regexp.MatchString("^"+expr+"$", s)
+	return err == nil && matched
+}
+
+// tokenizePAC splits src into identifiers, operators and string literals,
+// the latter unquoted and marked with a leading double quote
+func tokenizePAC(src string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return toks, nil
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment in PAC file")
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in PAC file")
+			}
+			toks = append(toks, `"`+src[i+1:i+1+end])
+			i += end + 2
+		case c == '_' || c == '$' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '$' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, src[i:j])
+			i = j
+		default:
+			op := string(c)
+			for _, o := range []string{"===", "!==", "==", "!=", "&&", "||"} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if !strings.Contains("(){},;!=&|", op[:1]) {
+				return nil, fmt.Errorf("unsupported character %q in PAC file", c)
+			}
+			toks = append(toks, op)
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
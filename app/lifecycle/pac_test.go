@@ -0,0 +1,174 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPAC = `
+// Route the update servers through the corporate proxy
+function FindProxyForURL(url, host) {
+	/* internal hosts go direct */
+	if (isPlainHostName(host) || dnsDomainIs(host, ".corp.example.com"))
+		return "DIRECT";
+	if (shExpMatch(host, "*.ollama.ai") || host == "ollama.com") {
+		return "PROXY proxy.corp.example.com:8080; DIRECT";
+	} else if (shExpMatch(url, "https://downloads.*")) {
+		return 'SOCKS5 socks.corp.example.com:1080';
+	}
+	return "PROXY fallback:3128";
+}
+`
+
+func TestPACFindProxyForURL(t *testing.T) {
+	script, err := parsePAC(testPAC)
+	require.NoError(t, err)
+
+	cases := []struct {
+		url, host, expect string
+	}{
+		{"http://intranet/", "intranet", "DIRECT"},
+		{"https://wiki.corp.example.com/", "wiki.corp.example.com", "DIRECT"},
+		{"https://ollama.ai/api/update", "ollama.ai", "PROXY fallback:3128"},
+		{"https://www.ollama.ai/api/update", "www.ollama.ai", "PROXY proxy.corp.example.com:8080; DIRECT"},
+		{"https://ollama.com/download", "ollama.com", "PROXY proxy.corp.example.com:8080; DIRECT"},
+		{"https://downloads.example.com/x", "downloads.example.com", "SOCKS5 socks.corp.example.com:1080"},
+		{"https://github.com/", "github.com", "PROXY fallback:3128"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expect, script.FindProxyForURL(c.url, c.host), c.url)
+	}
+}
+
+func TestParsePACUnsupported(t *testing.T) {
+	for _, src := range []string{
+		`var x = 1;`,
+		`function FindProxyForURL(url, host) { if (isInNet(dnsResolve(host), "10.0.0.0", "255.0.0.0")) return "DIRECT"; }`,
+		`function FindProxyForURL(url, host) { return "DIRECT";`,
+		`function FindProxyForURL(url, host) { return "DIRECT"; } function other() {}`,
+	} {
+		_, err := parsePAC(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestPACProxyURL(t *testing.T) {
+	u, err := pacProxyURL("PROXY proxy:8080; DIRECT")
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy:8080", u.String())
+
+	u, err = pacProxyURL("SOCKS socks:1080")
+	require.NoError(t, err)
+	assert.Equal(t, "socks5://socks:1080", u.String())
+
+	u, err = pacProxyURL("DIRECT")
+	require.NoError(t, err)
+	assert.Nil(t, u)
+}
+
+func TestUpdateProxyPAC(t *testing.T) {
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte(testPAC)) //nolint:errcheck
+	}))
+	defer ts.Close()
+	t.Setenv("OLLAMA_UPDATE_PAC_URL", ts.URL+"/proxy.pac")
+
+	req, err := http.NewRequest(http.MethodGet, "https://www.ollama.ai/api/update", nil)
+	require.NoError(t, err)
+	u, err := updateProxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.corp.example.com:8080", u.String())
+
+	req, err = http.NewRequest(http.MethodGet, "https://wiki.corp.example.com/", nil)
+	require.NoError(t, err)
+	u, err = updateProxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, u)
+	assert.EqualValues(t, 1, fetches.Load(), "PAC file should be cached")
+}
+
+func TestUpdateProxyPACRefresh(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_PAC_REFRESH_INTERVAL", "")
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) == 1 {
+			w.Write([]byte(testPAC)) //nolint:errcheck
+			return
+		}
+		w.Write([]byte(`function FindProxyForURL(url, host) { return "DIRECT"; }`)) //nolint:errcheck
+	}))
+	defer ts.Close()
+	pacURL := ts.URL + "/proxy.pac"
+
+	script, err := loadPAC(context.Background(), pacURL)
+	require.NoError(t, err)
+	assert.Equal(t, "PROXY fallback:3128", script.FindProxyForURL("https://example.com/", "example.com"))
+
+	pacMu.Lock()
+	pacLoadedAt = time.Now().Add(-2 * PACRefreshInterval)
+	pacMu.Unlock()
+	script, err = loadPAC(context.Background(), pacURL)
+	require.NoError(t, err)
+	assert.Equal(t, "DIRECT", script.FindProxyForURL("https://example.com/", "example.com"), "a stale PAC file is fetched again")
+	assert.EqualValues(t, 2, fetches.Load())
+}
+
+func TestLoadPACFetchesWithoutLock(t *testing.T) {
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		w.Write([]byte(testPAC)) //nolint:errcheck
+	}))
+	defer ts.Close()
+	defer close(release)
+	pacURL := ts.URL + "/proxy.pac"
+
+	stale, err := loadPAC(context.Background(), pacURL)
+	require.NoError(t, err)
+	pacMu.Lock()
+	pacLoadedAt = time.Now().Add(-2 * PACRefreshInterval)
+	pacMu.Unlock()
+
+	refreshed := make(chan error, 1)
+	go func() {
+		_, err := loadPAC(context.Background(), pacURL)
+		refreshed <- err
+	}()
+	require.Eventually(t, func() bool { return fetches.Load() == 2 }, 5*time.Second, time.Millisecond)
+
+	// The refresh is stuck on the server, the stale script still answers
+	script, err := loadPAC(context.Background(), pacURL)
+	require.NoError(t, err)
+	assert.Same(t, stale, script)
+	assert.Empty(t, refreshed)
+	assert.EqualValues(t, 2, fetches.Load(), "only one refresh at a time")
+
+	release <- struct{}{}
+	require.NoError(t, <-refreshed)
+}
+
+func TestUpdateProxyPACUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	t.Setenv("OLLAMA_UPDATE_PAC_URL", ts.URL+"/missing.pac")
+
+	// http.ProxyFromEnvironment caches the environment on first use, so the
+	// fallback is checked against a request it never proxies
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	require.NoError(t, err)
+	u, err := updateProxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, u)
+}
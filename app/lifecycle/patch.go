@@ -0,0 +1,222 @@
+package lifecycle
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+// UpdatePatch is a bsdiff patch from the installer of the running version
+// to the update. It arrives in the update response, so it's covered by the
+// response signature like the rest.
+type UpdatePatch struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// FromSHA256 is the checksum of the installer the patch applies to
+	FromSHA256 string `json:"from_sha256"`
+}
+
+const (
+	// Suffix of a downloaded patch staged next to the installer it builds
+	stagedPatchSuffix = ".patch"
+	// Suffix of the installer while the patch is applied
+	patchedSuffix = ".patched.part"
+)
+
+var errCorruptPatch = errors.New("corrupt update patch")
+
+// applyUpdatePatch builds the installer at dest by patching the retained
+// installer of the running version, returning its checksum. The result is
+// written next to dest and only moved into place once it matches the
+// update checksum, so a failure at any point leaves dest alone and the
+// caller can fall back to the full download.
+func applyUpdatePatch(ctx context.Context, updateResp UpdateResponse, dest string) (string, error) {
+	p := updateResp.Patch
+	if updateResp.Checksum == "" {
+		return "", fmt.Errorf("update has no checksum to verify the patched installer against")
+	}
+	if p.URL == "" || p.SHA256 == "" || p.FromSHA256 == "" {
+		return "", fmt.Errorf("update patch requires a url and checksums")
+	}
+	base, err := patchBase(p.FromSHA256)
+	if err != nil {
+		return "", err
+	}
+	patchURL, err := applyUpdateMirror(p.URL, p.SHA256)
+	if err != nil {
+		return "", err
+	}
+	if err := checkTrustedHost(patchURL); err != nil {
+		return "", err
+	}
+
+	patchFile := dest + stagedPatchSuffix
+	defer os.Remove(patchFile)
+	if _, err := downloadFile(ctx, patchURL, patchFile, p.SHA256, ""); err != nil {
+		return "", err
+	}
+
+	patched := dest + patchedSuffix
+	sum, err := patchFileTo(base, patchFile, patched)
+	if err != nil {
+		os.Remove(patched)
+		return "", err
+	}
+	if !strings.EqualFold(sum, updateResp.Checksum) {
+		os.Remove(patched)
+		return "", fmt.Errorf("checksum mismatch for patched installer: expected %s, got %s", updateResp.Checksum, sum)
+	}
+	if err := os.Rename(patched, dest); err != nil {
+		os.Remove(patched)
+		return "", err
+	}
+	slog.Info(fmt.Sprintf("patched %s to build %s", base, dest))
+	return sum, nil
+}
+
+// patchBase finds the retained installer of the running version with the
+// checksum sum
+func patchBase(sum string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(retainedDir(), url.PathEscape(version.Version), "*"))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, stagedMetadataSuffix) {
+			continue
+		}
+		if got, err := fileSHA256(file); err == nil && strings.EqualFold(got, sum) {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("no installer for %s to patch", version.Version)
+}
+
+// patchFileTo applies patchFile to base, writing the result to out, and
+// returns its checksum
+func patchFileTo(base, patchFile, out string) (string, error) {
+	oldFile, err := os.Open(base)
+	if err != nil {
+		return "", err
+	}
+	defer oldFile.Close()
+	fi, err := oldFile.Stat()
+	if err != nil {
+		return "", err
+	}
+	patch, err := os.ReadFile(patchFile)
+	if err != nil {
+		return "", err
+	}
+	fp, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(fp, h))
+	err = bspatch(oldFile, fi.Size(), patch, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// bspatch applies a BSDIFF40 patch to old, of oldSize bytes, writing the
+// new file to w
+func bspatch(old io.ReaderAt, oldSize int64, patch []byte, w io.Writer) error {
+	if len(patch) < 32 || string(patch[:8]) != "BSDIFF40" {
+		return fmt.Errorf("%w: bad header", errCorruptPatch)
+	}
+	ctrlLen, diffLen, newSize := offtin(patch[8:16]), offtin(patch[16:24]), offtin(patch[24:32])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || 32+ctrlLen+diffLen > int64(len(patch)) {
+		return fmt.Errorf("%w: bad header", errCorruptPatch)
+	}
+	body := patch[32:]
+	ctrl := bzip2.NewReader(bytes.NewReader(body[:ctrlLen]))
+	diff := bzip2.NewReader(bytes.NewReader(body[ctrlLen : ctrlLen+diffLen]))
+	extra := bzip2.NewReader(bytes.NewReader(body[ctrlLen+diffLen:]))
+
+	var newPos, oldPos int64
+	buf := make([]byte, 32*1024)
+	oldBuf := make([]byte, len(buf))
+	var tuple [24]byte
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, tuple[:]); err != nil {
+			return fmt.Errorf("%w: %s", errCorruptPatch, err)
+		}
+		add, copyLen, seek := offtin(tuple[0:8]), offtin(tuple[8:16]), offtin(tuple[16:24])
+		if add < 0 || copyLen < 0 || newPos+add+copyLen > newSize {
+			return fmt.Errorf("%w: bad control block", errCorruptPatch)
+		}
+
+		// Add the diff block to old
+		for add > 0 {
+			n := int64(len(buf))
+			if add < n {
+				n = add
+			}
+			if _, err := io.ReadFull(diff, buf[:n]); err != nil {
+				return fmt.Errorf("%w: %s", errCorruptPatch, err)
+			}
+			// Bytes outside old are taken as zero
+			clear(oldBuf[:n])
+			if lo, hi := max(oldPos, 0), min(oldPos+n, oldSize); lo < hi {
+				if _, err := old.ReadAt(oldBuf[lo-oldPos:hi-oldPos], lo); err != nil && err != io.EOF {
+					return err
+				}
+			}
+			for i := range buf[:n] {
+				buf[i] += oldBuf[i]
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			add -= n
+			newPos += n
+			oldPos += n
+		}
+
+		// Copy the extra block as is
+		if _, err := io.CopyN(w, extra, copyLen); err != nil {
+			return fmt.Errorf("%w: %s", errCorruptPatch, err)
+		}
+		newPos += copyLen
+		oldPos += seek
+	}
+	return nil
+}
+
+// offtin decodes bsdiff's sign and magnitude little endian integers
+func offtin(b []byte) int64 {
+	var y int64
+	for i := 7; i >= 0; i-- {
+		c := b[i]
+		if i == 7 {
+			c &= 0x7f
+		}
+		y = y<<8 | int64(c)
+	}
+	if b[7]&0x80 != 0 {
+		y = -y
+	}
+	return y
+}
@@ -0,0 +1,155 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmorganca/ollama/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	patchTestOld = []byte("ollama installer 0.1.1\n")
+	patchTestNew = []byte("ollama installer 0.1.2\nwith a fix\n")
+)
+
+// BSDIFF40 patch from patchTestOld to patchTestNew
+func patchTestPatch(t *testing.T) []byte {
+	t.Helper()
+	patch, err := hex.DecodeString("42534449464634302b000000000000002a000000000000002200000000000000" +
+		"425a6839314159265359d544db0e000005e00048080080200030cd3418c8a5ae38bb9229c28486aa26d870" +
+		"425a6839314159265359f03dc492000000e00060002000200030cc0934ca1d85dc914e14243c0f712480" +
+		"425a68393141592653597beb92cd000004d18000104000216004c0200031064c4101a36a1a94318578bb9229c28483df5c9668")
+	require.NoError(t, err)
+	return patch
+}
+
+func TestBspatch(t *testing.T) {
+	patch := patchTestPatch(t)
+	var out bytes.Buffer
+	require.NoError(t, bspatch(bytes.NewReader(patchTestOld), int64(len(patchTestOld)), patch, &out))
+	assert.Equal(t, patchTestNew, out.Bytes())
+
+	for _, corrupt := range [][]byte{patch[:20], patch[:100], append([]byte("BSDIFF41"), patch[8:]...)} {
+		out.Reset()
+		err := bspatch(bytes.NewReader(patchTestOld), int64(len(patchTestOld)), corrupt, &out)
+		assert.ErrorIs(t, err, errCorruptPatch)
+	}
+}
+
+func TestDownloadPatchedRelease(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	orig := version.Version
+	t.Cleanup(func() { version.Version = orig })
+	version.Version = "0.1.1"
+
+	patch := patchTestPatch(t)
+	var served []byte
+	var interrupt bool
+	var fullDownloads atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/OllamaSetup.exe":
+			if r.Method == http.MethodGet {
+				fullDownloads.Add(1)
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(len(patchTestNew)))
+			w.Write(patchTestNew)
+		case "/OllamaSetup.patch":
+			w.Header().Set("Content-Length", fmt.Sprint(len(served)))
+			if !interrupt {
+				w.Write(served)
+				return
+			}
+			w.Write(served[:len(served)/2])
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	setup := func(t *testing.T, patchBytes []byte) (UpdateResponse, string) {
+		UpdateStageDir = t.TempDir()
+		base := filepath.Join(retainedDir(), "0.1.1", Installer)
+		require.NoError(t, os.MkdirAll(filepath.Dir(base), 0o755))
+		require.NoError(t, os.WriteFile(base, patchTestOld, 0o755))
+		served = patchBytes
+		fullDownloads.Store(0)
+		return UpdateResponse{
+			UpdateURL:     ts.URL + "/OllamaSetup.exe",
+			UpdateVersion: "0.1.2",
+			Checksum:      sha256Hex(patchTestNew),
+			Patch: &UpdatePatch{
+				URL:        ts.URL + "/OllamaSetup.patch",
+				SHA256:     sha256Hex(patchBytes),
+				FromSHA256: sha256Hex(patchTestOld),
+			},
+		}, base
+	}
+	checkStaged := func(t *testing.T, base string) {
+		t.Helper()
+		installer, err := findStagedInstaller()
+		require.NoError(t, err)
+		staged, err := verifyStagedInstaller(installer)
+		require.NoError(t, err)
+		assert.Equal(t, "0.1.2", staged.Version)
+		b, err := os.ReadFile(installer)
+		require.NoError(t, err)
+		assert.Equal(t, patchTestNew, b)
+
+		b, err = os.ReadFile(base)
+		require.NoError(t, err)
+		assert.Equal(t, patchTestOld, b, "the installer patched from must be left alone")
+		for _, suffix := range []string{stagedPatchSuffix, stagedPatchSuffix + ".part", patchedSuffix} {
+			assert.NoFileExists(t, installer+suffix)
+		}
+	}
+
+	t.Run("patched", func(t *testing.T) {
+		interrupt = false
+		resp, base := setup(t, patch)
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+		checkStaged(t, base)
+		assert.Zero(t, fullDownloads.Load())
+	})
+
+	t.Run("interrupted patch download", func(t *testing.T) {
+		interrupt = true
+		resp, base := setup(t, patch)
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+		checkStaged(t, base)
+		assert.EqualValues(t, 1, fullDownloads.Load())
+	})
+
+	t.Run("patch fails part way", func(t *testing.T) {
+		interrupt = false
+		corrupt := bytes.Clone(patch)
+		// within the diff block
+		corrupt[90] ^= 0xff
+		resp, base := setup(t, corrupt)
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+		checkStaged(t, base)
+		assert.EqualValues(t, 1, fullDownloads.Load())
+	})
+
+	t.Run("nothing to patch", func(t *testing.T) {
+		interrupt = false
+		resp, base := setup(t, patch)
+		resp.Patch.FromSHA256 = sha256Hex([]byte("another installer"))
+		require.NoError(t, DownloadNewRelease(context.Background(), resp))
+		checkStaged(t, base)
+		assert.EqualValues(t, 1, fullDownloads.Load())
+	})
+}
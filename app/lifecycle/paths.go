@@ -21,6 +21,9 @@ var (
 	ServerLogFile  = "/tmp/ollama.log"
 	UpgradeLogFile = "/tmp/ollama_update.log"
 	Installer      = "OllamaSetup.exe"
+	// Where the version being installed and the installer's exit code are
+	// left for the next launch, since the installer closes the app
+	InstallerExitFile = "/tmp/ollama_installer_exit"
 )
 
 func init() {
@@ -34,6 +37,7 @@ func init() {
 		AppLogFile = filepath.Join(AppDataDir, "app.log")
 		ServerLogFile = filepath.Join(AppDataDir, "server.log")
 		UpgradeLogFile = filepath.Join(AppDataDir, "upgrade.log")
+		InstallerExitFile = filepath.Join(AppDataDir, "installer-exit")
 
 		// Executables are stored in APPDATA
 		AppDir = filepath.Join(localAppData, "Programs", "Ollama")
@@ -0,0 +1,73 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Pausing stops the active download like CancelDownload, but keeps the
+// partial download so ResumeDownload can carry on from where it stopped
+// with a range request. Background checks leave a paused download alone
+// until it's resumed.
+
+var (
+	errDownloadPaused   = errors.New("update download paused")
+	errNoPausedDownload = errors.New("no update download is paused")
+
+	// The update whose download was paused, guarded by muDownload
+	pausedDownload *UpdateResponse
+)
+
+// pausedBy reports whether ctx was stopped by PauseDownload
+func pausedBy(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errDownloadPaused)
+}
+
+// PauseDownload stops the active download, keeping what's downloaded so
+// far. It reports whether a download was active.
+func PauseDownload() bool {
+	muDownload.Lock()
+	defer muDownload.Unlock()
+	if pauseDownload == nil {
+		return false
+	}
+	slog.Info("pausing update download")
+	paused := *activeDownload
+	pausedDownload = &paused
+	pauseDownload()
+	return true
+}
+
+// DownloadPaused reports whether a download is paused
+func DownloadPaused() bool {
+	muDownload.Lock()
+	defer muDownload.Unlock()
+	return pausedDownload != nil
+}
+
+// ResumeDownload carries on with the paused download, then offers the
+// update by calling available
+func ResumeDownload(ctx context.Context, available func(ver, description string) error) error {
+	muDownload.Lock()
+	paused := pausedDownload
+	muDownload.Unlock()
+	if paused == nil {
+		return errNoPausedDownload
+	}
+	slog.Info(fmt.Sprintf("resuming download of update %s", paused.UpdateVersion))
+	err := DownloadNewRelease(ctx, *paused)
+	switch {
+	case errors.Is(err, errDownloadPaused):
+		return nil
+	case err != nil:
+		recordUpdate(paused.UpdateVersion, "download failed: "+err.Error())
+		if !errors.Is(err, context.Canceled) {
+			notifyUpdateFailed(paused.UpdateVersion, err)
+		}
+		return err
+	}
+	recordUpdate(paused.UpdateVersion, "downloaded")
+	return available(paused.UpdateVersion, paused.Description)
+}
@@ -0,0 +1,87 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseAndResumeDownload(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	UpdateStageDir = t.TempDir()
+	SetUpdateDownloaded(false)
+	t.Cleanup(func() { SetUpdateDownloaded(false) })
+	assert.False(t, PauseDownload(), "nothing to pause")
+	assert.ErrorIs(t, ResumeDownload(context.Background(), nil), errNoPausedDownload)
+
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	var mu sync.Mutex
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			http.ServeContent(w, r, Installer, time.Time{}, bytes.NewReader(payload))
+			return
+		}
+		// The first download stalls part way until it's paused
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", "10000")
+		w.Write(payload[:4000]) //nolint:errcheck
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	resp := UpdateResponse{
+		UpdateURL:     ts.URL + "/download/v0.1.30/OllamaSetup.exe",
+		UpdateVersion: "v0.1.30",
+		Checksum:      sha256Hex(payload),
+	}
+	staged := filepath.Join(UpdateStageDir, "abc", stageFileName(Installer, resp.UpdateURL))
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- DownloadNewRelease(context.Background(), resp)
+	}()
+	require.Eventually(t, func() bool { return partialSize(staged) == 4000 }, 5*time.Second, 10*time.Millisecond)
+
+	assert.True(t, PauseDownload())
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, errDownloadPaused)
+	case <-time.After(5 * time.Second):
+		t.Fatal("download was not paused")
+	}
+	assert.True(t, DownloadPaused())
+	assert.False(t, downloadActive())
+	assert.Equal(t, int64(4000), partialSize(staged), "kept for the resume")
+	assert.False(t, IsUpdateDownloaded())
+
+	var offered []string
+	require.NoError(t, ResumeDownload(context.Background(), func(ver, description string) error {
+		offered = append(offered, ver)
+		return nil
+	}))
+	assert.Equal(t, []string{"v0.1.30"}, offered)
+	assert.False(t, DownloadPaused())
+	assert.True(t, IsUpdateDownloaded())
+	b, err := os.ReadFile(staged)
+	require.NoError(t, err)
+	assert.Equal(t, payload, b)
+	mu.Lock()
+	assert.Equal(t, []string{"", "bytes=4000-"}, ranges, "resumed from where it was paused")
+	mu.Unlock()
+}
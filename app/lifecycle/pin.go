@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/jmorganca/ollama/version"
+)
+
+// A machine can be pinned to an exact version, after which the checker
+// ignores every other release. Unlike disabling updates, a pin still lets
+// the pinned version itself be offered, say to get back to it after a
+// manual install. Starting the app with OLLAMA_UPDATE_UNPIN set removes the
+// pin.
+
+// overridden in tests
+var (
+	pinnedVersionSetting = store.GetPinnedVersion
+	unpinVersion         = store.UnpinVersion
+)
+
+// pinAllows reports whether ver may be offered, which is any version unless
+// the machine is pinned
+func pinAllows(ver string) bool {
+	pinned := pinnedVersionSetting()
+	if pinned == "" || ver == pinned {
+		return true
+	}
+	cmp, ok := compareVersions(ver, pinned)
+	return ok && cmp == 0
+}
+
+// PinCurrentVersion pins the machine to the running version
+func PinCurrentVersion() {
+	slog.Info("pinning updates to " + version.Version)
+	store.SetPinnedVersion(version.Version)
+}
+
+// ApplyUnpinOverride removes the pin when OLLAMA_UPDATE_UNPIN is set,
+// reporting whether there was one
+func ApplyUnpinOverride() bool {
+	if os.Getenv("OLLAMA_UPDATE_UNPIN") == "" {
+		return false
+	}
+	pinned := pinnedVersionSetting()
+	if pinned == "" {
+		return false
+	}
+	slog.Info(fmt.Sprintf("OLLAMA_UPDATE_UNPIN set, no longer pinning updates to %s", pinned))
+	unpinVersion()
+	return true
+}
+
+// CheckPinDrift warns when the running version is newer than the pin, which
+// happens when a newer version is installed outside the app. It reports
+// whether the version has drifted.
+func CheckPinDrift() bool {
+	pinned := pinnedVersionSetting()
+	if pinned == "" {
+		return false
+	}
+	if cmp, ok := compareVersions(version.Version, pinned); ok && cmp > 0 {
+		slog.Warn(fmt.Sprintf("running %s, which is newer than the pinned version %s", version.Version, pinned))
+		return true
+	}
+	return false
+}
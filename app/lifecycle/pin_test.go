@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+func stubPinnedVersion(t *testing.T, ver string) {
+	t.Helper()
+	orig := pinnedVersionSetting
+	t.Cleanup(func() { pinnedVersionSetting = orig })
+	pinnedVersionSetting = func() string { return ver }
+}
+
+func TestPinAllows(t *testing.T) {
+	stubPinnedVersion(t, "")
+	assert.True(t, pinAllows("v0.1.33"))
+
+	stubPinnedVersion(t, "0.1.32")
+	assert.True(t, pinAllows("0.1.32"))
+	assert.True(t, pinAllows("v0.1.32"))
+	assert.False(t, pinAllows("v0.1.33"))
+	assert.False(t, pinAllows("v0.1.31"))
+	assert.False(t, pinAllows("v0.1.32-rc1"))
+	assert.False(t, pinAllows("bogus"))
+}
+
+func TestIsNewReleaseAvailablePinned(t *testing.T) {
+	setupTestKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"url":"https://example.com/download/v0.1.33/OllamaSetup.exe"}`)) //nolint:errcheck
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+
+	stubPinnedVersion(t, "0.1.32")
+	available, _ := IsNewReleaseAvailable(context.Background())
+	assert.False(t, available)
+
+	stubPinnedVersion(t, "0.1.33")
+	available, resp := IsNewReleaseAvailable(context.Background())
+	require.True(t, available)
+	assert.Equal(t, "v0.1.33", resp.UpdateVersion)
+}
+
+func TestCheckPinDrift(t *testing.T) {
+	orig := version.Version
+	t.Cleanup(func() { version.Version = orig })
+	version.Version = "0.1.33"
+
+	stubPinnedVersion(t, "")
+	assert.False(t, CheckPinDrift())
+	stubPinnedVersion(t, "0.1.33")
+	assert.False(t, CheckPinDrift())
+	stubPinnedVersion(t, "0.1.32")
+	assert.True(t, CheckPinDrift())
+}
+
+func TestApplyUnpinOverride(t *testing.T) {
+	orig := unpinVersion
+	t.Cleanup(func() { unpinVersion = orig })
+	unpinned := 0
+	unpinVersion = func() { unpinned++ }
+
+	stubPinnedVersion(t, "0.1.32")
+	t.Setenv("OLLAMA_UPDATE_UNPIN", "")
+	assert.False(t, ApplyUnpinOverride())
+	assert.Zero(t, unpinned)
+
+	t.Setenv("OLLAMA_UPDATE_UNPIN", "1")
+	assert.True(t, ApplyUnpinOverride())
+	assert.Equal(t, 1, unpinned)
+
+	stubPinnedVersion(t, "")
+	assert.False(t, ApplyUnpinOverride(), "nothing to unpin")
+	assert.Equal(t, 1, unpinned)
+}
@@ -0,0 +1,57 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// PowerStatus describes the system's current power source
+type PowerStatus struct {
+	OnBattery bool
+	// -1 when unknown or there is no battery
+	BatteryPercent int
+}
+
+type powerSource interface {
+	PowerStatus() (PowerStatus, error)
+}
+
+var (
+	// Downloads wait for AC power while the battery is below this
+	// percentage, overridden by OLLAMA_UPDATE_BATTERY_THRESHOLD
+	BatteryThreshold  = 50
+	PowerPollInterval = 60 * time.Second
+
+	// overridden in tests
+	systemPower powerSource = platformPower{}
+)
+
+// shouldDeferDownload reports whether the system is running on a low
+// battery. Unknown power states never defer.
+func shouldDeferDownload(p powerSource) bool {
+	status, err := p.PowerStatus()
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to determine power status: %s", err))
+		return false
+	}
+	threshold := envInt("OLLAMA_UPDATE_BATTERY_THRESHOLD", BatteryThreshold)
+	return status.OnBattery && status.BatteryPercent >= 0 && status.BatteryPercent < threshold
+}
+
+// waitForPower blocks while the system is on a low battery
+func waitForPower(ctx context.Context, p powerSource) error {
+	if !shouldDeferDownload(p) {
+		return nil
+	}
+	slog.Info("running on low battery, deferring update download until AC power is connected")
+	for shouldDeferDownload(p) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(PowerPollInterval):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package lifecycle
+
+type platformPower struct{}
+
+func (platformPower) PowerStatus() (PowerStatus, error) {
+	return PowerStatus{BatteryPercent: -1}, nil
+}
@@ -0,0 +1,70 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePower struct {
+	mu       sync.Mutex
+	statuses []PowerStatus
+	err      error
+}
+
+// PowerStatus returns each status in turn, repeating the last one
+func (f *fakePower) PowerStatus() (PowerStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.statuses[0]
+	if len(f.statuses) > 1 {
+		f.statuses = f.statuses[1:]
+	}
+	return s, f.err
+}
+
+func TestShouldDeferDownload(t *testing.T) {
+	cases := []struct {
+		name   string
+		status PowerStatus
+		err    error
+		expect bool
+	}{
+		{"on AC", PowerStatus{OnBattery: false, BatteryPercent: 10}, nil, false},
+		{"low battery", PowerStatus{OnBattery: true, BatteryPercent: 20}, nil, true},
+		{"charged battery", PowerStatus{OnBattery: true, BatteryPercent: 80}, nil, false},
+		{"unknown battery", PowerStatus{OnBattery: true, BatteryPercent: -1}, nil, false},
+		{"query failed", PowerStatus{OnBattery: true, BatteryPercent: 5}, errors.New("boom"), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &fakePower{statuses: []PowerStatus{tc.status}, err: tc.err}
+			assert.Equal(t, tc.expect, shouldDeferDownload(p))
+		})
+	}
+
+	t.Run("threshold override", func(t *testing.T) {
+		t.Setenv("OLLAMA_UPDATE_BATTERY_THRESHOLD", "90")
+		p := &fakePower{statuses: []PowerStatus{{OnBattery: true, BatteryPercent: 80}}}
+		assert.True(t, shouldDeferDownload(p))
+	})
+}
+
+func TestWaitForPower(t *testing.T) {
+	PowerPollInterval = time.Millisecond
+	low := PowerStatus{OnBattery: true, BatteryPercent: 10}
+	ac := PowerStatus{OnBattery: false, BatteryPercent: 10}
+
+	p := &fakePower{statuses: []PowerStatus{low, low, low, ac}}
+	assert.NoError(t, waitForPower(context.Background(), p))
+	assert.Len(t, p.statuses, 1, "should poll until AC is connected")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p = &fakePower{statuses: []PowerStatus{low}}
+	assert.ErrorIs(t, waitForPower(ctx, p), context.Canceled)
+}
@@ -0,0 +1,40 @@
+package lifecycle
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+var pGetSystemPowerStatus = k32.NewProc("GetSystemPowerStatus")
+
+// https://learn.microsoft.com/en-us/windows/win32/api/winbase/ns-winbase-system_power_status
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+type platformPower struct{}
+
+func (platformPower) PowerStatus() (PowerStatus, error) {
+	const (
+		AC_LINE_OFFLINE   = 0
+		BATTERY_FLAG_NONE = 128
+		BATTERY_UNKNOWN   = 255
+	)
+	var sps systemPowerStatus
+	if res, _, err := pGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&sps))); res == 0 {
+		return PowerStatus{BatteryPercent: -1}, fmt.Errorf("GetSystemPowerStatus failed: %w", err)
+	}
+	status := PowerStatus{
+		OnBattery:      sps.ACLineStatus == AC_LINE_OFFLINE,
+		BatteryPercent: int(sps.BatteryLifePercent),
+	}
+	if sps.BatteryFlag == BATTERY_FLAG_NONE || sps.BatteryLifePercent == BATTERY_UNKNOWN {
+		status.BatteryPercent = -1
+	}
+	return status, nil
+}
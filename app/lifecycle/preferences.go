@@ -0,0 +1,95 @@
+package lifecycle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+// preferencesFormat is the version of the exported preferences format
+const preferencesFormat = 1
+
+var (
+	// overridden in tests
+	preferencesSetting = store.GetPreferences
+	savePreferences    = store.SetPreferences
+)
+
+// exportedPreferences is the file written by ExportPreferences
+type exportedPreferences struct {
+	Format int `json:"format"`
+	store.Preferences
+}
+
+// ExportPreferences writes the tray and updater preferences to path as JSON,
+// for support or to move them to another machine
+func ExportPreferences(path string) error {
+	payload, err := json.MarshalIndent(exportedPreferences{Format: preferencesFormat, Preferences: preferencesSetting()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(payload, '\n'), 0o644); err != nil {
+		return fmt.Errorf("unable to export preferences: %w", err)
+	}
+	slog.Info("preferences exported to " + path)
+	return nil
+}
+
+// ImportPreferences replaces the preferences with those exported to path.
+// Nothing changes unless the whole file is valid. Updates that were
+// permanently disabled stay that way, as in the app.
+func ImportPreferences(path string) error {
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to import preferences: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	var imported exportedPreferences
+	if err := dec.Decode(&imported); err != nil {
+		return fmt.Errorf("invalid preferences file %s: %w", path, err)
+	}
+	if err := validatePreferences(imported); err != nil {
+		return fmt.Errorf("invalid preferences file %s: %w", path, err)
+	}
+	prefs := imported.Preferences
+	if preferencesSetting().UpdatesDisabledPermanently {
+		prefs.UpdatesDisabledPermanently = true
+	}
+	savePreferences(prefs)
+	slog.Info("preferences imported from " + path)
+	return nil
+}
+
+func validatePreferences(p exportedPreferences) error {
+	if p.Format != preferencesFormat {
+		return fmt.Errorf("unsupported format %d", p.Format)
+	}
+	if p.MaintenanceWindow != "" {
+		if _, err := parseMaintenanceWindow(p.MaintenanceWindow); err != nil {
+			return err
+		}
+	}
+	if p.QuietHours != "" {
+		if _, err := parseDailyWindow("quiet hours", p.QuietHours); err != nil {
+			return err
+		}
+	}
+	if p.UpdateReportURL != "" {
+		u, err := url.Parse(p.UpdateReportURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("update report URL %q should be an http or https URL", p.UpdateReportURL)
+		}
+	}
+	if p.PinnedVersion != "" {
+		if _, _, ok := parseVersion(p.PinnedVersion); !ok {
+			return fmt.Errorf("pinned version %q isn't a version", p.PinnedVersion)
+		}
+	}
+	return nil
+}
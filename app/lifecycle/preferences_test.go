@@ -0,0 +1,73 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+// stubPreferences keeps preferences in memory instead of the store
+func stubPreferences(t *testing.T, prefs store.Preferences) *store.Preferences {
+	t.Helper()
+	origGet, origSave := preferencesSetting, savePreferences
+	t.Cleanup(func() { preferencesSetting, savePreferences = origGet, origSave })
+	preferencesSetting = func() store.Preferences { return prefs }
+	savePreferences = func(p store.Preferences) { prefs = p }
+	return &prefs
+}
+
+func TestExportImportPreferences(t *testing.T) {
+	want := store.Preferences{
+		AutoInstallWhenIdle: true,
+		ActiveModel:         "mistral:7b",
+		MaintenanceWindow:   "22:00-02:00",
+		UpdateReportURL:     "https://updates.example.com/report",
+		PinnedVersion:       "0.1.32",
+		QuietHours:          "23:00-07:00",
+	}
+	stubPreferences(t, want)
+	path := filepath.Join(t.TempDir(), "ollama-settings.json")
+	require.NoError(t, ExportPreferences(path))
+
+	// Import on a machine with no preferences
+	prefs := stubPreferences(t, store.Preferences{})
+	require.NoError(t, ImportPreferences(path))
+	assert.Equal(t, want, *prefs)
+
+	// Permanently disabled updates can't be re-enabled by an import
+	prefs = stubPreferences(t, store.Preferences{UpdatesDisabledPermanently: true})
+	require.NoError(t, ImportPreferences(path))
+	assert.True(t, prefs.UpdatesDisabledPermanently)
+	assert.Equal(t, "0.1.32", prefs.PinnedVersion)
+}
+
+func TestImportPreferencesInvalid(t *testing.T) {
+	current := store.Preferences{ActiveModel: "llama2"}
+	for name, payload := range map[string]string{
+		"not json":           `auto-install-when-idle=true`,
+		"unknown format":     `{"format":2}`,
+		"missing format":     `{"active-model":"mistral"}`,
+		"unknown field":      `{"format":1,"pre-install-command":"evil.cmd"}`,
+		"wrong type":         `{"format":1,"auto-install-when-idle":"yes"}`,
+		"maintenance window": `{"format":1,"maintenance-window":"nights"}`,
+		"quiet hours":        `{"format":1,"quiet-hours":"22:00-22:00"}`,
+		"report URL":         `{"format":1,"update-report-url":"file:///etc/passwd"}`,
+		"pinned version":     `{"format":1,"pinned-version":"latest"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			prefs := stubPreferences(t, current)
+			path := filepath.Join(t.TempDir(), "ollama-settings.json")
+			require.NoError(t, os.WriteFile(path, []byte(payload), 0o644))
+			assert.Error(t, ImportPreferences(path))
+			assert.Equal(t, current, *prefs, "nothing changes on a failed import")
+		})
+	}
+
+	stubPreferences(t, current)
+	assert.Error(t, ImportPreferences(filepath.Join(t.TempDir(), "missing.json")))
+}
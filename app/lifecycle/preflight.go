@@ -0,0 +1,43 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+var (
+	// The least free memory and disk, in MB, DoUpgrade needs to run the
+	// installer, 0 skips the check. Overridden by
+	// OLLAMA_UPDATE_MIN_FREE_MEMORY_MB and OLLAMA_UPDATE_MIN_FREE_DISK_MB
+	UpgradeMinFreeMemoryMB = 0
+	UpgradeMinFreeDiskMB   = 0
+
+	// overridden in tests
+	memFree = freeMemory
+
+	errInsufficientResources = errors.New("insufficient resources to upgrade")
+)
+
+// upgradePreflight refuses to start an upgrade when the machine is too low
+// on memory, or on disk space under installDir, to finish it. A resource
+// that can't be measured doesn't block the upgrade.
+func upgradePreflight(installDir string) error {
+	if mb := envInt("OLLAMA_UPDATE_MIN_FREE_MEMORY_MB", UpgradeMinFreeMemoryMB); mb > 0 {
+		free, err := memFree()
+		if err != nil {
+			slog.Debug(fmt.Sprintf("unable to determine free memory: %s", err))
+		} else if free < uint64(mb)<<20 {
+			return fmt.Errorf("%w: %d MB of memory free, need %d MB", errInsufficientResources, free>>20, mb)
+		}
+	}
+	if mb := envInt("OLLAMA_UPDATE_MIN_FREE_DISK_MB", UpgradeMinFreeDiskMB); mb > 0 {
+		free, err := diskFree(installDir)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("unable to determine free disk space for %s: %s", installDir, err))
+		} else if free < uint64(mb)<<20 {
+			return fmt.Errorf("%w: %d MB of disk free in %s, need %d MB", errInsufficientResources, free>>20, installDir, mb)
+		}
+	}
+	return nil
+}
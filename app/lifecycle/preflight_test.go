@@ -0,0 +1,43 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stubResources(t *testing.T, mem, disk uint64, err error) {
+	t.Helper()
+	origMem, origDisk := memFree, diskFree
+	t.Cleanup(func() { memFree, diskFree = origMem, origDisk })
+	memFree = func() (uint64, error) { return mem, err }
+	diskFree = func(string) (uint64, error) { return disk, err }
+}
+
+func TestUpgradePreflight(t *testing.T) {
+	const mb = 1 << 20
+	t.Setenv("OLLAMA_UPDATE_MIN_FREE_MEMORY_MB", "")
+	t.Setenv("OLLAMA_UPDATE_MIN_FREE_DISK_MB", "")
+
+	stubResources(t, 1*mb, 1*mb, nil)
+	assert.NoError(t, upgradePreflight(t.TempDir()), "checks are off by default")
+
+	t.Setenv("OLLAMA_UPDATE_MIN_FREE_MEMORY_MB", "512")
+	t.Setenv("OLLAMA_UPDATE_MIN_FREE_DISK_MB", "1024")
+	stubResources(t, 512*mb, 1024*mb, nil)
+	assert.NoError(t, upgradePreflight(t.TempDir()), "exactly the minimum is enough")
+
+	stubResources(t, 511*mb, 4096*mb, nil)
+	err := upgradePreflight(t.TempDir())
+	assert.ErrorIs(t, err, errInsufficientResources)
+	assert.ErrorContains(t, err, "511 MB of memory free, need 512 MB")
+
+	stubResources(t, 4096*mb, 100*mb, nil)
+	err = upgradePreflight(t.TempDir())
+	assert.ErrorIs(t, err, errInsufficientResources)
+	assert.ErrorContains(t, err, "100 MB of disk free")
+
+	stubResources(t, 0, 0, errors.New("unsupported"))
+	assert.NoError(t, upgradePreflight(t.TempDir()), "unknown resources should not block the upgrade")
+}
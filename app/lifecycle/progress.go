@@ -0,0 +1,92 @@
+package lifecycle
+
+import "sync"
+
+// ProgressBufferSize is how many progress events a subscriber may fall
+// behind by before the oldest are dropped
+const ProgressBufferSize = 16
+
+// DownloadProgress reports how far an update download has got
+type DownloadProgress struct {
+	URL       string `json:"url"`
+	Completed int64  `json:"completed"`
+	// Total is the size of the download, or 0 when the server didn't say
+	Total int64 `json:"total,omitempty"`
+	// Done is set on the final event of a successful download
+	Done bool `json:"done,omitempty"`
+}
+
+// progressHub fans download progress out to subscribers, such as the REST
+// API streaming it to clients. Publishing never blocks, a subscriber that
+// falls behind loses its oldest events instead.
+type progressHub struct {
+	mu          sync.Mutex
+	subscribers []chan DownloadProgress
+}
+
+var downloadProgress = &progressHub{}
+
+// Subscribe returns a channel receiving update download progress until it's
+// passed to Unsubscribe
+func Subscribe() <-chan DownloadProgress {
+	return downloadProgress.subscribe()
+}
+
+// Unsubscribe stops progress events to ch and closes it
+func Unsubscribe(ch <-chan DownloadProgress) {
+	downloadProgress.unsubscribe(ch)
+}
+
+func (h *progressHub) subscribe() <-chan DownloadProgress {
+	ch := make(chan DownloadProgress, ProgressBufferSize)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers = append(h.subscribers, ch)
+	return ch
+}
+
+func (h *progressHub) unsubscribe(ch <-chan DownloadProgress) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, sub := range h.subscribers {
+		if (<-chan DownloadProgress)(sub) == ch {
+			h.subscribers = append(h.subscribers[:i], h.subscribers[i+1:]...)
+			close(sub)
+			return
+		}
+	}
+}
+
+// publish sends p to every subscriber, dropping a subscriber's oldest event
+// when its buffer is full
+func (h *progressHub) publish(p DownloadProgress) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range h.subscribers {
+		select {
+		case sub <- p:
+			continue
+		default:
+		}
+		select {
+		case <-sub:
+		default:
+		}
+		select {
+		case sub <- p:
+		default:
+		}
+	}
+}
+
+// progressWriter publishes progress as a download is written
+type progressWriter struct {
+	hub      *progressHub
+	progress DownloadProgress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.progress.Completed += int64(len(p))
+	w.hub.publish(w.progress)
+	return len(p), nil
+}
@@ -0,0 +1,72 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressSubscribe(t *testing.T) {
+	payload := strings.Repeat("x", 64<<10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(payload)))
+		w.Write([]byte(payload)) //nolint:errcheck
+	}))
+	defer ts.Close()
+
+	ch := Subscribe()
+	defer Unsubscribe(ch)
+	_, err := downloadFile(context.Background(), ts.URL, filepath.Join(t.TempDir(), Installer), "", "")
+	require.NoError(t, err)
+
+	var last DownloadProgress
+	for p := range ch {
+		assert.Equal(t, ts.URL, p.URL)
+		assert.GreaterOrEqual(t, p.Completed, last.Completed)
+		last = p
+		if p.Done {
+			break
+		}
+	}
+	assert.Equal(t, int64(len(payload)), last.Completed)
+	assert.Equal(t, int64(len(payload)), last.Total)
+}
+
+func TestProgressUnsubscribe(t *testing.T) {
+	h := &progressHub{}
+	a, b := h.subscribe(), h.subscribe()
+	h.unsubscribe(a)
+	_, open := <-a
+	assert.False(t, open, "unsubscribing closes the channel")
+
+	h.publish(DownloadProgress{Completed: 1})
+	assert.Equal(t, DownloadProgress{Completed: 1}, <-b)
+	h.unsubscribe(b)
+	h.unsubscribe(b)
+	h.publish(DownloadProgress{Completed: 2})
+}
+
+func TestProgressSlowSubscriber(t *testing.T) {
+	h := &progressHub{}
+	slow := h.subscribe()
+	defer h.unsubscribe(slow)
+
+	// Nobody reads slow, publishing must not block and keeps the newest
+	for i := 1; i <= 3*ProgressBufferSize; i++ {
+		h.publish(DownloadProgress{Completed: int64(i)})
+	}
+	require.Len(t, slow, ProgressBufferSize)
+	assert.Equal(t, int64(2*ProgressBufferSize+1), (<-slow).Completed)
+	var last DownloadProgress
+	for len(slow) > 0 {
+		last = <-slow
+	}
+	assert.Equal(t, int64(3*ProgressBufferSize), last.Completed)
+}
@@ -0,0 +1,32 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+// overridden in tests
+var quietHoursSetting = store.GetQuietHours
+
+// inQuietHours reports whether informational notifications should be held
+// back at now. OLLAMA_QUIET_HOURS overrides the stored hours, and windows
+// like "22:00-07:00" cross midnight.
+func inQuietHours(now time.Time) bool {
+	s := os.Getenv("OLLAMA_QUIET_HOURS")
+	if s == "" {
+		s = quietHoursSetting()
+	}
+	if s == "" {
+		return false
+	}
+	w, err := parseDailyWindow("quiet hours", s)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("ignoring quiet hours: %s", err))
+		return false
+	}
+	return w.contains(now)
+}
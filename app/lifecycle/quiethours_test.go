@@ -0,0 +1,39 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stubQuietHours(t *testing.T, hours string) {
+	t.Helper()
+	orig := quietHoursSetting
+	t.Cleanup(func() { quietHoursSetting = orig })
+	quietHoursSetting = func() string { return hours }
+}
+
+func TestInQuietHours(t *testing.T) {
+	t.Setenv("OLLAMA_QUIET_HOURS", "")
+
+	stubQuietHours(t, "")
+	assert.False(t, inQuietHours(atLocal(23, 0)))
+
+	// Crossing midnight
+	stubQuietHours(t, "22:00-07:00")
+	assert.True(t, inQuietHours(atLocal(22, 0)))
+	assert.True(t, inQuietHours(atLocal(3, 30)))
+	assert.False(t, inQuietHours(atLocal(7, 0)))
+	assert.False(t, inQuietHours(atLocal(12, 0)))
+
+	stubQuietHours(t, "12:00-13:00")
+	assert.True(t, inQuietHours(atLocal(12, 30)))
+	assert.False(t, inQuietHours(atLocal(23, 0)))
+
+	t.Setenv("OLLAMA_QUIET_HOURS", "23:00-01:00")
+	assert.True(t, inQuietHours(atLocal(23, 30)))
+	assert.False(t, inQuietHours(atLocal(12, 30)))
+
+	t.Setenv("OLLAMA_QUIET_HOURS", "nights")
+	assert.False(t, inQuietHours(atLocal(23, 30)), "invalid hours are ignored")
+}
@@ -0,0 +1,79 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Logs the failures the background updater keeps hitting, like being
+// offline, at most once an hour
+var updateLog = newRateLimitedLogger(time.Hour)
+
+// rateLimitedLogger logs a message at most once per key per window. The
+// first occurrence is logged as is, later ones are counted and summarized
+// once the window has passed.
+type rateLimitedLogger struct {
+	window time.Duration
+
+	// overridden in tests
+	now func() time.Time
+	log func(level slog.Level, msg string)
+
+	mu      sync.Mutex
+	entries map[string]*rateLimitedEntry
+}
+
+type rateLimitedEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+func newRateLimitedLogger(window time.Duration) *rateLimitedLogger {
+	return &rateLimitedLogger{
+		window:  window,
+		now:     time.Now,
+		log:     func(level slog.Level, msg string) { slog.Log(context.Background(), level, msg) },
+		entries: make(map[string]*rateLimitedEntry),
+	}
+}
+
+func (l *rateLimitedLogger) Warn(key, msg string) {
+	l.Log(slog.LevelWarn, key, msg)
+}
+
+func (l *rateLimitedLogger) Error(key, msg string) {
+	l.Log(slog.LevelError, key, msg)
+}
+
+// Log logs msg, unless something was logged for key within the window
+func (l *rateLimitedLogger) Log(level slog.Level, key, msg string) {
+	l.mu.Lock()
+	now := l.now()
+	e, ok := l.entries[key]
+	if ok && now.Sub(e.logged) < l.window {
+		e.suppressed++
+		l.mu.Unlock()
+		return
+	}
+	if ok && e.suppressed > 0 {
+		msg = fmt.Sprintf("%s (repeated %d more times since %s)", msg, e.suppressed, e.logged.Format(time.TimeOnly))
+	}
+	l.entries[key] = &rateLimitedEntry{logged: now}
+	l.mu.Unlock()
+	l.log(level, msg)
+}
+
+// Reset forgets key, once whatever kept failing works again, so the next
+// failure is logged straight away. Any repeats not yet logged are summarized.
+func (l *rateLimitedLogger) Reset(key string) {
+	l.mu.Lock()
+	e, ok := l.entries[key]
+	delete(l.entries, key)
+	l.mu.Unlock()
+	if ok && e.suppressed > 0 {
+		l.log(slog.LevelInfo, fmt.Sprintf("%s recovered, %d more failures since %s weren't logged", key, e.suppressed, e.logged.Format(time.TimeOnly)))
+	}
+}
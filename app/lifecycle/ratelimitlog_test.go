@@ -0,0 +1,49 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitedLogger(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	var logged []string
+	l := newRateLimitedLogger(time.Hour)
+	l.now = func() time.Time { return now }
+	l.log = func(level slog.Level, msg string) { logged = append(logged, fmt.Sprintf("%s %s", level, msg)) }
+
+	for i := 0; i < 10; i++ {
+		l.Warn("update check", "failed to check for update: offline")
+		now = now.Add(time.Minute)
+	}
+	l.Error("update download", "failed to download new release: offline")
+	require.Equal(t, []string{
+		"WARN failed to check for update: offline",
+		"ERROR failed to download new release: offline",
+	}, logged)
+
+	// Once the window passes, the next one is logged with a summary
+	now = now.Add(time.Hour)
+	logged = nil
+	l.Warn("update check", "failed to check for update: offline")
+	assert.Equal(t, []string{"WARN failed to check for update: offline (repeated 9 more times since 09:00:00)"}, logged)
+
+	// Recovering summarizes what wasn't logged, and starts over
+	logged = nil
+	l.Warn("update check", "failed to check for update: offline")
+	l.Reset("update check")
+	l.Warn("update check", "failed to check for update: offline")
+	assert.Equal(t, []string{
+		"INFO update check recovered, 1 more failures since 10:10:00 weren't logged",
+		"WARN failed to check for update: offline",
+	}, logged)
+
+	logged = nil
+	l.Reset("update download")
+	assert.Empty(t, logged, "nothing to summarize")
+}
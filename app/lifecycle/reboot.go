@@ -0,0 +1,196 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/jmorganca/ollama/version"
+)
+
+// InstallerRebootExitCode is what the installer exits with, given
+// /RESTARTEXITCODE, when files in use will only be replaced after a reboot
+const InstallerRebootExitCode = 3010
+
+var (
+	// How long to wait for the installer that relaunched the app to finish
+	// and leave its exit code, overridden by OLLAMA_INSTALLER_EXIT_TIMEOUT
+	InstallerExitTimeout      = 30 * time.Second
+	InstallerExitPollInterval = 250 * time.Millisecond
+)
+
+// installerExitCode extracts the exit code from the error returned waiting
+// on the installer, or -1 if it didn't run to completion
+func installerExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// What the installer's other exit codes mean
+// https://jrsoftware.org/ishelp/index.php?topic=setupexitcodes
+var installerExitReasons = map[int]string{
+	1: "setup failed to initialize",
+	2: "cancelled before installing",
+	3: "fatal error preparing to install",
+	4: "fatal error while installing",
+	5: "cancelled while installing",
+	6: "setup was terminated",
+	7: "setup can't proceed with the install",
+	8: "setup can't proceed until the system is restarted",
+}
+
+// installerOutcome maps an installer exit code to whether a reboot is needed
+// to finish the install
+func installerOutcome(code int) (rebootRequired bool, err error) {
+	switch code {
+	case 0:
+		return false, nil
+	case InstallerRebootExitCode:
+		return true, nil
+	}
+	if reason, ok := installerExitReasons[code]; ok {
+		return false, fmt.Errorf("installer exited with code %d: %s", code, reason)
+	}
+	return false, fmt.Errorf("installer exited with code %d", code)
+}
+
+// InstallResult is how an install run by DoUpgradeAndWait finished
+type InstallResult int
+
+const (
+	InstallSucceeded InstallResult = iota
+	InstallRebootRequired
+	InstallFailed
+)
+
+func (r InstallResult) String() string {
+	switch r {
+	case InstallSucceeded:
+		return "succeeded"
+	case InstallRebootRequired:
+		return "reboot required"
+	default:
+		return "failed"
+	}
+}
+
+// installResult maps an installer exit code to an InstallResult, with the
+// reason when it failed
+func installResult(code int) (InstallResult, error) {
+	rebootRequired, err := installerOutcome(code)
+	switch {
+	case err != nil:
+		return InstallFailed, err
+	case rebootRequired:
+		return InstallRebootRequired, nil
+	default:
+		return InstallSucceeded, nil
+	}
+}
+
+// recordInstallerExit records and reports the result of installing ver,
+// leaving the reboot for the user to pick a time for rather than forcing one.
+// A successful install is reported once the new version starts.
+func recordInstallerExit(ver string, code int) error {
+	rebootRequired, err := installerOutcome(code)
+	if err != nil {
+		recordUpdate(ver, "install failed: "+err.Error())
+		<-reportUpdateResult(version.Version, ver, "install failed: "+err.Error())
+		return err
+	}
+	if rebootRequired {
+		slog.Info(fmt.Sprintf("installing %s requires a reboot to complete", ver))
+		store.SetRebootPending(ver)
+		recordUpdate(ver, "installed, reboot pending")
+		<-reportUpdateResult(version.Version, ver, "installed, reboot pending")
+	}
+	return nil
+}
+
+// startInstallerExit notes in InstallerExitFile that ver is being installed,
+// for the installer's exit code to be appended to
+func startInstallerExit(ver string) error {
+	return os.WriteFile(InstallerExitFile, []byte(ver+"\n"), 0o644)
+}
+
+// readInstallerExit returns the version being installed and, once the
+// installer has finished, its exit code
+func readInstallerExit() (ver string, code int, finished bool, err error) {
+	data, err := os.ReadFile(InstallerExitFile)
+	if err != nil {
+		return "", 0, false, err
+	}
+	lines := strings.Fields(string(data))
+	if len(lines) == 0 {
+		return "", 0, false, fmt.Errorf("%s is empty", InstallerExitFile)
+	}
+	if len(lines) == 1 {
+		return lines[0], 0, false, nil
+	}
+	code, err = strconv.Atoi(lines[1])
+	if err != nil {
+		return lines[0], 0, false, fmt.Errorf("bad installer exit code %q: %w", lines[1], err)
+	}
+	return lines[0], code, true, nil
+}
+
+// waitInstallerExit waits up to timeout for the installer to leave its exit
+// code, then clears InstallerExitFile. It returns os.ErrNotExist when no
+// install was started.
+func waitInstallerExit(ctx context.Context, timeout time.Duration) (string, int, error) {
+	defer os.Remove(InstallerExitFile)
+	deadline := time.After(timeout)
+	for {
+		ver, code, finished, err := readInstallerExit()
+		if err != nil || finished {
+			return ver, code, err
+		}
+		select {
+		case <-ctx.Done():
+			return ver, 0, ctx.Err()
+		case <-deadline:
+			return ver, 0, fmt.Errorf("installer for %s didn't leave an exit code", ver)
+		case <-time.After(InstallerExitPollInterval):
+		}
+	}
+}
+
+// CheckInstallerExit records how the last install went. The installer
+// closes the app to replace it, so its exit code is left in
+// InstallerExitFile, usually just after it relaunched the app.
+func CheckInstallerExit(ctx context.Context) error {
+	ver, code, err := waitInstallerExit(ctx, envDuration("OLLAMA_INSTALLER_EXIT_TIMEOUT", InstallerExitTimeout))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return recordInstallerExit(ver, code)
+}
+
+// RebootPending returns the version waiting on a reboot to finish
+// installing, clearing it once that version is running
+func RebootPending() (string, bool) {
+	pending := store.GetRebootPending()
+	if pending == "" {
+		return "", false
+	}
+	if !isOlderVersion(version.Version, pending) {
+		store.SetRebootPending("")
+		return "", false
+	}
+	return pending, true
+}
@@ -0,0 +1,131 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+// TestInstallerHelperProcess stands in for the installer, exiting with
+// OLLAMA_TEST_INSTALLER_EXIT
+func TestInstallerHelperProcess(t *testing.T) {
+	code := os.Getenv("OLLAMA_TEST_INSTALLER_EXIT")
+	if code == "" {
+		return
+	}
+	n, _ := strconv.Atoi(code)
+	os.Exit(n)
+}
+
+func runFakeInstaller(t *testing.T, code int) error {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInstallerHelperProcess$")
+	cmd.Env = append(os.Environ(), "OLLAMA_TEST_INSTALLER_EXIT="+strconv.Itoa(code))
+	return cmd.Run()
+}
+
+func TestInstallerExitCode(t *testing.T) {
+	assert.Equal(t, 0, installerExitCode(runFakeInstaller(t, 0)))
+	assert.Equal(t, 5, installerExitCode(runFakeInstaller(t, 5)))
+	assert.Equal(t, -1, installerExitCode(errors.New("killed")))
+}
+
+func TestInstallerOutcome(t *testing.T) {
+	reboot, err := installerOutcome(0)
+	require.NoError(t, err)
+	assert.False(t, reboot)
+
+	reboot, err = installerOutcome(InstallerRebootExitCode)
+	require.NoError(t, err)
+	assert.True(t, reboot, "3010 means the install completes on reboot")
+
+	_, err = installerOutcome(1)
+	assert.ErrorContains(t, err, "exited with code 1")
+	_, err = installerOutcome(-1)
+	assert.Error(t, err)
+}
+
+func TestInstallResult(t *testing.T) {
+	result, err := installResult(0)
+	require.NoError(t, err)
+	assert.Equal(t, InstallSucceeded, result)
+
+	result, err = installResult(InstallerRebootExitCode)
+	require.NoError(t, err)
+	assert.Equal(t, InstallRebootRequired, result)
+
+	for code, reason := range installerExitReasons {
+		result, err := installResult(code)
+		assert.Equal(t, InstallFailed, result, "code %d", code)
+		assert.ErrorContains(t, err, reason)
+	}
+
+	result, err = installResult(42)
+	assert.Equal(t, InstallFailed, result)
+	assert.ErrorContains(t, err, "exited with code 42")
+	result, err = installResult(-1)
+	assert.Equal(t, InstallFailed, result)
+	assert.Error(t, err)
+}
+
+func stubInstallerExitFile(t *testing.T) {
+	t.Helper()
+	orig := InstallerExitFile
+	t.Cleanup(func() { InstallerExitFile = orig })
+	InstallerExitFile = filepath.Join(t.TempDir(), "installer-exit")
+}
+
+func TestCheckInstallerExit(t *testing.T) {
+	stubInstallerExitFile(t)
+	stubUpdateReportURL(t, "")
+	t.Setenv("OLLAMA_INSTALLER_EXIT_TIMEOUT", "")
+	origPending := store.GetRebootPending()
+	t.Cleanup(func() { store.SetRebootPending(origPending) })
+	store.SetRebootPending("")
+
+	// Nothing was installed
+	require.NoError(t, CheckInstallerExit(context.Background()))
+
+	// The installer finishes after relaunching the app
+	require.NoError(t, startInstallerExit("0.1.2"))
+	go func() {
+		time.Sleep(2 * InstallerExitPollInterval)
+		f, err := os.OpenFile(InstallerExitFile, os.O_APPEND|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\r\n", InstallerRebootExitCode)
+			f.Close()
+		}
+	}()
+	require.NoError(t, CheckInstallerExit(context.Background()))
+	assert.Equal(t, "0.1.2", store.GetRebootPending())
+	assert.NoFileExists(t, InstallerExitFile)
+
+	require.NoError(t, os.WriteFile(InstallerExitFile, []byte("0.1.2\n5\n"), 0o644))
+	assert.ErrorContains(t, CheckInstallerExit(context.Background()), "cancelled while installing")
+	assert.NoFileExists(t, InstallerExitFile)
+}
+
+func TestCheckInstallerExitTimeout(t *testing.T) {
+	stubInstallerExitFile(t)
+	t.Setenv("OLLAMA_INSTALLER_EXIT_TIMEOUT", "10ms")
+
+	// The installer was killed before it could leave an exit code
+	require.NoError(t, startInstallerExit("0.1.2"))
+	assert.ErrorContains(t, CheckInstallerExit(context.Background()), "didn't leave an exit code")
+	assert.NoFileExists(t, InstallerExitFile)
+
+	require.NoError(t, os.WriteFile(InstallerExitFile, []byte("0.1.2\nnope\n"), 0o644))
+	assert.ErrorContains(t, CheckInstallerExit(context.Background()), "bad installer exit code")
+	assert.NoFileExists(t, InstallerExitFile)
+}
@@ -0,0 +1,93 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+var (
+	// UpdateReportTimeout bounds how long a result report may take
+	UpdateReportTimeout = 10 * time.Second
+
+	// overridden in tests
+	updateReportURLSetting = store.GetUpdateReportURL
+)
+
+// UpdateResult is reported to the update report endpoint, letting admins
+// see which machines took an update
+type UpdateResult struct {
+	ID          string `json:"id"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	Result      string `json:"result"`
+}
+
+// updateReportURL returns where results are reported, or "" when reporting
+// isn't enabled. OLLAMA_UPDATE_REPORT_URL overrides the stored preference.
+func updateReportURL() string {
+	if u := os.Getenv("OLLAMA_UPDATE_REPORT_URL"); u != "" {
+		return u
+	}
+	return updateReportURLSetting()
+}
+
+func newUpdateResult(from, to, result string) UpdateResult {
+	return UpdateResult{
+		ID:          machineID(),
+		FromVersion: from,
+		ToVersion:   to,
+		Result:      result,
+	}
+}
+
+// sendUpdateResult posts r to endpoint
+func sendUpdateResult(ctx context.Context, endpoint string, r UpdateResult) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, UpdateReportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// reportUpdateResult reports the outcome of an update in the background, if
+// enabled. The returned channel is closed once the report is done, for
+// callers about to exit.
+func reportUpdateResult(from, to, result string) <-chan struct{} {
+	done := make(chan struct{})
+	endpoint := updateReportURL()
+	if endpoint == "" {
+		close(done)
+		return done
+	}
+	r := newUpdateResult(from, to, result)
+	go func() {
+		defer close(done)
+		if err := sendUpdateResult(context.Background(), endpoint, r); err != nil {
+			slog.Debug(fmt.Sprintf("failed to report update result: %s", err))
+		}
+	}()
+	return done
+}
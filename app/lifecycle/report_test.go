@@ -0,0 +1,81 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubUpdateReportURL(t *testing.T, u string) {
+	t.Helper()
+	origURL, origID := updateReportURLSetting, machineID
+	t.Cleanup(func() { updateReportURLSetting, machineID = origURL, origID })
+	updateReportURLSetting = func() string { return u }
+	machineID = func() string { return "machine-1" }
+	t.Setenv("OLLAMA_UPDATE_REPORT_URL", "")
+}
+
+func TestNewUpdateResult(t *testing.T) {
+	stubUpdateReportURL(t, "")
+	b, err := json.Marshal(newUpdateResult("0.1.29", "0.1.30", "installed"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"machine-1","from_version":"0.1.29","to_version":"0.1.30","result":"installed"}`, string(b))
+}
+
+func TestUpdateReportURL(t *testing.T) {
+	stubUpdateReportURL(t, "")
+	assert.Empty(t, updateReportURL(), "reporting should be opt-in")
+
+	stubUpdateReportURL(t, "https://fleet.example.com/stored")
+	assert.Equal(t, "https://fleet.example.com/stored", updateReportURL())
+
+	t.Setenv("OLLAMA_UPDATE_REPORT_URL", "https://fleet.example.com/env")
+	assert.Equal(t, "https://fleet.example.com/env", updateReportURL())
+}
+
+func TestReportUpdateResult(t *testing.T) {
+	received := make(chan UpdateResult, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var result UpdateResult
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&result))
+		received <- result
+	}))
+	defer ts.Close()
+
+	stubUpdateReportURL(t, ts.URL)
+	select {
+	case <-reportUpdateResult("0.1.29", "0.1.30", "install started"):
+	case <-time.After(5 * time.Second):
+		t.Fatal("report did not finish")
+	}
+	assert.Equal(t, UpdateResult{ID: "machine-1", FromVersion: "0.1.29", ToVersion: "0.1.30", Result: "install started"}, <-received)
+
+	stubUpdateReportURL(t, "")
+	select {
+	case <-reportUpdateResult("0.1.29", "0.1.30", "installed"):
+	default:
+		t.Fatal("should finish immediately when reporting is disabled")
+	}
+}
+
+func TestReportUpdateResultFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	origTimeout := UpdateReportTimeout
+	t.Cleanup(func() { UpdateReportTimeout = origTimeout })
+	UpdateReportTimeout = 10 * time.Millisecond
+
+	stubUpdateReportURL(t, ts.URL)
+	assert.Error(t, sendUpdateResult(context.Background(), ts.URL, newUpdateResult("0.1.29", "0.1.30", "installed")))
+}
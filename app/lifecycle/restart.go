@@ -0,0 +1,76 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Restarting the app starts a fresh instance of the executable, then quits
+// this one. Until this instance has stopped its server, the new one would
+// take it for another instance already running and exit, so it's started
+// with OLLAMA_APP_RESTARTED and waits for the server to go first.
+const restartedEnv = "OLLAMA_APP_RESTARTED"
+
+var (
+	// How long a restarted app waits for the instance it replaces to shut
+	// down, overridden by OLLAMA_APP_RESTART_TIMEOUT
+	RestartTimeout      = 30 * time.Second
+	RestartPollInterval = 250 * time.Millisecond
+
+	// overridden in tests
+	appExecutable  = os.Executable
+	restartCommand = exec.Command
+	serverRunning  = IsServerRunning
+)
+
+// RestartApp starts a new instance of the app and, once it's running, calls
+// quit to shut this one down. Nothing is quit if the new instance can't be
+// started, or while an installer is running.
+func RestartApp(quit func()) error {
+	if installerRunning() {
+		return errInstallInProgress
+	}
+	exe, err := appExecutable()
+	if err != nil {
+		return fmt.Errorf("unable to find the app executable: %w", err)
+	}
+	cmd := restartCommand(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), restartedEnv+"="+strconv.Itoa(os.Getpid()))
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start a new instance of the app: %w", err)
+	}
+	slog.Info(fmt.Sprintf("started new instance %d of the app, quitting", cmd.Process.Pid))
+	if err := cmd.Process.Release(); err != nil {
+		slog.Debug(fmt.Sprintf("failed to release new instance: %s", err))
+	}
+	quit()
+	return nil
+}
+
+// WaitForReplacedInstance holds a restarted app back until the instance it
+// replaces has stopped its server, or RestartTimeout passes
+func WaitForReplacedInstance(ctx context.Context) {
+	pid := os.Getenv(restartedEnv)
+	if pid == "" {
+		return
+	}
+	// The server and anything else started from here isn't restarted
+	os.Unsetenv(restartedEnv)
+	timeout := time.After(envDuration("OLLAMA_APP_RESTART_TIMEOUT", RestartTimeout))
+	for serverRunning(ctx) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout:
+			slog.Warn(fmt.Sprintf("instance %s still running after restarting, carrying on", pid))
+			return
+		case <-time.After(RestartPollInterval):
+		}
+	}
+	slog.Info(fmt.Sprintf("restarted, replacing instance %s", pid))
+}
@@ -0,0 +1,108 @@
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRestartHelperProcess stands in for the new instance, writing the pid
+// of the instance it replaces to OLLAMA_TEST_RESTART_OUT
+func TestRestartHelperProcess(t *testing.T) {
+	out := os.Getenv("OLLAMA_TEST_RESTART_OUT")
+	if out == "" {
+		return
+	}
+	os.WriteFile(out, []byte(os.Getenv(restartedEnv)), 0o644) //nolint:errcheck
+	os.Exit(0)
+}
+
+func stubRestart(t *testing.T, command func(name string, args ...string) *exec.Cmd) {
+	t.Helper()
+	origExe, origCommand := appExecutable, restartCommand
+	t.Cleanup(func() { appExecutable, restartCommand = origExe, origCommand })
+	appExecutable = func() (string, error) { return "/opt/ollama/ollama app", nil }
+	restartCommand = command
+}
+
+func TestRestartApp(t *testing.T) {
+	stubInstallerRunning(t, false)
+	out := filepath.Join(t.TempDir(), "restarted")
+	t.Setenv("OLLAMA_TEST_RESTART_OUT", out)
+
+	var spawned *exec.Cmd
+	stubRestart(t, func(name string, args ...string) *exec.Cmd {
+		assert.Equal(t, "/opt/ollama/ollama app", name)
+		assert.Equal(t, os.Args[1:], args)
+		spawned = exec.Command(os.Args[0], "-test.run=^TestRestartHelperProcess$")
+		return spawned
+	})
+	quits := 0
+	require.NoError(t, RestartApp(func() {
+		require.NotNil(t, spawned)
+		assert.NotNil(t, spawned.Process, "the new instance starts before this one quits")
+		quits++
+	}))
+	assert.Equal(t, 1, quits)
+	assert.Eventually(t, func() bool {
+		b, err := os.ReadFile(out)
+		return err == nil && string(b) == strconv.Itoa(os.Getpid())
+	}, 5*time.Second, 10*time.Millisecond, "the new instance should know which one it replaces")
+}
+
+func TestRestartAppKeepsRunningOnFailure(t *testing.T) {
+	stubInstallerRunning(t, false)
+	stubRestart(t, func(string, ...string) *exec.Cmd {
+		return exec.Command(filepath.Join(t.TempDir(), "missing"))
+	})
+	quit := func() { t.Error("should keep running when the new instance can't start") }
+	assert.ErrorContains(t, RestartApp(quit), "unable to start a new instance")
+
+	stubInstallerRunning(t, true)
+	stubRestart(t, func(string, ...string) *exec.Cmd {
+		t.Error("nothing should start while installing")
+		return exec.Command(os.Args[0])
+	})
+	assert.ErrorIs(t, RestartApp(quit), errInstallInProgress)
+}
+
+func TestWaitForReplacedInstance(t *testing.T) {
+	orig, origInterval := serverRunning, RestartPollInterval
+	t.Cleanup(func() { serverRunning, RestartPollInterval = orig, origInterval })
+	RestartPollInterval = time.Millisecond
+	checks := 0
+	running := func(n int) func(context.Context) bool {
+		checks = 0
+		return func(context.Context) bool {
+			checks++
+			return checks <= n
+		}
+	}
+
+	// Not restarted, so a running server is another instance
+	serverRunning = running(5)
+	t.Setenv(restartedEnv, "")
+	WaitForReplacedInstance(context.Background())
+	assert.Zero(t, checks)
+
+	serverRunning = running(3)
+	t.Setenv(restartedEnv, "1234")
+	WaitForReplacedInstance(context.Background())
+	assert.Equal(t, 4, checks, "waits until the old server stops")
+	_, set := os.LookupEnv(restartedEnv)
+	assert.False(t, set, "not passed on to the server")
+
+	serverRunning = running(1000000)
+	t.Setenv(restartedEnv, "1234")
+	t.Setenv("OLLAMA_APP_RESTART_TIMEOUT", "20ms")
+	start := time.Now()
+	WaitForReplacedInstance(context.Background())
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,102 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// UpdateKeep is how many installed updates are retained under
+// UpdateStageDir, newest first, overridden by OLLAMA_UPDATE_KEEP. 0 removes
+// each installer once it's installed.
+var UpdateKeep = 1
+
+// retainedDirName is the directory under UpdateStageDir where installed
+// updates are retained, one directory per version. It's never treated as a
+// staged update.
+const retainedDirName = "retained"
+
+func retainedDir() string {
+	return filepath.Join(UpdateStageDir, retainedDirName)
+}
+
+// stagedUpdateDir returns the directory holding the staged update
+func stagedUpdateDir() (string, error) {
+	if stageDir, err := findStagedManifest(); err == nil {
+		return stageDir, nil
+	}
+	installer, err := findStagedInstaller()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(installer), nil
+}
+
+// retainInstalledUpdate moves the staged update for ver, which is now
+// installed, out of the way of future downloads and prunes the retained
+// updates down to OLLAMA_UPDATE_KEEP
+func retainInstalledUpdate(ver string) {
+	keep := envInt("OLLAMA_UPDATE_KEEP", UpdateKeep)
+	if keep > 0 {
+		if err := moveToRetained(ver); err != nil {
+			slog.Warn(fmt.Sprintf("failed to retain installed update %s: %s", ver, err))
+		}
+	}
+	cleanupOldDownloads()
+	pruneRetainedUpdates(keep)
+}
+
+func moveToRetained(ver string) error {
+	src, err := stagedUpdateDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(retainedDir(), 0o755); err != nil {
+		return err
+	}
+	dst := filepath.Join(retainedDir(), url.PathEscape(ver))
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// pruneRetainedUpdates removes all but the keep newest retained updates,
+// along with anything that isn't named after a version
+func pruneRetainedUpdates(keep int) {
+	entries, err := os.ReadDir(retainedDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		slog.Warn(fmt.Sprintf("failed to list retained updates: %s", err))
+		return
+	}
+	var remove, retained []string
+	versions := map[string]string{}
+	for _, entry := range entries {
+		ver, err := url.PathUnescape(entry.Name())
+		if _, _, ok := parseVersion(ver); err != nil || !ok || !entry.IsDir() {
+			remove = append(remove, entry.Name())
+			continue
+		}
+		retained = append(retained, entry.Name())
+		versions[entry.Name()] = ver
+	}
+	sort.Slice(retained, func(i, j int) bool {
+		return isOlderVersion(versions[retained[j]], versions[retained[i]])
+	})
+	if len(retained) > keep {
+		remove = append(remove, retained[keep:]...)
+	}
+	for _, name := range remove {
+		dir := filepath.Join(retainedDir(), name)
+		slog.Debug("cleaning up retained update: " + dir)
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn(fmt.Sprintf("failed to clean up retained update %s", err))
+		}
+	}
+}
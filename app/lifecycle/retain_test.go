@@ -0,0 +1,76 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func retainTestUpdates(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		dir := filepath.Join(retainedDir(), name)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, Installer), []byte("installer"), 0o755))
+	}
+}
+
+func retainedNames(t *testing.T) []string {
+	t.Helper()
+	entries, err := os.ReadDir(retainedDir())
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestPruneRetainedUpdates(t *testing.T) {
+	for _, tc := range []struct {
+		keep     int
+		expected []string
+	}{
+		{0, nil},
+		{1, []string{"0.1.10"}},
+		{2, []string{"0.1.10", "0.1.9"}},
+		{5, []string{"0.1.10", "0.1.8", "0.1.9"}},
+	} {
+		UpdateStageDir = t.TempDir()
+		retainTestUpdates(t, "0.1.8", "0.1.10", "0.1.9", "junk")
+		pruneRetainedUpdates(tc.keep)
+		assert.ElementsMatch(t, tc.expected, retainedNames(t), "keep %d", tc.keep)
+	}
+}
+
+func TestRetainInstalledUpdate(t *testing.T) {
+	t.Run("keeps the newest", func(t *testing.T) {
+		t.Setenv("OLLAMA_UPDATE_KEEP", "2")
+		stageTestInstaller(t, "installer")
+		retainTestUpdates(t, "0.1.0", "0.1.1")
+		retainInstalledUpdate("0.1.2")
+		assert.ElementsMatch(t, []string{"0.1.1", "0.1.2"}, retainedNames(t))
+		_, err := findStagedInstaller()
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("OLLAMA_UPDATE_KEEP", "0")
+		installer := stageTestInstaller(t, "installer")
+		retainTestUpdates(t, "0.1.1")
+		retainInstalledUpdate("0.1.2")
+		assert.Empty(t, retainedNames(t))
+		_, err := os.Stat(installer)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("survives cleanup", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		retainTestUpdates(t, "0.1.1")
+		cleanupOldDownloads()
+		assert.Equal(t, []string{"0.1.1"}, retainedNames(t))
+	})
+}
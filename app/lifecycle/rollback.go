@@ -0,0 +1,87 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// ReleaseInfo describes a release that can be installed to roll back
+type ReleaseInfo struct {
+	Version  string `json:"version"`
+	URL      string `json:"url"`
+	Checksum string `json:"sha256,omitempty"`
+}
+
+// parseReleaseList decodes a release list, verified like an update check
+// response so a tampered list can't roll the app back to anything
+func parseReleaseList(body []byte) ([]ReleaseInfo, error) {
+	body, _, err := verifyResponseBody(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release list: %w", err)
+	}
+	var releases []ReleaseInfo
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return nil, fmt.Errorf("malformed release list: %w", err)
+	}
+	valid := make([]ReleaseInfo, 0, len(releases))
+	for _, r := range releases {
+		if r.Version == "" || r.URL == "" {
+			slog.Debug(fmt.Sprintf("skipping incomplete release entry %+v", r))
+			continue
+		}
+		valid = append(valid, r)
+	}
+	return valid, nil
+}
+
+// ListReleases asks the update server for the releases available to roll back to
+func ListReleases(ctx context.Context) ([]ReleaseInfo, error) {
+	req, err := newUpdateCheckRequest(ctx, updateCheckURLBase(), url.Values{"list": []string{"1"}})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status listing releases %d", resp.StatusCode)
+	}
+
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body response: %w", err)
+	}
+	return parseReleaseList(body)
+}
+
+// RollbackTo downloads the installer for an older version and runs upgrade
+// to install it
+func RollbackTo(ctx context.Context, ver string, upgrade func() error) error {
+	releases, err := ListReleases(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range releases {
+		if r.Version != ver {
+			continue
+		}
+		slog.Info(fmt.Sprintf("rolling back to version %s", ver))
+		err := DownloadNewRelease(ctx, UpdateResponse{
+			UpdateURL:     r.URL,
+			UpdateVersion: r.Version,
+			Checksum:      r.Checksum,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to download version %s: %w", ver, err)
+		}
+		return upgrade()
+	}
+	return fmt.Errorf("version %s is not available to roll back to", ver)
+}
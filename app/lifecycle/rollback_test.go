@@ -0,0 +1,97 @@
+package lifecycle
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReleaseList(t *testing.T) {
+	releases, err := parseReleaseList([]byte(`[
+		{"version": "0.1.28", "url": "https://example.com/v0.1.28/OllamaSetup.exe"},
+		{"version": "", "url": "https://example.com/bogus/OllamaSetup.exe"},
+		{"version": "0.1.27", "url": "https://example.com/v0.1.27/OllamaSetup.exe", "sha256": "abc"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, []ReleaseInfo{
+		{Version: "0.1.28", URL: "https://example.com/v0.1.28/OllamaSetup.exe"},
+		{Version: "0.1.27", URL: "https://example.com/v0.1.27/OllamaSetup.exe", Checksum: "abc"},
+	}, releases)
+
+	_, err = parseReleaseList([]byte(`{"url": "nope"}`))
+	assert.Error(t, err)
+}
+
+func TestParseSignedReleaseList(t *testing.T) {
+	const list = `[{"version": "0.1.28", "url": "https://example.com/v0.1.28/OllamaSetup.exe", "sha256": "abc"}]`
+	key := setTestPublicKey(t)
+
+	releases, err := parseReleaseList([]byte(signJWS(t, key, "EdDSA", list)))
+	require.NoError(t, err)
+	assert.Equal(t, []ReleaseInfo{{Version: "0.1.28", URL: "https://example.com/v0.1.28/OllamaSetup.exe", Checksum: "abc"}}, releases)
+
+	_, err = parseReleaseList([]byte(list))
+	assert.ErrorIs(t, err, errUnsignedResponse)
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = parseReleaseList([]byte(signJWS(t, otherKey, "EdDSA", list)))
+	assert.ErrorContains(t, err, "signature verification failed")
+}
+
+func TestRollbackTo(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	setupTestKey(t)
+	UpdateStageDir = t.TempDir()
+
+	installer := []byte("older installer")
+	sum := sha256.Sum256(installer)
+
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/api/update", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("list"))
+		json.NewEncoder(w).Encode([]ReleaseInfo{ //nolint:errcheck
+			{Version: "0.1.28", URL: ts.URL + "/download/v0.1.28/OllamaSetup.exe", Checksum: hex.EncodeToString(sum[:])},
+		})
+	})
+	mux.HandleFunc("/download/v0.1.28/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v0.1.28"`)
+		w.Write(installer) //nolint:errcheck
+	})
+	UpdateCheckURLBase = ts.URL + "/api/update"
+
+	t.Run("known version", func(t *testing.T) {
+		upgraded := false
+		err := RollbackTo(context.Background(), "0.1.28", func() error {
+			upgraded = true
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, upgraded)
+
+		staged, err := os.ReadFile(filepath.Join(UpdateStageDir, "v0.1.28", stageFileName(Installer, ts.URL+"/download/v0.1.28/OllamaSetup.exe")))
+		require.NoError(t, err)
+		assert.Equal(t, installer, staged)
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		err := RollbackTo(context.Background(), "0.0.1", func() error {
+			t.Error("unexpected upgrade")
+			return nil
+		})
+		assert.ErrorContains(t, err, "not available")
+	})
+}
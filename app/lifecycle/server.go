@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/jmorganca/ollama/api"
@@ -43,36 +44,40 @@ func getCLIFullPath(command string) string {
 	return command
 }
 
-func SpawnServer(ctx context.Context, command string) (chan int, error) {
-	done := make(chan int)
+var (
+	// ServerStopGracePeriod is how long in-flight requests are given to
+	// complete when the server is interrupted for a restart
+	ServerStopGracePeriod = 5 * time.Second
 
-	logDir := filepath.Dir(ServerLogFile)
-	_, err := os.Stat(logDir)
-	if errors.Is(err, os.ErrNotExist) {
-		if err := os.MkdirAll(logDir, 0o755); err != nil {
-			return done, fmt.Errorf("create ollama server log dir %s: %v", logDir, err)
-		}
-	}
+	serverMu         sync.Mutex
+	serverCmd        *exec.Cmd
+	serverExited     chan struct{}
+	serverRestarting bool
 
+	supervisor     *serverSupervisor
+	stopSupervisor context.CancelFunc
+)
+
+func startServer(ctx context.Context, command string) (*exec.Cmd, error) {
 	cmd := getCmd(ctx, getCLIFullPath(command))
 	// send stdout and stderr to a file
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return done, fmt.Errorf("failed to spawn server stdout pipe %s", err)
+		return nil, fmt.Errorf("failed to spawn server stdout pipe %s", err)
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return done, fmt.Errorf("failed to spawn server stderr pipe %s", err)
+		return nil, fmt.Errorf("failed to spawn server stderr pipe %s", err)
 	}
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return done, fmt.Errorf("failed to spawn server stdin pipe %s", err)
+	// stdin is closed by Wait once the server exits
+	if _, err := cmd.StdinPipe(); err != nil {
+		return nil, fmt.Errorf("failed to spawn server stdin pipe %s", err)
 	}
 
 	// TODO - rotation
 	logFile, err := os.OpenFile(ServerLogFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0755)
 	if err != nil {
-		return done, fmt.Errorf("failed to create server log %w", err)
+		return nil, fmt.Errorf("failed to create server log %w", err)
 	}
 	go func() {
 		defer logFile.Close()
@@ -85,44 +90,128 @@ func SpawnServer(ctx context.Context, command string) (chan int, error) {
 
 	// run the command and wait for it to finish
 	if err := cmd.Start(); err != nil {
-		return done, fmt.Errorf("failed to start server %w", err)
+		return nil, fmt.Errorf("failed to start server %w", err)
 	}
 	if cmd.Process != nil {
 		slog.Info(fmt.Sprintf("started ollama server with pid %d", cmd.Process.Pid))
 	}
+
+	serverMu.Lock()
+	serverCmd = cmd
+	serverExited = make(chan struct{})
+	serverMu.Unlock()
+	return cmd, nil
+}
+
+// SpawnServer starts the server and keeps it running until ctx is done or
+// StopServer is called, at which point the exit code is sent on the
+// returned channel
+func SpawnServer(ctx context.Context, command string, cb ServerCallbacks) (chan int, error) {
+	done := make(chan int)
+
+	logDir := filepath.Dir(ServerLogFile)
+	_, err := os.Stat(logDir)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(logDir, 0o755); err != nil {
+			return done, fmt.Errorf("create ollama server log dir %s: %v", logDir, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd, err := startServer(ctx, command)
+	if err != nil {
+		cancel()
+		return done, err
+	}
 	slog.Info(fmt.Sprintf("ollama server logs %s", ServerLogFile))
 
-	go func() {
-		// Keep the server running unless we're shuttind down the app
-		crashCount := 0
-		for {
-			cmd.Wait() //nolint:errcheck
-			stdin.Close()
-			var code int
-			if cmd.ProcessState != nil {
-				code = cmd.ProcessState.ExitCode()
+	s := &serverSupervisor{
+		start: func(ctx context.Context) (serverProcess, error) {
+			cmd, err := startServer(ctx, command)
+			if err != nil {
+				return nil, err
 			}
+			return cmdProcess{cmd}, nil
+		},
+		expectedExit: func() bool {
+			serverMu.Lock()
+			defer serverMu.Unlock()
+			restarting := serverRestarting
+			serverRestarting = false
+			return restarting
+		},
+		cb: cb,
+	}
+	serverMu.Lock()
+	supervisor = s
+	stopSupervisor = cancel
+	serverMu.Unlock()
 
-			select {
-			case <-ctx.Done():
-				slog.Debug(fmt.Sprintf("server shutdown with exit code %d", code))
-				done <- code
-				return
-			default:
-				crashCount++
-				slog.Warn(fmt.Sprintf("server crash %d - exit code %d - respawning", crashCount, code))
-				time.Sleep(500 * time.Millisecond)
-				if err := cmd.Start(); err != nil {
-					slog.Error(fmt.Sprintf("failed to restart server %s", err))
-					// Keep trying, but back off if we keep failing
-					time.Sleep(time.Duration(crashCount) * time.Second)
-				}
-			}
-		}
+	go func() {
+		// Keep the server running unless we're shutting down the app
+		code := s.run(ctx, cmdProcess{cmd})
+		cancel()
+		done <- code
 	}()
 	return done, nil
 }
 
+// StopServer stops the managed server without restarting it
+func StopServer() {
+	serverMu.Lock()
+	stop := stopSupervisor
+	serverMu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+// ServerStatus reports what the server supervisor is doing
+func ServerStatus() ServerState {
+	serverMu.Lock()
+	s := supervisor
+	serverMu.Unlock()
+	if s == nil {
+		return ServerStopped
+	}
+	return s.State()
+}
+
+// RestartServer stops the managed server and lets the SpawnServer loop start
+// a fresh one. Where the server can be interrupted, in-flight requests get
+// ServerStopGracePeriod to complete. Otherwise, as on Windows, where the
+// server doesn't share a console with the app to send it a Ctrl-Break, it's
+// killed straight away.
+func RestartServer() error {
+	serverMu.Lock()
+	cmd := serverCmd
+	exited := serverExited
+	serverRestarting = true
+	serverMu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		serverMu.Lock()
+		serverRestarting = false
+		serverMu.Unlock()
+		return fmt.Errorf("server is not running")
+	}
+
+	slog.Info(fmt.Sprintf("restarting ollama server with pid %d", cmd.Process.Pid))
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		slog.Debug(fmt.Sprintf("unable to interrupt server, killing: %s", err))
+	} else {
+		select {
+		case <-exited:
+			return nil
+		case <-time.After(ServerStopGracePeriod):
+		}
+		slog.Debug("server did not stop within grace period, killing")
+	}
+	if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+	return nil
+}
+
 func IsServerRunning(ctx context.Context) bool {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
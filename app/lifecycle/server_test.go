@@ -0,0 +1,54 @@
+package lifecycle
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServerHelperProcess stands in for a server that keeps running until
+// it's stopped
+func TestServerHelperProcess(t *testing.T) {
+	if os.Getenv("OLLAMA_TEST_SERVER") == "" {
+		return
+	}
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+func TestRestartServerDoesNotWaitOutGracePeriod(t *testing.T) {
+	origGrace := ServerStopGracePeriod
+	t.Cleanup(func() { ServerStopGracePeriod = origGrace })
+	ServerStopGracePeriod = time.Minute
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestServerHelperProcess$")
+	cmd.Env = append(os.Environ(), "OLLAMA_TEST_SERVER=1")
+	require.NoError(t, cmd.Start())
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait() //nolint:errcheck
+		close(exited)
+	}()
+	serverMu.Lock()
+	serverCmd, serverExited = cmd, exited
+	serverMu.Unlock()
+	t.Cleanup(func() {
+		serverMu.Lock()
+		serverCmd, serverExited, serverRestarting = nil, nil, false
+		serverMu.Unlock()
+	})
+
+	// Interrupted where that's supported, otherwise killed straight away
+	start := time.Now()
+	require.NoError(t, RestartServer())
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("server still running")
+	}
+	assert.Less(t, time.Since(start), ServerStopGracePeriod)
+}
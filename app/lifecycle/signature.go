@@ -0,0 +1,117 @@
+package lifecycle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// UpdatePublicKey is the base64 encoded ed25519 public key that signs
+// update check responses. It is set at build time with -ldflags and can be
+// overridden with OLLAMA_UPDATE_PUBLIC_KEY. Once a key is configured,
+// unsigned responses are rejected.
+var UpdatePublicKey = ""
+
+var errUnsignedResponse = errors.New("update response is not signed")
+
+type jwsHeader struct {
+	Algorithm string `json:"alg"`
+}
+
+func updatePublicKey() (ed25519.PublicKey, error) {
+	encoded := UpdatePublicKey
+	if v := os.Getenv("OLLAMA_UPDATE_PUBLIC_KEY"); v != "" {
+		encoded = v
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid update public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyJWS checks a compact serialized EdDSA JWS and returns its payload
+func verifyJWS(token string, key ed25519.PublicKey) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWS: expected 3 parts, got %d", len(parts))
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWS header: %w", err)
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, fmt.Errorf("malformed JWS header: %w", err)
+	}
+	if header.Algorithm != "EdDSA" {
+		return nil, fmt.Errorf("unsupported JWS algorithm %q", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWS signature: %w", err)
+	}
+	if !ed25519.Verify(key, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, fmt.Errorf("JWS signature verification failed")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWS payload: %w", err)
+	}
+	return payload, nil
+}
+
+// decodeUpdateResponse parses an update check response body, which is
+// either plain JSON or a JWS wrapping the JSON. Signatures are checked
+// against the configured update public key.
+func decodeUpdateResponse(body []byte) (UpdateResponse, error) {
+	var updateResp UpdateResponse
+	body, signed, err := verifyResponseBody(body)
+	if err != nil {
+		return updateResp, err
+	}
+	if err := json.Unmarshal(body, &updateResp); err != nil {
+		return updateResp, err
+	}
+	updateResp.Signed = signed
+	return updateResp, nil
+}
+
+// verifyResponseBody returns the JSON in an update server response body,
+// checking its signature if it's a JWS, and whether it was signed. Plain
+// JSON is refused once an update public key is configured.
+func verifyResponseBody(body []byte) ([]byte, bool, error) {
+	key, err := updatePublicKey()
+	if err != nil {
+		return nil, false, err
+	}
+
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("{")) || bytes.HasPrefix(body, []byte("[")) {
+		if key != nil {
+			return nil, false, errUnsignedResponse
+		}
+		return body, false, nil
+	}
+	if key == nil {
+		return nil, false, fmt.Errorf("received signed update response but no update public key is configured")
+	}
+	if body, err = verifyJWS(string(body), key); err != nil {
+		return nil, false, err
+	}
+	return body, true, nil
+}
@@ -0,0 +1,74 @@
+package lifecycle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signJWS(t *testing.T, key ed25519.PrivateKey, alg, payload string) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + alg + `"}`))
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	sig := ed25519.Sign(key, []byte(header+"."+body))
+	return header + "." + body + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestDecodeUpdateResponse(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	const payload = `{"url":"https://example.com/download/v0.1.30/OllamaSetup.exe","sha256":"abc"}`
+
+	t.Run("plain JSON without key", func(t *testing.T) {
+		t.Setenv("OLLAMA_UPDATE_PUBLIC_KEY", "")
+		resp, err := decodeUpdateResponse([]byte(payload))
+		require.NoError(t, err)
+		assert.Equal(t, "abc", resp.Checksum)
+	})
+
+	t.Setenv("OLLAMA_UPDATE_PUBLIC_KEY", base64.StdEncoding.EncodeToString(pub))
+
+	t.Run("valid signature", func(t *testing.T) {
+		resp, err := decodeUpdateResponse([]byte(signJWS(t, priv, "EdDSA", payload) + "\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/download/v0.1.30/OllamaSetup.exe", resp.UpdateURL)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, err := decodeUpdateResponse([]byte(signJWS(t, otherPriv, "EdDSA", payload)))
+		assert.ErrorContains(t, err, "verification failed")
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		token := signJWS(t, priv, "EdDSA", payload)
+		tampered := signJWS(t, priv, "EdDSA", `{"url":"https://evil.example.com/OllamaSetup.exe"}`)
+		parts := strings.Split(token, ".")
+		parts[1] = strings.Split(tampered, ".")[1]
+		_, err := decodeUpdateResponse([]byte(strings.Join(parts, ".")))
+		assert.ErrorContains(t, err, "verification failed")
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		_, err := decodeUpdateResponse([]byte(signJWS(t, priv, "none", payload)))
+		assert.ErrorContains(t, err, "unsupported JWS algorithm")
+	})
+
+	t.Run("unsigned JSON rejected", func(t *testing.T) {
+		_, err := decodeUpdateResponse([]byte(payload))
+		assert.ErrorIs(t, err, errUnsignedResponse)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		t.Setenv("OLLAMA_UPDATE_PUBLIC_KEY", base64.StdEncoding.EncodeToString([]byte("short")))
+		_, err := decodeUpdateResponse([]byte(payload))
+		assert.ErrorContains(t, err, "invalid update public key")
+	})
+}
@@ -0,0 +1,245 @@
+package lifecycle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/jmorganca/ollama/version"
+)
+
+// Suffix of the metadata file written alongside a staged installer
+const stagedMetadataSuffix = ".json"
+
+// StagedUpdate records what was downloaded so the installer can be verified
+// again before it is offered or run
+type StagedUpdate struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+}
+
+func writeStagedMetadata(installer string, staged StagedUpdate) error {
+	payload, err := json.Marshal(staged)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(installer+stagedMetadataSuffix, payload, 0o644)
+}
+
+func readStagedMetadata(installer string) (StagedUpdate, error) {
+	var staged StagedUpdate
+	payload, err := os.ReadFile(installer + stagedMetadataSuffix)
+	if err != nil {
+		return staged, err
+	}
+	err = json.Unmarshal(payload, &staged)
+	return staged, err
+}
+
+func fileSHA256(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findStagedInstaller returns the path of the staged installer, if any,
+// which may only be staged compressed
+func findStagedInstaller() (string, error) {
+	files, err := filepath.Glob(filepath.Join(UpdateStageDir, "*", "*"))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, stagedMetadataSuffix) || strings.HasSuffix(file, ".part") || strings.HasSuffix(file, stagedPatchSuffix) {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			return strings.TrimSuffix(file, compressedSuffix), nil
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+// resolvePath returns the absolute, cleaned form of path with any symlinks
+// resolved, as far as they exist
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved, nil
+	}
+	return filepath.Clean(path), nil
+}
+
+// checkInStageDir refuses installers that resolve to somewhere outside
+// UpdateStageDir, such as through ".." in a manifest, so nothing else on
+// disk is ever executed as an upgrade
+func checkInStageDir(installer string) error {
+	dir, err := resolvePath(UpdateStageDir)
+	if err != nil {
+		return err
+	}
+	path, err := resolvePath(installer)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return fmt.Errorf("installer %s is outside the update directory %s", installer, UpdateStageDir)
+	}
+	return nil
+}
+
+// checkInstallerFile refuses to run anything but a regular file, so a build
+// with no Installer name, or a manifest naming a directory, fails clearly
+// instead of trying to execute the stage dir
+func checkInstallerFile(installer string) error {
+	if Installer == "" {
+		return fmt.Errorf("no installer name is configured, this build is misconfigured")
+	}
+	info, err := os.Stat(installer)
+	if err != nil {
+		return fmt.Errorf("unable to find installer: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("installer %s is not a regular file", installer)
+	}
+	return nil
+}
+
+// verifyStagedInstaller checks the installer against the checksum recorded
+// when it was downloaded
+func verifyStagedInstaller(installer string) (StagedUpdate, error) {
+	staged, err := readStagedMetadata(installer)
+	if err != nil {
+		return staged, fmt.Errorf("unable to read staged update metadata: %w", err)
+	}
+	if staged.SHA256 == "" {
+		return staged, fmt.Errorf("staged update metadata has no checksum")
+	}
+	sum, err := stagedSHA256(installer)
+	if err != nil {
+		return staged, err
+	}
+	if !strings.EqualFold(sum, staged.SHA256) {
+		return staged, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", installer, staged.SHA256, sum)
+	}
+	return staged, nil
+}
+
+// VerifyStagedUpdate re-checks an update downloaded in a previous session.
+// A staged installer that fails verification is removed so it is never
+// offered for install.
+func VerifyStagedUpdate() (StagedUpdate, bool) {
+	if stageDir, err := findStagedManifest(); err == nil {
+		manifest, err := verifyStagedManifest(stageDir)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("discarding staged update: %s", err))
+			cleanupOldDownloads()
+			SetUpdateDownloaded(false)
+			return StagedUpdate{}, false
+		}
+		slog.Info(fmt.Sprintf("verified staged update %s", stageDir))
+		SetUpdateDownloaded(true)
+		return StagedUpdate{Version: manifest.Version}, true
+	}
+
+	installer, err := findStagedInstaller()
+	if err != nil {
+		return StagedUpdate{}, false
+	}
+	staged, err := verifyStagedInstaller(installer)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("discarding staged update: %s", err))
+		cleanupOldDownloads()
+		SetUpdateDownloaded(false)
+		return StagedUpdate{}, false
+	}
+	slog.Info(fmt.Sprintf("verified staged update %s", installer))
+	dropDecompressedInstaller(installer)
+	SetUpdateDownloaded(true)
+	return staged, true
+}
+
+// RestorePendingUpdate offers an update staged in a previous session again,
+// once it passes verification, by calling pending with its version. This
+// brings back the Update menu and tray badge after a restart. One older than
+// the running version, say after a manual install, is discarded.
+func RestorePendingUpdate(pending func(ver string) error) bool {
+	if UpdatesDisabled() {
+		return false
+	}
+	staged, ok := VerifyStagedUpdate()
+	if !ok {
+		return false
+	}
+	cmp, ok := compareVersions(staged.Version, version.Version)
+	if ok && cmp == 0 {
+		slog.Info(fmt.Sprintf("staged update %s is already installed", staged.Version))
+		retainInstalledUpdate(staged.Version)
+		SetUpdateDownloaded(false)
+		return false
+	}
+	if !ok || cmp < 0 {
+		slog.Info(fmt.Sprintf("staged update %s is no longer newer than %s, discarding it", staged.Version, version.Version))
+		cleanupOldDownloads()
+		SetUpdateDownloaded(false)
+		return false
+	}
+	if !pinAllows(staged.Version) {
+		slog.Info(fmt.Sprintf("staged update %s isn't the pinned version, discarding it", staged.Version))
+		cleanupOldDownloads()
+		SetUpdateDownloaded(false)
+		return false
+	}
+	if err := pending(staged.Version); err != nil {
+		slog.Warn(fmt.Sprintf("failed to restore pending update %s: %s", staged.Version, err))
+	}
+	return true
+}
+
+// recordUpdate appends an entry to the update history in the store
+func recordUpdate(ver, result string) {
+	store.AppendUpdateHistory(store.UpdateRecord{
+		Version:   ver,
+		Timestamp: time.Now(),
+		Result:    result,
+	})
+}
+
+// stagedVersion returns the version of a staged installer, if known
+func stagedVersion(installer string) string {
+	if staged, err := readStagedMetadata(installer); err == nil {
+		return staged.Version
+	}
+	if stageDir, err := findStagedManifest(); err == nil {
+		if manifest, err := readStagedManifest(stageDir); err == nil {
+			return manifest.Version
+		}
+	}
+	return ""
+}
+
+// PruneStore drops stored metadata for versions older than the one running
+func PruneStore() {
+	if n := store.PruneObsolete(func(ver string) bool { return isOlderVersion(ver, version.Version) }); n > 0 {
+		slog.Debug(fmt.Sprintf("pruned %d obsolete store entries", n))
+	}
+}
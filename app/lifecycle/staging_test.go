@@ -0,0 +1,175 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+func stageTestInstaller(t *testing.T, contents string) string {
+	t.Helper()
+	UpdateStageDir = t.TempDir()
+	installer := filepath.Join(UpdateStageDir, "etag", Installer)
+	require.NoError(t, os.MkdirAll(filepath.Dir(installer), 0o755))
+	require.NoError(t, os.WriteFile(installer, []byte(contents), 0o755))
+	sum, err := fileSHA256(installer)
+	require.NoError(t, err)
+	require.NoError(t, writeStagedMetadata(installer, StagedUpdate{Version: "0.1.2", SHA256: sum}))
+	return installer
+}
+
+func TestCheckInstallerFile(t *testing.T) {
+	installer := stageTestInstaller(t, "installer")
+	assert.NoError(t, checkInstallerFile(installer))
+
+	assert.ErrorContains(t, checkInstallerFile(filepath.Dir(installer)), "not a regular file")
+	assert.ErrorIs(t, checkInstallerFile(filepath.Join(UpdateStageDir, "missing.exe")), os.ErrNotExist)
+
+	orig := Installer
+	t.Cleanup(func() { Installer = orig })
+	Installer = ""
+	assert.ErrorContains(t, checkInstallerFile(filepath.Join(UpdateStageDir, "etag", Installer)), "no installer name")
+}
+
+func TestVerifyStagedUpdate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		stageTestInstaller(t, "installer")
+		staged, ok := VerifyStagedUpdate()
+		assert.True(t, ok)
+		assert.True(t, IsUpdateDownloaded())
+		assert.Equal(t, "0.1.2", staged.Version)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		installer := stageTestInstaller(t, "installer")
+		require.NoError(t, os.WriteFile(installer, []byte("malicious"), 0o755))
+		_, ok := VerifyStagedUpdate()
+		assert.False(t, ok)
+		assert.False(t, IsUpdateDownloaded())
+		_, err := os.Stat(installer)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("missing metadata", func(t *testing.T) {
+		installer := stageTestInstaller(t, "installer")
+		require.NoError(t, os.Remove(installer+stagedMetadataSuffix))
+		_, ok := VerifyStagedUpdate()
+		assert.False(t, ok)
+	})
+
+	t.Run("nothing staged", func(t *testing.T) {
+		UpdateStageDir = t.TempDir()
+		_, ok := VerifyStagedUpdate()
+		assert.False(t, ok)
+	})
+}
+
+func TestRestorePendingUpdate(t *testing.T) {
+	setUpdatesDisabled(t, false)
+	orig := version.Version
+	t.Cleanup(func() { version.Version = orig })
+	version.Version = "0.1.1"
+
+	var restored []string
+	pending := func(ver string) error {
+		restored = append(restored, ver)
+		return nil
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		restored = nil
+		SetUpdateDownloaded(false)
+		stageTestInstaller(t, "installer")
+		assert.True(t, RestorePendingUpdate(pending))
+		assert.Equal(t, []string{"0.1.2"}, restored)
+		assert.True(t, IsUpdateDownloaded())
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		restored = nil
+		installer := stageTestInstaller(t, "installer")
+		require.NoError(t, os.WriteFile(installer, []byte("malicious"), 0o755))
+		assert.False(t, RestorePendingUpdate(pending))
+		assert.Empty(t, restored)
+	})
+
+	t.Run("already installed", func(t *testing.T) {
+		restored = nil
+		version.Version = "0.1.2"
+		t.Cleanup(func() { version.Version = "0.1.1" })
+		installer := stageTestInstaller(t, "installer")
+		assert.False(t, RestorePendingUpdate(pending))
+		assert.Empty(t, restored)
+		assert.False(t, IsUpdateDownloaded())
+		_, err := os.Stat(installer)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.FileExists(t, filepath.Join(retainedDir(), "0.1.2", Installer))
+		_, ok := VerifyStagedUpdate()
+		assert.False(t, ok)
+	})
+
+	t.Run("older than the running version", func(t *testing.T) {
+		restored = nil
+		version.Version = "0.1.3"
+		t.Cleanup(func() { version.Version = "0.1.1" })
+		installer := stageTestInstaller(t, "installer")
+		assert.False(t, RestorePendingUpdate(pending))
+		assert.Empty(t, restored)
+		assert.False(t, IsUpdateDownloaded())
+		_, err := os.Stat(installer)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.NoDirExists(t, filepath.Join(retainedDir(), "0.1.2"))
+	})
+
+	t.Run("not the pinned version", func(t *testing.T) {
+		restored = nil
+		stubPinnedVersion(t, "0.1.1")
+		installer := stageTestInstaller(t, "installer")
+		assert.False(t, RestorePendingUpdate(pending))
+		assert.Empty(t, restored)
+		_, err := os.Stat(installer)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("updates disabled", func(t *testing.T) {
+		restored = nil
+		setUpdatesDisabled(t, true)
+		stageTestInstaller(t, "installer")
+		assert.False(t, RestorePendingUpdate(pending))
+		assert.Empty(t, restored)
+	})
+}
+
+func TestCheckInStageDir(t *testing.T) {
+	UpdateStageDir = t.TempDir()
+	outside := t.TempDir()
+
+	installer := filepath.Join(UpdateStageDir, "abc", Installer)
+	require.NoError(t, os.MkdirAll(filepath.Dir(installer), 0o755))
+	require.NoError(t, os.WriteFile(installer, []byte("installer"), 0o755))
+	assert.NoError(t, checkInStageDir(installer))
+
+	for _, path := range []string{
+		filepath.Join(UpdateStageDir, "..", Installer),
+		filepath.Join(UpdateStageDir, "abc", "..", "..", filepath.Base(outside), Installer),
+		filepath.Join(outside, Installer),
+		UpdateStageDir,
+		UpdateStageDir + "-evil" + string(filepath.Separator) + Installer,
+	} {
+		assert.Error(t, checkInStageDir(path), path)
+	}
+
+	// A symlink out of the stage dir is followed before checking
+	target := filepath.Join(outside, Installer)
+	require.NoError(t, os.WriteFile(target, []byte("elsewhere"), 0o755))
+	link := filepath.Join(UpdateStageDir, "abc", "link.exe")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unavailable: %s", err)
+	}
+	assert.Error(t, checkInStageDir(link))
+}
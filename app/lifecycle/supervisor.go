@@ -0,0 +1,197 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ServerState is what the server supervisor is doing
+type ServerState int
+
+const (
+	ServerStopped ServerState = iota
+	ServerStarting
+	ServerRunning
+	// Waiting to restart after a crash or failed start
+	ServerBackoff
+)
+
+func (s ServerState) String() string {
+	switch s {
+	case ServerStopped:
+		return "stopped"
+	case ServerStarting:
+		return "starting"
+	case ServerRunning:
+		return "running"
+	case ServerBackoff:
+		return "backing off"
+	}
+	return fmt.Sprintf("ServerState(%d)", int(s))
+}
+
+var (
+	// The delay before restarting a crashed server, doubling with each
+	// consecutive failure up to ServerRestartMaxDelay
+	ServerRestartInitialDelay = 500 * time.Millisecond
+	ServerRestartMaxDelay     = 30 * time.Second
+	// The tray is told once the server fails this many times in a row
+	ServerFailureNotifyThreshold = 3
+	// A server that stays up this long resets the failure count
+	ServerHealthyUptime = time.Minute
+)
+
+// ServerCallbacks are how the server supervisor reports to the tray
+type ServerCallbacks struct {
+	// RepeatedFailures is called once the server has failed
+	// ServerFailureNotifyThreshold times in a row
+	RepeatedFailures func(failures int) error
+}
+
+// serverProcess is a running server
+type serverProcess interface {
+	// Wait blocks until the process exits and returns its exit code
+	Wait() int
+}
+
+type cmdProcess struct {
+	cmd *exec.Cmd
+}
+
+// Wait also signals RestartServer that the server is gone
+func (p cmdProcess) Wait() int {
+	p.cmd.Wait() //nolint:errcheck
+	serverMu.Lock()
+	if serverCmd == p.cmd {
+		close(serverExited)
+		serverCmd = nil
+	}
+	serverMu.Unlock()
+	if p.cmd.ProcessState == nil {
+		return -1
+	}
+	return p.cmd.ProcessState.ExitCode()
+}
+
+// serverSupervisor keeps a server running, restarting it with backoff
+// whenever it exits unexpectedly
+type serverSupervisor struct {
+	start func(ctx context.Context) (serverProcess, error)
+	// expectedExit reports, and clears, whether the last exit was requested
+	expectedExit func() bool
+	cb           ServerCallbacks
+
+	mu       sync.Mutex
+	state    ServerState
+	failures int
+	notified bool
+}
+
+func (s *serverSupervisor) State() ServerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *serverSupervisor) setState(state ServerState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
+
+// serverRestartDelay is the backoff after the given number of consecutive
+// failures
+func serverRestartDelay(failures int) time.Duration {
+	delay := ServerRestartInitialDelay
+	for i := 1; i < failures && delay < ServerRestartMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > ServerRestartMaxDelay {
+		delay = ServerRestartMaxDelay
+	}
+	return delay
+}
+
+// failed records a failure and waits out the backoff, returning false if
+// ctx is done first
+func (s *serverSupervisor) failed(ctx context.Context) bool {
+	s.mu.Lock()
+	s.failures++
+	failures := s.failures
+	notify := failures >= ServerFailureNotifyThreshold && !s.notified
+	if notify {
+		s.notified = true
+	}
+	s.state = ServerBackoff
+	s.mu.Unlock()
+
+	delay := serverRestartDelay(failures)
+	slog.Warn(fmt.Sprintf("server failure %d, restarting in %s", failures, delay))
+
+	if notify && s.cb.RepeatedFailures != nil {
+		if err := s.cb.RepeatedFailures(failures); err != nil {
+			slog.Warn(fmt.Sprintf("failed to report server failures with tray: %s", err))
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+func (s *serverSupervisor) resetFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = 0
+	s.notified = false
+}
+
+// run supervises proc, and its replacements, until ctx is done and returns
+// the final exit code
+func (s *serverSupervisor) run(ctx context.Context, proc serverProcess) int {
+	for {
+		s.setState(ServerRunning)
+		started := time.Now()
+		code := proc.Wait()
+		if ctx.Err() != nil {
+			slog.Debug(fmt.Sprintf("server shutdown with exit code %d", code))
+			s.setState(ServerStopped)
+			return code
+		}
+
+		if time.Since(started) >= ServerHealthyUptime {
+			s.resetFailures()
+		}
+		if s.expectedExit != nil && s.expectedExit() {
+			slog.Info(fmt.Sprintf("server stopped for restart with exit code %d", code))
+			s.resetFailures()
+		} else {
+			slog.Warn(fmt.Sprintf("server exited unexpectedly with exit code %d", code))
+			if !s.failed(ctx) {
+				s.setState(ServerStopped)
+				return code
+			}
+		}
+
+		for {
+			s.setState(ServerStarting)
+			var err error
+			proc, err = s.start(ctx)
+			if err == nil {
+				break
+			}
+			slog.Error(fmt.Sprintf("failed to restart server %s", err))
+			if !s.failed(ctx) {
+				s.setState(ServerStopped)
+				return code
+			}
+		}
+	}
+}
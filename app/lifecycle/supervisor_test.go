@@ -0,0 +1,136 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProcess exits with code as soon as it's waited on
+type stubProcess struct {
+	code int
+}
+
+func (p stubProcess) Wait() int {
+	return p.code
+}
+
+func TestServerRestartDelay(t *testing.T) {
+	origInitial, origMax := ServerRestartInitialDelay, ServerRestartMaxDelay
+	t.Cleanup(func() { ServerRestartInitialDelay, ServerRestartMaxDelay = origInitial, origMax })
+	ServerRestartInitialDelay = 500 * time.Millisecond
+	ServerRestartMaxDelay = 30 * time.Second
+
+	assert.Equal(t, 500*time.Millisecond, serverRestartDelay(1))
+	assert.Equal(t, time.Second, serverRestartDelay(2))
+	assert.Equal(t, 2*time.Second, serverRestartDelay(3))
+	assert.Equal(t, 16*time.Second, serverRestartDelay(6))
+	assert.Equal(t, 30*time.Second, serverRestartDelay(7), "should cap the backoff")
+	assert.Equal(t, 30*time.Second, serverRestartDelay(100))
+}
+
+func TestServerSupervisorRestarts(t *testing.T) {
+	origInitial, origThreshold := ServerRestartInitialDelay, ServerFailureNotifyThreshold
+	t.Cleanup(func() { ServerRestartInitialDelay, ServerFailureNotifyThreshold = origInitial, origThreshold })
+	ServerRestartInitialDelay = time.Millisecond
+	ServerFailureNotifyThreshold = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	starts := 0
+	var notified []int
+	s := &serverSupervisor{
+		start: func(context.Context) (serverProcess, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			starts++
+			switch {
+			case starts == 2:
+				return nil, errors.New("port in use")
+			case starts >= 5:
+				// Stop after a few restarts, the next exit is a shutdown
+				cancel()
+			}
+			return stubProcess{code: 1}, nil
+		},
+		cb: ServerCallbacks{RepeatedFailures: func(failures int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			notified = append(notified, failures)
+			return nil
+		}},
+	}
+
+	code := s.run(ctx, stubProcess{code: 2})
+	assert.Equal(t, 1, code)
+	assert.Equal(t, ServerStopped, s.State())
+	assert.Equal(t, 5, starts)
+	assert.Equal(t, []int{3}, notified, "should notify once per failure streak")
+}
+
+func TestServerSupervisorExpectedExit(t *testing.T) {
+	origInitial := ServerRestartInitialDelay
+	t.Cleanup(func() { ServerRestartInitialDelay = origInitial })
+	// Long enough that the test would time out if a restart were delayed
+	ServerRestartInitialDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	starts := 0
+	s := &serverSupervisor{
+		start: func(context.Context) (serverProcess, error) {
+			starts++
+			if starts == 3 {
+				cancel()
+			}
+			return stubProcess{}, nil
+		},
+		expectedExit: func() bool { return true },
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx, stubProcess{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("requested restarts should not back off")
+	}
+	assert.Equal(t, 3, starts)
+	assert.Zero(t, s.failures)
+}
+
+func TestServerSupervisorStopDuringBackoff(t *testing.T) {
+	origInitial := ServerRestartInitialDelay
+	t.Cleanup(func() { ServerRestartInitialDelay = origInitial })
+	ServerRestartInitialDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &serverSupervisor{
+		start: func(context.Context) (serverProcess, error) {
+			t.Error("should not restart once stopped")
+			return nil, errors.New("unreachable")
+		},
+	}
+
+	done := make(chan int)
+	go func() { done <- s.run(ctx, stubProcess{code: 3}) }()
+	require.Eventually(t, func() bool { return s.State() == ServerBackoff }, time.Second, time.Millisecond)
+	cancel()
+	select {
+	case code := <-done:
+		assert.Equal(t, 3, code)
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not stop")
+	}
+	assert.Equal(t, ServerStopped, s.State())
+}
@@ -0,0 +1,44 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// OLLAMA_UPDATE_TEST_SERVER points every update check and download at a
+// fixture server, so the whole update flow can be exercised end to end
+// without touching ollama.com. Plain http is only accepted for a server on
+// this machine.
+
+// updateTestServer returns the configured test server, if any
+func updateTestServer() (*url.URL, bool) {
+	s := os.Getenv("OLLAMA_UPDATE_TEST_SERVER")
+	if s == "" {
+		return nil, false
+	}
+	u, err := url.Parse(strings.TrimRight(s, "/"))
+	if err != nil || u.Host == "" {
+		slog.Warn(fmt.Sprintf("ignoring invalid OLLAMA_UPDATE_TEST_SERVER %q", s))
+		return nil, false
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && isLoopbackHost(u.Hostname()):
+	default:
+		slog.Warn(fmt.Sprintf("ignoring OLLAMA_UPDATE_TEST_SERVER %q, it must use https unless it's on localhost", s))
+		return nil, false
+	}
+	return u, true
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,75 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateTestServer(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+	_, ok := updateTestServer()
+	assert.False(t, ok)
+	assert.Equal(t, UpdateCheckURLBase, updateCheckURLBase())
+
+	for _, s := range []string{"http://localhost:8080", "http://127.0.0.1:8080/", "http://[::1]:8080", "https://fixtures.example.com"} {
+		t.Setenv("OLLAMA_UPDATE_TEST_SERVER", s)
+		_, ok := updateTestServer()
+		assert.True(t, ok, s)
+	}
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "http://127.0.0.1:8080/")
+	assert.Equal(t, "http://127.0.0.1:8080/api/update", updateCheckURLBase())
+
+	for _, s := range []string{"http://fixtures.example.com", "ftp://localhost", "not a url"} {
+		t.Setenv("OLLAMA_UPDATE_TEST_SERVER", s)
+		_, ok := updateTestServer()
+		assert.False(t, ok, s)
+	}
+}
+
+// TestUpdateFlowAgainstTestServer drives a check, download and verification
+// of the staged installer against a local fixture server
+func TestUpdateFlowAgainstTestServer(t *testing.T) {
+	setupTestKey(t)
+	setUpdatesDisabled(t, false)
+	stubPinnedVersion(t, "")
+	UpdateStageDir = t.TempDir()
+	t.Cleanup(func() { SetUpdateDownloaded(false) })
+
+	installer := []byte("fixture installer")
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/api/update", func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, r.Header.Get("Authorization"), "check should be signed")
+		w.Header().Set("Content-Type", "application/json")
+		// The fixture hands out the production URL, which is redirected to
+		// the test server too
+		w.Write([]byte(`{"url":"https://ollama.com/download/v0.1.30/OllamaSetup.exe","sha256":"` + sha256Hex(installer) + `"}`)) //nolint:errcheck
+	})
+	mux.HandleFunc("/download/v0.1.30/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"fixture"`)
+		http.ServeContent(w, r, "OllamaSetup.exe", time.Time{}, bytes.NewReader(installer))
+	})
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", ts.URL)
+
+	available, resp := IsNewReleaseAvailable(context.Background())
+	require.True(t, available)
+	assert.Equal(t, "v0.1.30", resp.UpdateVersion)
+
+	require.NoError(t, DownloadNewRelease(context.Background(), resp))
+	require.True(t, IsUpdateDownloaded())
+
+	SetUpdateDownloaded(false)
+	staged, ok := VerifyStagedUpdate()
+	require.True(t, ok)
+	assert.Contains(t, staged.Version, "0.1.30")
+	assert.True(t, IsUpdateDownloaded())
+}
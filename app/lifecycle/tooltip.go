@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+// UpdateFailureTooltipThreshold is how many update checks, or downloads, in
+// a row must fail before the tray tooltip says so. Overridden by
+// OLLAMA_UPDATE_FAILURE_TOOLTIP_THRESHOLD
+var UpdateFailureTooltipThreshold = 3
+
+const (
+	checkFailedKey    = "update check"
+	downloadFailedKey = "update download"
+)
+
+// Hints the tray that updates keep failing, shown until that works again
+var updateFailures = newFailureTooltip()
+
+// failureTooltip counts consecutive failures per key, showing a tooltip
+// once one passes the threshold and restoring the default once none do
+type failureTooltip struct {
+	mu     sync.Mutex
+	set    func(text string) error
+	counts map[string]int
+	shown  string
+}
+
+func newFailureTooltip() *failureTooltip {
+	return &failureTooltip{counts: make(map[string]int)}
+}
+
+// setTooltipFunc provides how the tooltip is shown, applying the current one
+func (f *failureTooltip) setTooltipFunc(set func(text string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set = set
+	f.shown = ""
+	f.update()
+}
+
+func (f *failureTooltip) failed(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[key]++
+	f.update()
+}
+
+func (f *failureTooltip) succeeded(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.counts, key)
+	f.update()
+}
+
+// tooltip is what to show for the current failures, "" for the default. A
+// failing check is reported over a failing download, since downloads only
+// follow successful checks.
+func (f *failureTooltip) tooltip() string {
+	threshold := max(envInt("OLLAMA_UPDATE_FAILURE_TOOLTIP_THRESHOLD", UpdateFailureTooltipThreshold), 1)
+	switch {
+	case f.counts[checkFailedKey] >= threshold:
+		return commontray.ToolTip + " — update check failed"
+	case f.counts[downloadFailedKey] >= threshold:
+		return commontray.ToolTip + " — update download failed"
+	}
+	return ""
+}
+
+// update shows the tooltip if it changed, with f.mu held
+func (f *failureTooltip) update() {
+	text := f.tooltip()
+	if f.set == nil || text == f.shown {
+		return
+	}
+	if err := f.set(text); err != nil {
+		slog.Warn(fmt.Sprintf("failed to update tray tooltip: %s", err))
+		return
+	}
+	f.shown = text
+}
@@ -0,0 +1,110 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stubUpdateFailures(t *testing.T) *[]string {
+	t.Helper()
+	orig := updateFailures
+	t.Cleanup(func() { updateFailures = orig })
+	updateFailures = newFailureTooltip()
+	var shown []string
+	updateFailures.setTooltipFunc(func(text string) error {
+		shown = append(shown, text)
+		return nil
+	})
+	return &shown
+}
+
+func TestFailureTooltipTransitions(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_FAILURE_TOOLTIP_THRESHOLD", "")
+	shown := stubUpdateFailures(t)
+	f := updateFailures
+
+	// A failure or two is just as likely to be a blip
+	f.failed(checkFailedKey)
+	f.failed(checkFailedKey)
+	assert.Empty(t, *shown)
+	f.failed(checkFailedKey)
+	f.failed(checkFailedKey)
+	assert.Equal(t, []string{"Ollama — update check failed"}, *shown, "only shown when it changes")
+
+	f.succeeded(checkFailedKey)
+	assert.Equal(t, []string{"Ollama — update check failed", ""}, *shown, "a successful check restores the default")
+
+	*shown = nil
+	for i := 0; i < UpdateFailureTooltipThreshold; i++ {
+		f.failed(downloadFailedKey)
+	}
+	assert.Equal(t, []string{"Ollama — update download failed"}, *shown)
+	for i := 0; i < UpdateFailureTooltipThreshold; i++ {
+		f.failed(checkFailedKey)
+	}
+	f.succeeded(checkFailedKey)
+	assert.Equal(t, []string{"Ollama — update download failed", "Ollama — update check failed", "Ollama — update download failed"}, *shown,
+		"the download is still failing")
+	f.succeeded(downloadFailedKey)
+	assert.Equal(t, "", (*shown)[len(*shown)-1])
+
+	// Counting restarts after a success
+	*shown = nil
+	t.Setenv("OLLAMA_UPDATE_FAILURE_TOOLTIP_THRESHOLD", "1")
+	f.failed(checkFailedKey)
+	assert.Equal(t, []string{"Ollama — update check failed"}, *shown)
+}
+
+func TestFailureTooltipRetriesAfterError(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_FAILURE_TOOLTIP_THRESHOLD", "1")
+	f := newFailureTooltip()
+	f.failed(checkFailedKey)
+
+	calls := 0
+	fail := true
+	f.setTooltipFunc(func(text string) error {
+		calls++
+		if fail {
+			return errors.New("the notification area isn't ready")
+		}
+		return nil
+	})
+	assert.Equal(t, 1, calls, "applied as soon as there's a tray")
+	fail = false
+	f.failed(checkFailedKey)
+	assert.Equal(t, 2, calls, "not marked as shown until it is")
+	f.failed(checkFailedKey)
+	assert.Equal(t, 2, calls)
+}
+
+func TestUpdateCheckFailureTooltip(t *testing.T) {
+	setupTestKey(t)
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+	t.Setenv("OLLAMA_UPDATE_FAILURE_TOOLTIP_THRESHOLD", "2")
+	shown := stubUpdateFailures(t)
+
+	healthy := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	t.Setenv("OLLAMA_UPDATE_CHECK_URLS", ts.URL)
+
+	IsNewReleaseAvailable(context.Background())
+	assert.Empty(t, *shown)
+	IsNewReleaseAvailable(context.Background())
+	assert.Equal(t, []string{"Ollama — update check failed"}, *shown)
+
+	healthy = true
+	IsNewReleaseAvailable(context.Background())
+	assert.Equal(t, []string{"Ollama — update check failed", ""}, *shown)
+}
@@ -0,0 +1,73 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var (
+	// TrustedUpdateHosts are the hosts, and their subdomains, updates may be
+	// downloaded from. OLLAMA_UPDATE_TRUSTED_HOSTS adds more, comma separated,
+	// for self-hosting, and a configured mirror or test server is always
+	// trusted.
+	TrustedUpdateHosts = []string{
+		"ollama.com",
+		"github.com",
+		"objects.githubusercontent.com",
+	}
+
+	errUntrustedHost = errors.New("update host isn't trusted")
+)
+
+// trustedUpdateHosts returns every host downloads may come from
+func trustedUpdateHosts() []string {
+	hosts := append([]string{}, TrustedUpdateHosts...)
+	for _, host := range strings.Split(os.Getenv("OLLAMA_UPDATE_TRUSTED_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if mirror := os.Getenv("OLLAMA_UPDATE_MIRROR"); mirror != "" {
+		if !strings.Contains(mirror, "://") {
+			mirror = "https://" + mirror
+		}
+		if u, err := url.Parse(mirror); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	if u, ok := updateTestServer(); ok {
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
+}
+
+// checkTrustedHost refuses downloads from hosts that aren't trusted, so a
+// tampered update response can't point the updater elsewhere. Downloads must
+// use https, so nobody on the network can swap the installer, except from
+// a local test server.
+func checkTrustedHost(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.EqualFold(u.Scheme, "https"):
+	case strings.EqualFold(u.Scheme, "http") && isLoopbackHost(u.Hostname()):
+	default:
+		slog.Warn(fmt.Sprintf("refusing to download update from %q, only https is allowed", rawURL))
+		return fmt.Errorf("%w: %s", errUntrustedHost, rawURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, trusted := range trustedUpdateHosts() {
+		trusted = strings.ToLower(trusted)
+		if host == trusted || strings.HasSuffix(host, "."+trusted) {
+			return nil
+		}
+	}
+	slog.Warn(fmt.Sprintf("refusing to download update from %q, add it to OLLAMA_UPDATE_TRUSTED_HOSTS to allow it", u.Host))
+	return fmt.Errorf("%w: %s", errUntrustedHost, u.Host)
+}
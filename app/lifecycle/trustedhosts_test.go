@@ -0,0 +1,114 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trustLocalUpdateHosts lets a test download from httptest servers
+func trustLocalUpdateHosts(t *testing.T) {
+	t.Helper()
+	t.Setenv("OLLAMA_UPDATE_TRUSTED_HOSTS", "127.0.0.1")
+}
+
+func TestCheckTrustedHost(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_TRUSTED_HOSTS", "")
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+
+	for _, u := range []string{
+		"https://ollama.com/download/v0.1.30/OllamaSetup.exe",
+		"https://OLLAMA.com/download/v0.1.30/OllamaSetup.exe",
+		"https://registry.ollama.com:443/download/OllamaSetup.exe",
+		"https://github.com/ollama/ollama/releases/download/v0.1.30/OllamaSetup.exe",
+		"https://objects.githubusercontent.com/github-production-release-asset/OllamaSetup.exe",
+	} {
+		assert.NoError(t, checkTrustedHost(u), u)
+	}
+	for _, u := range []string{
+		"https://evil.example.com/OllamaSetup.exe",
+		"https://ollama.com.evil.example.com/OllamaSetup.exe",
+		"https://notollama.com/OllamaSetup.exe",
+		"http://127.0.0.1:8080/OllamaSetup.exe",
+		"http://ollama.com/download/v0.1.30/OllamaSetup.exe",
+		"http://objects.githubusercontent.com/github-production-release-asset/OllamaSetup.exe",
+		"/OllamaSetup.exe",
+		"file:///srv/updates/OllamaSetup.exe",
+		"file://ollama.com/download/OllamaSetup.exe",
+	} {
+		assert.ErrorIs(t, checkTrustedHost(u), errUntrustedHost, u)
+	}
+}
+
+func TestCheckTrustedHostExtended(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+	t.Setenv("OLLAMA_UPDATE_TRUSTED_HOSTS", "updates.corp.example, 127.0.0.1")
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "mirror.example.net:8443")
+
+	assert.NoError(t, checkTrustedHost("https://updates.corp.example/OllamaSetup.exe"))
+	assert.NoError(t, checkTrustedHost("http://127.0.0.1:8080/OllamaSetup.exe"))
+	assert.NoError(t, checkTrustedHost("https://mirror.example.net:8443/OllamaSetup.exe"))
+	assert.ErrorIs(t, checkTrustedHost("http://updates.corp.example/OllamaSetup.exe"), errUntrustedHost, "only local servers may use http")
+	// Extending keeps the built-in hosts
+	assert.NoError(t, checkTrustedHost("https://ollama.com/download/OllamaSetup.exe"))
+	assert.ErrorIs(t, checkTrustedHost("https://evil.example.com/OllamaSetup.exe"), errUntrustedHost)
+}
+
+func TestDownloadNewReleaseUntrustedHost(t *testing.T) {
+	setUpdatesDisabled(t, false)
+	t.Setenv("OLLAMA_UPDATE_TRUSTED_HOSTS", "")
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+	UpdateStageDir = t.TempDir()
+
+	err := DownloadNewRelease(context.Background(), UpdateResponse{UpdateURL: "https://evil.example.com/download/v0.1.30/OllamaSetup.exe"})
+	assert.ErrorIs(t, err, errUntrustedHost)
+	err = DownloadNewRelease(context.Background(), UpdateResponse{ManifestURL: "https://evil.example.com/manifest.json"})
+	assert.ErrorIs(t, err, errUntrustedHost)
+}
+
+func TestDownloadRedirectToUntrustedHost(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+	UpdateStageDir = t.TempDir()
+
+	var untrustedHits atomic.Int32
+	untrusted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		untrustedHits.Add(1)
+		w.Write([]byte("payload")) //nolint:errcheck
+	}))
+	defer untrusted.Close()
+	u, err := url.Parse(untrusted.URL)
+	require.NoError(t, err)
+	// Same server, but by a name that isn't trusted
+	u.Host = "localhost:" + u.Port()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/elsewhere":
+			http.Redirect(w, r, u.String()+"/OllamaSetup.exe", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/OllamaSetup.exe", http.StatusFound)
+		default:
+			w.Write([]byte("payload")) //nolint:errcheck
+		}
+	}))
+	defer ts.Close()
+
+	dest := filepath.Join(UpdateStageDir, "abc", Installer)
+	_, err = downloadFile(context.Background(), ts.URL+"/elsewhere", dest, "", "")
+	assert.ErrorIs(t, err, errUntrustedHost)
+	assert.Zero(t, untrustedHits.Load())
+
+	// Redirects on the same host are followed
+	_, err = downloadFile(context.Background(), ts.URL+"/moved", dest, "", "")
+	assert.NoError(t, err)
+}
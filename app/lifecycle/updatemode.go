@@ -0,0 +1,50 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/jmorganca/ollama/app/store"
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+// The tray offers a single choice of update mode, which is stored as the
+// auto download and auto install preferences the checker reads at each
+// check.
+
+var (
+	// overridden in tests
+	autoDownloadSetting = store.GetAutoDownload
+	saveAutoDownload    = store.SetAutoDownload
+	saveAutoInstall     = store.SetAutoInstallWhenIdle
+)
+
+// currentUpdateMode maps the preferences to the mode they amount to
+func currentUpdateMode() commontray.UpdateMode {
+	switch {
+	case !autoDownloadSetting():
+		return commontray.UpdateManual
+	case autoInstallEnabled():
+		return commontray.UpdateAutomatic
+	}
+	return commontray.UpdateNotify
+}
+
+// SetUpdateMode saves the preferences for mode, taking effect from the next
+// check
+func SetUpdateMode(mode commontray.UpdateMode) {
+	var download, install bool
+	switch mode {
+	case commontray.UpdateAutomatic:
+		download, install = true, true
+	case commontray.UpdateNotify:
+		download = true
+	case commontray.UpdateManual:
+	default:
+		slog.Warn(fmt.Sprintf("ignoring unknown update mode %d", mode))
+		return
+	}
+	slog.Info(fmt.Sprintf("setting update mode %d", mode))
+	saveAutoDownload(download)
+	saveAutoInstall(install)
+}
@@ -0,0 +1,93 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+// stubUpdateMode keeps the auto download and install preferences in memory
+func stubUpdateMode(t *testing.T, download, install bool) (*bool, *bool) {
+	t.Helper()
+	origDownload, origSaveDownload := autoDownloadSetting, saveAutoDownload
+	origInstall, origSaveInstall := autoInstallEnabled, saveAutoInstall
+	t.Cleanup(func() {
+		autoDownloadSetting, saveAutoDownload = origDownload, origSaveDownload
+		autoInstallEnabled, saveAutoInstall = origInstall, origSaveInstall
+	})
+	autoDownloadSetting = func() bool { return download }
+	saveAutoDownload = func(val bool) { download = val }
+	autoInstallEnabled = func() bool { return install }
+	saveAutoInstall = func(val bool) { install = val }
+	return &download, &install
+}
+
+func TestSetUpdateMode(t *testing.T) {
+	download, install := stubUpdateMode(t, true, false)
+	assert.Equal(t, commontray.UpdateNotify, currentUpdateMode(), "the default")
+
+	for _, tc := range []struct {
+		mode              commontray.UpdateMode
+		download, install bool
+	}{
+		{commontray.UpdateAutomatic, true, true},
+		{commontray.UpdateManual, false, false},
+		{commontray.UpdateNotify, true, false},
+	} {
+		SetUpdateMode(tc.mode)
+		assert.Equal(t, tc.download, *download, "download for mode %d", tc.mode)
+		assert.Equal(t, tc.install, *install, "install for mode %d", tc.mode)
+		assert.Equal(t, tc.mode, currentUpdateMode())
+	}
+
+	SetUpdateMode(commontray.UpdateMode(42))
+	assert.Equal(t, commontray.UpdateNotify, currentUpdateMode(), "unknown modes are ignored")
+}
+
+func TestManualUpdateModeSkipsDownload(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	setupTestKey(t)
+	setUpdatesDisabled(t, false)
+	stubPinnedVersion(t, "")
+	stubNotifiers(t, nil)
+	stubAvailableUpdate(t)
+	stubUpdateMode(t, false, false)
+	UpdateStageDir = t.TempDir()
+	var downloads atomic.Int32
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/api/update", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"url":"%s/download/v0.1.30/OllamaSetup.exe"}`, ts.URL)
+	})
+	mux.HandleFunc("/download/v0.1.30/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		http.NotFound(w, r)
+	})
+	UpdateCheckURLBase = ts.URL + "/api/update"
+	t.Setenv("OLLAMA_UPDATE_MIRROR", "")
+	t.Setenv("OLLAMA_UPDATE_TEST_SERVER", "")
+
+	var pending []string
+	cb := UpdaterCallbacks{
+		UpdateAvailable: func(string, string) error { return nil },
+		UpdatePending: func(ver string) error {
+			pending = append(pending, ver)
+			return nil
+		},
+	}
+	checkForUpdate(context.Background(), false, cb)
+	assert.Zero(t, downloads.Load(), "background checks don't download")
+	assert.Equal(t, []string{"v0.1.30"}, pending, "shown in the menu")
+
+	checkForUpdate(context.Background(), true, cb)
+	assert.NotZero(t, downloads.Load(), "checking from the menu downloads")
+}
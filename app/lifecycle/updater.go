@@ -1,9 +1,11 @@
 package lifecycle
 
 import (
+	"compress/gzip"
 	"context"
 	"crypto/rand"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -16,165 +18,592 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jmorganca/ollama/app/store"
 	"github.com/jmorganca/ollama/auth"
 	"github.com/jmorganca/ollama/version"
 )
 
 var (
 	UpdateCheckURLBase  = "https://ollama.com/api/update"
-	UpdateDownloaded    = false
 	UpdateCheckInterval = 60 * 60 * time.Second
+	// Don't blast an update message immediately after startup, overridden by
+	// OLLAMA_UPDATE_STARTUP_DELAY
+	UpdateStartupDelay  = 3 * time.Second
+	SessionPollInterval = 30 * time.Second
+
+	// Whether the first check skips UpdateStartupDelay, overridden in tests
+	checkOnLaunchSetting = store.GetCheckOnLaunch
+
+	// Platform reported to the update service, overridden in tests and by
+	// builds that detect they are running under emulation
+	UpdateOS   = runtime.GOOS
+	UpdateArch = runtime.GOARCH
+
+	updateDownloaded   = false
+	muUpdateDownloaded sync.Mutex
+
+	cancelDownload context.CancelFunc
+	muDownload     sync.Mutex
+
+	// Set alongside cancelDownload, guarded by muDownload
+	pauseDownload  func()
+	activeDownload *UpdateResponse
+
+	// Set while an upgrade is waiting for the session or running, so
+	// clicking Update again doesn't queue another
+	upgradePending atomic.Bool
+
+	// Set from preparing an install until the installer has started
+	installPreparing atomic.Bool
 )
 
+func SetUpdateDownloaded(downloaded bool) {
+	muUpdateDownloaded.Lock()
+	defer muUpdateDownloaded.Unlock()
+	updateDownloaded = downloaded
+}
+
+// IsUpdateDownloaded reports whether a verified update is staged for install
+func IsUpdateDownloaded() bool {
+	muUpdateDownloaded.Lock()
+	defer muUpdateDownloaded.Unlock()
+	return updateDownloaded
+}
+
 // TODO - maybe move up to the API package?
 type UpdateResponse struct {
 	UpdateURL     string `json:"url"`
 	UpdateVersion string `json:"version"`
+	Checksum      string `json:"sha256,omitempty"`
+	// ManifestURL optionally points at an UpdateManifest listing the files
+	// of a multi-file update package, instead of a single installer
+	ManifestURL string `json:"manifest,omitempty"`
+	// MinOSVersion is the oldest OS release the update supports, such as
+	// "10.0.17763" on Windows
+	MinOSVersion string `json:"min_os_version,omitempty"`
+	// Requirements are the hardware capabilities the update needs
+	Requirements *UpdateRequirements `json:"requirements,omitempty"`
+	// Assets optionally lists the download for each platform, keyed by
+	// "os/arch", instead of the single UpdateURL
+	Assets map[string]UpdateAsset `json:"assets,omitempty"`
+	// Description optionally summarizes the update in the language sent
+	// with the check
+	Description string `json:"description,omitempty"`
+	// Mandatory updates fix critical issues, so they can't be dismissed and
+	// install automatically once MandatoryGracePeriod has passed. That's
+	// only honored for signed responses, see required.
+	Mandatory        bool   `json:"mandatory,omitempty"`
+	MandatoryMessage string `json:"mandatory_message,omitempty"`
+	// Patch optionally builds the installer from the one of the running
+	// version, falling back to UpdateURL when it can't be applied
+	Patch *UpdatePatch `json:"patch,omitempty"`
+
+	// Signed is set when the response's signature was verified
+	Signed bool `json:"-"`
 }
 
-func IsNewReleaseAvailable(ctx context.Context) (bool, UpdateResponse) {
-	var updateResp UpdateResponse
+// required reports whether the update is mandatory. Anyone who can tamper
+// with an unsigned response could otherwise force an install, so those are
+// handled like any other update, with the mandatory message as their
+// description.
+func (r UpdateResponse) required() bool {
+	return r.Mandatory && r.Signed
+}
+
+// GetUpdateCheckURL builds the update check URL for this client, merging in
+// any extra query parameters
+func GetUpdateCheckURL(extra url.Values) (*url.URL, error) {
+	return buildUpdateCheckURL(updateCheckURLBase(), extra)
+}
 
-	requestURL, err := url.Parse(UpdateCheckURLBase)
+// buildUpdateCheckURL builds the update check URL against base
+func buildUpdateCheckURL(base string, extra url.Values) (*url.URL, error) {
+	requestURL, err := url.Parse(base)
 	if err != nil {
-		return false, updateResp
+		return nil, err
 	}
 
 	query := requestURL.Query()
-	query.Add("os", runtime.GOOS)
-	query.Add("arch", runtime.GOARCH)
+	query.Add("os", UpdateOS)
+	query.Add("arch", UpdateArch)
+	query.Add("native_arch", nativeArch(systemNativeArch))
 	query.Add("version", version.Version)
 	query.Add("ts", fmt.Sprintf("%d", time.Now().Unix()))
+	if lang := uiLanguage(); lang != "" {
+		query.Add("lang", lang)
+	}
 
 	nonce, err := auth.NewNonce(rand.Reader, 16)
 	if err != nil {
-		return false, updateResp
+		return nil, err
 	}
 
 	query.Add("nonce", nonce)
+	for k, vals := range extra {
+		for _, v := range vals {
+			query.Add(k, v)
+		}
+	}
 	requestURL.RawQuery = query.Encode()
+	return requestURL, nil
+}
+
+// newUpdateCheckRequest returns a signed request against the update server
+// at base
+func newUpdateCheckRequest(ctx context.Context, base string, extra url.Values) (*http.Request, error) {
+	requestURL, err := buildUpdateCheckURL(base, extra)
+	if err != nil {
+		return nil, err
+	}
 
 	data := []byte(fmt.Sprintf("%s,%s", http.MethodGet, requestURL.RequestURI()))
 	signature, err := auth.Sign(ctx, data)
 	if err != nil {
-		return false, updateResp
+		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
 	if err != nil {
-		slog.Warn(fmt.Sprintf("failed to check for update: %s", err))
-		return false, updateResp
+		return nil, err
 	}
 	req.Header.Set("Authorization", signature)
 	req.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+	// Setting this explicitly disables the transport's transparent
+	// decompression, so readResponseBody handles it
+	req.Header.Set("Accept-Encoding", "gzip")
+	return req, nil
+}
+
+// MaxUpdateResponseSize caps how much of an update server response is read,
+// after decompression
+var MaxUpdateResponseSize int64 = 1 << 20
 
-	slog.Debug("checking for available update", "requestURL", requestURL)
-	resp, err := http.DefaultClient.Do(req)
+// readResponseBody reads an update server response, decompressing it if
+// needed. Responses over MaxUpdateResponseSize are rejected.
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	var reader io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed gzip response: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, MaxUpdateResponseSize+1))
 	if err != nil {
-		slog.Warn(fmt.Sprintf("failed to check for update: %s", err))
-		return false, updateResp
+		return nil, err
+	}
+	if int64(len(body)) > MaxUpdateResponseSize {
+		return nil, fmt.Errorf("response exceeds %d bytes", MaxUpdateResponseSize)
+	}
+	return body, nil
+}
+
+// fetchUpdateResponse checks for an update with the server at base, within
+// UpdateCheckTimeout. upToDate is set when the server has nothing newer.
+func fetchUpdateResponse(ctx context.Context, base string) (updateResp UpdateResponse, upToDate bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, envDuration("OLLAMA_UPDATE_CHECK_TIMEOUT", UpdateCheckTimeout))
+	defer cancel()
+
+	req, err := newUpdateCheckRequest(ctx, base, nil)
+	if err != nil {
+		return updateResp, false, err
+	}
+
+	slog.Debug("checking for available update", "requestURL", req.URL)
+	setLastCheckURL(req.URL.String())
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return updateResp, false, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 204 {
-		slog.Debug("check update response 204 (current version is up to date)")
-		return false, updateResp
+		checkClockSkew(resp.Header.Get("Date"), time.Now(), false)
+		return updateResp, true, nil
+	}
+	if ct := resp.Header.Get("Content-Type"); !isUpdateContentType(ct) {
+		return updateResp, false, fmt.Errorf("unexpected %q response, likely a captive portal or proxy error page", ct)
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := readResponseBody(resp)
 	if err != nil {
-		slog.Warn(fmt.Sprintf("failed to read body response: %s", err))
+		return updateResp, false, fmt.Errorf("failed to read body response: %w", err)
+	}
+	updateResp, err = decodeUpdateResponse(body)
+	if err != nil {
+		return UpdateResponse{}, false, fmt.Errorf("invalid response: %w", err)
+	}
+	checkClockSkew(resp.Header.Get("Date"), time.Now(), updateResp.Signed)
+	if err := selectUpdateAsset(&updateResp, UpdateOS, UpdateArch); err != nil {
+		return UpdateResponse{}, false, fmt.Errorf("invalid response: %w", err)
+	}
+	return updateResp, false, nil
+}
+
+// IsNewReleaseAvailable checks each update server in turn, moving on to the
+// next when one fails, and reports whether the first to answer has an
+// update for this machine
+func IsNewReleaseAvailable(ctx context.Context) (bool, UpdateResponse) {
+	var updateResp UpdateResponse
+	var upToDate bool
+	var err error
+	bases := updateCheckURLBases()
+	for i, base := range bases {
+		updateResp, upToDate, err = fetchUpdateResponse(ctx, base)
+		if err == nil {
+			if i > 0 {
+				slog.Info(fmt.Sprintf("checked for updates with %s after %d failed", base, i))
+			}
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(bases)-1 {
+			slog.Warn(fmt.Sprintf("failed to check for update with %s, trying %s: %s", base, bases[i+1], err))
+		}
 	}
-	err = json.Unmarshal(body, &updateResp)
 	if err != nil {
-		slog.Warn(fmt.Sprintf("malformed response checking for update: %s", err))
+		updateLog.Warn("update check", fmt.Sprintf("failed to check for update: %s", err))
+		if ctx.Err() == nil {
+			updateFailures.failed(checkFailedKey)
+		}
+		return false, UpdateResponse{}
+	}
+	updateLog.Reset("update check")
+	updateFailures.succeeded(checkFailedKey)
+	if upToDate {
+		// Nothing left to download
+		updateFailures.succeeded(downloadFailedKey)
+		slog.Debug("check update response 204 (current version is up to date)")
 		return false, updateResp
 	}
+
 	// Extract the version string from the URL in the github release artifact path
 	updateResp.UpdateVersion = path.Base(path.Dir(updateResp.UpdateURL))
 
+	if !pinAllows(updateResp.UpdateVersion) {
+		slog.Info(fmt.Sprintf("ignoring update %s, updates are pinned to %s", updateResp.UpdateVersion, pinnedVersionSetting()))
+		return false, updateResp
+	}
+
+	if !osSupported(systemOSVersion, updateResp.MinOSVersion) {
+		return false, updateResp
+	}
+	if !requirementsMet(systemCapabilities, updateResp.Requirements) {
+		return false, updateResp
+	}
+
 	slog.Info("New update available at " + updateResp.UpdateURL)
 	return true, updateResp
 }
 
-func DownloadNewRelease(ctx context.Context, updateResp UpdateResponse) error {
-	// Do a head first to check etag info
-	req, err := http.NewRequestWithContext(ctx, http.MethodHead, updateResp.UpdateURL, nil)
+// isUpdateContentType reports whether contentType is one an update check
+// response can have, either JSON or a JWS wrapping it
+func isUpdateContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "application/json", mediaType == "application/jose":
+		return true
+	case strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"):
+		return true
+	}
+	return false
+}
+
+// CancelDownload stops an in-progress DownloadNewRelease, which removes any
+// partial download and returns context.Canceled. It reports whether a
+// download was active.
+func CancelDownload() bool {
+	muDownload.Lock()
+	defer muDownload.Unlock()
+	if cancelDownload == nil {
+		return false
+	}
+	slog.Info("cancelling update download")
+	cancelDownload()
+	return true
+}
+
+// UpdateInProgress reports whether an update is downloading or an install is
+// being prepared, which ending the session would interrupt. A running
+// installer isn't included, it closes the app itself and finishes on its own.
+func UpdateInProgress() bool {
+	return downloadActive() || installPreparing.Load()
+}
+
+// downloadActive reports whether DownloadNewRelease is running
+func downloadActive() bool {
+	muDownload.Lock()
+	defer muDownload.Unlock()
+	return cancelDownload != nil
+}
+
+// DownloadNewRelease downloads and stages updateResp. A download stopped by
+// PauseDownload returns errDownloadPaused, keeping what was downloaded so
+// far for ResumeDownload.
+func DownloadNewRelease(ctx context.Context, updateResp UpdateResponse) error {
+	if UpdatesDisabled() {
+		return errUpdatesDisabled
+	}
+	if err := verifyBeforeDownload(updateVerifyLevel(), updateResp); err != nil {
 		return err
 	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	muDownload.Lock()
+	cancelDownload = func() { cancel(context.Canceled) }
+	pauseDownload = func() { cancel(errDownloadPaused) }
+	activeDownload = &updateResp
+	pausedDownload = nil
+	muDownload.Unlock()
+	defer func() {
+		muDownload.Lock()
+		cancelDownload, pauseDownload, activeDownload = nil, nil, nil
+		muDownload.Unlock()
+		cancel(nil)
+	}()
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error checking update: %w", err)
+	if err := downloadNewRelease(ctx, updateResp); err != nil {
+		if pausedBy(ctx) {
+			return errDownloadPaused
+		}
+		return err
+	}
+	return nil
+}
+
+func downloadNewRelease(ctx context.Context, updateResp UpdateResponse) error {
+	if src, ok := localUpdateSource(); ok {
+		return stageLocalRelease(ctx, src, updateResp)
 	}
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("unexpected status attempting to download update %d", resp.StatusCode)
+
+	if updateResp.ManifestURL != "" {
+		if err := checkTrustedHost(updateResp.ManifestURL); err != nil {
+			return err
+		}
+		return downloadManifestRelease(ctx, updateResp)
 	}
-	resp.Body.Close()
-	etag := strings.Trim(resp.Header.Get("etag"), "\"")
-	if etag == "" {
-		slog.Debug("no etag detected, falling back to filename based dedup")
-		etag = "_"
+	var err error
+	if updateResp.UpdateURL, err = applyUpdateMirror(updateResp.UpdateURL, updateResp.Checksum); err != nil {
+		return err
 	}
-	filename := Installer
-	_, params, err := mime.ParseMediaType(resp.Header.Get("content-disposition"))
-	if err == nil {
-		filename = params["filename"]
+	if err := checkTrustedHost(updateResp.UpdateURL); err != nil {
+		return err
 	}
 
-	stageFilename := filepath.Join(UpdateStageDir, etag, filename)
+	// Do a head first to check etag, size and range support
+	setLastUpdateURL(updateResp.UpdateURL)
+	info, err := probeDownload(ctx, updateResp.UpdateURL)
+	if err != nil {
+		return err
+	}
+	setLastUpdateURL(info.URL)
+
+	stageDir := stageDirName(info.ETag, updateResp.UpdateURL)
+	stageFilename := filepath.Join(UpdateStageDir, stageDir, stageFileName(info.Filename, updateResp.UpdateURL))
 
 	// Check to see if we already have it downloaded
-	_, err = os.Stat(stageFilename)
-	if err == nil {
-		slog.Info("update already downloaded")
-		return nil
+	if stagedInstallerExists(stageFilename) {
+		if _, err := verifyStagedInstaller(stageFilename); err == nil {
+			slog.Info("update already downloaded")
+			SetUpdateDownloaded(true)
+			return nil
+		}
+		slog.Warn(fmt.Sprintf("re-downloading update: %s", err))
+		removeStagedInstaller(stageFilename)
 	}
 
+	// Only an interrupted download of this same release can be resumed,
+	// which takes a strong ETag to make sure it hasn't changed since
+	resumeETag := ""
+	if info.AcceptRanges && !strings.HasPrefix(info.ETag, "W/") {
+		resumeETag = info.ETag
+	}
+	partial := partialSize(stageFilename)
+	resume := resumeETag != "" && partial > 0 && partial < info.Size
+	if resume {
+		cleanupOldDownloadsExcept(stageDir)
+	} else {
+		cleanupOldDownloads()
+	}
+
+	if info.Size > 0 {
+		needed := info.Size
+		if resume {
+			needed -= partial
+		}
+		if err := checkDiskSpace(UpdateStageDir, needed); err != nil {
+			return err
+		}
+	}
+
+	// A patch is much smaller, but anything going wrong with it just means
+	// downloading the whole installer
+	var checksum string
+	if updateResp.Patch != nil && !resume {
+		if checksum, err = applyUpdatePatch(ctx, updateResp, stageFilename); err != nil {
+			slog.Warn(fmt.Sprintf("unable to patch the installer, downloading all of it: %s", err))
+		}
+	}
+	if checksum == "" {
+		if checksum, err = downloadFile(ctx, updateResp.UpdateURL, stageFilename, updateResp.Checksum, resumeETag); err != nil {
+			return err
+		}
+	}
+	staged := StagedUpdate{
+		Version: updateResp.UpdateVersion,
+		URL:     updateResp.UpdateURL,
+		SHA256:  checksum,
+	}
+	if err := writeStagedMetadata(stageFilename, staged); err != nil {
+		return fmt.Errorf("write update metadata %s: %w", stageFilename, err)
+	}
+	slog.Info("new update downloaded " + stageFilename)
+	storeStagedInstaller(stageFilename)
+
+	SetUpdateDownloaded(true)
+	return nil
+}
+
+// ForceRedownload discards anything already staged, including an update
+// that passes verification, and downloads updateResp again
+func ForceRedownload(ctx context.Context, updateResp UpdateResponse) error {
+	slog.Info("discarding staged update and downloading again")
+	SetUpdateDownloaded(false)
 	cleanupOldDownloads()
+	return DownloadNewRelease(ctx, updateResp)
+}
 
-	req.Method = http.MethodGet
-	resp, err = http.DefaultClient.Do(req)
+// downloadFile streams url to dest and returns its sha256 checksum. The
+// payload is written to a .part file which is only renamed to dest once
+// complete and verified against checksum, if set. With the ETag of the
+// download, an existing .part file is continued with a range request, only
+// if it still matches, and kept if the download fails part way.
+func downloadFile(ctx context.Context, url, dest, checksum, etag string) (string, error) {
+	reqCtx, cancelReq := downloadContext(ctx)
+	defer cancelReq()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	partial := dest + ".part"
+	resumable := etag != ""
+	offset := int64(0)
+	if resumable {
+		offset = partialSize(dest)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", etag)
+	}
+	resp, err := updateClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("error checking update: %w", err)
+		if ctx.Err() != nil {
+			return "", context.Cause(ctx)
+		}
+		return "", fmt.Errorf("error downloading update: %w", err)
 	}
 	defer resp.Body.Close()
-	etag = strings.Trim(resp.Header.Get("etag"), "\"")
-	if etag == "" {
-		slog.Debug("no etag detected, falling back to filename based dedup") // TODO probably can get rid of this redundant log
-		etag = "_"
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		slog.Info(fmt.Sprintf("resuming update download at %d bytes", offset))
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range, or the download changed, start over
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial doesn't fit the download any more
+		slog.Warn(fmt.Sprintf("unable to resume update download at %d bytes, starting over", offset))
+		resp.Body.Close()
+		os.Remove(partial)
+		return downloadFile(ctx, url, dest, checksum, etag)
+	default:
+		os.Remove(partial)
+		return "", fmt.Errorf("unexpected status attempting to download update %d", resp.StatusCode)
 	}
 
-	stageFilename = filepath.Join(UpdateStageDir, etag, filename)
-
-	_, err = os.Stat(filepath.Dir(stageFilename))
+	_, err = os.Stat(filepath.Dir(dest))
 	if errors.Is(err, os.ErrNotExist) {
-		if err := os.MkdirAll(filepath.Dir(stageFilename), 0o755); err != nil {
-			return fmt.Errorf("create ollama dir %s: %v", filepath.Dir(stageFilename), err)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return "", fmt.Errorf("create ollama dir %s: %v", filepath.Dir(dest), err)
 		}
 	}
 
-	payload, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read body response: %w", err)
+	h := sha256.New()
+	var fp *os.File
+	if offset > 0 {
+		fp, err = os.OpenFile(partial, os.O_RDWR, 0o755)
+		if err == nil {
+			// Hash what we already have so the checksum covers the whole file
+			if _, err = io.CopyN(h, fp, offset); err == nil {
+				_, err = fp.Seek(offset, io.SeekStart)
+			}
+			if err != nil {
+				fp.Close()
+			}
+		}
+	} else {
+		fp, err = os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
 	}
-	fp, err := os.OpenFile(stageFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
 	if err != nil {
-		return fmt.Errorf("write payload %s: %w", stageFilename, err)
+		os.Remove(partial)
+		return "", fmt.Errorf("write payload %s: %w", partial, err)
 	}
-	defer fp.Close()
-	if n, err := fp.Write(payload); err != nil || n != len(payload) {
-		return fmt.Errorf("write payload %s: %d vs %d -- %w", stageFilename, n, len(payload), err)
+	body := newStallReader(resp.Body, envDuration("OLLAMA_UPDATE_STALL_TIMEOUT", UpdateStallTimeout), cancelReq)
+	progress := &progressWriter{hub: downloadProgress, progress: DownloadProgress{URL: url, Completed: offset}}
+	if resp.ContentLength > 0 {
+		progress.progress.Total = offset + resp.ContentLength
+	}
+	_, err = io.Copy(io.MultiWriter(fp, h, progress), body)
+	body.Stop()
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if pausedBy(ctx) {
+			slog.Info(fmt.Sprintf("update download paused with %d bytes of %s", partialSize(dest), dest))
+			return "", errDownloadPaused
+		}
+		if ctx.Err() != nil {
+			os.Remove(partial)
+			slog.Info("update download cancelled")
+			return "", ctx.Err()
+		}
+		if !resumable {
+			os.Remove(partial)
+		}
+		return "", fmt.Errorf("write payload %s: %w", partial, err)
 	}
-	slog.Info("new update downloaded " + stageFilename)
 
-	UpdateDownloaded = true
-	return nil
+	sum := hex.EncodeToString(h.Sum(nil))
+	if checksum != "" && !strings.EqualFold(checksum, sum) {
+		os.Remove(partial)
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", url, checksum, sum)
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("write payload %s: %w", dest, err)
+	}
+	progress.progress.Done = true
+	downloadProgress.publish(progress.progress)
+	return sum, nil
 }
 
 func cleanupOldDownloads() {
+	cleanupOldDownloadsExcept("")
+}
+
+// cleanupOldDownloadsExcept removes everything staged other than the keep
+// directory and the retained installed updates, dropping decompressed
+// copies of the installers still kept compressed in those
+func cleanupOldDownloadsExcept(keep string) {
 	files, err := os.ReadDir(UpdateStageDir)
 	if err != nil && errors.Is(err, os.ErrNotExist) {
 		// Expected behavior on first run
@@ -184,6 +613,10 @@ func cleanupOldDownloads() {
 		return
 	}
 	for _, file := range files {
+		if (keep != "" && file.Name() == keep) || file.Name() == retainedDirName {
+			dropDecompressedCopies(filepath.Join(UpdateStageDir, file.Name()))
+			continue
+		}
 		fullname := filepath.Join(UpdateStageDir, file.Name())
 		slog.Debug("cleaning up old download: " + fullname)
 		err = os.RemoveAll(fullname)
@@ -193,31 +626,257 @@ func cleanupOldDownloads() {
 	}
 }
 
-func StartBackgroundUpdaterChecker(ctx context.Context, cb func(string) error) {
-	go func() {
-		// Don't blast an update message immediately after startup
-		// time.Sleep(30 * time.Second)
-		time.Sleep(3 * time.Second)
+// UpdaterCallbacks are how the background update checker reports to the tray
+type UpdaterCallbacks struct {
+	// UpdateAvailable notifies about ver, with the localized description
+	// from the update server, if any
+	UpdateAvailable func(ver, description string) error
+	// UpdateMandatory notifies about a mandatory update, with the message
+	// from the update server, if any
+	UpdateMandatory func(ver, message string) error
+	// UpToDate is only called for manual checks, so background checks don't
+	// nag about there being nothing new
+	UpToDate func() error
+	// UpdatePending shows an available update without notifying, used while
+	// re-notifications are backed off
+	UpdatePending func(ver string) error
+	// Install applies a downloaded update, used when automatic installs
+	// are enabled
+	Install func() error
+}
+
+// Requests an immediate, manual, update check
+var checkNow = make(chan struct{}, 1)
 
-		for {
-			available, resp := IsNewReleaseAvailable(ctx)
-			if available {
-				err := DownloadNewRelease(ctx, resp)
-				if err != nil {
-					slog.Error(fmt.Sprintf("failed to download new release: %s", err))
-				}
-				err = cb(resp.UpdateVersion)
-				if err != nil {
-					slog.Warn(fmt.Sprintf("failed to register update available with tray: %s", err))
-				}
-			}
-			select {
-			case <-ctx.Done():
-				slog.Debug("stopping background update checker")
+// Requests a background check after the system wakes from sleep, once
+// ResumeCheckDelay has given the network time to reconnect
+var (
+	resumeCheck      = make(chan struct{}, 1)
+	ResumeCheckDelay = 15 * time.Second
+)
+
+// Manual checks are throttled to one per ManualCheckCooldown, so the menu
+// item can't be used to hammer the update server. Overridden by
+// OLLAMA_UPDATE_MANUAL_CHECK_COOLDOWN
+var (
+	ManualCheckCooldown = time.Minute
+
+	lastManualCheck   time.Time
+	muLastManualCheck sync.Mutex
+)
+
+// CheckNow asks the background checker to check for an update right away.
+// It reports false if a manual check was requested too recently.
+func CheckNow() bool {
+	muLastManualCheck.Lock()
+	defer muLastManualCheck.Unlock()
+	cooldown := envDuration("OLLAMA_UPDATE_MANUAL_CHECK_COOLDOWN", ManualCheckCooldown)
+	if !lastManualCheck.IsZero() && time.Since(lastManualCheck) < cooldown {
+		slog.Info(fmt.Sprintf("ignoring update check, the last one was less than %s ago", cooldown))
+		return false
+	}
+	lastManualCheck = time.Now()
+	select {
+	case checkNow <- struct{}{}:
+	default:
+		slog.Debug("update check already pending")
+	}
+	return true
+}
+
+// CheckAfterResume asks the background checker to check soon after the
+// system wakes, rather than whenever the interval started before sleeping
+// runs out
+func CheckAfterResume() {
+	select {
+	case resumeCheck <- struct{}{}:
+	default:
+		slog.Debug("update check already pending")
+	}
+}
+
+func StartBackgroundUpdaterChecker(ctx context.Context, cb UpdaterCallbacks) {
+	if UpdatesDisabled() {
+		slog.Info("updates are disabled on this machine, not checking for updates")
+		return
+	}
+	go runUpdateChecker(ctx, cb)
+}
+
+func runUpdateChecker(ctx context.Context, cb UpdaterCallbacks) {
+	manual := false
+	jitter := newJitterRand(machineID())
+	delay := envDuration("OLLAMA_UPDATE_STARTUP_DELAY", UpdateStartupDelay) + startupOffset(jitter, UpdateStartupJitter)
+	if checkOnLaunchSetting() {
+		// Still goes through every gate in the loop below
+		slog.Debug("checking for updates on launch")
+		delay = 0
+	}
+	select {
+	case <-ctx.Done():
+		slog.Debug("stopping background update checker")
+		return
+	case <-checkNow:
+		manual = true
+	case <-resumeCheck:
+		if !waitAfterResume(ctx) {
+			return
+		}
+	case <-time.After(delay):
+	}
+
+	for {
+		if UpdatesDisabled() {
+			slog.Info("updates were disabled, stopping background update checker")
+			return
+		}
+		checkForUpdate(ctx, manual, cb)
+		manual = false
+		select {
+		case <-ctx.Done():
+			slog.Debug("stopping background update checker")
+			return
+		case <-checkNow:
+			manual = true
+		case <-resumeCheck:
+			if !waitAfterResume(ctx) {
 				return
-			default:
-				time.Sleep(UpdateCheckInterval)
 			}
+		case <-time.After(jitteredInterval(jitter, UpdateCheckInterval, UpdateCheckJitter)):
 		}
-	}()
+	}
+}
+
+// waitAfterResume waits out ResumeCheckDelay, reporting false if the checker
+// was stopped meanwhile. The interval starts over after the check.
+func waitAfterResume(ctx context.Context) bool {
+	slog.Info("system resumed from sleep, checking for updates")
+	select {
+	case <-ctx.Done():
+		slog.Debug("stopping background update checker")
+		return false
+	case <-time.After(ResumeCheckDelay):
+		return true
+	}
+}
+
+func checkForUpdate(ctx context.Context, manual bool, cb UpdaterCallbacks) {
+	available, resp := IsNewReleaseAvailable(ctx)
+	if !available {
+		if manual && cb.UpToDate != nil {
+			if err := cb.UpToDate(); err != nil {
+				slog.Warn(fmt.Sprintf("failed to report up to date with tray: %s", err))
+			}
+		}
+		return
+	}
+	rememberAvailableUpdate(resp)
+
+	if DownloadPaused() {
+		slog.Info(fmt.Sprintf("update %s found, leaving the paused download until it's resumed", resp.UpdateVersion))
+		showUpdatePending(cb, resp.UpdateVersion)
+		return
+	}
+	// In manual mode the update is only shown in the menu, and a check from
+	// there downloads it. Required updates download regardless.
+	if resp.Mandatory && !resp.Signed {
+		slog.Warn(fmt.Sprintf("update %s is marked mandatory but the response isn't signed, treating it as a regular update", resp.UpdateVersion))
+		if resp.MandatoryMessage != "" {
+			resp.Description = resp.MandatoryMessage
+		}
+	}
+	if !manual && !resp.required() && !autoDownloadSetting() {
+		slog.Info(fmt.Sprintf("update %s found, not downloading it until asked to", resp.UpdateVersion))
+		showUpdatePending(cb, resp.UpdateVersion)
+		return
+	}
+
+	// The check is cheap, but the download can wait for AC power and an
+	// unmetered connection. A metered one is tried again on the next check,
+	// unless this one was asked for.
+	if !manual && shouldDeferOnMetered(systemNetwork) {
+		slog.Info(fmt.Sprintf("connection is metered, deferring download of update %s until the next check", resp.UpdateVersion))
+		showUpdatePending(cb, resp.UpdateVersion)
+		return
+	}
+	if err := waitForPower(ctx, systemPower); err != nil {
+		return
+	}
+
+	err := DownloadNewRelease(ctx, resp)
+	if errors.Is(err, errDownloadPaused) {
+		showUpdatePending(cb, resp.UpdateVersion)
+		return
+	}
+	if err != nil {
+		updateLog.Error("update download", fmt.Sprintf("failed to download new release: %s", err))
+		recordUpdate(resp.UpdateVersion, "download failed: "+err.Error())
+		if errors.Is(err, context.Canceled) {
+			showUpdatePending(cb, resp.UpdateVersion)
+			return
+		}
+		// The failure is the only notification, the update isn't ready
+		notifyUpdateFailed(resp.UpdateVersion, err)
+		updateFailures.failed(downloadFailedKey)
+		return
+	}
+	updateLog.Reset("update download")
+	updateFailures.succeeded(downloadFailedKey)
+	recordUpdate(resp.UpdateVersion, "downloaded")
+	if cb.Install != nil && (resp.required() || autoInstallEnabled()) && autoInstallPossible(resp.UpdateVersion) {
+		if resp.required() {
+			scheduleMandatoryInstall(ctx, availableUpdateSetting().Found, cb.Install)
+		} else {
+			scheduleAutoInstall(ctx, cb.Install)
+		}
+	}
+	switch {
+	case resp.required() && cb.UpdateMandatory != nil:
+		// Dismissing a mandatory update doesn't back off its notifications
+		err = cb.UpdateMandatory(resp.UpdateVersion, resp.MandatoryMessage)
+		notifyUpdateAvailable(resp.UpdateVersion)
+	case notifyUpdate(resp.UpdateVersion) || cb.UpdatePending == nil:
+		err = cb.UpdateAvailable(resp.UpdateVersion, resp.Description)
+		notifyUpdateAvailable(resp.UpdateVersion)
+	default:
+		err = cb.UpdatePending(resp.UpdateVersion)
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("failed to register update available with tray: %s", err))
+	}
+}
+
+// showUpdatePending shows ver in the menu without notifying
+func showUpdatePending(cb UpdaterCallbacks, ver string) {
+	if cb.UpdatePending == nil {
+		return
+	}
+	if err := cb.UpdatePending(ver); err != nil {
+		slog.Warn(fmt.Sprintf("failed to register update available with tray: %s", err))
+	}
+}
+
+// DeferUpgrade waits until the user session is active (unlocked and not
+// presenting) before running the upgrade, doing nothing if one is already
+// underway
+func DeferUpgrade(ctx context.Context, sessionActive func() bool, upgrade func() error) error {
+	if UpdatesDisabled() {
+		return errUpdatesDisabled
+	}
+	if !upgradePending.CompareAndSwap(false, true) {
+		slog.Info("upgrade already underway, ignoring")
+		return nil
+	}
+	defer upgradePending.Store(false)
+	if !sessionActive() {
+		slog.Info("session is locked or presenting, deferring upgrade")
+	}
+	for !sessionActive() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(SessionPollInterval):
+		}
+	}
+	return upgrade()
 }
@@ -10,3 +10,7 @@ import (
 func DoUpgrade(cancel context.CancelFunc, done chan int) error {
 	return fmt.Errorf("DoUpgrade not yet implemented")
 }
+
+func DoUpgradeAndWait(cancel context.CancelFunc, done chan int) (InstallResult, error) {
+	return InstallFailed, fmt.Errorf("DoUpgradeAndWait not yet implemented")
+}
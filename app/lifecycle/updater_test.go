@@ -0,0 +1,431 @@
+package lifecycle
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+// setupTestKey creates a private key in a temporary home directory so update
+// check requests can be signed
+func setupTestKey(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".ollama"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".ollama", "id_ed25519"), pem.EncodeToMemory(block), 0o600))
+}
+
+func TestDeferUpgrade(t *testing.T) {
+	SessionPollInterval = 10 * time.Millisecond
+	t.Run("active", func(t *testing.T) {
+		called := false
+		err := DeferUpgrade(context.Background(), func() bool { return true }, func() error {
+			called = true
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, called)
+	})
+
+	t.Run("locked then unlocked", func(t *testing.T) {
+		checks := 0
+		called := false
+		err := DeferUpgrade(context.Background(), func() bool {
+			checks++
+			return checks > 3
+		}, func() error {
+			called = true
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, called)
+	})
+
+	t.Run("cancelled while locked", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		called := false
+		err := DeferUpgrade(ctx, func() bool { return false }, func() error {
+			called = true
+			return nil
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, called)
+	})
+
+	t.Run("clicked again while waiting", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var unlocked atomic.Bool
+		var upgrades atomic.Int32
+		upgrade := func() error {
+			upgrades.Add(1)
+			return nil
+		}
+		first := make(chan error, 1)
+		go func() {
+			first <- DeferUpgrade(ctx, unlocked.Load, upgrade)
+		}()
+		require.Eventually(t, upgradePending.Load, 5*time.Second, time.Millisecond)
+
+		require.NoError(t, DeferUpgrade(ctx, func() bool { return true }, upgrade))
+		assert.Zero(t, upgrades.Load(), "the second click doesn't queue an upgrade")
+
+		unlocked.Store(true)
+		require.NoError(t, <-first)
+		assert.EqualValues(t, 1, upgrades.Load())
+		assert.False(t, upgradePending.Load())
+	})
+}
+
+func stubCheckOnLaunch(t *testing.T, val bool) {
+	t.Helper()
+	orig := checkOnLaunchSetting
+	t.Cleanup(func() { checkOnLaunchSetting = orig })
+	checkOnLaunchSetting = func() bool { return val }
+}
+
+func TestUpdateCheckerStartupDelay(t *testing.T) {
+	stubCheckOnLaunch(t, false)
+	t.Setenv("OLLAMA_UPDATE_STARTUP_DELAY", "1h")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	returned := make(chan struct{})
+	go func() {
+		runUpdateChecker(ctx, UpdaterCallbacks{
+			UpdateAvailable: func(string, string) error {
+				t.Error("unexpected update callback")
+				return nil
+			},
+		})
+		close(returned)
+	}()
+
+	cancel()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("update checker did not stop during startup delay")
+	}
+}
+
+func TestUpdateCheckerLaunchCheck(t *testing.T) {
+	setupTestKey(t)
+	checked := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checked <- struct{}{}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+	setUpdatesDisabled(t, false)
+	stubCheckOnLaunch(t, true)
+	t.Setenv("OLLAMA_UPDATE_STARTUP_DELAY", "1h")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runUpdateChecker(ctx, UpdaterCallbacks{
+		UpdateAvailable: func(string, string) error { return nil },
+	})
+
+	// The check doesn't wait out the startup delay
+	select {
+	case <-checked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update check on launch")
+	}
+}
+
+func TestEnvDuration(t *testing.T) {
+	t.Setenv("OLLAMA_TEST_DURATION", "")
+	assert.Equal(t, 3*time.Second, envDuration("OLLAMA_TEST_DURATION", 3*time.Second))
+	t.Setenv("OLLAMA_TEST_DURATION", "90s")
+	assert.Equal(t, 90*time.Second, envDuration("OLLAMA_TEST_DURATION", 3*time.Second))
+	t.Setenv("OLLAMA_TEST_DURATION", "bogus")
+	assert.Equal(t, 3*time.Second, envDuration("OLLAMA_TEST_DURATION", 3*time.Second))
+}
+
+func TestIsNewReleaseAvailableGzip(t *testing.T) {
+	setupTestKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Error("expected gzip to be accepted")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		gz.Write([]byte(`{"url":"https://example.com/download/v0.1.30/OllamaSetup.exe"}`)) //nolint:errcheck
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+
+	available, resp := IsNewReleaseAvailable(context.Background())
+	require.True(t, available)
+	assert.Equal(t, "https://example.com/download/v0.1.30/OllamaSetup.exe", resp.UpdateURL)
+	assert.Equal(t, "v0.1.30", resp.UpdateVersion)
+}
+
+func TestIsNewReleaseAvailableOversized(t *testing.T) {
+	setupTestKey(t)
+	payload := `{"url":"https://example.com/download/v0.1.30/OllamaSetup.exe","padding":"` + strings.Repeat("x", 2<<20) + `"}`
+	for _, compressed := range []bool{false, true} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if compressed {
+				w.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(w)
+				defer gz.Close()
+				gz.Write([]byte(payload)) //nolint:errcheck
+				return
+			}
+			w.Write([]byte(payload)) //nolint:errcheck
+		}))
+		UpdateCheckURLBase = ts.URL
+
+		available, _ := IsNewReleaseAvailable(context.Background())
+		assert.False(t, available, "oversized response should be rejected, compressed: %v", compressed)
+		ts.Close()
+	}
+}
+
+func TestIsNewReleaseAvailableNotJSON(t *testing.T) {
+	setupTestKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><body>Please sign in to the network</body></html>`)) //nolint:errcheck
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+
+	available, resp := IsNewReleaseAvailable(context.Background())
+	assert.False(t, available)
+	assert.Equal(t, UpdateResponse{}, resp)
+}
+
+func TestIsUpdateContentType(t *testing.T) {
+	assert.True(t, isUpdateContentType("application/json"))
+	assert.True(t, isUpdateContentType("application/json; charset=utf-8"))
+	assert.True(t, isUpdateContentType("application/jose"))
+	assert.True(t, isUpdateContentType("application/vnd.ollama.update+json"))
+	assert.False(t, isUpdateContentType("text/html; charset=utf-8"))
+	assert.False(t, isUpdateContentType("text/plain"))
+	assert.False(t, isUpdateContentType(""))
+}
+
+func TestUpdateDownloadedConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(downloaded bool) {
+			defer wg.Done()
+			SetUpdateDownloaded(downloaded)
+		}(i%2 == 0)
+		go func() {
+			defer wg.Done()
+			IsUpdateDownloaded()
+		}()
+	}
+	wg.Wait()
+
+	SetUpdateDownloaded(true)
+	assert.True(t, IsUpdateDownloaded())
+	SetUpdateDownloaded(false)
+	assert.False(t, IsUpdateDownloaded())
+}
+
+func TestCancelDownload(t *testing.T) {
+	trustLocalUpdateHosts(t)
+	UpdateStageDir = t.TempDir()
+	SetUpdateDownloaded(false)
+	assert.False(t, CancelDownload())
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Content-Length", "1048576")
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(make([]byte, 1024)) //nolint:errcheck
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	updateURL := ts.URL + "/download/v0.1.30/OllamaSetup.exe"
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- DownloadNewRelease(context.Background(), UpdateResponse{UpdateURL: updateURL})
+	}()
+
+	staged := filepath.Join(UpdateStageDir, "abc", stageFileName(Installer, updateURL))
+	partial := staged + ".part"
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(partial)
+		return err == nil && info.Size() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.True(t, CancelDownload())
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("download was not cancelled")
+	}
+
+	_, err := os.Stat(partial)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(staged)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.False(t, IsUpdateDownloaded())
+}
+
+func TestCheckForUpdateUpToDate(t *testing.T) {
+	setupTestKey(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+
+	upToDate := 0
+	cb := UpdaterCallbacks{
+		UpdateAvailable: func(string, string) error {
+			t.Error("unexpected update callback")
+			return nil
+		},
+		UpToDate: func() error {
+			upToDate++
+			return nil
+		},
+	}
+
+	checkForUpdate(context.Background(), false, cb)
+	assert.Equal(t, 0, upToDate, "background checks should not report up to date")
+
+	checkForUpdate(context.Background(), true, cb)
+	assert.Equal(t, 1, upToDate)
+}
+
+func TestGetUpdateCheckURLPlatform(t *testing.T) {
+	origOS, origArch, origVersion := UpdateOS, UpdateArch, version.Version
+	t.Cleanup(func() {
+		UpdateOS, UpdateArch, version.Version = origOS, origArch, origVersion
+	})
+	UpdateCheckURLBase = "https://ollama.com/api/update"
+
+	cases := []struct{ os, arch string }{
+		{"windows", "amd64"},
+		{"darwin", "arm64"},
+		{"linux", "arm64"},
+	}
+	for _, tc := range cases {
+		UpdateOS, UpdateArch = tc.os, tc.arch
+		version.Version = "0.1.30"
+		u, err := GetUpdateCheckURL(url.Values{"list": []string{"1"}})
+		require.NoError(t, err)
+		assert.Equal(t, "ollama.com", u.Host)
+		assert.Equal(t, "/api/update", u.Path)
+		q := u.Query()
+		assert.Equal(t, tc.os, q.Get("os"))
+		assert.Equal(t, tc.arch, q.Get("arch"))
+		assert.Equal(t, "0.1.30", q.Get("version"))
+		assert.Equal(t, "1", q.Get("list"))
+		assert.NotEmpty(t, q.Get("nonce"))
+		assert.NotEmpty(t, q.Get("ts"))
+	}
+}
+
+func TestUpdateCheckerResume(t *testing.T) {
+	setupTestKey(t)
+	checked := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checked <- struct{}{}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	UpdateCheckURLBase = ts.URL
+	stubCheckOnLaunch(t, false)
+	t.Setenv("OLLAMA_UPDATE_STARTUP_DELAY", "1h")
+	origDelay := ResumeCheckDelay
+	t.Cleanup(func() { ResumeCheckDelay = origDelay })
+	ResumeCheckDelay = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runUpdateChecker(ctx, UpdaterCallbacks{
+		UpdateAvailable: func(string, string) error { return nil },
+		UpToDate: func() error {
+			t.Error("checks after resuming aren't manual")
+			return nil
+		},
+	})
+
+	// Waking checks straight away, without waiting out the startup delay
+	// or interval
+	for i := 0; i < 2; i++ {
+		CheckAfterResume()
+		select {
+		case <-checked:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("resume %d did not trigger a check", i)
+		}
+	}
+}
+
+func TestCheckNowCooldown(t *testing.T) {
+	drain := func() int {
+		n := 0
+		for {
+			select {
+			case <-checkNow:
+				n++
+			default:
+				return n
+			}
+		}
+	}
+	t.Cleanup(func() {
+		lastManualCheck = time.Time{}
+		drain()
+	})
+	lastManualCheck = time.Time{}
+	drain()
+
+	t.Setenv("OLLAMA_UPDATE_MANUAL_CHECK_COOLDOWN", "1h")
+	assert.True(t, CheckNow())
+	assert.Equal(t, 1, drain())
+	for i := 0; i < 5; i++ {
+		assert.False(t, CheckNow(), "repeated checks should be throttled")
+	}
+	assert.Equal(t, 0, drain())
+
+	t.Setenv("OLLAMA_UPDATE_MANUAL_CHECK_COOLDOWN", "0s")
+	assert.True(t, CheckNow())
+	assert.Equal(t, 1, drain())
+}
@@ -2,34 +2,102 @@ package lifecycle
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/jmorganca/ollama/version"
 )
 
-func DoUpgrade(cancel context.CancelFunc, done chan int) error {
+// overridden in tests
+var (
+	execCommand = exec.Command
+	exitApp     = os.Exit
+)
+
+// isTransientLaunchError reports whether the installer failed to start
+// because something, typically an AV scanner, briefly has it locked
+func isTransientLaunchError(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_ACCESS_DENIED)
+}
+
+func findInstaller() (string, error) {
+	if stageDir, err := findStagedManifest(); err == nil {
+		manifest, err := verifyStagedManifest(stageDir)
+		if err != nil {
+			return "", fmt.Errorf("staged update failed verification: %w", err)
+		}
+		return filepath.Join(stageDir, filepath.FromSlash(manifest.Installer)), nil
+	}
+
 	files, err := filepath.Glob(filepath.Join(UpdateStageDir, "*", "*.exe")) // TODO generalize for multiplatform
 	if err != nil {
-		return fmt.Errorf("failed to lookup downloads: %s", err)
+		return "", fmt.Errorf("failed to lookup downloads: %s", err)
 	}
 	if len(files) == 0 {
-		return fmt.Errorf("no update downloads found")
+		// Decompressing now means the installer is checked right before
+		// it's run
+		if installer, err := findStagedInstaller(); err == nil && strings.HasSuffix(installer, ".exe") {
+			if err := decompressStagedInstaller(installer); err != nil {
+				return "", fmt.Errorf("staged update failed verification: %w", err)
+			}
+			return installer, nil
+		}
+		return "", fmt.Errorf("no update downloads found")
 	} else if len(files) > 1 {
 		// Shouldn't happen
 		slog.Warn(fmt.Sprintf("multiple downloads found, using first one %v", files))
 	}
-	installerExe := files[0]
+	return files[0], nil
+}
+
+// prepareUpgrade finds and checks the staged installer, runs the pre-install
+// hook, and returns the installer with the arguments to run it with
+func prepareUpgrade() (installerExe, ver string, installArgs []string, err error) {
+	installerExe, err = findInstaller()
+	if err != nil {
+		return "", "", nil, err
+	}
+	if err := checkInStageDir(installerExe); err != nil {
+		return "", "", nil, err
+	}
+	if err := checkInstallerFile(installerExe); err != nil {
+		return "", "", nil, err
+	}
+	ver = stagedVersion(installerExe)
+	if err := verifyBeforeInstall(updateVerifyLevel(), installerExe); err != nil {
+		recordUpdate(ver, "install refused: "+err.Error())
+		return "", "", nil, err
+	}
+	if err := checkNoInstallInProgress(); err != nil {
+		return "", "", nil, err
+	}
+	if err := upgradePreflight(AppDir); err != nil {
+		recordUpdate(ver, "install refused: "+err.Error())
+		return "", "", nil, err
+	}
+	if err := runPreInstallHook(ver, installerExe); err != nil {
+		recordUpdate(ver, "install aborted: "+err.Error())
+		return "", "", nil, err
+	}
 
 	slog.Info("starting upgrade with " + installerExe)
 	slog.Info("upgrade log file " + UpgradeLogFile)
 
 	// When running in debug mode, we'll be "verbose" and let the installer pop up and prompt
-	installArgs := []string{
+	installArgs = []string{
 		"/CLOSEAPPLICATIONS",                    // Quit the tray app if it's still running
 		"/LOG=" + filepath.Base(UpgradeLogFile), // Only relative seems reliable, so set pwd
 		"/FORCECLOSEAPPLICATIONS",               // Force close the tray app - might be needed
+		"/NORESTART",                            // Leave rebooting up to the user
+		fmt.Sprintf("/RESTARTEXITCODE=%d", InstallerRebootExitCode),
 	}
 	// When we're not in debug mode, make the upgrade as quiet as possible (no GUI, no prompts)
 	// TODO - temporarily disable since we're pinning in debug mode for the preview
@@ -41,7 +109,39 @@ func DoUpgrade(cancel context.CancelFunc, done chan int) error {
 		"/VERYSILENT",
 	)
 	// }
+	return installerExe, ver, installArgs, nil
+}
+
+// installerCommand runs the installer through cmd.exe, which appends the
+// installer's exit code to InstallerExitFile and exits with it. The installer
+// closes this app to replace it but leaves cmd.exe running, so the exit code
+// is still recorded for the relaunched app to pick up.
+func installerCommand(installerExe string, installArgs []string) *exec.Cmd {
+	installer := execCommand(installerExe, installArgs...)
+	quoted := []string{`"` + installer.Path + `"`}
+	for _, arg := range installer.Args[1:] {
+		quoted = append(quoted, `"`+arg+`"`)
+	}
+	shell := os.Getenv("ComSpec")
+	if shell == "" {
+		shell = "cmd.exe"
+	}
+	cmd := exec.Command(shell)
+	cmd.Env = installer.Env
+	cmd.Dir = installer.Dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: 0x08000000,
+		// start /wait waits even for a GUI installer, and delayed expansion
+		// reads its exit code once it's done
+		CmdLine: fmt.Sprintf(`"%s" /S /V:ON /C "start "" /wait %s & (set code=!ERRORLEVEL!) & (>>"%s" echo !code!) & exit !code!"`,
+			shell, strings.Join(quoted, " "), InstallerExitFile),
+	}
+	return cmd
+}
 
+// startInstaller stops the server, then starts the installer
+func startInstaller(cancel context.CancelFunc, done chan int, installerExe, ver string, installArgs []string) (*exec.Cmd, error) {
 	// Safeguard in case we have requests in flight that need to drain...
 	slog.Info("Waiting for server to shutdown")
 	cancel()
@@ -54,27 +154,89 @@ func DoUpgrade(cancel context.CancelFunc, done chan int) error {
 
 	slog.Debug(fmt.Sprintf("starting installer: %s %v", installerExe, installArgs))
 	os.Chdir(filepath.Dir(UpgradeLogFile)) //nolint:errcheck
-	cmd := exec.Command(installerExe, installArgs...)
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("unable to start ollama app %w", err)
+	if err := startInstallerExit(ver); err != nil {
+		return nil, fmt.Errorf("unable to record the install: %w", err)
+	}
+	var cmd *exec.Cmd
+	err := launchWithRetry(func() error {
+		cmd = installerCommand(installerExe, installArgs)
+		return cmd.Start()
+	}, isTransientLaunchError)
+	if err != nil {
+		os.Remove(InstallerExitFile) //nolint:errcheck
+		return nil, fmt.Errorf("unable to start ollama app %w", err)
 	}
 
-	if cmd.Process != nil {
-		err = cmd.Process.Release()
-		if err != nil {
-			slog.Error(fmt.Sprintf("failed to release server process: %s", err))
-		}
-	} else {
+	if cmd.Process == nil {
 		// TODO - some details about why it didn't start, or is this a pedantic error case?
-		return fmt.Errorf("installer process did not start")
+		return nil, fmt.Errorf("installer process did not start")
 	}
 
-	// TODO should we linger for a moment and check to make sure it's actually running by checking the pid?
+	recordUpdate(ver, "install started")
+	reportUpdateResult(version.Version, ver, "install started")
+	runPostInstallHook(ver, installerExe)
+	return cmd, nil
+}
+
+// launchInstaller prepares the staged update and starts its installer,
+// holding off the session ending meanwhile
+func launchInstaller(cancel context.CancelFunc, done chan int) (*exec.Cmd, string, error) {
+	installPreparing.Store(true)
+	defer installPreparing.Store(false)
+	installerExe, ver, installArgs, err := prepareUpgrade()
+	if err != nil {
+		return nil, "", err
+	}
+	cmd, err := startInstaller(cancel, done, installerExe, ver, installArgs)
+	if err != nil {
+		return nil, "", err
+	}
+	return cmd, ver, nil
+}
 
-	slog.Info("Installer started in background, exiting")
+// finishInstall waits for the installer and records how it went, rather
+// than leaving that to the next launch, returning its exit code
+func finishInstall(ver string, cmd *exec.Cmd) (int, error) {
+	code := installerExitCode(cmd.Wait())
+	os.Remove(InstallerExitFile) //nolint:errcheck
+	return code, recordInstallerExit(ver, code)
+}
 
-	os.Exit(0)
+func DoUpgrade(cancel context.CancelFunc, done chan int) error {
+	cmd, ver, err := launchInstaller(cancel, done)
+	if err != nil {
+		return err
+	}
+	slog.Info("Installer started, waiting for it to finish")
+
+	// The installer normally closes the app to replace it before it gets
+	// this far, leaving the relaunched app to record how it went. If the app
+	// is still running, anything in use is replaced on the next reboot,
+	// which the installer reports through its exit code.
+	if _, err := finishInstall(ver, cmd); err != nil {
+		slog.Error(fmt.Sprintf("upgrade failed: %s", err))
+	}
+
+	exitApp(0)
 	// Not reached
 	return nil
 }
+
+// DoUpgradeAndWait installs the staged update like DoUpgrade, but waits for
+// the installer and returns how it went instead of exiting, for callers like
+// the command line that report the result themselves
+func DoUpgradeAndWait(cancel context.CancelFunc, done chan int) (InstallResult, error) {
+	cmd, ver, err := launchInstaller(cancel, done)
+	if err != nil {
+		return InstallFailed, err
+	}
+	slog.Info("Installer started, waiting for it to finish")
+
+	code, err := finishInstall(ver, cmd)
+	if err != nil {
+		return InstallFailed, err
+	}
+	result, err := installResult(code)
+	slog.Info(fmt.Sprintf("install of %s %s", ver, result))
+	return result, err
+}
@@ -0,0 +1,177 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+
+	"github.com/jmorganca/ollama/app/store"
+)
+
+func TestIsTransientLaunchError(t *testing.T) {
+	wrap := func(err error) error {
+		return fmt.Errorf("start: %w", &os.PathError{Op: "fork/exec", Path: "OllamaSetup.exe", Err: err})
+	}
+	assert.True(t, isTransientLaunchError(wrap(windows.ERROR_SHARING_VIOLATION)))
+	assert.True(t, isTransientLaunchError(wrap(windows.ERROR_ACCESS_DENIED)))
+	assert.False(t, isTransientLaunchError(wrap(windows.ERROR_FILE_NOT_FOUND)))
+}
+
+func TestInstallerRebootExitCode(t *testing.T) {
+	// Exit codes are 32 bits on Windows, so 3010 survives the round trip
+	reboot, err := installerOutcome(installerExitCode(runFakeInstaller(t, InstallerRebootExitCode)))
+	assert.NoError(t, err)
+	assert.True(t, reboot)
+}
+
+func TestPlatformNativeArch(t *testing.T) {
+	arch, err := platformNativeArch{}.NativeArch()
+	if err != nil {
+		t.Skipf("IsWow64Process2 unavailable: %s", err)
+	}
+	assert.Contains(t, []string{"386", "arm", "amd64", "arm64"}, arch)
+}
+
+func TestDoUpgradePreInstallHookFailure(t *testing.T) {
+	stageTestInstaller(t, "installer")
+	stubInstallerSignature(t, nil)
+	stubInstallHooks(t, writeHookScript(t, 1, filepath.Join(t.TempDir(), "ran")), "")
+	origExec := execCommand
+	t.Cleanup(func() { execCommand = origExec })
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		t.Error("the installer should not run")
+		return origExec(name, args...)
+	}
+
+	cancelled := false
+	err := DoUpgrade(func() { cancelled = true }, nil)
+	assert.ErrorIs(t, err, errPreInstallHook)
+	assert.False(t, cancelled, "the server should keep running")
+}
+
+// stubFakeInstaller has the installer replaced by TestInstallerHelperProcess
+// exiting with code
+func stubFakeInstaller(t *testing.T, code int) {
+	t.Helper()
+	origExec := execCommand
+	t.Cleanup(func() { execCommand = origExec })
+	execCommand = func(string, ...string) *exec.Cmd {
+		cmd := origExec(os.Args[0], "-test.run=^TestInstallerHelperProcess$")
+		cmd.Env = append(os.Environ(), "OLLAMA_TEST_INSTALLER_EXIT="+strconv.Itoa(code))
+		return cmd
+	}
+}
+
+func TestInstallerCommandLeavesExitCode(t *testing.T) {
+	stubInstallerExitFile(t)
+	stubFakeInstaller(t, InstallerRebootExitCode)
+
+	// Nothing here waits on the installer, as when it closes the app
+	require.NoError(t, startInstallerExit("0.1.2"))
+	cmd := installerCommand("OllamaSetup.exe", []string{"/SILENT"})
+	require.NoError(t, cmd.Start())
+	require.NoError(t, cmd.Process.Release())
+
+	ver, code, err := waitInstallerExit(context.Background(), 30*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "0.1.2", ver)
+	assert.Equal(t, InstallerRebootExitCode, code)
+}
+
+func TestDoUpgradeRebootRequired(t *testing.T) {
+	stageTestInstaller(t, "installer")
+	stubInstallHooks(t, "", "")
+	stubInstallerSignature(t, nil)
+	stubUpdateReportURL(t, "")
+	stubInstallerExitFile(t)
+	stubFakeInstaller(t, InstallerRebootExitCode)
+	UpgradeLogFile = filepath.Join(t.TempDir(), "upgrade.log")
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Chdir(wd) }) //nolint:errcheck
+	origPending := store.GetRebootPending()
+	t.Cleanup(func() { store.SetRebootPending(origPending) })
+	store.SetRebootPending("")
+	origExit := exitApp
+	t.Cleanup(func() { exitApp = origExit })
+	exited := -1
+	exitApp = func(code int) { exited = code }
+
+	done := make(chan int, 1)
+	done <- 0
+	require.NoError(t, DoUpgrade(func() {}, done))
+	assert.Equal(t, 0, exited)
+	assert.Equal(t, "0.1.2", store.GetRebootPending())
+	assert.NoFileExists(t, InstallerExitFile)
+}
+
+func TestDoUpgradeAndWait(t *testing.T) {
+	stubInstallHooks(t, "", "")
+	stubInstallerSignature(t, nil)
+	stubUpdateReportURL(t, "")
+	stubInstallerExitFile(t)
+	UpgradeLogFile = filepath.Join(t.TempDir(), "upgrade.log")
+	// The installer runs from the log directory, which has to be left
+	// before it's removed
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Chdir(wd) }) //nolint:errcheck
+
+	for _, tc := range []struct {
+		code   int
+		result InstallResult
+	}{
+		{0, InstallSucceeded},
+		{InstallerRebootExitCode, InstallRebootRequired},
+		{5, InstallFailed},
+	} {
+		stageTestInstaller(t, "installer")
+		stubFakeInstaller(t, tc.code)
+		done := make(chan int, 1)
+		done <- 0
+		result, err := DoUpgradeAndWait(func() {}, done)
+		assert.Equal(t, tc.result, result, "exit code %d", tc.code)
+		if tc.result == InstallFailed {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+}
+
+func TestPlatformInstallerRunning(t *testing.T) {
+	assert.False(t, platformInstallerRunning())
+
+	name, err := windows.UTF16PtrFromString(InstallerMutexName)
+	require.NoError(t, err)
+	h, err := windows.CreateMutex(nil, false, name)
+	require.NoError(t, err)
+	defer windows.CloseHandle(h) //nolint:errcheck
+	assert.True(t, platformInstallerRunning())
+}
+
+func TestDoUpgradeInstallInProgress(t *testing.T) {
+	stageTestInstaller(t, "installer")
+	stubInstallerSignature(t, nil)
+	stubInstallerRunning(t, true)
+	origExec := execCommand
+	t.Cleanup(func() { execCommand = origExec })
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		t.Error("the installer should not run")
+		return origExec(name, args...)
+	}
+
+	cancelled := false
+	err := DoUpgrade(func() { cancelled = true }, nil)
+	assert.ErrorIs(t, err, errInstallInProgress)
+	assert.False(t, cancelled, "the server should keep running")
+}
@@ -0,0 +1,50 @@
+package lifecycle
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The URLs the updater last used, after mirror and redirect rewriting, to
+// help troubleshoot downloads
+var (
+	lastCheckURL  string
+	lastUpdateURL string
+	muLastURLs    sync.Mutex
+)
+
+func setLastCheckURL(u string) {
+	muLastURLs.Lock()
+	defer muLastURLs.Unlock()
+	lastCheckURL = u
+}
+
+func setLastUpdateURL(u string) {
+	muLastURLs.Lock()
+	defer muLastURLs.Unlock()
+	lastUpdateURL = u
+}
+
+// LastUpdateURLs returns the URL last used to check for updates, and the
+// update URL last resolved for a download
+func LastUpdateURLs() (checkURL, updateURL string) {
+	muLastURLs.Lock()
+	defer muLastURLs.Unlock()
+	return lastCheckURL, lastUpdateURL
+}
+
+func updateURLsText() string {
+	checkURL, updateURL := LastUpdateURLs()
+	if checkURL == "" {
+		checkURL = "(not checked yet)"
+	}
+	if updateURL == "" {
+		updateURL = "(nothing downloaded yet)"
+	}
+	return redactSecrets(fmt.Sprintf("Update check URL: %s\nUpdate URL: %s\n", checkURL, updateURL))
+}
+
+// CopyUpdateURLs places the last update URLs on the clipboard
+func CopyUpdateURLs() error {
+	return SetClipboardText(updateURLsText())
+}
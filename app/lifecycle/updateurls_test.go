@@ -0,0 +1,46 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastUpdateURLs(t *testing.T) {
+	t.Cleanup(func() {
+		setLastCheckURL("")
+		setLastUpdateURL("")
+	})
+	setLastCheckURL("")
+	setLastUpdateURL("")
+	assert.Equal(t, "Update check URL: (not checked yet)\nUpdate URL: (nothing downloaded yet)\n", updateURLsText())
+
+	UpdateStageDir = t.TempDir()
+	payload := []byte("installer payload")
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/download/v0.1.30/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/cdn/OllamaSetup.exe", http.StatusFound)
+	})
+	mux.HandleFunc("/cdn/OllamaSetup.exe", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload) //nolint:errcheck
+	})
+
+	t.Setenv("OLLAMA_UPDATE_MIRROR", ts.URL)
+	resp := UpdateResponse{UpdateURL: "https://ollama.com/download/v0.1.30/OllamaSetup.exe", Checksum: sha256Hex(payload)}
+	require.NoError(t, DownloadNewRelease(context.Background(), resp))
+
+	_, updateURL := LastUpdateURLs()
+	assert.Equal(t, ts.URL+"/cdn/OllamaSetup.exe", updateURL, "should record the URL after mirror and redirect rewriting")
+
+	setupTestKey(t)
+	UpdateCheckURLBase = ts.URL + "/api/update"
+	IsNewReleaseAvailable(context.Background())
+	checkURL, _ := LastUpdateURLs()
+	assert.Contains(t, checkURL, ts.URL+"/api/update?")
+}
@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// VerifyLevel is how strictly updates are verified before they're
+// downloaded and installed, set with OLLAMA_UPDATE_VERIFY to "none",
+// "checksum" or "signature"
+type VerifyLevel int
+
+const (
+	// VerifyNone checks whatever the server provides: the checksum when it
+	// sends one, and the response signature once a public key is configured
+	VerifyNone VerifyLevel = iota
+	// VerifyChecksum refuses updates without a checksum, and checks the
+	// staged installer against it again right before it's run
+	VerifyChecksum
+	// VerifySignature also requires signed update responses, and an
+	// Authenticode signature on the installer from InstallerSigner
+	VerifySignature
+)
+
+var verifyLevelNames = map[VerifyLevel]string{
+	VerifyNone:      "none",
+	VerifyChecksum:  "checksum",
+	VerifySignature: "signature",
+}
+
+// InstallerSigner is the subject of the certificate Ollama's installers are
+// signed with, overridden by OLLAMA_UPDATE_INSTALLER_SIGNER
+var InstallerSigner = "Ollama Inc."
+
+func (l VerifyLevel) String() string {
+	if name, ok := verifyLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("VerifyLevel(%d)", int(l))
+}
+
+var errVerification = errors.New("update verification failed")
+
+// overridden in tests
+var (
+	verifyInstallerSignature = checkInstallerSignature
+	installerSigner          = platformInstallerSigner
+)
+
+func parseVerifyLevel(s string) (VerifyLevel, error) {
+	for level, name := range verifyLevelNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return level, nil
+		}
+	}
+	return VerifyNone, fmt.Errorf("unknown verification level %q", s)
+}
+
+// defaultVerifyLevel is VerifySignature on platforms that check installer
+// signatures once an update public key is configured to check responses
+// with. Until then, and elsewhere, only what the server provides is checked,
+// since the update server doesn't send checksums yet.
+func defaultVerifyLevel() VerifyLevel {
+	if !installerSignaturesSupported {
+		return VerifyNone
+	}
+	if key, err := updatePublicKey(); err == nil && key != nil {
+		return VerifySignature
+	}
+	return VerifyNone
+}
+
+func updateVerifyLevel() VerifyLevel {
+	val := os.Getenv("OLLAMA_UPDATE_VERIFY")
+	if val == "" {
+		return defaultVerifyLevel()
+	}
+	level, err := parseVerifyLevel(val)
+	if err != nil {
+		// Most likely a typo of a stricter level than the default, so a
+		// mistake never weakens verification
+		slog.Warn(fmt.Sprintf("invalid OLLAMA_UPDATE_VERIFY=%q, using %s", val, VerifySignature))
+		return VerifySignature
+	}
+	return level
+}
+
+// checkInstallerSignature checks installer has a valid Authenticode
+// signature from InstallerSigner, rather than just any trusted publisher
+func checkInstallerSignature(installer string) error {
+	signer, err := installerSigner(installer)
+	if err != nil {
+		return err
+	}
+	expected := os.Getenv("OLLAMA_UPDATE_INSTALLER_SIGNER")
+	if expected == "" {
+		expected = InstallerSigner
+	}
+	if !strings.EqualFold(signer, expected) {
+		return fmt.Errorf("signed by %q rather than %q", signer, expected)
+	}
+	return nil
+}
+
+// verifyBeforeDownload refuses updateResp when it can't be verified as
+// strictly as level requires. A manifest release always has a checksum for
+// every file.
+func verifyBeforeDownload(level VerifyLevel, updateResp UpdateResponse) error {
+	if level >= VerifyChecksum && updateResp.Checksum == "" && updateResp.ManifestURL == "" {
+		return fmt.Errorf("%w: update %s has no checksum", errVerification, updateResp.UpdateVersion)
+	}
+	if level >= VerifySignature {
+		key, err := updatePublicKey()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return fmt.Errorf("%w: update responses can't be checked without an update public key", errVerification)
+		}
+	}
+	return nil
+}
+
+// verifyBeforeInstall checks the staged installer as strictly as level
+// requires, right before it's run. A manifest's files were already checked
+// against it when the installer was found.
+func verifyBeforeInstall(level VerifyLevel, installer string) error {
+	if level >= VerifyChecksum {
+		if _, err := findStagedManifest(); err != nil {
+			if _, err := verifyStagedInstaller(installer); err != nil {
+				return fmt.Errorf("%w: %w", errVerification, err)
+			}
+		}
+	}
+	if level >= VerifySignature {
+		if err := verifyInstallerSignature(installer); err != nil {
+			return fmt.Errorf("%w: %s is not signed: %w", errVerification, installer, err)
+		}
+	}
+	return nil
+}
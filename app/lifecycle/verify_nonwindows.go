@@ -0,0 +1,11 @@
+//go:build !windows
+
+package lifecycle
+
+import "errors"
+
+const installerSignaturesSupported = false
+
+func platformInstallerSigner(installer string) (string, error) {
+	return "", errors.New("installer signatures can't be checked on this platform")
+}
@@ -0,0 +1,131 @@
+package lifecycle
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setTestPublicKey configures a new update public key, returning the
+// private key to sign responses with
+func setTestPublicKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	t.Setenv("OLLAMA_UPDATE_PUBLIC_KEY", base64.StdEncoding.EncodeToString(pub))
+	return priv
+}
+
+func stubInstallerSignature(t *testing.T, err error) *int {
+	t.Helper()
+	orig := verifyInstallerSignature
+	t.Cleanup(func() { verifyInstallerSignature = orig })
+	calls := 0
+	verifyInstallerSignature = func(string) error {
+		calls++
+		return err
+	}
+	return &calls
+}
+
+func TestUpdateVerifyLevel(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_PUBLIC_KEY", "")
+	t.Setenv("OLLAMA_UPDATE_VERIFY", "")
+	expected := VerifyNone
+	assert.Equal(t, expected, updateVerifyLevel(), "the server doesn't send checksums without a key")
+
+	setTestPublicKey(t)
+	if installerSignaturesSupported {
+		expected = VerifySignature
+	}
+	assert.Equal(t, expected, updateVerifyLevel())
+
+	for val, level := range map[string]VerifyLevel{
+		"none":       VerifyNone,
+		"checksum":   VerifyChecksum,
+		" Signature": VerifySignature,
+		"strict":     VerifySignature,
+	} {
+		t.Setenv("OLLAMA_UPDATE_VERIFY", val)
+		assert.Equal(t, level, updateVerifyLevel(), val)
+	}
+	assert.Equal(t, "checksum", VerifyChecksum.String())
+}
+
+func TestVerifyBeforeDownload(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_PUBLIC_KEY", "")
+	unchecked := UpdateResponse{UpdateVersion: "0.1.2", UpdateURL: "https://ollama.com/download/OllamaSetup.exe"}
+	checked := unchecked
+	checked.Checksum = sha256Hex([]byte("installer"))
+	manifest := unchecked
+	manifest.ManifestURL = "https://ollama.com/download/manifest.json"
+
+	// none keeps checking only what the server provides
+	assert.NoError(t, verifyBeforeDownload(VerifyNone, unchecked))
+
+	assert.ErrorIs(t, verifyBeforeDownload(VerifyChecksum, unchecked), errVerification)
+	assert.NoError(t, verifyBeforeDownload(VerifyChecksum, checked))
+	assert.NoError(t, verifyBeforeDownload(VerifyChecksum, manifest), "manifest files have checksums")
+
+	err := verifyBeforeDownload(VerifySignature, checked)
+	assert.ErrorIs(t, err, errVerification)
+	assert.ErrorContains(t, err, "without an update public key")
+	setTestPublicKey(t)
+	assert.NoError(t, verifyBeforeDownload(VerifySignature, checked))
+	assert.ErrorIs(t, verifyBeforeDownload(VerifySignature, unchecked), errVerification)
+
+	// Refused before anything is downloaded
+	t.Setenv("OLLAMA_UPDATE_VERIFY", "checksum")
+	UpdateStageDir = t.TempDir()
+	assert.ErrorIs(t, DownloadNewRelease(context.Background(), unchecked), errVerification)
+	assert.False(t, downloadActive())
+}
+
+func TestVerifyBeforeInstall(t *testing.T) {
+	installer := stageTestInstaller(t, "installer")
+	calls := stubInstallerSignature(t, nil)
+
+	assert.NoError(t, verifyBeforeInstall(VerifyNone, installer))
+	assert.NoError(t, verifyBeforeInstall(VerifyChecksum, installer))
+	assert.Zero(t, *calls, "only checked at the signature level")
+	assert.NoError(t, verifyBeforeInstall(VerifySignature, installer))
+	assert.Equal(t, 1, *calls)
+
+	stubInstallerSignature(t, errors.New("no signature present"))
+	err := verifyBeforeInstall(VerifySignature, installer)
+	assert.ErrorIs(t, err, errVerification)
+	assert.ErrorContains(t, err, "no signature present")
+	assert.NoError(t, verifyBeforeInstall(VerifyChecksum, installer))
+
+	// Tampered with after it was staged
+	require.NoError(t, os.WriteFile(installer, []byte("tampered"), 0o755))
+	assert.NoError(t, verifyBeforeInstall(VerifyNone, installer))
+	err = verifyBeforeInstall(VerifyChecksum, installer)
+	assert.ErrorIs(t, err, errVerification)
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestCheckInstallerSignature(t *testing.T) {
+	orig := installerSigner
+	t.Cleanup(func() { installerSigner = orig })
+	signer, signErr := "Ollama Inc.", error(nil)
+	installerSigner = func(string) (string, error) { return signer, signErr }
+	t.Setenv("OLLAMA_UPDATE_INSTALLER_SIGNER", "")
+
+	assert.NoError(t, checkInstallerSignature("OllamaSetup.exe"))
+
+	signer = "Some Other Publisher"
+	assert.ErrorContains(t, checkInstallerSignature("OllamaSetup.exe"), `signed by "Some Other Publisher"`, "any trusted publisher isn't enough")
+	t.Setenv("OLLAMA_UPDATE_INSTALLER_SIGNER", "some other publisher")
+	assert.NoError(t, checkInstallerSignature("OllamaSetup.exe"))
+
+	signErr = errors.New("no signature present")
+	assert.ErrorIs(t, checkInstallerSignature("OllamaSetup.exe"), signErr)
+}
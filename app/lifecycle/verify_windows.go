@@ -0,0 +1,80 @@
+package lifecycle
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const installerSignaturesSupported = true
+
+var (
+	wintrust = windows.NewLazySystemDLL("wintrust.dll")
+
+	pWTHelperProvDataFromStateData  = wintrust.NewProc("WTHelperProvDataFromStateData")
+	pWTHelperGetProvSignerFromChain = wintrust.NewProc("WTHelperGetProvSignerFromChain")
+	pWTHelperGetProvCertFromChain   = wintrust.NewProc("WTHelperGetProvCertFromChain")
+)
+
+// The start of CRYPT_PROVIDER_CERT, which is all that's needed of it
+// https://learn.microsoft.com/en-us/windows/win32/api/wintrust/ns-wintrust-crypt_provider_cert
+type cryptProviderCert struct {
+	Size uint32
+	Cert *windows.CertContext
+}
+
+// platformInstallerSigner checks the Authenticode signature of installer
+// with WinVerifyTrust, without any UI, and returns the subject of the
+// certificate it was signed with. Revocation isn't checked, so an offline
+// machine can still install.
+func platformInstallerSigner(installer string) (string, error) {
+	path, err := windows.UTF16PtrFromString(installer)
+	if err != nil {
+		return "", err
+	}
+	data := &windows.WinTrustData{
+		Size:             uint32(unsafe.Sizeof(windows.WinTrustData{})),
+		UIChoice:         windows.WTD_UI_NONE,
+		RevocationChecks: windows.WTD_REVOKE_NONE,
+		UnionChoice:      windows.WTD_CHOICE_FILE,
+		StateAction:      windows.WTD_STATEACTION_VERIFY,
+		FileOrCatalogOrBlobOrSgnrOrCert: unsafe.Pointer(&windows.WinTrustFileInfo{
+			Size:     uint32(unsafe.Sizeof(windows.WinTrustFileInfo{})),
+			FilePath: path,
+		}),
+	}
+	defer func() {
+		data.StateAction = windows.WTD_STATEACTION_CLOSE
+		windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data) //nolint:errcheck
+	}()
+	if err := windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data); err != nil {
+		return "", err
+	}
+
+	// The signer's certificate is only available until the state is closed
+	provData, _, _ := pWTHelperProvDataFromStateData.Call(uintptr(data.StateData))
+	if provData == 0 {
+		return "", errors.New("no signature state")
+	}
+	signer, _, _ := pWTHelperGetProvSignerFromChain.Call(provData, 0, 0, 0)
+	if signer == 0 {
+		return "", errors.New("no signer")
+	}
+	provCert, _, _ := pWTHelperGetProvCertFromChain.Call(signer, 0)
+	if provCert == 0 {
+		return "", errors.New("no signer certificate")
+	}
+	// provCert points to memory wintrust owns while the state is open, not
+	// to anything the Go runtime could move
+	cert := (*(**cryptProviderCert)(unsafe.Pointer(&provCert))).Cert
+	if cert == nil {
+		return "", errors.New("no signer certificate")
+	}
+	name := make([]uint16, 256)
+	n := windows.CertGetNameString(cert, windows.CERT_NAME_SIMPLE_DISPLAY_TYPE, 0, nil, &name[0], uint32(len(name)))
+	if n <= 1 {
+		return "", errors.New("signer certificate has no subject")
+	}
+	return windows.UTF16ToString(name[:n]), nil
+}
@@ -0,0 +1,22 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultVerifyLevelWithoutKey(t *testing.T) {
+	t.Setenv("OLLAMA_UPDATE_PUBLIC_KEY", "")
+	t.Setenv("OLLAMA_UPDATE_VERIFY", "")
+	assert.Equal(t, VerifyNone, updateVerifyLevel(), "the server doesn't send checksums yet")
+
+	installer := stageTestInstaller(t, "installer")
+	calls := stubInstallerSignature(t, nil)
+	assert.NoError(t, verifyBeforeDownload(updateVerifyLevel(), UpdateResponse{UpdateURL: "https://ollama.com/download/OllamaSetup.exe"}))
+	assert.NoError(t, verifyBeforeInstall(updateVerifyLevel(), installer))
+	assert.Zero(t, *calls)
+
+	setTestPublicKey(t)
+	assert.Equal(t, VerifySignature, updateVerifyLevel())
+}
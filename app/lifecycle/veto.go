@@ -0,0 +1,32 @@
+package lifecycle
+
+import "sync"
+
+// The server can hold off automatic installs while it's busy with work that
+// idle detection can't see, like a long generation from another machine.
+
+var (
+	installVetoMu sync.Mutex
+	installVeto   func() (ok bool, reason string)
+)
+
+// RegisterInstallVeto sets the hook asked right before an automatic install
+// whether it may go ahead. When it says no, the install waits and asks again
+// later. nil removes the hook.
+func RegisterInstallVeto(canInstallNow func() (ok bool, reason string)) {
+	installVetoMu.Lock()
+	defer installVetoMu.Unlock()
+	installVeto = canInstallNow
+}
+
+// canInstallNow asks the registered hook, if any, whether an automatic
+// install may start
+func canInstallNow() (bool, string) {
+	installVetoMu.Lock()
+	veto := installVeto
+	installVetoMu.Unlock()
+	if veto == nil {
+		return true, ""
+	}
+	return veto()
+}
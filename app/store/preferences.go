@@ -0,0 +1,54 @@
+package store
+
+// Preferences are the user's settings in the store, as opposed to state the
+// app tracks for itself, so they can be moved between machines. Install
+// hooks run commands, so they're deliberately left out.
+type Preferences struct {
+	AutoInstallWhenIdle        bool   `json:"auto-install-when-idle,omitempty"`
+	ActiveModel                string `json:"active-model,omitempty"`
+	UpdatesDisabledPermanently bool   `json:"updates-disabled-permanently,omitempty"`
+	MaintenanceWindow          string `json:"maintenance-window,omitempty"`
+	UpdateReportURL            string `json:"update-report-url,omitempty"`
+	PinnedVersion              string `json:"pinned-version,omitempty"`
+	QuietHours                 string `json:"quiet-hours,omitempty"`
+	SkipLaunchCheck            bool   `json:"skip-launch-check,omitempty"`
+	SkipAutoDownload           bool   `json:"skip-auto-download,omitempty"`
+}
+
+func GetPreferences() Preferences {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return Preferences{
+		AutoInstallWhenIdle:        store.AutoInstallWhenIdle,
+		ActiveModel:                store.ActiveModel,
+		UpdatesDisabledPermanently: store.UpdatesDisabledPermanently,
+		MaintenanceWindow:          store.MaintenanceWindow,
+		UpdateReportURL:            store.UpdateReportURL,
+		PinnedVersion:              store.PinnedVersion,
+		QuietHours:                 store.QuietHours,
+		SkipLaunchCheck:            store.SkipLaunchCheck,
+		SkipAutoDownload:           store.SkipAutoDownload,
+	}
+}
+
+// SetPreferences replaces every preference at once
+func SetPreferences(p Preferences) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	store.AutoInstallWhenIdle = p.AutoInstallWhenIdle
+	store.ActiveModel = p.ActiveModel
+	store.UpdatesDisabledPermanently = p.UpdatesDisabledPermanently
+	store.MaintenanceWindow = p.MaintenanceWindow
+	store.UpdateReportURL = p.UpdateReportURL
+	store.PinnedVersion = p.PinnedVersion
+	store.QuietHours = p.QuietHours
+	store.SkipLaunchCheck = p.SkipLaunchCheck
+	store.SkipAutoDownload = p.SkipAutoDownload
+	writeStore(storePathFn())
+}
@@ -7,19 +7,105 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Store struct {
-	ID           string `json:"id"`
-	FirstTimeRun bool   `json:"first-time-run"`
+	ID            string         `json:"id"`
+	FirstTimeRun  bool           `json:"first-time-run"`
+	UpdateHistory []UpdateRecord `json:"update-history,omitempty"`
+
+	// Install downloaded updates without prompting once the system is idle
+	AutoInstallWhenIdle bool `json:"auto-install-when-idle,omitempty"`
+
+	// The model picked in the tray menu
+	ActiveModel string `json:"active-model,omitempty"`
+
+	UpdateNotice *UpdateNotice `json:"update-notice,omitempty"`
+
+	// The version that last ran, to detect completed upgrades
+	LastRunVersion string `json:"last-run-version,omitempty"`
+
+	// Never check for, download or install updates on this machine
+	UpdatesDisabledPermanently bool `json:"updates-disabled-permanently,omitempty"`
+
+	// The version an installer finished staging that needs a reboot to
+	// complete
+	RebootPending string `json:"reboot-pending,omitempty"`
+
+	// Local hours, like "02:00-04:00", when updates may install automatically
+	MaintenanceWindow string `json:"maintenance-window,omitempty"`
+
+	// Where to report the outcome of updates, which isn't sent when empty
+	UpdateReportURL string `json:"update-report-url,omitempty"`
+
+	// Where the running app listens for local control requests, and the
+	// token they must present
+	ControlPort  int    `json:"control-port,omitempty"`
+	ControlToken string `json:"control-token,omitempty"`
+
+	// Commands run before and after the installer when upgrading
+	PreInstallCommand  string `json:"pre-install-command,omitempty"`
+	PostInstallCommand string `json:"post-install-command,omitempty"`
+
+	// Only ever update to this version, ignoring any other release
+	PinnedVersion string `json:"pinned-version,omitempty"`
+
+	// The newest update found by the last check, restored on the next launch
+	AvailableUpdate *AvailableUpdate `json:"available-update,omitempty"`
+
+	// Local hours, like "22:00-07:00", when informational notifications are
+	// held back
+	QuietHours string `json:"quiet-hours,omitempty"`
+
+	// Don't check for updates the moment the app starts, waiting out the
+	// startup delay instead
+	SkipLaunchCheck bool `json:"skip-launch-check,omitempty"`
+
+	// Only download updates when asked to, instead of as soon as they're
+	// found
+	SkipAutoDownload bool `json:"skip-auto-download,omitempty"`
+}
+
+// AvailableUpdate describes an update that was found but not yet installed
+type AvailableUpdate struct {
+	Version  string `json:"version"`
+	URL      string `json:"url"`
+	Checksum string `json:"sha256,omitempty"`
+	// Found is when the version was first found
+	Found time.Time `json:"found"`
+	// Must be installed, and can't be dismissed
+	Mandatory bool `json:"mandatory,omitempty"`
+}
+
+// UpdateNotice tracks how often the user was told about, and dismissed, an
+// available update
+type UpdateNotice struct {
+	Version      string    `json:"version"`
+	Declines     int       `json:"declines"`
+	LastNotified time.Time `json:"last-notified"`
 }
 
+// UpdateRecord is an entry in the update history
+type UpdateRecord struct {
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	Result    string    `json:"result"`
+}
+
+// MaxUpdateHistory caps how many update records are kept
+const MaxUpdateHistory = 20
+
 var (
 	lock  sync.Mutex
 	store Store
+
+	// overridden in tests
+	storePathFn = getStorePath
 )
 
 func GetID() string {
@@ -48,25 +134,472 @@ func SetFirstTimeRun(val bool) {
 		return
 	}
 	store.FirstTimeRun = val
-	writeStore(getStorePath())
+	writeStore(storePathFn())
+}
+
+func GetAutoInstallWhenIdle() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.AutoInstallWhenIdle
+}
+
+func SetAutoInstallWhenIdle(val bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.AutoInstallWhenIdle == val {
+		return
+	}
+	store.AutoInstallWhenIdle = val
+	writeStore(storePathFn())
+}
+
+func GetActiveModel() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.ActiveModel
+}
+
+func SetActiveModel(model string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.ActiveModel == model {
+		return
+	}
+	store.ActiveModel = model
+	writeStore(storePathFn())
+}
+
+func GetLastRunVersion() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.LastRunVersion
+}
+
+func SetLastRunVersion(ver string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.LastRunVersion == ver {
+		return
+	}
+	store.LastRunVersion = ver
+	writeStore(storePathFn())
+}
+
+func GetUpdatesDisabledPermanently() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.UpdatesDisabledPermanently
+}
+
+func SetUpdatesDisabledPermanently(val bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.UpdatesDisabledPermanently == val {
+		return
+	}
+	store.UpdatesDisabledPermanently = val
+	writeStore(storePathFn())
+}
+
+func GetRebootPending() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.RebootPending
+}
+
+func SetRebootPending(ver string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.RebootPending == ver {
+		return
+	}
+	store.RebootPending = ver
+	writeStore(storePathFn())
+}
+
+func GetMaintenanceWindow() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.MaintenanceWindow
+}
+
+func SetMaintenanceWindow(window string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.MaintenanceWindow == window {
+		return
+	}
+	store.MaintenanceWindow = window
+	writeStore(storePathFn())
+}
+
+func GetUpdateReportURL() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.UpdateReportURL
+}
+
+func SetUpdateReportURL(u string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.UpdateReportURL == u {
+		return
+	}
+	store.UpdateReportURL = u
+	writeStore(storePathFn())
+}
+
+func GetPinnedVersion() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.PinnedVersion
+}
+
+func SetPinnedVersion(ver string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.PinnedVersion == ver {
+		return
+	}
+	store.PinnedVersion = ver
+	writeStore(storePathFn())
 }
 
+// UnpinVersion lets every version be offered again
+func UnpinVersion() {
+	SetPinnedVersion("")
+}
+
+func GetQuietHours() string {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.QuietHours
+}
+
+func SetQuietHours(hours string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.QuietHours == hours {
+		return
+	}
+	store.QuietHours = hours
+	writeStore(storePathFn())
+}
+
+// GetCheckOnLaunch reports whether to check for updates as soon as the app
+// starts, which is the default
+func GetCheckOnLaunch() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return !store.SkipLaunchCheck
+}
+
+func SetCheckOnLaunch(val bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.SkipLaunchCheck == !val {
+		return
+	}
+	store.SkipLaunchCheck = !val
+	writeStore(storePathFn())
+}
+
+// GetAutoDownload reports whether updates download as soon as they're
+// found, which is the default
+func GetAutoDownload() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return !store.SkipAutoDownload
+}
+
+func SetAutoDownload(val bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.SkipAutoDownload == !val {
+		return
+	}
+	store.SkipAutoDownload = !val
+	writeStore(storePathFn())
+}
+
+// GetControlEndpoint returns the running app's control port and token
+func GetControlEndpoint() (port int, token string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.ControlPort, store.ControlToken
+}
+
+func SetControlEndpoint(port int, token string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.ControlPort == port && store.ControlToken == token {
+		return
+	}
+	store.ControlPort = port
+	store.ControlToken = token
+	writeStore(storePathFn())
+}
+
+// GetInstallHooks returns the commands run around the installer
+func GetInstallHooks() (pre, post string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	return store.PreInstallCommand, store.PostInstallCommand
+}
+
+func SetInstallHooks(pre, post string) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.PreInstallCommand == pre && store.PostInstallCommand == post {
+		return
+	}
+	store.PreInstallCommand = pre
+	store.PostInstallCommand = post
+	writeStore(storePathFn())
+}
+
+// GetUpdateNotice returns the notification state of the available update
+func GetUpdateNotice() UpdateNotice {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.UpdateNotice == nil {
+		return UpdateNotice{}
+	}
+	return *store.UpdateNotice
+}
+
+func SetUpdateNotice(notice UpdateNotice) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	store.UpdateNotice = &notice
+	writeStore(storePathFn())
+}
+
+// GetAvailableUpdate returns the update found by the last check, if any
+func GetAvailableUpdate() AvailableUpdate {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if store.AvailableUpdate == nil {
+		return AvailableUpdate{}
+	}
+	return *store.AvailableUpdate
+}
+
+// SetAvailableUpdate records the update found by a check, an empty Version
+// clears it
+func SetAvailableUpdate(update AvailableUpdate) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	if update.Version == "" {
+		if store.AvailableUpdate == nil {
+			return
+		}
+		store.AvailableUpdate = nil
+	} else {
+		store.AvailableUpdate = &update
+	}
+	writeStore(storePathFn())
+}
+
+// AppendUpdateHistory records an update event, dropping the oldest records
+// beyond MaxUpdateHistory
+func AppendUpdateHistory(record UpdateRecord) {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	store.UpdateHistory = append(store.UpdateHistory, record)
+	if len(store.UpdateHistory) > MaxUpdateHistory {
+		store.UpdateHistory = store.UpdateHistory[len(store.UpdateHistory)-MaxUpdateHistory:]
+	}
+	writeStore(storePathFn())
+}
+
+// GetUpdateHistory returns the recorded update events, oldest first
+func GetUpdateHistory() []UpdateRecord {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	history := make([]UpdateRecord, len(store.UpdateHistory))
+	copy(history, store.UpdateHistory)
+	return history
+}
+
+// PruneObsolete drops per-version entries, the update history and available
+// update, for versions that obsolete reports as superseded. Preferences are never
+// pruned. It returns how many entries were removed.
+func PruneObsolete(obsolete func(version string) bool) int {
+	lock.Lock()
+	defer lock.Unlock()
+	if store.ID == "" {
+		initStore()
+	}
+	kept := store.UpdateHistory[:0]
+	for _, record := range store.UpdateHistory {
+		if !obsolete(record.Version) {
+			kept = append(kept, record)
+		}
+	}
+	pruned := len(store.UpdateHistory) - len(kept)
+	if store.AvailableUpdate != nil && obsolete(store.AvailableUpdate.Version) {
+		store.AvailableUpdate = nil
+		pruned++
+	}
+	if pruned == 0 {
+		return 0
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	store.UpdateHistory = kept
+	writeStore(storePathFn())
+	return pruned
+}
+
+// corruptStoreSuffix is appended to the name of a store that couldn't be
+// parsed when it's set aside
+const corruptStoreSuffix = ".corrupt"
+
+var storeIDPattern = regexp.MustCompile(`"id"\s*:\s*"([^"]*)"`)
+
 // lock must be held
 func initStore() {
-	storeFile, err := os.Open(getStorePath())
+	path := storePathFn()
+	payload, err := os.ReadFile(path)
 	if err == nil {
-		defer storeFile.Close()
-		err = json.NewDecoder(storeFile).Decode(&store)
-		if err == nil {
-			slog.Debug(fmt.Sprintf("loaded existing store %s - ID: %s", getStorePath(), store.ID))
+		var loaded Store
+		corrupt := false
+		if err := json.Unmarshal(payload, &loaded); err == nil {
+			store = loaded
+		} else {
+			corrupt = true
+			slog.Warn(fmt.Sprintf("store %s is corrupt, resetting to defaults: %s", path, err))
+			backupCorruptStore(path)
+			// Keep the machine's identity if it can be salvaged
+			store = Store{}
+			if m := storeIDPattern.FindSubmatch(payload); m != nil {
+				store.ID = string(m[1])
+			}
+		}
+		if _, err := uuid.Parse(store.ID); err == nil {
+			slog.Debug(fmt.Sprintf("loaded existing store %s - ID: %s", path, store.ID))
+			if corrupt {
+				writeStore(path)
+			}
 			return
 		}
+		if store.ID != "" {
+			slog.Warn(fmt.Sprintf("store has an invalid ID %q, generating a new one", store.ID))
+		}
 	} else if !errors.Is(err, os.ErrNotExist) {
 		slog.Debug(fmt.Sprintf("unexpected error searching for store: %s", err))
 	}
 	slog.Debug("initializing new store")
 	store.ID = uuid.New().String()
-	writeStore(getStorePath())
+	writeStore(path)
+}
+
+// backupCorruptStore sets the store file aside for troubleshooting,
+// replacing any earlier backup
+func backupCorruptStore(path string) {
+	if err := os.Rename(path, path+corruptStoreSuffix); err != nil {
+		slog.Warn(fmt.Sprintf("failed to back up corrupt store: %s", err))
+		return
+	}
+	slog.Info("corrupt store backed up to " + path + corruptStoreSuffix)
 }
 
 func writeStore(storeFilename string) {
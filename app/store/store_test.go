@@ -0,0 +1,309 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestStore points the store at a fresh file in a temp dir
+func useTestStore(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	orig := storePathFn
+	storePathFn = func() string { return path }
+	t.Cleanup(func() {
+		storePathFn = orig
+		store = Store{}
+	})
+	store = Store{}
+	return path
+}
+
+func TestUpdateHistory(t *testing.T) {
+	useTestStore(t)
+	assert.Empty(t, GetUpdateHistory())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	AppendUpdateHistory(UpdateRecord{Version: "0.1.29", Timestamp: now, Result: "downloaded"})
+	AppendUpdateHistory(UpdateRecord{Version: "0.1.29", Timestamp: now, Result: "install started"})
+	history := GetUpdateHistory()
+	require.Len(t, history, 2)
+	assert.Equal(t, "downloaded", history[0].Result)
+	assert.Equal(t, "install started", history[1].Result)
+
+	// reload from disk
+	store = Store{}
+	assert.Equal(t, history, GetUpdateHistory())
+}
+
+func TestUpdateHistoryTruncation(t *testing.T) {
+	useTestStore(t)
+	for i := 0; i < MaxUpdateHistory+5; i++ {
+		AppendUpdateHistory(UpdateRecord{Version: fmt.Sprintf("0.1.%d", i), Result: "downloaded"})
+	}
+	history := GetUpdateHistory()
+	require.Len(t, history, MaxUpdateHistory)
+	assert.Equal(t, "0.1.5", history[0].Version)
+	assert.Equal(t, fmt.Sprintf("0.1.%d", MaxUpdateHistory+4), history[len(history)-1].Version)
+}
+
+func TestAutoInstallWhenIdle(t *testing.T) {
+	useTestStore(t)
+	assert.False(t, GetAutoInstallWhenIdle(), "should default to off")
+
+	SetAutoInstallWhenIdle(true)
+	store = Store{}
+	assert.True(t, GetAutoInstallWhenIdle())
+}
+
+func TestUpdatesDisabledPermanently(t *testing.T) {
+	useTestStore(t)
+	assert.False(t, GetUpdatesDisabledPermanently(), "should default to off")
+
+	SetUpdatesDisabledPermanently(true)
+	store = Store{}
+	assert.True(t, GetUpdatesDisabledPermanently())
+}
+
+func TestRebootPending(t *testing.T) {
+	useTestStore(t)
+	assert.Empty(t, GetRebootPending())
+
+	SetRebootPending("0.1.30")
+	store = Store{}
+	assert.Equal(t, "0.1.30", GetRebootPending())
+
+	SetRebootPending("")
+	store = Store{}
+	assert.Empty(t, GetRebootPending())
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	useTestStore(t)
+	assert.Empty(t, GetMaintenanceWindow())
+
+	SetMaintenanceWindow("22:00-02:00")
+	store = Store{}
+	assert.Equal(t, "22:00-02:00", GetMaintenanceWindow())
+}
+
+func TestUpdateReportURL(t *testing.T) {
+	useTestStore(t)
+	assert.Empty(t, GetUpdateReportURL())
+
+	SetUpdateReportURL("https://fleet.example.com/ollama/updates")
+	store = Store{}
+	assert.Equal(t, "https://fleet.example.com/ollama/updates", GetUpdateReportURL())
+}
+
+func TestControlEndpoint(t *testing.T) {
+	useTestStore(t)
+	port, token := GetControlEndpoint()
+	assert.Zero(t, port)
+	assert.Empty(t, token)
+
+	SetControlEndpoint(51234, "secret")
+	store = Store{}
+	port, token = GetControlEndpoint()
+	assert.Equal(t, 51234, port)
+	assert.Equal(t, "secret", token)
+}
+
+func TestInstallHooks(t *testing.T) {
+	useTestStore(t)
+	pre, post := GetInstallHooks()
+	assert.Empty(t, pre)
+	assert.Empty(t, post)
+
+	SetInstallHooks(`C:\scripts\stop.bat`, `C:\scripts\start.bat`)
+	store = Store{}
+	pre, post = GetInstallHooks()
+	assert.Equal(t, `C:\scripts\stop.bat`, pre)
+	assert.Equal(t, `C:\scripts\start.bat`, post)
+}
+
+func TestActiveModel(t *testing.T) {
+	useTestStore(t)
+	assert.Empty(t, GetActiveModel())
+
+	SetActiveModel("mistral:7b")
+	store = Store{}
+	assert.Equal(t, "mistral:7b", GetActiveModel())
+}
+
+func TestPruneObsolete(t *testing.T) {
+	useTestStore(t)
+	SetAutoInstallWhenIdle(true)
+	SetActiveModel("mistral:7b")
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, ver := range []string{"0.1.27", "0.1.28", "0.1.29", "0.1.30"} {
+		AppendUpdateHistory(UpdateRecord{Version: ver, Timestamp: now, Result: "downloaded"})
+	}
+
+	obsolete := func(ver string) bool { return ver < "0.1.29" }
+	assert.Equal(t, 2, PruneObsolete(obsolete))
+	assert.Equal(t, 0, PruneObsolete(obsolete), "nothing left to prune")
+
+	// reload from disk
+	store = Store{}
+	history := GetUpdateHistory()
+	require.Len(t, history, 2)
+	assert.Equal(t, "0.1.29", history[0].Version)
+	assert.Equal(t, "0.1.30", history[1].Version)
+	assert.True(t, GetAutoInstallWhenIdle())
+	assert.Equal(t, "mistral:7b", GetActiveModel())
+}
+
+func TestUpdateNotice(t *testing.T) {
+	useTestStore(t)
+	assert.Equal(t, UpdateNotice{}, GetUpdateNotice())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	SetUpdateNotice(UpdateNotice{Version: "v0.1.30", Declines: 2, LastNotified: now})
+	store = Store{}
+	assert.Equal(t, UpdateNotice{Version: "v0.1.30", Declines: 2, LastNotified: now}, GetUpdateNotice())
+}
+
+func TestAvailableUpdate(t *testing.T) {
+	useTestStore(t)
+	assert.Equal(t, AvailableUpdate{}, GetAvailableUpdate())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	update := AvailableUpdate{Version: "v0.1.30", URL: "https://example.com/download/v0.1.30/OllamaSetup.exe", Checksum: "abcd", Found: now}
+	SetAvailableUpdate(update)
+	store = Store{}
+	assert.Equal(t, update, GetAvailableUpdate())
+
+	assert.Equal(t, 1, PruneObsolete(func(ver string) bool { return ver == "v0.1.30" }))
+	store = Store{}
+	assert.Equal(t, AvailableUpdate{}, GetAvailableUpdate())
+
+	SetAvailableUpdate(update)
+	SetAvailableUpdate(AvailableUpdate{})
+	store = Store{}
+	assert.Equal(t, AvailableUpdate{}, GetAvailableUpdate())
+}
+
+func TestCorruptStore(t *testing.T) {
+	const id = "0b5b8b6e-3f4c-4bb2-9d43-6c3b0a1f2e4d"
+	for _, tc := range []struct {
+		name, payload string
+		keepID        bool
+	}{
+		{"truncated", `{"id":"` + id + `","first-time-run":true,"active-model":"mis`, true},
+		{"garbage", "\x00\x00\x00\x00", false},
+		{"empty", "", false},
+		{"wrong type", `{"id":"` + id + `","first-time-run":"yes"}`, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := useTestStore(t)
+			require.NoError(t, os.WriteFile(path, []byte(tc.payload), 0o644))
+
+			got := GetID()
+			_, err := uuid.Parse(got)
+			require.NoError(t, err, "should have a valid ID")
+			if tc.keepID {
+				assert.Equal(t, id, got, "should salvage the existing ID")
+			}
+			assert.False(t, GetFirstTimeRun(), "should reset to defaults")
+
+			backup, err := os.ReadFile(path + corruptStoreSuffix)
+			require.NoError(t, err)
+			assert.Equal(t, tc.payload, string(backup))
+
+			// The reset store is written back and reloads cleanly
+			store = Store{}
+			assert.Equal(t, got, GetID())
+		})
+	}
+}
+
+func TestInvalidStoreID(t *testing.T) {
+	path := useTestStore(t)
+	require.NoError(t, os.WriteFile(path, []byte(`{"id":"not-a-uuid","first-time-run":true}`), 0o644))
+	got := GetID()
+	_, err := uuid.Parse(got)
+	require.NoError(t, err)
+	assert.True(t, GetFirstTimeRun(), "other settings should be kept")
+	_, err = os.Stat(path + corruptStoreSuffix)
+	assert.ErrorIs(t, err, os.ErrNotExist, "a parseable store isn't backed up")
+}
+
+func TestPinnedVersion(t *testing.T) {
+	useTestStore(t)
+	assert.Empty(t, GetPinnedVersion())
+
+	SetPinnedVersion("0.1.32")
+	store = Store{}
+	assert.Equal(t, "0.1.32", GetPinnedVersion())
+
+	UnpinVersion()
+	store = Store{}
+	assert.Empty(t, GetPinnedVersion())
+}
+
+func TestQuietHours(t *testing.T) {
+	useTestStore(t)
+	assert.Empty(t, GetQuietHours())
+
+	SetQuietHours("22:00-07:00")
+	store = Store{}
+	assert.Equal(t, "22:00-07:00", GetQuietHours())
+}
+
+func TestCheckOnLaunch(t *testing.T) {
+	useTestStore(t)
+	assert.True(t, GetCheckOnLaunch())
+
+	SetCheckOnLaunch(false)
+	store = Store{}
+	assert.False(t, GetCheckOnLaunch())
+	SetCheckOnLaunch(true)
+	store = Store{}
+	assert.True(t, GetCheckOnLaunch())
+}
+
+func TestAutoDownload(t *testing.T) {
+	useTestStore(t)
+	assert.True(t, GetAutoDownload())
+
+	SetAutoDownload(false)
+	store = Store{}
+	assert.False(t, GetAutoDownload())
+	SetAutoDownload(true)
+	store = Store{}
+	assert.True(t, GetAutoDownload())
+}
+
+func TestPreferences(t *testing.T) {
+	useTestStore(t)
+	SetControlEndpoint(1234, "token")
+	SetInstallHooks("pre.cmd", "post.cmd")
+	prefs := Preferences{
+		AutoInstallWhenIdle: true,
+		ActiveModel:         "mistral:7b",
+		MaintenanceWindow:   "02:00-04:00",
+		UpdateReportURL:     "https://updates.example.com/report",
+		PinnedVersion:       "0.1.32",
+		QuietHours:          "22:00-07:00",
+		SkipLaunchCheck:     true,
+		SkipAutoDownload:    true,
+	}
+	SetPreferences(prefs)
+
+	store = Store{}
+	assert.Equal(t, prefs, GetPreferences())
+	port, token := GetControlEndpoint()
+	assert.Equal(t, 1234, port, "state isn't a preference")
+	assert.Equal(t, "token", token)
+	pre, post := GetInstallHooks()
+	assert.Equal(t, "pre.cmd", pre, "install hooks aren't a preference")
+	assert.Equal(t, "post.cmd", post)
+}
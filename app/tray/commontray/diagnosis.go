@@ -0,0 +1,70 @@
+package commontray
+
+import (
+	"strings"
+)
+
+// TrayDiagnosis is what the tray found checking the usual reasons its icon
+// doesn't show up
+type TrayDiagnosis struct {
+	// Supported is false on platforms without a tray
+	Supported bool `json:"supported"`
+	// Headless is set when the app runs without the tray, Error saying why
+	Headless bool   `json:"headless"`
+	Error    string `json:"error,omitempty"`
+
+	// ShellRunning is set when the taskbar, which hosts the icon, exists
+	ShellRunning  bool `json:"shell_running"`
+	WindowCreated bool `json:"window_created"`
+	IconLoaded    bool `json:"icon_loaded"`
+	IconAdded     bool `json:"icon_added"`
+	// LastAddError is why adding the icon to the notification area last
+	// failed, even if a later attempt succeeded
+	LastAddError string `json:"last_add_error,omitempty"`
+}
+
+// Healthy reports whether nothing is known to keep the icon from showing
+func (d TrayDiagnosis) Healthy() bool {
+	return d.Supported && !d.Headless && d.ShellRunning && d.WindowCreated && d.IconLoaded && d.IconAdded
+}
+
+// Summary explains what's wrong in plain words, one problem per line, with
+// the likely fix
+func (d TrayDiagnosis) Summary() string {
+	if !d.Supported {
+		return "There's no tray icon on this platform yet, Ollama runs without it."
+	}
+
+	var lines []string
+	if d.Headless {
+		line := "Ollama is running without the tray icon"
+		if d.Error != "" {
+			line += ": " + d.Error
+		}
+		lines = append(lines, line+".")
+	}
+	if !d.ShellRunning {
+		lines = append(lines, "The taskbar isn't running, so there's nowhere to show the icon. Restart Windows Explorer, or sign out and back in.")
+	}
+	if !d.WindowCreated {
+		lines = append(lines, "The tray's window couldn't be created. Restart Ollama, and if that doesn't help, restart the computer.")
+	}
+	if !d.IconLoaded {
+		lines = append(lines, "The tray icon couldn't be loaded, so the installation may be damaged. Reinstalling Ollama should fix it.")
+	}
+	if !d.IconAdded {
+		line := "The icon couldn't be added to the notification area"
+		if d.LastAddError != "" {
+			line += " (" + d.LastAddError + ")"
+		}
+		lines = append(lines, line+". This usually means the taskbar wasn't ready yet, restarting Ollama should add it.")
+	}
+	if len(lines) == 0 {
+		line := "The tray icon is in place. If you can't see it, it may be hidden in the taskbar's overflow area."
+		if d.LastAddError != "" {
+			line += " Adding it failed at first: " + d.LastAddError + "."
+		}
+		return line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,59 @@
+package commontray
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrayDiagnosisSummary(t *testing.T) {
+	healthy := TrayDiagnosis{Supported: true, ShellRunning: true, WindowCreated: true, IconLoaded: true, IconAdded: true}
+	assert.True(t, healthy.Healthy())
+	assert.Equal(t, "The tray icon is in place. If you can't see it, it may be hidden in the taskbar's overflow area.", healthy.Summary())
+
+	retried := healthy
+	retried.LastAddError = "the notification area isn't ready"
+	assert.True(t, retried.Healthy())
+	assert.Contains(t, retried.Summary(), "Adding it failed at first: the notification area isn't ready.")
+
+	cases := []struct {
+		name  string
+		seed  func(d *TrayDiagnosis)
+		lines []string
+	}{
+		{"explorer crashed", func(d *TrayDiagnosis) {
+			d.ShellRunning = false
+			d.IconAdded = false
+			d.LastAddError = "Unspecified error"
+		}, []string{
+			"The taskbar isn't running, so there's nowhere to show the icon. Restart Windows Explorer, or sign out and back in.",
+			"The icon couldn't be added to the notification area (Unspecified error). This usually means the taskbar wasn't ready yet, restarting Ollama should add it.",
+		}},
+		{"icon resource missing", func(d *TrayDiagnosis) {
+			d.IconLoaded = false
+		}, []string{
+			"The tray icon couldn't be loaded, so the installation may be damaged. Reinstalling Ollama should fix it.",
+		}},
+		{"no window", func(d *TrayDiagnosis) {
+			d.Headless = true
+			d.Error = "failed to register window class"
+			d.WindowCreated = false
+			d.IconAdded = false
+		}, []string{
+			"Ollama is running without the tray icon: failed to register window class.",
+			"The tray's window couldn't be created. Restart Ollama, and if that doesn't help, restart the computer.",
+			"The icon couldn't be added to the notification area. This usually means the taskbar wasn't ready yet, restarting Ollama should add it.",
+		}},
+	}
+	for _, tc := range cases {
+		d := healthy
+		tc.seed(&d)
+		assert.False(t, d.Healthy(), tc.name)
+		assert.Equal(t, strings.Join(tc.lines, "\n"), d.Summary(), tc.name)
+	}
+
+	unsupported := TrayDiagnosis{Headless: true, Error: "NOT IMPLEMENTED YET"}
+	assert.False(t, unsupported.Healthy())
+	assert.Equal(t, "There's no tray icon on this platform yet, Ollama runs without it.", unsupported.Summary())
+}
@@ -1,24 +1,181 @@
 package commontray
 
+import (
+	"sync"
+	"time"
+)
+
 var (
 	Title   = "Ollama"
 	ToolTip = "Ollama"
 
 	UpdateIconName = "tray_upgrade"
 	IconName       = "tray"
+
+	// WarningIconName is optional, the normal icon is used when it's missing
+	WarningIconName = "tray_warning"
+)
+
+// TrayStatus selects which icon the tray shows
+type TrayStatus int
+
+const (
+	StatusNormal TrayStatus = iota
+	StatusServerUnreachable
+	StatusUpdateStaged
 )
 
+// UpdateMode is how far updates go on their own once they're found
+type UpdateMode int
+
+const (
+	// UpdateNotify downloads updates and asks before installing them
+	UpdateNotify UpdateMode = iota
+	// UpdateAutomatic also installs them once the system is idle
+	UpdateAutomatic
+	// UpdateManual only downloads updates when checking from the menu
+	UpdateManual
+)
+
+// UpdateState is what the updater knows about updates right now
+type UpdateState struct {
+	// Version is the update available, "" when there's none
+	Version string
+	// Downloaded is set once the update is staged, ready to install
+	Downloaded bool
+	// Downloading is set while it downloads, and Paused once that's paused
+	Downloading bool
+	Paused      bool
+	Mandatory   bool
+	// Disabled is set when updates are disabled on this machine
+	Disabled bool
+	Mode     UpdateMode
+}
+
 type Callbacks struct {
 	Quit       chan struct{}
 	Update     chan struct{}
 	DoFirstUse chan struct{}
 	ShowLogs   chan struct{}
+
+	RestartServer chan struct{}
+	Rollback      chan string
+	ReportIssue   chan struct{}
+	CheckUpdates  chan struct{}
+
+	CopyDiagnostics chan struct{}
+	SetActiveModel  chan string
+	CopyVersion     chan struct{}
+	UpdateDeclined  chan struct{}
+
+	ShowReleaseNotes chan struct{}
+	DisableUpdates   chan struct{}
+	SaveDiagnostics  chan struct{}
+	CopyUpdateURLs   chan struct{}
+
+	PinVersion chan struct{}
+	// Resumed fires when the system wakes from sleep
+	Resumed chan struct{}
+
+	SetUpdateMode  chan UpdateMode
+	PauseDownload  chan struct{}
+	ResumeDownload chan struct{}
+
+	DiagnoseTray chan struct{}
+	RestartApp   chan struct{}
 }
 
 type OllamaTray interface {
 	GetCallbacks() Callbacks
 	Run()
-	UpdateAvailable(ver string) error
+	// UpdateAvailable notifies the user about ver, using the server's
+	// localized description when it sent one
+	UpdateAvailable(ver, description string) error
+	// UpdateMandatory notifies about a required update, which isn't
+	// dismissed like a regular one, with the server's message if it sent one
+	UpdateMandatory(ver, message string) error
+	// UpdatePending shows the update in the menu without notifying
+	UpdatePending(ver string) error
 	DisplayFirstUseNotification() error
+	DisplayUpToDateNotification() error
+	// DisplayUpgradedNotification tells the user they are now running ver
+	DisplayUpgradedNotification(ver string) error
+	// DisplayRebootPendingNotification asks the user to reboot to finish
+	// installing ver
+	DisplayRebootPendingNotification(ver string) error
+	// DisplayServerFailedNotification tells the user the server keeps
+	// crashing
+	DisplayServerFailedNotification() error
+	// DisplayPleaseWaitNotification asks the user to wait before checking
+	// for updates again
+	DisplayPleaseWaitNotification() error
+	// DisplayNotification shows a plain notification
+	DisplayNotification(title, message string) error
+	// DisplayErrorNotification shows a plain notification that's never held
+	// back, even during quiet hours
+	DisplayErrorNotification(title, message string) error
+	SessionActive() bool
+	SetRollbackVersions(versions []string) error
+	// SetModelLister provides the models shown in the tray menu, which is
+	// called in the background periodically and after the menu opens, never
+	// while it's showing
+	SetModelLister(lister func() (models []string, active string))
+	// SetUpdateStateProvider provides the updater's current state, which is
+	// queried each time the menu opens
+	SetUpdateStateProvider(state func() UpdateState)
+	// SetQuietHours provides when informational notifications are held
+	// back, the most recent being shown once quiet hours end
+	SetQuietHours(quiet func(now time.Time) bool)
+	// SetUpdateBusy provides whether an update is downloading or an install
+	// is being prepared, which holds off the session ending until it's done
+	SetUpdateBusy(busy func() bool)
+	// DisableUpdates removes every update entry from the tray for good
+	DisableUpdates() error
+	// SetStatusIcon swaps the tray icon to reflect status
+	SetStatusIcon(status TrayStatus) error
+	// SetTooltip changes the text shown when hovering over the icon, with ""
+	// restoring the default
+	SetTooltip(text string) error
+	// Diagnose checks the usual reasons the tray icon doesn't show up
+	Diagnose() TrayDiagnosis
 	Quit()
 }
+
+// SessionState tracks whether the interactive user session is in a state
+// where disruptive actions, such as installing an update, are acceptable.
+type SessionState struct {
+	mu         sync.Mutex
+	locked     bool
+	presenting bool
+}
+
+func (s *SessionState) SetLocked(locked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locked = locked
+}
+
+func (s *SessionState) SetPresenting(presenting bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.presenting = presenting
+}
+
+func (s *SessionState) Locked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked
+}
+
+func (s *SessionState) Presenting() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.presenting
+}
+
+// Active reports true when the session is unlocked and not presenting
+func (s *SessionState) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.locked && !s.presenting
+}
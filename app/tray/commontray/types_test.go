@@ -0,0 +1,24 @@
+package commontray
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionState(t *testing.T) {
+	var s SessionState
+	assert.True(t, s.Active())
+
+	s.SetLocked(true)
+	assert.True(t, s.Locked())
+	assert.False(t, s.Active())
+
+	s.SetPresenting(true)
+	s.SetLocked(false)
+	assert.True(t, s.Presenting())
+	assert.False(t, s.Active())
+
+	s.SetPresenting(false)
+	assert.True(t, s.Active())
+}
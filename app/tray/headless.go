@@ -0,0 +1,165 @@
+package tray
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+// headlessTray stands in when the platform tray can't be created. The
+// server and updater keep running, notifications go to the log, and the app
+// runs until signaled to quit.
+type headlessTray struct {
+	callbacks commontray.Callbacks
+	quit      chan struct{}
+	quitOnce  sync.Once
+
+	// err is why the platform tray couldn't be created
+	err error
+}
+
+func newHeadlessTray() *headlessTray {
+	return &headlessTray{
+		callbacks: commontray.Callbacks{
+			Quit:             make(chan struct{}),
+			Update:           make(chan struct{}),
+			DoFirstUse:       make(chan struct{}),
+			ShowLogs:         make(chan struct{}),
+			RestartServer:    make(chan struct{}),
+			Rollback:         make(chan string),
+			ReportIssue:      make(chan struct{}),
+			CheckUpdates:     make(chan struct{}),
+			CopyDiagnostics:  make(chan struct{}),
+			SetActiveModel:   make(chan string),
+			CopyVersion:      make(chan struct{}),
+			UpdateDeclined:   make(chan struct{}),
+			ShowReleaseNotes: make(chan struct{}),
+			DisableUpdates:   make(chan struct{}),
+			SaveDiagnostics:  make(chan struct{}),
+			CopyUpdateURLs:   make(chan struct{}),
+			PinVersion:       make(chan struct{}),
+			Resumed:          make(chan struct{}),
+			SetUpdateMode:    make(chan commontray.UpdateMode),
+			PauseDownload:    make(chan struct{}),
+			ResumeDownload:   make(chan struct{}),
+			DiagnoseTray:     make(chan struct{}),
+			RestartApp:       make(chan struct{}),
+		},
+		quit: make(chan struct{}),
+	}
+}
+
+func (t *headlessTray) GetCallbacks() commontray.Callbacks {
+	return t.callbacks
+}
+
+func (t *headlessTray) Run() {
+	<-t.quit
+}
+
+func (t *headlessTray) UpdateAvailable(ver, description string) error {
+	slog.Info(fmt.Sprintf("Ollama version %s is ready to install, restart the app to update", ver))
+	if description != "" {
+		slog.Info(description)
+	}
+	return nil
+}
+
+func (t *headlessTray) UpdateMandatory(ver, message string) error {
+	slog.Warn(fmt.Sprintf("Ollama version %s is a required update and will install automatically", ver))
+	if message != "" {
+		slog.Warn(message)
+	}
+	return nil
+}
+
+func (t *headlessTray) UpdatePending(ver string) error {
+	return nil
+}
+
+func (t *headlessTray) DisplayFirstUseNotification() error {
+	slog.Info("Ollama is running")
+	return nil
+}
+
+func (t *headlessTray) DisplayUpToDateNotification() error {
+	slog.Info("Ollama is up to date")
+	return nil
+}
+
+func (t *headlessTray) DisplayUpgradedNotification(ver string) error {
+	slog.Info(fmt.Sprintf("Ollama has been updated to version %s", ver))
+	return nil
+}
+
+func (t *headlessTray) DisplayServerFailedNotification() error {
+	slog.Warn("the Ollama server keeps crashing, see the server log for details")
+	return nil
+}
+
+func (t *headlessTray) DisplayPleaseWaitNotification() error {
+	slog.Info("an update check was just requested, try again in a moment")
+	return nil
+}
+
+func (t *headlessTray) DisplayNotification(title, message string) error {
+	slog.Info(fmt.Sprintf("%s: %s", title, message))
+	return nil
+}
+
+func (t *headlessTray) DisplayErrorNotification(title, message string) error {
+	slog.Error(fmt.Sprintf("%s: %s", title, message))
+	return nil
+}
+
+func (t *headlessTray) DisplayRebootPendingNotification(ver string) error {
+	slog.Info(fmt.Sprintf("restart the computer to finish installing Ollama version %s", ver))
+	return nil
+}
+
+// Without a UI there's nobody to defer to
+func (t *headlessTray) SessionActive() bool {
+	return true
+}
+
+func (t *headlessTray) SetRollbackVersions(versions []string) error {
+	return nil
+}
+
+func (t *headlessTray) SetModelLister(lister func() ([]string, string)) {}
+
+func (t *headlessTray) SetQuietHours(quiet func(time.Time) bool) {}
+
+func (t *headlessTray) SetUpdateBusy(busy func() bool) {}
+
+func (t *headlessTray) SetUpdateStateProvider(state func() commontray.UpdateState) {}
+
+func (t *headlessTray) DisableUpdates() error {
+	return nil
+}
+
+func (t *headlessTray) SetStatusIcon(status commontray.TrayStatus) error {
+	return nil
+}
+
+func (t *headlessTray) SetTooltip(text string) error {
+	return nil
+}
+
+// Diagnose reports why the platform tray couldn't be created, along with
+// how far it got
+func (t *headlessTray) Diagnose() commontray.TrayDiagnosis {
+	d := diagnosePlatformTray()
+	d.Headless = true
+	if t.err != nil {
+		d.Error = t.err.Error()
+	}
+	return d
+}
+
+func (t *headlessTray) Quit() {
+	t.quitOnce.Do(func() { close(t.quit) })
+}
@@ -2,6 +2,7 @@ package tray
 
 import (
 	"fmt"
+	"log/slog"
 	"runtime"
 
 	"github.com/jmorganca/ollama/app/assets"
@@ -24,10 +25,34 @@ func NewTray() (commontray.OllamaTray, error) {
 		return nil, fmt.Errorf("failed to load icon %s: %w", iconName, err)
 	}
 
-	tray, err := InitPlatformTray(icon, updateIcon)
+	iconName = commontray.WarningIconName + extension
+	warningIcon, err := assets.GetIcon(iconName)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("no warning icon, using the normal icon instead: %s", err))
+		warningIcon = icon
+	}
+
+	tray, err := InitPlatformTray(icon, updateIcon, warningIcon)
 	if err != nil {
 		return nil, err
 	}
 
 	return tray, nil
 }
+
+// NewTrayOrHeadless creates the tray, falling back to headless mode when it
+// can't be created. headless reports which one was returned.
+func NewTrayOrHeadless() (t commontray.OllamaTray, headless bool) {
+	return trayOrHeadless(NewTray)
+}
+
+func trayOrHeadless(newTray func() (commontray.OllamaTray, error)) (commontray.OllamaTray, bool) {
+	t, err := newTray()
+	if err == nil {
+		return t, false
+	}
+	slog.Error(fmt.Sprintf("the tray is unavailable, running without it: %s", err))
+	headless := newHeadlessTray()
+	headless.err = err
+	return headless, true
+}
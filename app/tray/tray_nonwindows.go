@@ -8,6 +8,11 @@ import (
 	"github.com/jmorganca/ollama/app/tray/commontray"
 )
 
-func InitPlatformTray(icon, updateIcon []byte) (commontray.OllamaTray, error) {
+func InitPlatformTray(icon, updateIcon, warningIcon []byte) (commontray.OllamaTray, error) {
 	return nil, fmt.Errorf("NOT IMPLEMENTED YET")
 }
+
+// There's no tray to diagnose, so it's reported as unsupported
+func diagnosePlatformTray() commontray.TrayDiagnosis {
+	return commontray.TrayDiagnosis{}
+}
@@ -0,0 +1,43 @@
+package tray
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+func TestTrayOrHeadless(t *testing.T) {
+	expect := newHeadlessTray()
+	tray, headless := trayOrHeadless(func() (commontray.OllamaTray, error) { return expect, nil })
+	assert.False(t, headless)
+	assert.Same(t, expect, tray)
+
+	tray, headless = trayOrHeadless(func() (commontray.OllamaTray, error) {
+		return nil, errors.New("failed to register window class")
+	})
+	require.True(t, headless)
+	require.NotNil(t, tray)
+	assert.NoError(t, tray.UpdateAvailable("0.1.30", ""))
+	assert.True(t, tray.SessionActive())
+	diagnosis := tray.Diagnose()
+	assert.True(t, diagnosis.Headless)
+	assert.Equal(t, "failed to register window class", diagnosis.Error)
+
+	done := make(chan struct{})
+	go func() {
+		tray.Run()
+		close(done)
+	}()
+	tray.Quit()
+	tray.Quit()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after Quit")
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"github.com/jmorganca/ollama/app/tray/wintray"
 )
 
-func InitPlatformTray(icon, updateIcon []byte) (commontray.OllamaTray, error) {
-	return wintray.InitTray(icon, updateIcon)
+func InitPlatformTray(icon, updateIcon, warningIcon []byte) (commontray.OllamaTray, error) {
+	return wintray.InitTray(icon, updateIcon, warningIcon)
+}
+
+func diagnosePlatformTray() commontray.TrayDiagnosis {
+	return wintray.Diagnose()
 }
@@ -0,0 +1,69 @@
+//go:build windows
+
+package wintray
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+// Class of the taskbar's window, which only exists while Explorer runs the
+// shell
+const shellTrayClassName = "Shell_TrayWnd"
+
+// addIcon adds the icon to the notification area, recording how that went
+// for Diagnose. muNID is only held for each attempt, not while waiting to
+// retry. Once shutdown starts the icon isn't added again.
+func (t *winTray) addIcon() error {
+	return addWithRetry(func() error {
+		t.muNID.Lock()
+		defer t.muNID.Unlock()
+		if t.closing.Load() {
+			return nil
+		}
+		err := t.nid.add()
+		if err != nil {
+			t.lastAddErr = err
+		}
+		t.iconAdded = err == nil
+		return err
+	})
+}
+
+// readdIcon adds the icon again in the background, after Explorer restarts,
+// so retrying doesn't hold up the message loop
+func (t *winTray) readdIcon() {
+	if !t.readdingIcon.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer t.readdingIcon.Store(false)
+		if err := t.addIcon(); err != nil {
+			slog.Error(fmt.Sprintf("failed to refresh the taskbar on explorer restart: %s", err))
+		}
+	}()
+}
+
+func (t *winTray) Diagnose() commontray.TrayDiagnosis {
+	d := commontray.TrayDiagnosis{
+		Supported:     true,
+		ShellRunning:  findWindow(shellTrayClassName),
+		WindowCreated: t.window != 0,
+	}
+	t.muNID.RLock()
+	defer t.muNID.RUnlock()
+	d.IconLoaded = t.nid != nil && t.nid.Icon != 0
+	d.IconAdded = t.iconAdded
+	if t.lastAddErr != nil {
+		d.LastAddError = t.lastAddErr.Error()
+	}
+	return d
+}
+
+// Diagnose checks the tray even when creating it failed, to find out how
+// far it got
+func Diagnose() commontray.TrayDiagnosis {
+	return wt.Diagnose()
+}
@@ -3,10 +3,11 @@
 package wintray
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
-	"unsafe"
+	"time"
 
 	"golang.org/x/sys/windows"
 )
@@ -16,38 +17,55 @@ var (
 )
 
 func (t *winTray) Run() {
-	nativeLoop()
+	if err := nativeLoop(); err != nil {
+		slog.Error(err.Error())
+	}
 }
 
-func nativeLoop() {
+var (
+	// How many GetMessage failures in a row the message loop rides out
+	// before giving up, waiting messageLoopRetryDelay after each
+	messageLoopMaxErrors  = 5
+	messageLoopRetryDelay = 100 * time.Millisecond
+)
+
+// isFatalMessageError reports whether a GetMessage failure will only repeat,
+// such as the window or message buffer being invalid
+func isFatalMessageError(err error) bool {
+	return errors.Is(err, windows.ERROR_INVALID_WINDOW_HANDLE) || errors.Is(err, windows.ERROR_INVALID_PARAMETER)
+}
+
+// nativeLoop pumps messages until WM_QUIT. Failures to get a message are
+// retried, unless fatal or repeated too many times in a row.
+func nativeLoop() error {
 	// Main message pump.
 	slog.Debug("starting event handling loop")
-	m := &struct {
-		WindowHandle windows.Handle
-		Message      uint32
-		Wparam       uintptr
-		Lparam       uintptr
-		Time         uint32
-		Pt           point
-		LPrivate     uint32
-	}{}
+	m := &msg{}
+	failures := 0
 	for {
-		ret, _, err := pGetMessage.Call(uintptr(unsafe.Pointer(m)), 0, 0, 0)
+		ret, err := getMessage(m)
 
 		// If the function retrieves a message other than WM_QUIT, the return value is nonzero.
 		// If the function retrieves the WM_QUIT message, the return value is zero.
 		// If there is an error, the return value is -1
 		// https://msdn.microsoft.com/en-us/library/windows/desktop/ms644936(v=vs.85).aspx
-		switch int32(ret) {
+		switch ret {
 		case -1:
-			slog.Error(fmt.Sprintf("get message failure: %v", err))
-			return
+			if isFatalMessageError(err) {
+				return fmt.Errorf("get message failure: %w", err)
+			}
+			failures++
+			if failures >= messageLoopMaxErrors {
+				return fmt.Errorf("get message failed %d times in a row: %w", failures, err)
+			}
+			slog.Warn(fmt.Sprintf("get message failure, retrying: %v", err))
+			time.Sleep(messageLoopRetryDelay)
 		case 0:
-			return
+			return nil
 		default:
-			pTranslateMessage.Call(uintptr(unsafe.Pointer(m))) //nolint:errcheck
-			pDispatchMessage.Call(uintptr(unsafe.Pointer(m)))  //nolint:errcheck
-
+			failures = 0
+			translateMessage(m)
+			dispatchMessage(m)
 		}
 	}
 }
@@ -64,58 +82,40 @@ func (t *winTray) wndProc(hWnd windows.Handle, message uint32, wParam, lParam ui
 		WM_DESTROY     = 0x0002
 		WM_MOUSEMOVE   = 0x0200
 		WM_LBUTTONDOWN = 0x0201
+
+		WM_WTSSESSION_CHANGE = 0x02B1
+		WM_POWERBROADCAST    = 0x0218
+		WM_QUERYENDSESSION   = 0x0011
 	)
+	if t.closing.Load() {
+		// Once shutting down, nothing may act on the tray being torn down
+		switch message {
+		case WM_COMMAND, WM_WTSSESSION_CHANGE, WM_POWERBROADCAST, t.wmSystrayMessage, t.wmTaskbarCreated:
+			return 0
+		}
+	}
 	switch message {
 	case WM_COMMAND:
-		menuItemId := int32(wParam)
-		// https://docs.microsoft.com/en-us/windows/win32/menurc/wm-command#menus
-		switch menuItemId {
-		case quitMenuID:
-			select {
-			case t.callbacks.Quit <- struct{}{}:
-			// should not happen but in case not listening
-			default:
-				slog.Error("no listener on Quit")
-			}
-		case updateMenuID:
-			select {
-			case t.callbacks.Update <- struct{}{}:
-			// should not happen but in case not listening
-			default:
-				slog.Error("no listener on Update")
-			}
-		case diagLogsMenuID:
-			select {
-			case t.callbacks.ShowLogs <- struct{}{}:
-			// should not happen but in case not listening
-			default:
-				slog.Error("no listener on ShowLogs")
-			}
-		default:
-			slog.Debug(fmt.Sprintf("Unexpected menu item id: %d", menuItemId))
-		}
+		t.handleMenuCommand(int32(wParam))
+	case WM_WTSSESSION_CHANGE:
+		t.handleSessionChange(wParam)
+	case WM_POWERBROADCAST:
+		t.handlePowerBroadcast(wParam)
+		lResult = 1 // TRUE
 	case WM_CLOSE:
-		boolRet, _, err := pDestroyWindow.Call(uintptr(t.window))
-		if boolRet == 0 {
-			slog.Error(fmt.Sprintf("failed to destroy window: %s", err))
-		}
-		err = t.wcex.unregister()
-		if err != nil {
-			slog.Error(fmt.Sprintf("failed to uregister windo %s", err))
-		}
+		t.shutdown()
 	case WM_DESTROY:
+		if t.closing.Load() {
+			// shutdown is destroying the window and ends the loop itself
+			break
+		}
 		// same as WM_ENDSESSION, but throws 0 exit code after all
-		defer pPostQuitMessage.Call(uintptr(int32(0))) //nolint:errcheck
+		defer postQuitMessage(0)
 		fallthrough
 	case WM_ENDSESSION:
-		t.muNID.Lock()
-		if t.nid != nil {
-			err := t.nid.delete()
-			if err != nil {
-				slog.Error(fmt.Sprintf("failed to delete nid: %s", err))
-			}
-		}
-		t.muNID.Unlock()
+		t.deleteIcon()
+	case WM_QUERYENDSESSION:
+		lResult = t.queryEndSession(lParam)
 	case t.wmSystrayMessage:
 		switch lParam {
 		case WM_MOUSEMOVE, WM_LBUTTONDOWN:
@@ -125,60 +125,240 @@ func (t *winTray) wndProc(hWnd windows.Handle, message uint32, wParam, lParam ui
 			if err != nil {
 				slog.Error(fmt.Sprintf("failed to show menu: %s", err))
 			}
-		case 0x405: // TODO - how is this magic value derived for the notification left click
-			if t.pendingUpdate {
-				select {
-				case t.callbacks.Update <- struct{}{}:
-				// should not happen but in case not listening
-				default:
-					slog.Error("no listener on Update")
-				}
-			} else {
-				select {
-				case t.callbacks.DoFirstUse <- struct{}{}:
-				// should not happen but in case not listening
-				default:
-					slog.Error("no listener on DoFirstUse")
-				}
+		case 0x405: // NIN_BALLOONUSERCLICK
+			// Each notification that does something when clicked says what,
+			// the rest, such as the up to date one, are just dismissed
+			t.muNID.RLock()
+			action := t.balloonAction
+			t.muNID.RUnlock()
+			if action != nil {
+				action()
 			}
-		case 0x404: // Middle click or close notification
-			// slog.Debug("doing nothing on close of first time notification")
+		case 0x404: // NIN_BALLOONTIMEOUT
+			// Sent both when the notification times out and when it's closed,
+			// so it isn't taken for the user declining the update
+			slog.Debug("notification closed or timed out")
 		default:
 			// 0x402 also seems common - what is it?
 			slog.Debug(fmt.Sprintf("unmanaged app message, lParm: 0x%x", lParam))
 		}
 	case t.wmTaskbarCreated: // on explorer.exe restarts
-		t.muNID.Lock()
-		err := t.nid.add()
-		if err != nil {
-			slog.Error(fmt.Sprintf("failed to refresh the taskbar on explorer restart: %s", err))
-		}
-		t.muNID.Unlock()
+		t.readdIcon()
 	default:
 		// Calls the default window procedure to provide default processing for any window messages that an application does not process.
 		// https://msdn.microsoft.com/en-us/library/windows/desktop/ms633572(v=vs.85).aspx
-		lResult, _, _ = pDefWindowProc.Call(
-			uintptr(hWnd),
-			uintptr(message),
-			uintptr(wParam),
-			uintptr(lParam),
-		)
+		lResult = defWindowProc(hWnd, message, wParam, lParam)
 	}
 	return
 }
 
+// shutdown tears the tray down in an order that can't leave a ghost icon
+// behind: stop acting on messages, remove the icon while the window that owns
+// it still exists, destroy the window, unregister its class, and finally end
+// the message loop so Run returns and the caller stops the server.
+func (t *winTray) shutdown() {
+	if !t.closing.CompareAndSwap(false, true) {
+		return
+	}
+	if err := t.unregisterSessionNotification(); err != nil {
+		slog.Debug(err.Error())
+	}
+	t.muShutdownBlock.Lock()
+	t.clearShutdownBlock()
+	t.muShutdownBlock.Unlock()
+	t.deleteIcon()
+	if err := destroyWindow(t.window); err != nil {
+		slog.Error(fmt.Sprintf("failed to destroy window: %s", err))
+	}
+	if err := t.wcex.unregister(); err != nil {
+		slog.Error(fmt.Sprintf("failed to unregister window class: %s", err))
+	}
+	postQuitMessage(0)
+}
+
+// deleteIcon removes the icon from the notification area
+func (t *winTray) deleteIcon() {
+	t.muNID.Lock()
+	defer t.muNID.Unlock()
+	if t.nid != nil {
+		if err := t.nid.delete(); err != nil {
+			slog.Error(fmt.Sprintf("failed to delete nid: %s", err))
+		}
+	}
+}
+
+// handleMenuCommand routes a menu click to its callback
+func (t *winTray) handleMenuCommand(menuItemId int32) {
+	// https://docs.microsoft.com/en-us/windows/win32/menurc/wm-command#menus
+	switch menuItemId {
+	case quitMenuID:
+		select {
+		case t.callbacks.Quit <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on Quit")
+		}
+	case updateMenuID:
+		select {
+		case t.callbacks.Update <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on Update")
+		}
+	case remindLaterMenuID:
+		select {
+		case t.callbacks.UpdateDeclined <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on UpdateDeclined")
+		}
+	case pauseDownloadMenuID:
+		select {
+		case t.callbacks.PauseDownload <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on PauseDownload")
+		}
+	case resumeDownloadMenuID:
+		select {
+		case t.callbacks.ResumeDownload <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on ResumeDownload")
+		}
+	case diagLogsMenuID:
+		select {
+		case t.callbacks.ShowLogs <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on ShowLogs")
+		}
+	case copyDiagMenuID:
+		select {
+		case t.callbacks.CopyDiagnostics <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on CopyDiagnostics")
+		}
+	case saveDiagMenuID:
+		select {
+		case t.callbacks.SaveDiagnostics <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on SaveDiagnostics")
+		}
+	case copyUpdateURLMenuID:
+		select {
+		case t.callbacks.CopyUpdateURLs <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on CopyUpdateURLs")
+		}
+	case copyVersionMenuID:
+		select {
+		case t.callbacks.CopyVersion <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on CopyVersion")
+		}
+	case restartServerMenuID:
+		select {
+		case t.callbacks.RestartServer <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on RestartServer")
+		}
+	case restartAppMenuID:
+		select {
+		case t.callbacks.RestartApp <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on RestartApp")
+		}
+	case checkUpdatesMenuID:
+		select {
+		case t.callbacks.CheckUpdates <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on CheckUpdates")
+		}
+	case disableUpdatesMenuID:
+		if messageBox(t.window, disableUpdatesMessage, disableUpdatesTitle, MB_YESNO|MB_ICONWARNING) != IDYES {
+			break
+		}
+		select {
+		case t.callbacks.DisableUpdates <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on DisableUpdates")
+		}
+	case pinVersionMenuID:
+		select {
+		case t.callbacks.PinVersion <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on PinVersion")
+		}
+	case reportIssueMenuID:
+		select {
+		case t.callbacks.ReportIssue <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on ReportIssue")
+		}
+	case getStartedMenuID:
+		select {
+		case t.callbacks.DoFirstUse <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on DoFirstUse")
+		}
+	case diagnoseTrayMenuID:
+		select {
+		case t.callbacks.DiagnoseTray <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on DiagnoseTray")
+		}
+	default:
+		if ver, ok := t.rollbackVersion(menuItemId); ok {
+			select {
+			case t.callbacks.Rollback <- ver:
+			// should not happen but in case not listening
+			default:
+				slog.Error("no listener on Rollback")
+			}
+			break
+		}
+		if mode, ok := updateModeForMenuItem(menuItemId); ok {
+			select {
+			case t.callbacks.SetUpdateMode <- mode:
+			// should not happen but in case not listening
+			default:
+				slog.Error("no listener on SetUpdateMode")
+			}
+			break
+		}
+		if model, ok := t.modelForMenuItem(menuItemId); ok {
+			t.setCachedActiveModel(model)
+			select {
+			case t.callbacks.SetActiveModel <- model:
+			// should not happen but in case not listening
+			default:
+				slog.Error("no listener on SetActiveModel")
+			}
+			break
+		}
+		slog.Debug(fmt.Sprintf("Unexpected menu item id: %d", menuItemId))
+	}
+}
+
 func (t *winTray) Quit() {
 	quitOnce.Do(quit)
 }
 
 func quit() {
-	boolRet, _, err := pPostMessage.Call(
-		uintptr(wt.window),
-		WM_CLOSE,
-		0,
-		0,
-	)
-	if boolRet == 0 {
+	if err := postMessage(wt.window, WM_CLOSE, 0, 0); err != nil {
 		slog.Error(fmt.Sprintf("failed to post close message on shutdown %s", err))
 	}
 }
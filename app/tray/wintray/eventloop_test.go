@@ -0,0 +1,377 @@
+//go:build windows
+
+package wintray
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+const (
+	testWM_COMMAND = 0x0111
+	testWM_CLOSE   = 0x0010
+	testWM_DESTROY = 0x0002
+
+	testWM_QUERYENDSESSION = 0x0011
+)
+
+func newTestTray() *winTray {
+	return &winTray{
+		window: windows.Handle(42),
+		wcex:   &wndClassEx{},
+		nid:    &notifyIconData{},
+		callbacks: commontray.Callbacks{
+			Quit:            make(chan struct{}, 1),
+			Update:          make(chan struct{}, 1),
+			DoFirstUse:      make(chan struct{}, 1),
+			ShowLogs:        make(chan struct{}, 1),
+			RestartServer:   make(chan struct{}, 1),
+			Rollback:        make(chan string, 1),
+			ReportIssue:     make(chan struct{}, 1),
+			CheckUpdates:    make(chan struct{}, 1),
+			CopyDiagnostics: make(chan struct{}, 1),
+			SetActiveModel:  make(chan string, 1),
+			CopyVersion:     make(chan struct{}, 1),
+			UpdateDeclined:  make(chan struct{}, 1),
+
+			ShowReleaseNotes: make(chan struct{}, 1),
+			DisableUpdates:   make(chan struct{}, 1),
+			SaveDiagnostics:  make(chan struct{}, 1),
+			CopyUpdateURLs:   make(chan struct{}, 1),
+			PinVersion:       make(chan struct{}, 1),
+			Resumed:          make(chan struct{}, 1),
+			SetUpdateMode:    make(chan commontray.UpdateMode, 1),
+			PauseDownload:    make(chan struct{}, 1),
+			ResumeDownload:   make(chan struct{}, 1),
+			DiagnoseTray:     make(chan struct{}, 1),
+			RestartApp:       make(chan struct{}, 1),
+		},
+		rollbackVersions: []string{"0.1.28", "0.1.27"},
+		models:           []string{"llama2:latest", "mistral:7b"},
+	}
+}
+
+func TestMenuCommandRouting(t *testing.T) {
+	cases := []struct {
+		id uintptr
+		ch func(commontray.Callbacks) chan struct{}
+	}{
+		{quitMenuID, func(c commontray.Callbacks) chan struct{} { return c.Quit }},
+		{updateMenuID, func(c commontray.Callbacks) chan struct{} { return c.Update }},
+		{diagLogsMenuID, func(c commontray.Callbacks) chan struct{} { return c.ShowLogs }},
+		{copyDiagMenuID, func(c commontray.Callbacks) chan struct{} { return c.CopyDiagnostics }},
+		{saveDiagMenuID, func(c commontray.Callbacks) chan struct{} { return c.SaveDiagnostics }},
+		{copyUpdateURLMenuID, func(c commontray.Callbacks) chan struct{} { return c.CopyUpdateURLs }},
+		{copyVersionMenuID, func(c commontray.Callbacks) chan struct{} { return c.CopyVersion }},
+		{restartServerMenuID, func(c commontray.Callbacks) chan struct{} { return c.RestartServer }},
+		{checkUpdatesMenuID, func(c commontray.Callbacks) chan struct{} { return c.CheckUpdates }},
+		{reportIssueMenuID, func(c commontray.Callbacks) chan struct{} { return c.ReportIssue }},
+		{pinVersionMenuID, func(c commontray.Callbacks) chan struct{} { return c.PinVersion }},
+		{getStartedMenuID, func(c commontray.Callbacks) chan struct{} { return c.DoFirstUse }},
+		{pauseDownloadMenuID, func(c commontray.Callbacks) chan struct{} { return c.PauseDownload }},
+		{resumeDownloadMenuID, func(c commontray.Callbacks) chan struct{} { return c.ResumeDownload }},
+		{diagnoseTrayMenuID, func(c commontray.Callbacks) chan struct{} { return c.DiagnoseTray }},
+		{restartAppMenuID, func(c commontray.Callbacks) chan struct{} { return c.RestartApp }},
+		{remindLaterMenuID, func(c commontray.Callbacks) chan struct{} { return c.UpdateDeclined }},
+	}
+	for _, tc := range cases {
+		tray := newTestTray()
+		tray.wndProc(tray.window, testWM_COMMAND, tc.id, 0)
+		select {
+		case <-tc.ch(tray.callbacks):
+		default:
+			t.Errorf("menu item %d did not reach its callback", tc.id)
+		}
+	}
+
+	tray := newTestTray()
+	tray.wndProc(tray.window, testWM_COMMAND, rollbackVersionMenuIDBase+1, 0)
+	select {
+	case ver := <-tray.callbacks.Rollback:
+		assert.Equal(t, "0.1.27", ver)
+	default:
+		t.Error("roll back item did not reach its callback")
+	}
+
+	tray.wndProc(tray.window, testWM_COMMAND, modelMenuIDBase+1, 0)
+	select {
+	case model := <-tray.callbacks.SetActiveModel:
+		assert.Equal(t, "mistral:7b", model)
+	default:
+		t.Error("model item did not reach its callback")
+	}
+
+	tray.wndProc(tray.window, testWM_COMMAND, updateModeMenuIDBase+2, 0)
+	select {
+	case mode := <-tray.callbacks.SetUpdateMode:
+		assert.Equal(t, commontray.UpdateManual, mode)
+	default:
+		t.Error("update mode item did not reach its callback")
+	}
+
+	// Unknown items, and a full channel, are dropped rather than blocking
+	tray.wndProc(tray.window, testWM_COMMAND, rollbackVersionMenuIDBase+10, 0)
+	tray.wndProc(tray.window, testWM_COMMAND, quitMenuID, 0)
+	tray.wndProc(tray.window, testWM_COMMAND, quitMenuID, 0)
+}
+
+func TestBalloonTimeoutIsNotADecline(t *testing.T) {
+	tray := newTestTray()
+	tray.wmSystrayMessage = WM_USER + 1
+	tray.pendingUpdate = true
+	tray.wndProc(tray.window, tray.wmSystrayMessage, 0, 0x404)
+	assert.Empty(t, tray.callbacks.UpdateDeclined)
+	assert.Empty(t, tray.callbacks.Update)
+}
+
+func TestBalloonClick(t *testing.T) {
+	tray := newTestTray()
+	tray.wmSystrayMessage = WM_USER + 1
+	tray.pendingUpdate = true
+	tray.wndProc(tray.window, tray.wmSystrayMessage, 0, 0x405)
+	assert.Empty(t, tray.callbacks.Update, "a notification without an action does nothing")
+	assert.Empty(t, tray.callbacks.DoFirstUse)
+
+	tray.balloonAction = sendCallback(tray.callbacks.DoFirstUse, "DoFirstUse")
+	tray.wndProc(tray.window, tray.wmSystrayMessage, 0, 0x405)
+	assert.Len(t, tray.callbacks.DoFirstUse, 1)
+	assert.Empty(t, tray.callbacks.Update)
+}
+
+func TestDisableUpdatesConfirmation(t *testing.T) {
+	orig := messageBox
+	t.Cleanup(func() { messageBox = orig })
+
+	answer := int32(7) // IDNO
+	messageBox = func(windows.Handle, string, string, uint32) int32 { return answer }
+	tray := newTestTray()
+	tray.wndProc(tray.window, testWM_COMMAND, disableUpdatesMenuID, 0)
+	select {
+	case <-tray.callbacks.DisableUpdates:
+		t.Error("updates disabled without confirmation")
+	default:
+	}
+
+	answer = IDYES
+	tray.wndProc(tray.window, testWM_COMMAND, disableUpdatesMenuID, 0)
+	select {
+	case <-tray.callbacks.DisableUpdates:
+	default:
+		t.Error("confirmed disable did not reach its callback")
+	}
+}
+
+func TestWndProcTeardown(t *testing.T) {
+	var calls []string
+	stub := func(orig *func(windows.Handle) error, name string) {
+		saved := *orig
+		*orig = func(windows.Handle) error {
+			calls = append(calls, name)
+			return nil
+		}
+		t.Cleanup(func() { *orig = saved })
+	}
+	stub(&wtsUnRegisterSessionNotification, "WTSUnRegisterSessionNotification")
+
+	tray := newTestTray()
+	origDestroy := destroyWindow
+	t.Cleanup(func() { destroyWindow = origDestroy })
+	destroyWindow = func(hWnd windows.Handle) error {
+		calls = append(calls, "DestroyWindow")
+		// DestroyWindow sends WM_DESTROY before returning
+		tray.wndProc(hWnd, testWM_DESTROY, 0, 0)
+		return nil
+	}
+
+	origUnregister, origNotify, origQuit, origDef := unregisterClass, shellNotifyIcon, postQuitMessage, defWindowProc
+	t.Cleanup(func() {
+		unregisterClass, shellNotifyIcon, postQuitMessage, defWindowProc = origUnregister, origNotify, origQuit, origDef
+	})
+	unregisterClass = func(*uint16, windows.Handle) error {
+		calls = append(calls, "UnregisterClass")
+		return nil
+	}
+	shellNotifyIcon = func(message uint32, _ *notifyIconData) error {
+		assert.Equal(t, uint32(0x2), message, "expected NIM_DELETE")
+		calls = append(calls, "Shell_NotifyIcon")
+		return nil
+	}
+	postQuitMessage = func(code int32) {
+		assert.Equal(t, int32(0), code)
+		calls = append(calls, "PostQuitMessage")
+	}
+	defWindowProc = func(windows.Handle, uint32, uintptr, uintptr) uintptr {
+		calls = append(calls, "DefWindowProc")
+		return 7
+	}
+
+	tray.wndProc(tray.window, testWM_CLOSE, 0, 0)
+	assert.Equal(t, []string{
+		"WTSUnRegisterSessionNotification",
+		"Shell_NotifyIcon",
+		"DestroyWindow",
+		"UnregisterClass",
+		"PostQuitMessage",
+	}, calls)
+
+	// Closing again, or clicking the torn down menu, does nothing
+	calls = nil
+	tray.wndProc(tray.window, testWM_CLOSE, 0, 0)
+	tray.wndProc(tray.window, testWM_COMMAND, quitMenuID, 0)
+	assert.Empty(t, calls)
+	assert.Empty(t, tray.callbacks.Quit)
+
+	assert.Equal(t, uintptr(7), tray.wndProc(tray.window, 0x9999, 0, 0))
+	assert.Equal(t, []string{"DefWindowProc"}, calls)
+
+	// A window destroyed some other way still removes its icon and quits
+	calls = nil
+	tray = newTestTray()
+	tray.wndProc(tray.window, testWM_DESTROY, 0, 0)
+	assert.Equal(t, []string{"Shell_NotifyIcon", "PostQuitMessage"}, calls)
+}
+
+type fakeMessage struct {
+	ret int32
+	err error
+}
+
+// stubMessageLoop feeds messages to nativeLoop, counting how many it
+// dispatches
+func stubMessageLoop(t *testing.T, messages []fakeMessage) *int {
+	t.Helper()
+	origGet, origTranslate, origDispatch, origDelay := getMessage, translateMessage, dispatchMessage, messageLoopRetryDelay
+	t.Cleanup(func() {
+		getMessage, translateMessage, dispatchMessage, messageLoopRetryDelay = origGet, origTranslate, origDispatch, origDelay
+	})
+	messageLoopRetryDelay = time.Millisecond
+
+	dispatched := 0
+	getMessage = func(*msg) (int32, error) {
+		if len(messages) == 0 {
+			return 0, nil
+		}
+		m := messages[0]
+		messages = messages[1:]
+		return m.ret, m.err
+	}
+	translateMessage = func(*msg) {}
+	dispatchMessage = func(*msg) { dispatched++ }
+	return &dispatched
+}
+
+func TestNativeLoopRecovers(t *testing.T) {
+	transient := errors.New("transient")
+	dispatched := stubMessageLoop(t, []fakeMessage{
+		{ret: 1},
+		{ret: -1, err: transient},
+		{ret: -1, err: transient},
+		{ret: 1},
+		{ret: 0},
+	})
+	require.NoError(t, nativeLoop())
+	assert.Equal(t, 2, *dispatched, "should keep pumping after transient failures")
+}
+
+func TestNativeLoopGivesUp(t *testing.T) {
+	transient := errors.New("transient")
+	var messages []fakeMessage
+	for i := 0; i < messageLoopMaxErrors; i++ {
+		messages = append(messages, fakeMessage{ret: -1, err: transient})
+	}
+	stubMessageLoop(t, messages)
+	assert.ErrorIs(t, nativeLoop(), transient)
+
+	// Failures separated by a message don't add up
+	var interrupted []fakeMessage
+	interrupted = append(interrupted, messages[1:]...)
+	interrupted = append(interrupted, fakeMessage{ret: 1})
+	interrupted = append(interrupted, messages[1:]...)
+	stubMessageLoop(t, interrupted)
+	assert.NoError(t, nativeLoop())
+
+	dispatched := stubMessageLoop(t, []fakeMessage{
+		{ret: -1, err: windows.ERROR_INVALID_WINDOW_HANDLE},
+		{ret: 1},
+	})
+	assert.ErrorIs(t, nativeLoop(), windows.ERROR_INVALID_WINDOW_HANDLE, "fatal errors should not be retried")
+	assert.Equal(t, 0, *dispatched)
+}
+
+func TestWndProcPowerBroadcast(t *testing.T) {
+	const WM_POWERBROADCAST = 0x0218
+	const PBT_APMSUSPEND = 0x4
+
+	tray := newTestTray()
+	assert.Equal(t, uintptr(1), tray.wndProc(tray.window, WM_POWERBROADCAST, PBT_APMSUSPEND, 0))
+	assert.Empty(t, tray.callbacks.Resumed)
+
+	tray.wndProc(tray.window, WM_POWERBROADCAST, PBT_APMRESUMEAUTOMATIC, 0)
+	assert.Len(t, tray.callbacks.Resumed, 1)
+}
+
+func TestQueryEndSession(t *testing.T) {
+	origCreate, origDestroy, origInterval := shutdownBlockReasonCreate, shutdownBlockReasonDestroy, shutdownBlockPollInterval
+	t.Cleanup(func() {
+		shutdownBlockReasonCreate, shutdownBlockReasonDestroy, shutdownBlockPollInterval = origCreate, origDestroy, origInterval
+	})
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	recorded := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+	shutdownBlockReasonCreate = func(_ windows.Handle, reason string) error {
+		record("create " + reason)
+		return nil
+	}
+	shutdownBlockReasonDestroy = func(windows.Handle) error {
+		record("destroy")
+		return nil
+	}
+	shutdownBlockPollInterval = time.Millisecond
+
+	tray := newTestTray()
+	assert.EqualValues(t, 1, tray.wndProc(tray.window, testWM_QUERYENDSESSION, 0, 0), "nothing to wait for")
+
+	var busy atomic.Bool
+	tray.SetUpdateBusy(busy.Load)
+	assert.EqualValues(t, 1, tray.wndProc(tray.window, testWM_QUERYENDSESSION, 0, 0), "no update underway")
+	assert.Empty(t, recorded())
+
+	busy.Store(true)
+	assert.EqualValues(t, 1, tray.wndProc(tray.window, testWM_QUERYENDSESSION, 0, ENDSESSION_CLOSEAPP), "an installer closing the app")
+	assert.Empty(t, recorded())
+	assert.EqualValues(t, 0, tray.wndProc(tray.window, testWM_QUERYENDSESSION, 0, 0))
+	assert.EqualValues(t, 0, tray.wndProc(tray.window, testWM_QUERYENDSESSION, 0, 0))
+	assert.Equal(t, []string{"create " + shutdownBlockReason}, recorded(), "the block is only set once")
+
+	busy.Store(false)
+	require.Eventually(t, func() bool { return len(recorded()) == 2 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, "destroy", recorded()[1])
+	assert.EqualValues(t, 1, tray.wndProc(tray.window, testWM_QUERYENDSESSION, 0, 0))
+
+	// Quitting while blocked releases it too
+	busy.Store(true)
+	shutdownBlockPollInterval = time.Hour
+	assert.EqualValues(t, 0, tray.wndProc(tray.window, testWM_QUERYENDSESSION, 0, 0))
+	tray.muShutdownBlock.Lock()
+	tray.clearShutdownBlock()
+	tray.muShutdownBlock.Unlock()
+	assert.Equal(t, []string{"create " + shutdownBlockReason, "destroy", "create " + shutdownBlockReason, "destroy"}, recorded())
+}
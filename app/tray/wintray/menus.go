@@ -5,24 +5,99 @@ package wintray
 import (
 	"fmt"
 	"log/slog"
-	"unsafe"
 
-	"golang.org/x/sys/windows"
+	"github.com/jmorganca/ollama/app/tray/commontray"
 )
 
 const (
 	updatAvailableMenuID = 1
 	updateMenuID         = updatAvailableMenuID + 1
-	separatorMenuID      = updateMenuID + 1
-	diagLogsMenuID       = separatorMenuID + 1
-	diagSeparatorMenuID  = diagLogsMenuID + 1
+	remindLaterMenuID    = updateMenuID + 1
+	pauseDownloadMenuID  = remindLaterMenuID + 1
+	resumeDownloadMenuID = pauseDownloadMenuID + 1
+	separatorMenuID      = resumeDownloadMenuID + 1
+	modelsMenuID         = separatorMenuID + 1
+	checkUpdatesMenuID   = modelsMenuID + 1
+	disableUpdatesMenuID = checkUpdatesMenuID + 1
+	pinVersionMenuID     = disableUpdatesMenuID + 1
+	updateModeMenuID     = pinVersionMenuID + 1
+	diagLogsMenuID       = updateModeMenuID + 1
+	copyDiagMenuID       = diagLogsMenuID + 1
+	saveDiagMenuID       = copyDiagMenuID + 1
+	copyUpdateURLMenuID  = saveDiagMenuID + 1
+	copyVersionMenuID    = copyUpdateURLMenuID + 1
+	restartServerMenuID  = copyVersionMenuID + 1
+	restartAppMenuID     = restartServerMenuID + 1
+	rollbackMenuID       = restartAppMenuID + 1
+	reportIssueMenuID    = rollbackMenuID + 1
+	getStartedMenuID     = reportIssueMenuID + 1
+	diagnoseTrayMenuID   = getStartedMenuID + 1
+	diagSeparatorMenuID  = diagnoseTrayMenuID + 1
 	quitMenuID           = diagSeparatorMenuID + 1
+
+	// Items in the roll back submenu are numbered from here, one per version
+	rollbackVersionMenuIDBase = 1000
+	// The roll back submenu lists this many of the versions it's given at
+	// most, which also keeps its IDs clear of the models submenu's
+	maxRollbackVersions = 20
+	// Items in the models submenu are numbered from here, one per model
+	modelMenuIDBase = 2000
+	// Items in the updates submenu are numbered from here, one per mode
+	updateModeMenuIDBase = 3000
 )
 
 func (t *winTray) initMenus() error {
+	if err := t.addSubMenu(modelsMenuID, 0, modelsMenuTitle); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(checkUpdatesMenuID, 0, checkUpdatesMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(disableUpdatesMenuID, 0, disableUpdatesMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(pinVersionMenuID, 0, pinVersionMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addSubMenu(updateModeMenuID, 0, updateModeMenuTitle); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	for _, item := range updateModeMenuItems(commontray.UpdateNotify) {
+		if err := t.addOrUpdateMenuItemState(item.id, updateModeMenuID, item.title, item.state); err != nil {
+			return fmt.Errorf("unable to create menu entries %w", err)
+		}
+	}
 	if err := t.addOrUpdateMenuItem(diagLogsMenuID, 0, diagLogsMenuTitle, false); err != nil {
 		return fmt.Errorf("unable to create menu entries %w\n", err)
 	}
+	if err := t.addOrUpdateMenuItem(copyDiagMenuID, 0, copyDiagMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(saveDiagMenuID, 0, saveDiagMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(copyUpdateURLMenuID, 0, copyUpdateURLMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(copyVersionMenuID, 0, copyVersionMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(restartServerMenuID, 0, restartServerMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(restartAppMenuID, 0, restartAppMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(reportIssueMenuID, 0, reportIssueMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	// Unlike the first use notification, this stays so the tour can be replayed
+	if err := t.addOrUpdateMenuItem(getStartedMenuID, 0, getStartedMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	if err := t.addOrUpdateMenuItem(diagnoseTrayMenuID, 0, diagnoseTrayMenuTitle, false); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
 	if err := t.addSeparatorMenuItem(diagSeparatorMenuID, 0); err != nil {
 		return fmt.Errorf("unable to create menu entries %w", err)
 	}
@@ -32,9 +107,56 @@ func (t *winTray) initMenus() error {
 	return nil
 }
 
-func (t *winTray) UpdateAvailable(ver string) error {
+// UpdateAvailable shows the update in the menu and notifies the user, each
+// time it is called
+func (t *winTray) UpdateAvailable(ver, description string) error {
+	if err := t.UpdatePending(ver); err != nil {
+		return err
+	}
+	message := description
+	if message == "" {
+		message = fmt.Sprintf(updateMessage, ver)
+	}
+	slog.Debug("sending notification for new update")
+	return t.notifier.notify(updateTitle, message, updateActionTitle,
+		sendCallback(t.callbacks.Update, "Update"))
+}
+
+// UpdateMandatory shows a required update in the menu with a notification
+// that stays until it's acted on, each time it is called
+func (t *winTray) UpdateMandatory(ver, message string) error {
+	if err := t.UpdatePending(ver); err != nil {
+		return err
+	}
+	if message == "" {
+		message = fmt.Sprintf(mandatoryUpdateMessage, ver)
+	}
+	slog.Debug("sending notification for mandatory update")
+	return t.notifier.notifyPersistent(mandatoryUpdateTitle, message, updateActionTitle,
+		sendCallback(t.callbacks.Update, "Update"))
+}
+
+func (t *winTray) UpdatePending(ver string) error {
+	if t.updatesDisabled.Load() {
+		return nil
+	}
+	if err := t.showPendingUpdate(); err != nil {
+		return err
+	}
+	// An update found but not downloaded yet, such as one restored from a
+	// previous session, isn't shown as staged until it is
+	if t.updateDownloaded() {
+		return t.SetStatusIcon(commontray.StatusUpdateStaged)
+	}
+	return nil
+}
+
+// showPendingUpdate adds the update entries to the menu, once
+func (t *winTray) showPendingUpdate() error {
+	t.muPendingUpdate.Lock()
+	defer t.muPendingUpdate.Unlock()
 	if !t.updateNotified {
-		slog.Debug("updating menu and sending notification for new update")
+		slog.Debug("updating menu for new update")
 		if err := t.addOrUpdateMenuItem(updatAvailableMenuID, 0, updateAvailableMenuTitle, true); err != nil {
 			return fmt.Errorf("unable to create menu entries %w", err)
 		}
@@ -44,28 +166,299 @@ func (t *winTray) UpdateAvailable(ver string) error {
 		if err := t.addSeparatorMenuItem(separatorMenuID, 0); err != nil {
 			return fmt.Errorf("unable to create menu entries %w", err)
 		}
-		iconFilePath, err := iconBytesToFilePath(wt.updateIcon)
-		if err != nil {
-			return fmt.Errorf("unable to write icon data to temp file: %w", err)
+		t.updateNotified = true
+
+		t.pendingUpdate = true
+	}
+	return nil
+}
+
+// updateDownloaded reports whether the update is downloaded, assuming it is
+// without an update state provider
+func (t *winTray) updateDownloaded() bool {
+	t.muUpdateState.Lock()
+	defer t.muUpdateState.Unlock()
+	if t.updateState == nil {
+		return true
+	}
+	return t.updateState().Downloaded
+}
+
+// DisableUpdates removes the update entries from the menu, and ignores any
+// later attempt to show an update
+func (t *winTray) DisableUpdates() error {
+	t.updatesDisabled.Store(true)
+	t.muRollback.Lock()
+	t.rollbackVersions = nil
+	t.muRollback.Unlock()
+	for _, id := range []uint32{updatAvailableMenuID, updateMenuID, remindLaterMenuID, pauseDownloadMenuID, resumeDownloadMenuID, separatorMenuID, checkUpdatesMenuID, disableUpdatesMenuID, pinVersionMenuID, updateModeMenuID, rollbackMenuID} {
+		if err := t.removeMenuItem(id, 0); err != nil {
+			return fmt.Errorf("unable to remove menu entries %w", err)
 		}
-		if err := wt.setIcon(iconFilePath); err != nil {
-			return fmt.Errorf("unable to set icon: %w", err)
+	}
+	t.muPendingUpdate.Lock()
+	t.pendingUpdate = false
+	t.muPendingUpdate.Unlock()
+	t.muStatus.Lock()
+	staged := t.status == commontray.StatusUpdateStaged
+	t.muStatus.Unlock()
+	if staged {
+		return t.SetStatusIcon(commontray.StatusNormal)
+	}
+	return nil
+}
+
+// SetStatusIcon shows the icon for status, doing nothing if it's already shown
+func (t *winTray) SetStatusIcon(status commontray.TrayStatus) error {
+	if status == commontray.StatusUpdateStaged && t.updatesDisabled.Load() {
+		status = commontray.StatusNormal
+	}
+	t.muStatus.Lock()
+	defer t.muStatus.Unlock()
+	if status == t.status {
+		return nil
+	}
+	iconFilePath, err := iconBytesToFilePath(t.statusIcon(status))
+	if err != nil {
+		return fmt.Errorf("unable to write icon data to temp file: %w", err)
+	}
+	if err := t.setIcon(iconFilePath); err != nil {
+		return fmt.Errorf("unable to set icon: %w", err)
+	}
+	t.status = status
+	return nil
+}
+
+// statusIcon returns the icon data for status
+func (t *winTray) statusIcon(status commontray.TrayStatus) []byte {
+	switch status {
+	case commontray.StatusServerUnreachable:
+		if len(t.warningIcon) > 0 {
+			return t.warningIcon
 		}
-		t.updateNotified = true
+	case commontray.StatusUpdateStaged:
+		return t.updateIcon
+	}
+	return t.normalIcon
+}
+
+// SetRollbackVersions populates the roll back submenu with older versions
+func (t *winTray) SetRollbackVersions(versions []string) error {
+	if len(versions) == 0 || t.updatesDisabled.Load() {
+		return nil
+	}
+	t.muRollback.Lock()
+	defer t.muRollback.Unlock()
+	if len(t.rollbackVersions) > 0 {
+		slog.Debug("roll back menu already populated")
+		return nil
+	}
+
+	if len(versions) > maxRollbackVersions {
+		versions = versions[:maxRollbackVersions]
+	}
+	if err := t.addSubMenu(rollbackMenuID, 0, rollbackMenuTitle); err != nil {
+		return fmt.Errorf("unable to create menu entries %w", err)
+	}
+	for i, ver := range versions {
+		if err := t.addOrUpdateMenuItem(uint32(rollbackVersionMenuIDBase+i), rollbackMenuID, ver, false); err != nil {
+			return fmt.Errorf("unable to create menu entries %w", err)
+		}
+	}
+	t.rollbackVersions = versions
+	return nil
+}
+
+// rollbackVersion maps a roll back submenu item ID to its version
+func (t *winTray) rollbackVersion(menuItemId int32) (string, bool) {
+	t.muRollback.Lock()
+	defer t.muRollback.Unlock()
+	i := int(menuItemId) - rollbackVersionMenuIDBase
+	if i < 0 || i >= len(t.rollbackVersions) {
+		return "", false
+	}
+	return t.rollbackVersions[i], true
+}
+
+// menuItem is an entry laid out before it's added to a menu
+type menuItem struct {
+	id    uint32
+	title string
+	state uint32
+}
+
+// modelMenuItems lays out the models submenu, checking the active model
+func modelMenuItems(models []string, active string) []menuItem {
+	if len(models) == 0 {
+		return []menuItem{{id: modelMenuIDBase, title: noModelsMenuTitle, state: MFS_DISABLED}}
+	}
+	items := make([]menuItem, len(models))
+	for i, model := range models {
+		items[i] = menuItem{id: uint32(modelMenuIDBase + i), title: model}
+		if model == active {
+			items[i].state = MFS_CHECKED
+		}
+	}
+	return items
+}
+
+// updateMenuItems lays out the update entries for state, which are left
+// out while no update is available. A required update can't be put off.
+func updateMenuItems(state commontray.UpdateState) []menuItem {
+	if state.Disabled || state.Version == "" {
+		return nil
+	}
+	available := menuItem{id: updatAvailableMenuID, title: updateAvailableMenuTitle, state: MFS_DISABLED}
+	if state.Mandatory {
+		available.title = mandatoryUpdateMenuTitle
+	}
+	update := menuItem{id: updateMenuID, title: updateMenutTitle}
+	if !state.Downloaded {
+		update.state = MFS_DISABLED
+	}
+	items := []menuItem{available, update}
+	if !state.Mandatory {
+		items = append(items, menuItem{id: remindLaterMenuID, title: remindLaterMenuTitle})
+	}
+	switch {
+	case state.Downloaded:
+	case state.Paused:
+		items = append(items, menuItem{id: resumeDownloadMenuID, title: resumeDownloadMenuTitle})
+	case state.Downloading:
+		items = append(items, menuItem{id: pauseDownloadMenuID, title: pauseDownloadMenuTitle})
+	}
+	return items
+}
+
+// updateModes lists the modes in the updates submenu, in order
+var updateModes = []struct {
+	mode  commontray.UpdateMode
+	title string
+}{
+	{commontray.UpdateAutomatic, automaticUpdatesMenuTitle},
+	{commontray.UpdateNotify, notifyUpdatesMenuTitle},
+	{commontray.UpdateManual, manualUpdatesMenuTitle},
+}
+
+// updateModeMenuItems lays out the updates submenu, checking only mode
+func updateModeMenuItems(mode commontray.UpdateMode) []menuItem {
+	items := make([]menuItem, len(updateModes))
+	for i, m := range updateModes {
+		items[i] = menuItem{id: uint32(updateModeMenuIDBase + i), title: m.title}
+		if m.mode == mode {
+			items[i].state = MFS_CHECKED
+		}
+	}
+	return items
+}
 
+// updateModeForMenuItem maps an updates submenu item ID to its mode
+func updateModeForMenuItem(menuItemId int32) (commontray.UpdateMode, bool) {
+	i := int(menuItemId) - updateModeMenuIDBase
+	if i < 0 || i >= len(updateModes) {
+		return 0, false
+	}
+	return updateModes[i].mode, true
+}
+
+func (t *winTray) SetUpdateStateProvider(state func() commontray.UpdateState) {
+	t.muUpdateState.Lock()
+	defer t.muUpdateState.Unlock()
+	t.updateState = state
+}
+
+// refreshUpdateMenu brings the update entries, and the mode checked in the
+// updates submenu, in line with the updater's current state
+func (t *winTray) refreshUpdateMenu() error {
+	t.muUpdateState.Lock()
+	defer t.muUpdateState.Unlock()
+	if t.updateState == nil || t.updatesDisabled.Load() {
+		return nil
+	}
+	state := t.updateState()
+	t.muPendingUpdate.Lock()
+	defer t.muPendingUpdate.Unlock()
+	if !state.Disabled {
+		for _, item := range updateModeMenuItems(state.Mode) {
+			if err := t.addOrUpdateMenuItemState(item.id, updateModeMenuID, item.title, item.state); err != nil {
+				return fmt.Errorf("unable to update menu entries %w", err)
+			}
+		}
+	}
+	items := updateMenuItems(state)
+	shown := map[uint32]bool{}
+	for _, item := range items {
+		if err := t.addOrUpdateMenuItemState(item.id, 0, item.title, item.state); err != nil {
+			return fmt.Errorf("unable to create menu entries %w", err)
+		}
+		shown[item.id] = true
+	}
+	for _, id := range []uint32{updatAvailableMenuID, updateMenuID, remindLaterMenuID, pauseDownloadMenuID, resumeDownloadMenuID} {
+		if shown[id] {
+			continue
+		}
+		if err := t.removeMenuItem(id, 0); err != nil {
+			return fmt.Errorf("unable to remove menu entries %w", err)
+		}
+	}
+	if len(items) == 0 {
+		if !t.pendingUpdate {
+			return nil
+		}
+		if err := t.removeMenuItem(separatorMenuID, 0); err != nil {
+			return fmt.Errorf("unable to remove menu entries %w", err)
+		}
+		t.pendingUpdate = false
+		t.updateNotified = false
+		return nil
+	}
+	if !t.pendingUpdate {
+		if err := t.addSeparatorMenuItem(separatorMenuID, 0); err != nil {
+			return fmt.Errorf("unable to create menu entries %w", err)
+		}
 		t.pendingUpdate = true
-		// Now pop up the notification
-		t.muNID.Lock()
-		defer t.muNID.Unlock()
-		copy(t.nid.InfoTitle[:], windows.StringToUTF16(updateTitle))
-		copy(t.nid.Info[:], windows.StringToUTF16(fmt.Sprintf(updateMessage, ver)))
-		t.nid.Flags |= NIF_INFO
-		t.nid.Timeout = 10
-		t.nid.Size = uint32(unsafe.Sizeof(*wt.nid))
-		err = t.nid.modify()
-		if err != nil {
-			return err
+		t.updateNotified = true
+	}
+	return nil
+}
+
+func (t *winTray) SetModelLister(lister func() ([]string, string)) {
+	t.muModels.Lock()
+	t.modelLister = lister
+	t.muModels.Unlock()
+	t.startModelRefresh()
+}
+
+// refreshModelsMenu rebuilds the models submenu from the cached model list,
+// which is listed in the background so opening the menu never waits on it
+func (t *winTray) refreshModelsMenu() error {
+	t.muModels.Lock()
+	defer t.muModels.Unlock()
+	if t.modelLister == nil {
+		return nil
+	}
+	models, active := t.cachedModels, t.cachedActive
+
+	if err := t.clearSubMenu(modelsMenuID); err != nil {
+		return err
+	}
+	t.models = nil
+	for _, item := range modelMenuItems(models, active) {
+		if err := t.addOrUpdateMenuItemState(item.id, modelsMenuID, item.title, item.state); err != nil {
+			return fmt.Errorf("unable to create menu entries %w", err)
 		}
 	}
+	t.models = models
 	return nil
 }
+
+// modelForMenuItem maps a models submenu item ID to its model
+func (t *winTray) modelForMenuItem(menuItemId int32) (string, bool) {
+	t.muModels.Lock()
+	defer t.muModels.Unlock()
+	i := int(menuItemId) - modelMenuIDBase
+	if i < 0 || i >= len(t.models) {
+		return "", false
+	}
+	return t.models[i], true
+}
@@ -0,0 +1,166 @@
+//go:build windows
+
+package wintray
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+)
+
+func TestModelMenuItems(t *testing.T) {
+	items := modelMenuItems([]string{"llama2:latest", "mistral:7b", "phi:latest"}, "mistral:7b")
+	assert.Equal(t, []menuItem{
+		{id: modelMenuIDBase, title: "llama2:latest"},
+		{id: modelMenuIDBase + 1, title: "mistral:7b", state: MFS_CHECKED},
+		{id: modelMenuIDBase + 2, title: "phi:latest"},
+	}, items)
+
+	items = modelMenuItems(nil, "")
+	assert.Equal(t, []menuItem{{id: modelMenuIDBase, title: noModelsMenuTitle, state: MFS_DISABLED}}, items)
+}
+
+func TestUpdateMenuItems(t *testing.T) {
+	assert.Empty(t, updateMenuItems(commontray.UpdateState{}), "nothing is shown without an update")
+	assert.Empty(t, updateMenuItems(commontray.UpdateState{Version: "0.1.30", Downloaded: true, Disabled: true}))
+
+	assert.Equal(t, []menuItem{
+		{id: updatAvailableMenuID, title: updateAvailableMenuTitle, state: MFS_DISABLED},
+		{id: updateMenuID, title: updateMenutTitle, state: MFS_DISABLED},
+		{id: remindLaterMenuID, title: remindLaterMenuTitle},
+	}, updateMenuItems(commontray.UpdateState{Version: "0.1.30"}), "can't restart to update before it's downloaded")
+
+	assert.Equal(t, []menuItem{
+		{id: updatAvailableMenuID, title: updateAvailableMenuTitle, state: MFS_DISABLED},
+		{id: updateMenuID, title: updateMenutTitle},
+		{id: remindLaterMenuID, title: remindLaterMenuTitle},
+	}, updateMenuItems(commontray.UpdateState{Version: "0.1.30", Downloaded: true}))
+
+	assert.Equal(t, []menuItem{
+		{id: updatAvailableMenuID, title: mandatoryUpdateMenuTitle, state: MFS_DISABLED},
+		{id: updateMenuID, title: updateMenutTitle},
+	}, updateMenuItems(commontray.UpdateState{Version: "0.1.30", Downloaded: true, Mandatory: true}))
+
+	assert.Equal(t, []menuItem{
+		{id: updatAvailableMenuID, title: updateAvailableMenuTitle, state: MFS_DISABLED},
+		{id: updateMenuID, title: updateMenutTitle, state: MFS_DISABLED},
+		{id: remindLaterMenuID, title: remindLaterMenuTitle},
+		{id: pauseDownloadMenuID, title: pauseDownloadMenuTitle},
+	}, updateMenuItems(commontray.UpdateState{Version: "0.1.30", Downloading: true}))
+
+	assert.Equal(t, []menuItem{
+		{id: updatAvailableMenuID, title: updateAvailableMenuTitle, state: MFS_DISABLED},
+		{id: updateMenuID, title: updateMenutTitle, state: MFS_DISABLED},
+		{id: remindLaterMenuID, title: remindLaterMenuTitle},
+		{id: resumeDownloadMenuID, title: resumeDownloadMenuTitle},
+	}, updateMenuItems(commontray.UpdateState{Version: "0.1.30", Paused: true}))
+}
+
+func TestUpdateModeMenuItems(t *testing.T) {
+	for _, tc := range []struct {
+		mode    commontray.UpdateMode
+		checked uint32
+	}{
+		{commontray.UpdateAutomatic, updateModeMenuIDBase},
+		{commontray.UpdateNotify, updateModeMenuIDBase + 1},
+		{commontray.UpdateManual, updateModeMenuIDBase + 2},
+	} {
+		items := updateModeMenuItems(tc.mode)
+		require.Len(t, items, 3)
+		for _, item := range items {
+			if item.id == tc.checked {
+				assert.Equal(t, uint32(MFS_CHECKED), item.state, item.title)
+			} else {
+				assert.Zero(t, item.state, "only one mode is checked")
+			}
+		}
+		mode, ok := updateModeForMenuItem(int32(tc.checked))
+		require.True(t, ok)
+		assert.Equal(t, tc.mode, mode)
+	}
+	_, ok := updateModeForMenuItem(updateModeMenuIDBase + 3)
+	assert.False(t, ok)
+}
+
+func TestStatusIcon(t *testing.T) {
+	tray := &winTray{
+		normalIcon:  []byte("normal"),
+		updateIcon:  []byte("update"),
+		warningIcon: []byte("warning"),
+	}
+	assert.Equal(t, []byte("normal"), tray.statusIcon(commontray.StatusNormal))
+	assert.Equal(t, []byte("warning"), tray.statusIcon(commontray.StatusServerUnreachable))
+	assert.Equal(t, []byte("update"), tray.statusIcon(commontray.StatusUpdateStaged))
+
+	tray.warningIcon = nil
+	assert.Equal(t, []byte("normal"), tray.statusIcon(commontray.StatusServerUnreachable), "should fall back without a warning icon")
+}
+
+func TestUpdateDownloaded(t *testing.T) {
+	tray := &winTray{}
+	assert.True(t, tray.updateDownloaded(), "assumed without a state provider")
+
+	state := commontray.UpdateState{Version: "0.1.30"}
+	tray.SetUpdateStateProvider(func() commontray.UpdateState { return state })
+	assert.False(t, tray.updateDownloaded(), "a restored update isn't staged until it's downloaded")
+	state.Downloaded = true
+	assert.True(t, tray.updateDownloaded())
+}
+
+func TestPendingUpdateConcurrently(t *testing.T) {
+	tray := newTestTray()
+	tray.visibleItems = make(map[uint32][]uint32)
+	tray.menus = make(map[uint32]windows.Handle)
+	tray.menuOf = make(map[uint32]windows.Handle)
+	require.NoError(t, tray.createMenu())
+	tray.SetUpdateStateProvider(func() commontray.UpdateState { return commontray.UpdateState{Version: "0.1.30"} })
+
+	// The updater shows the update while the menu is refreshed on the UI
+	// thread, which -race checks
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, tray.UpdatePending("0.1.30"))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, tray.refreshUpdateMenu())
+		}()
+	}
+	wg.Wait()
+
+	tray.muPendingUpdate.Lock()
+	defer tray.muPendingUpdate.Unlock()
+	assert.True(t, tray.pendingUpdate)
+	assert.True(t, tray.updateNotified)
+}
+
+func TestSetRollbackVersionsCapped(t *testing.T) {
+	tray := newTestTray()
+	tray.rollbackVersions = nil
+	tray.visibleItems = make(map[uint32][]uint32)
+	tray.menus = make(map[uint32]windows.Handle)
+	tray.menuOf = make(map[uint32]windows.Handle)
+	require.NoError(t, tray.createMenu())
+
+	// Enough versions to run into the models submenu's IDs
+	versions := make([]string, modelMenuIDBase-rollbackVersionMenuIDBase+10)
+	for i := range versions {
+		versions[i] = fmt.Sprintf("0.0.%d", len(versions)-i)
+	}
+	require.NoError(t, tray.SetRollbackVersions(versions))
+	assert.Len(t, tray.rollbackVersions, maxRollbackVersions)
+
+	ver, ok := tray.rollbackVersion(rollbackVersionMenuIDBase + maxRollbackVersions - 1)
+	assert.True(t, ok)
+	assert.Equal(t, versions[maxRollbackVersions-1], ver)
+	_, ok = tray.rollbackVersion(modelMenuIDBase)
+	assert.False(t, ok, "model items aren't taken for roll back items")
+}
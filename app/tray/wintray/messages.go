@@ -7,9 +7,60 @@ const (
 	firstTimeMessage = "Click here to get started"
 	updateTitle      = "Update available"
 	updateMessage    = "Ollama version %s is ready to install"
+	upToDateTitle    = "Ollama is up to date"
+	upToDateMessage  = "You're running the latest version"
+	upgradedTitle    = "Ollama has been updated"
+	upgradedMessage  = "You're now running version %s"
+
+	rebootPendingTitle   = "Restart to finish updating"
+	rebootPendingMessage = "Restart your computer to finish installing Ollama version %s"
+	serverFailedTitle    = "Ollama server keeps crashing"
+	serverFailedMessage  = "Ollama will keep restarting it, the logs may explain why"
+
+	mandatoryUpdateTitle   = "Required update"
+	mandatoryUpdateMessage = "Ollama version %s fixes a critical issue and will install automatically soon"
+
+	pleaseWaitTitle   = "Please wait…"
+	pleaseWaitMessage = "Ollama just checked for updates, try again shortly"
+
+	// Shown by Windows when logging off while an update is underway
+	shutdownBlockReason = "Ollama is updating, this should only take a moment"
+
+	disableUpdatesTitle   = "Never update Ollama?"
+	disableUpdatesMessage = "Ollama will stop checking for, downloading and installing updates on this machine. This can't be undone from the app."
+
+	firstTimeActionTitle = "Get started"
+	updateActionTitle    = "Install update"
+	upgradedActionTitle  = "See details"
+
+	serverFailedActionTitle = "View logs"
 
 	quitMenuTitle            = "Quit Ollama"
 	updateAvailableMenuTitle = "An update is available"
+	mandatoryUpdateMenuTitle = "A required update is available"
 	updateMenutTitle         = "Restart to update"
+	remindLaterMenuTitle     = "Remind me later"
+	pauseDownloadMenuTitle   = "Pause download"
+	resumeDownloadMenuTitle  = "Resume download"
+	checkUpdatesMenuTitle    = "Check for updates"
+	disableUpdatesMenuTitle  = "Never update on this machine..."
+	pinVersionMenuTitle      = "Pin current version"
 	diagLogsMenuTitle        = "View logs"
+	copyDiagMenuTitle        = "Copy diagnostics"
+	saveDiagMenuTitle        = "Save diagnostics..."
+	copyUpdateURLMenuTitle   = "Copy update URLs"
+	copyVersionMenuTitle     = "Copy version"
+	modelsMenuTitle          = "Models"
+	noModelsMenuTitle        = "No models available"
+	restartServerMenuTitle   = "Restart server"
+	restartAppMenuTitle      = "Restart app"
+	rollbackMenuTitle        = "Roll back..."
+	reportIssueMenuTitle     = "Report an issue"
+	getStartedMenuTitle      = "Get started"
+	diagnoseTrayMenuTitle    = "Check tray icon"
+
+	updateModeMenuTitle       = "Updates"
+	automaticUpdatesMenuTitle = "Automatic"
+	notifyUpdatesMenuTitle    = "Notify only"
+	manualUpdatesMenuTitle    = "Manual"
 )
@@ -0,0 +1,67 @@
+//go:build windows
+
+package wintray
+
+import (
+	"time"
+)
+
+// How often the model list is refreshed in the background, overridden in
+// tests
+var modelRefreshInterval = 30 * time.Second
+
+// startModelRefresh starts refreshing the model list in the background,
+// once, so listing models never holds up the message loop
+func (t *winTray) startModelRefresh() {
+	t.startModelRefreshes.Do(func() {
+		t.muModels.Lock()
+		t.modelRefresh = make(chan struct{}, 1)
+		t.muModels.Unlock()
+		go t.refreshModels()
+	})
+}
+
+// refreshModels lists the models right away, then again every
+// modelRefreshInterval or when asked to, until the tray shuts down
+func (t *winTray) refreshModels() {
+	ticker := time.NewTicker(modelRefreshInterval)
+	defer ticker.Stop()
+	for !t.closing.Load() {
+		t.muModels.Lock()
+		lister := t.modelLister
+		t.muModels.Unlock()
+		if lister != nil {
+			models, active := lister()
+			t.muModels.Lock()
+			t.cachedModels, t.cachedActive = models, active
+			t.muModels.Unlock()
+		}
+		select {
+		case <-ticker.C:
+		case <-t.modelRefresh:
+		}
+	}
+}
+
+// requestModelRefresh lists the models again in the background, if that
+// isn't already pending
+func (t *winTray) requestModelRefresh() {
+	t.muModels.Lock()
+	refresh := t.modelRefresh
+	t.muModels.Unlock()
+	if refresh == nil {
+		return
+	}
+	select {
+	case refresh <- struct{}{}:
+	default:
+	}
+}
+
+// setCachedActiveModel shows model as active the next time the menu opens,
+// without waiting for the list to be refreshed
+func (t *winTray) setCachedActiveModel(model string) {
+	t.muModels.Lock()
+	defer t.muModels.Unlock()
+	t.cachedActive = model
+}
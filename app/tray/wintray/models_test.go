@@ -0,0 +1,55 @@
+//go:build windows
+
+package wintray
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelRefresh(t *testing.T) {
+	orig := modelRefreshInterval
+	t.Cleanup(func() { modelRefreshInterval = orig })
+	modelRefreshInterval = time.Hour
+
+	tray := newTestTray()
+	t.Cleanup(func() {
+		tray.closing.Store(true)
+		tray.requestModelRefresh()
+	})
+	var calls atomic.Int32
+	tray.SetModelLister(func() ([]string, string) {
+		calls.Add(1)
+		return []string{"llama2:latest", "mistral:7b"}, "mistral:7b"
+	})
+	cached := func() ([]string, string) {
+		tray.muModels.Lock()
+		defer tray.muModels.Unlock()
+		return tray.cachedModels, tray.cachedActive
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, 5*time.Second, 10*time.Millisecond, "listed right away")
+	assert.Eventually(t, func() bool {
+		models, _ := cached()
+		return len(models) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Picking a model shows it before the list is refreshed
+	tray.setCachedActiveModel("llama2:latest")
+	_, active := cached()
+	assert.Equal(t, "llama2:latest", active)
+
+	tray.requestModelRefresh()
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, 5*time.Second, 10*time.Millisecond, "listed again when asked")
+
+	// Setting another lister doesn't start another refresher
+	tray.SetModelLister(func() ([]string, string) { return nil, "" })
+	tray.requestModelRefresh()
+	assert.Eventually(t, func() bool {
+		models, _ := cached()
+		return models == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load())
+}
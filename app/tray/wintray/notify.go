@@ -0,0 +1,88 @@
+//go:build windows
+
+package wintray
+
+import (
+	"fmt"
+	"log/slog"
+	"unsafe"
+)
+
+// notifier displays a notification to the user. If action is set, it labels
+// a button (or the notification itself) which triggers onAction when clicked.
+type notifier interface {
+	notify(title, message, action string, onAction func()) error
+}
+
+// persistentNotifier is implemented by notifiers that can show a
+// notification which stays on screen until the user acts on it
+type persistentNotifier interface {
+	notifyPersistent(title, message, action string, onAction func()) error
+}
+
+// notifyPersistent shows a persistent notification with n if it can, and a
+// regular one otherwise
+func notifyPersistent(n notifier, title, message, action string, onAction func()) error {
+	if p, ok := n.(persistentNotifier); ok {
+		return p.notifyPersistent(title, message, action, onAction)
+	}
+	return n.notify(title, message, action, onAction)
+}
+
+// balloonNotifier shows a classic notification area balloon. Clicks are
+// delivered to wndProc as a systray message, which then runs onAction.
+type balloonNotifier struct {
+	t *winTray
+}
+
+func (b balloonNotifier) notify(title, message, action string, onAction func()) error {
+	b.t.muNID.Lock()
+	defer b.t.muNID.Unlock()
+	copyNIDText(b.t.nid.InfoTitle[:], title)
+	copyNIDText(b.t.nid.Info[:], message)
+	b.t.balloonAction = onAction
+	b.t.nid.Flags |= NIF_INFO
+	b.t.nid.Timeout = 10
+	b.t.nid.Size = uint32(unsafe.Sizeof(*b.t.nid))
+	return b.t.nid.modify()
+}
+
+// fallbackNotifier tries primary first, and uses fallback if it fails
+type fallbackNotifier struct {
+	primary  notifier
+	fallback notifier
+}
+
+func (f fallbackNotifier) notify(title, message, action string, onAction func()) error {
+	if f.primary != nil {
+		err := f.primary.notify(title, message, action, onAction)
+		if err == nil {
+			return nil
+		}
+		slog.Debug(fmt.Sprintf("falling back to balloon notification: %s", err))
+	}
+	return f.fallback.notify(title, message, action, onAction)
+}
+
+func (f fallbackNotifier) notifyPersistent(title, message, action string, onAction func()) error {
+	if f.primary != nil {
+		err := notifyPersistent(f.primary, title, message, action, onAction)
+		if err == nil {
+			return nil
+		}
+		slog.Debug(fmt.Sprintf("falling back to balloon notification: %s", err))
+	}
+	return notifyPersistent(f.fallback, title, message, action, onAction)
+}
+
+// sendCallback returns a func that signals ch without blocking
+func sendCallback(ch chan struct{}, name string) func() {
+	return func() {
+		select {
+		case ch <- struct{}{}:
+		// should not happen but in case not listening
+		default:
+			slog.Error("no listener on " + name)
+		}
+	}
+}
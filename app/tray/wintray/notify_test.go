@@ -0,0 +1,175 @@
+//go:build windows
+
+package wintray
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+)
+
+type recordingNotifier struct {
+	err      error
+	titles   []string
+	onAction func()
+}
+
+func (r *recordingNotifier) notify(title, message, action string, onAction func()) error {
+	r.titles = append(r.titles, title)
+	r.onAction = onAction
+	return r.err
+}
+
+func TestBalloonNotifierTruncates(t *testing.T) {
+	orig := shellNotifyIcon
+	t.Cleanup(func() { shellNotifyIcon = orig })
+	var title, message string
+	shellNotifyIcon = func(_ uint32, nid *notifyIconData) error {
+		title = windows.UTF16ToString(nid.InfoTitle[:])
+		message = windows.UTF16ToString(nid.Info[:])
+		assert.Zero(t, nid.InfoTitle[len(nid.InfoTitle)-1])
+		assert.Zero(t, nid.Info[len(nid.Info)-1])
+		return nil
+	}
+
+	tray := newTestTray()
+	require.NoError(t, balloonNotifier{tray}.notify(strings.Repeat("t", 100), strings.Repeat("m", 1000), "", nil))
+	assert.Len(t, title, 63)
+	assert.Len(t, message, 255)
+
+	require.NoError(t, balloonNotifier{tray}.notify("Update", "Fixes a bug", "", nil))
+	assert.Equal(t, "Update", title)
+	assert.Equal(t, "Fixes a bug", message, "nothing is left of the longer message")
+}
+
+func TestFallbackNotifier(t *testing.T) {
+	t.Run("toast succeeds", func(t *testing.T) {
+		toast := &recordingNotifier{}
+		balloon := &recordingNotifier{}
+		n := fallbackNotifier{primary: toast, fallback: balloon}
+		require.NoError(t, n.notify("title", "message", "action", nil))
+		assert.Equal(t, []string{"title"}, toast.titles)
+		assert.Empty(t, balloon.titles)
+	})
+
+	t.Run("toast unavailable", func(t *testing.T) {
+		toast := &recordingNotifier{err: errors.New("no toasts")}
+		balloon := &recordingNotifier{}
+		n := fallbackNotifier{primary: toast, fallback: balloon}
+		require.NoError(t, n.notify("title", "message", "action", nil))
+		assert.Equal(t, []string{"title"}, balloon.titles)
+	})
+
+	t.Run("action maps to callback", func(t *testing.T) {
+		toast := &recordingNotifier{}
+		update := make(chan struct{}, 1)
+		n := fallbackNotifier{primary: toast, fallback: &recordingNotifier{}}
+		require.NoError(t, n.notify("title", "message", "action", sendCallback(update, "Update")))
+		toast.onAction()
+		assert.Len(t, update, 1)
+	})
+}
+
+func TestToastXML(t *testing.T) {
+	xml := toastXML("Update <available>", "Ollama & friends", "Install")
+	assert.Contains(t, xml, "Update &lt;available&gt;")
+	assert.Contains(t, xml, "Ollama &amp; friends")
+	assert.Contains(t, xml, `<action content="Install"`)
+	assert.NotContains(t, toastXML("t", "m", ""), "<actions>")
+	assert.NotContains(t, xml, "scenario")
+	assert.Contains(t, scenarioToastXML("t", "m", "Install", "reminder"), `<toast launch="action" scenario="reminder">`)
+}
+
+func TestFallbackNotifierPersistent(t *testing.T) {
+	// Balloons can't persist, so they're shown as usual
+	balloon := &recordingNotifier{}
+	n := fallbackNotifier{primary: &recordingNotifier{err: errors.New("no toasts")}, fallback: balloon}
+	require.NoError(t, notifyPersistent(n, "required", "message", "Install", nil))
+	assert.Equal(t, []string{"required"}, balloon.titles)
+}
+
+type fakeNotificationState struct {
+	state int32
+	err   error
+}
+
+func (f *fakeNotificationState) notificationState() (int32, error) {
+	return f.state, f.err
+}
+
+func TestSuppressNotification(t *testing.T) {
+	for _, state := range []int32{QUNS_BUSY, QUNS_RUNNING_D3D_FULL_SCREEN, QUNS_PRESENTATION_MODE, QUNS_QUIET_TIME} {
+		assert.True(t, suppressNotification(state, false), "state %d", state)
+		assert.False(t, suppressNotification(state, true), "critical in state %d", state)
+	}
+	for _, state := range []int32{QUNS_NOT_PRESENT, QUNS_ACCEPTS_NOTIFICATIONS, QUNS_APP} {
+		assert.False(t, suppressNotification(state, false), "state %d", state)
+	}
+}
+
+func TestQuietNotifier(t *testing.T) {
+	t.Setenv("OLLAMA_NOTIFY_WHEN_BUSY", "")
+	quietRetryInterval = time.Hour
+	defer func() { quietRetryInterval = time.Minute }()
+
+	next := &recordingNotifier{}
+	state := &fakeNotificationState{state: QUNS_RUNNING_D3D_FULL_SCREEN}
+	q := &quietNotifier{next: next, state: state}
+
+	require.NoError(t, q.notify("update", "message", "", nil))
+	require.NoError(t, q.notify("update", "newer message", "", nil))
+	assert.Empty(t, next.titles)
+
+	require.NoError(t, q.notifyCritical("failed", "message", "", nil))
+	assert.Equal(t, []string{"failed"}, next.titles)
+
+	state.state = QUNS_ACCEPTS_NOTIFICATIONS
+	require.NoError(t, q.notify("upgraded", "message", "", nil))
+	assert.Equal(t, []string{"failed", "update", "upgraded"}, next.titles)
+
+	t.Run("query fails", func(t *testing.T) {
+		next := &recordingNotifier{}
+		q := &quietNotifier{next: next, state: &fakeNotificationState{err: errors.New("boom")}}
+		require.NoError(t, q.notify("update", "message", "", nil))
+		assert.Equal(t, []string{"update"}, next.titles)
+	})
+
+	t.Run("opted out", func(t *testing.T) {
+		t.Setenv("OLLAMA_NOTIFY_WHEN_BUSY", "1")
+		next := &recordingNotifier{}
+		q := &quietNotifier{next: next, state: &fakeNotificationState{state: QUNS_PRESENTATION_MODE}}
+		require.NoError(t, q.notify("update", "message", "", nil))
+		assert.Equal(t, []string{"update"}, next.titles)
+	})
+}
+
+func TestQuietHoursNotifier(t *testing.T) {
+	t.Setenv("OLLAMA_NOTIFY_WHEN_BUSY", "")
+	quietRetryInterval = time.Hour
+	defer func() { quietRetryInterval = time.Minute }()
+
+	next := &recordingNotifier{}
+	q := &quietNotifier{next: next, state: &fakeNotificationState{state: QUNS_ACCEPTS_NOTIFICATIONS}}
+	quiet := true
+	q.setQuietHours(func(time.Time) bool { return quiet })
+
+	require.NoError(t, q.notify("update", "message", "", nil))
+	require.NoError(t, q.notify("upgraded", "message", "", nil))
+	assert.Empty(t, next.titles)
+
+	// Errors still get through, without releasing what's held
+	require.NoError(t, q.notifyCritical("failed", "message", "", nil))
+	assert.Equal(t, []string{"failed"}, next.titles)
+
+	// Only the most recent is shown once quiet hours end
+	quiet = false
+	q.flush()
+	assert.Equal(t, []string{"failed", "upgraded"}, next.titles)
+	q.flush()
+	assert.Equal(t, []string{"failed", "upgraded"}, next.titles)
+}
@@ -3,11 +3,20 @@
 package wintray
 
 import (
-	"unsafe"
+	"fmt"
+	"log/slog"
+	"time"
 
 	"golang.org/x/sys/windows"
 )
 
+var (
+	// At login the app can start before the shell's notification area is
+	// ready, so adding the icon is retried, doubling the delay each time
+	nidAddAttempts     = 6
+	nidAddInitialDelay = 250 * time.Millisecond
+)
+
 // Contains information that the system needs to display notifications in the notification area.
 // Used by Shell_NotifyIcon.
 // https://msdn.microsoft.com/en-us/library/windows/desktop/bb773352(v=vs.85).aspx
@@ -31,36 +40,36 @@ type notifyIconData struct {
 
 func (nid *notifyIconData) add() error {
 	const NIM_ADD = 0x00000000
-	res, _, err := pShellNotifyIcon.Call(
-		uintptr(NIM_ADD),
-		uintptr(unsafe.Pointer(nid)),
-	)
-	if res == 0 {
-		return err
+	return shellNotifyIcon(NIM_ADD, nid)
+}
+
+// addWithRetry calls add until it succeeds, backing off between failed
+// attempts. Nothing is held while it sleeps, so add takes any locks itself.
+func addWithRetry(add func() error) error {
+	delay := nidAddInitialDelay
+	for attempt := 1; ; attempt++ {
+		err := add()
+		if err == nil {
+			if attempt > 1 {
+				slog.Info(fmt.Sprintf("added tray icon on attempt %d", attempt))
+			}
+			return nil
+		}
+		if attempt >= nidAddAttempts {
+			return fmt.Errorf("unable to add tray icon after %d attempts: %w", attempt, err)
+		}
+		slog.Warn(fmt.Sprintf("tray icon add attempt %d failed, retrying in %s: %s", attempt, delay, err))
+		time.Sleep(delay)
+		delay *= 2
 	}
-	return nil
 }
 
 func (nid *notifyIconData) modify() error {
 	const NIM_MODIFY = 0x00000001
-	res, _, err := pShellNotifyIcon.Call(
-		uintptr(NIM_MODIFY),
-		uintptr(unsafe.Pointer(nid)),
-	)
-	if res == 0 {
-		return err
-	}
-	return nil
+	return shellNotifyIcon(NIM_MODIFY, nid)
 }
 
 func (nid *notifyIconData) delete() error {
 	const NIM_DELETE = 0x00000002
-	res, _, err := pShellNotifyIcon.Call(
-		uintptr(NIM_DELETE),
-		uintptr(unsafe.Pointer(nid)),
-	)
-	if res == 0 {
-		return err
-	}
-	return nil
+	return shellNotifyIcon(NIM_DELETE, nid)
 }
@@ -0,0 +1,104 @@
+//go:build windows
+
+package wintray
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+
+	"github.com/jmorganca/ollama/app/tray/commontray"
+)
+
+func stubNIDAdd(t *testing.T, failures int) *int {
+	t.Helper()
+	origNotify, origDelay := shellNotifyIcon, nidAddInitialDelay
+	t.Cleanup(func() { shellNotifyIcon, nidAddInitialDelay = origNotify, origDelay })
+	nidAddInitialDelay = time.Millisecond
+
+	calls := 0
+	shellNotifyIcon = func(message uint32, _ *notifyIconData) error {
+		assert.Equal(t, uint32(0), message, "expected NIM_ADD")
+		calls++
+		if calls <= failures {
+			return errors.New("the notification area isn't ready")
+		}
+		return nil
+	}
+	return &calls
+}
+
+func TestNIDAddWithRetry(t *testing.T) {
+	calls := stubNIDAdd(t, 2)
+	nid := &notifyIconData{}
+	require.NoError(t, addWithRetry(nid.add))
+	assert.Equal(t, 3, *calls)
+
+	calls = stubNIDAdd(t, nidAddAttempts)
+	err := addWithRetry(nid.add)
+	assert.ErrorContains(t, err, "after 6 attempts")
+	assert.Equal(t, nidAddAttempts, *calls)
+}
+
+func TestTaskbarCreatedRetriesAdd(t *testing.T) {
+	stubNIDAdd(t, 1)
+	nidAddInitialDelay = time.Hour
+	tray := newTestTray()
+	tray.wmTaskbarCreated = 0xC0DE
+
+	// The retry waits in the background, without holding muNID
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tray.wndProc(tray.window, tray.wmTaskbarCreated, 0, 0)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message loop waited for the icon to be added")
+	}
+	assert.Eventually(t, func() bool { return tray.Diagnose().LastAddError != "" }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, tray.Diagnose().IconAdded)
+
+	// Once the shell is ready the icon is back
+	stubNIDAdd(t, 1)
+	tray = newTestTray()
+	tray.wmTaskbarCreated = 0xC0DE
+	tray.wndProc(tray.window, tray.wmTaskbarCreated, 0, 0)
+	assert.Eventually(t, func() bool { return tray.Diagnose().IconAdded }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "the notification area isn't ready", tray.Diagnose().LastAddError)
+}
+
+func TestDiagnose(t *testing.T) {
+	orig := findWindow
+	t.Cleanup(func() { findWindow = orig })
+	shellRunning := false
+	findWindow = func(className string) bool {
+		assert.Equal(t, shellTrayClassName, className)
+		return shellRunning
+	}
+
+	stubNIDAdd(t, nidAddAttempts)
+	tray := newTestTray()
+	require.Error(t, tray.addIcon())
+	d := tray.Diagnose()
+	assert.Equal(t, commontray.TrayDiagnosis{
+		Supported:     true,
+		WindowCreated: true,
+		LastAddError:  "the notification area isn't ready",
+	}, d)
+
+	// Explorer restarting adds the icon again
+	shellRunning = true
+	stubNIDAdd(t, 0)
+	tray.nid.Icon = windows.Handle(7)
+	tray.wmTaskbarCreated = 0xC0DE
+	tray.wndProc(tray.window, tray.wmTaskbarCreated, 0, 0)
+	assert.Eventually(t, func() bool { return tray.Diagnose().Healthy() }, 5*time.Second, 10*time.Millisecond)
+	d = tray.Diagnose()
+	assert.Equal(t, "the notification area isn't ready", d.LastAddError)
+}
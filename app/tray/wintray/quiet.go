@@ -0,0 +1,217 @@
+//go:build windows
+
+package wintray
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// QUERY_USER_NOTIFICATION_STATE values
+// https://learn.microsoft.com/en-us/windows/win32/api/shellapi/ne-shellapi-query_user_notification_state
+const (
+	QUNS_NOT_PRESENT             = 1
+	QUNS_BUSY                    = 2
+	QUNS_RUNNING_D3D_FULL_SCREEN = 3
+	QUNS_ACCEPTS_NOTIFICATIONS   = 5
+	QUNS_QUIET_TIME              = 6
+	QUNS_APP                     = 7
+)
+
+// How often queued notifications are retried while the user is busy
+var quietRetryInterval = time.Minute
+
+// notificationStateQuerier reports the user's QUERY_USER_NOTIFICATION_STATE
+type notificationStateQuerier interface {
+	notificationState() (int32, error)
+}
+
+type shellNotificationState struct{}
+
+// https://learn.microsoft.com/en-us/windows/win32/api/shellapi/nf-shellapi-shqueryusernotificationstate
+func (shellNotificationState) notificationState() (int32, error) {
+	var state int32
+	res, _, _ := pSHQueryUserNotificationState.Call(uintptr(unsafe.Pointer(&state)))
+	if res != 0 { // S_OK
+		return 0, fmt.Errorf("unable to query user notification state: 0x%x", res)
+	}
+	return state, nil
+}
+
+// suppressNotification reports whether a notification should wait because
+// the user is presenting, playing fullscreen, or otherwise asked not to be
+// disturbed. Critical notifications are never held back.
+func suppressNotification(state int32, critical bool) bool {
+	if critical {
+		return false
+	}
+	switch state {
+	case QUNS_BUSY, QUNS_RUNNING_D3D_FULL_SCREEN, QUNS_PRESENTATION_MODE, QUNS_QUIET_TIME:
+		return true
+	}
+	return false
+}
+
+type queuedNotification struct {
+	title, message, action string
+	onAction               func()
+}
+
+// quietNotifier holds back non-critical notifications while the user is busy
+// and shows them once they're available again. Setting
+// OLLAMA_NOTIFY_WHEN_BUSY shows them straight away. During quiet hours only
+// the most recent is kept, and shown once they end.
+type quietNotifier struct {
+	next  notifier
+	state notificationStateQuerier
+
+	mu         sync.Mutex
+	queued     []queuedNotification
+	retrying   bool
+	quietHours func(time.Time) bool
+	held       *queuedNotification
+}
+
+func newQuietNotifier(next notifier) *quietNotifier {
+	return &quietNotifier{next: next, state: shellNotificationState{}}
+}
+
+func (q *quietNotifier) notify(title, message, action string, onAction func()) error {
+	return q.send(queuedNotification{title, message, action, onAction}, false)
+}
+
+// notifyCritical shows a notification regardless of the user's state
+func (q *quietNotifier) notifyCritical(title, message, action string, onAction func()) error {
+	return q.send(queuedNotification{title, message, action, onAction}, true)
+}
+
+// notifyPersistent shows a notification that stays until it's acted on,
+// regardless of the user's state
+func (q *quietNotifier) notifyPersistent(title, message, action string, onAction func()) error {
+	q.flushIfAvailable()
+	return notifyPersistent(q.next, title, message, action, onAction)
+}
+
+func (q *quietNotifier) setQuietHours(quiet func(time.Time) bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.quietHours = quiet
+}
+
+func (q *quietNotifier) send(n queuedNotification, critical bool) error {
+	q.mu.Lock()
+	if !critical && q.quiet() {
+		q.hold(n)
+		q.mu.Unlock()
+		return nil
+	}
+	if q.busy(critical) {
+		q.queue(n)
+		q.mu.Unlock()
+		return nil
+	}
+	q.mu.Unlock()
+	q.flushIfAvailable()
+	return q.next.notify(n.title, n.message, n.action, n.onAction)
+}
+
+// flushIfAvailable shows the queued notifications ahead of a new one, unless
+// the user is busy. Critical notifications skip the queue rather than
+// draining it.
+func (q *quietNotifier) flushIfAvailable() {
+	q.mu.Lock()
+	busy := q.busy(false)
+	q.mu.Unlock()
+	if !busy {
+		q.flush()
+	}
+}
+
+// busy reports whether a notification should be held back, lock must be held
+func (q *quietNotifier) busy(critical bool) bool {
+	if critical || os.Getenv("OLLAMA_NOTIFY_WHEN_BUSY") != "" {
+		return false
+	}
+	state, err := q.state.notificationState()
+	if err != nil {
+		slog.Debug(err.Error())
+		return false
+	}
+	return suppressNotification(state, false)
+}
+
+// quiet reports whether it's quiet hours, lock must be held
+func (q *quietNotifier) quiet() bool {
+	return q.quietHours != nil && q.quietHours(time.Now())
+}
+
+// hold keeps n, replacing any older notification, until quiet hours end.
+// Lock must be held.
+func (q *quietNotifier) hold(n queuedNotification) {
+	slog.Debug(fmt.Sprintf("quiet hours, holding notification %q", n.title))
+	q.held = &n
+	q.startRetry()
+}
+
+// queue holds n until the user is available, replacing an older
+// notification with the same title. Lock must be held.
+func (q *quietNotifier) queue(n queuedNotification) {
+	slog.Debug(fmt.Sprintf("user is busy, holding notification %q", n.title))
+	for i := range q.queued {
+		if q.queued[i].title == n.title {
+			q.queued[i] = n
+			return
+		}
+	}
+	q.queued = append(q.queued, n)
+	q.startRetry()
+}
+
+// startRetry starts flushing held notifications in the background, lock
+// must be held
+func (q *quietNotifier) startRetry() {
+	if !q.retrying {
+		q.retrying = true
+		go q.retry(quietRetryInterval)
+	}
+}
+
+// retry periodically flushes the queue until it's empty
+func (q *quietNotifier) retry(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		q.mu.Lock()
+		if q.quiet() || q.busy(false) {
+			q.mu.Unlock()
+			continue
+		}
+		q.retrying = false
+		q.mu.Unlock()
+		q.flush()
+		return
+	}
+}
+
+// flush shows any queued notifications, unless it's quiet hours
+func (q *quietNotifier) flush() {
+	q.mu.Lock()
+	if q.quiet() {
+		q.mu.Unlock()
+		return
+	}
+	queued := q.queued
+	if q.held != nil {
+		queued = append(queued, *q.held)
+	}
+	q.queued, q.held = nil, nil
+	q.mu.Unlock()
+	for _, n := range queued {
+		if err := q.next.notify(n.title, n.message, n.action, n.onAction); err != nil {
+			slog.Warn(fmt.Sprintf("failed to show queued notification: %s", err))
+		}
+	}
+}
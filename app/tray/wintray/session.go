@@ -0,0 +1,75 @@
+//go:build windows
+
+package wintray
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const (
+	NOTIFY_FOR_THIS_SESSION = 0
+	WTS_SESSION_LOCK        = 0x7
+	WTS_SESSION_UNLOCK      = 0x8
+	QUNS_PRESENTATION_MODE  = 4
+
+	PBT_APMRESUMEAUTOMATIC = 0x12
+)
+
+// Registers the tray window to receive WM_WTSSESSION_CHANGE notifications
+// https://learn.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsregistersessionnotification
+func (t *winTray) registerSessionNotification() error {
+	boolRet, _, err := pWTSRegisterSessionNotification.Call(
+		uintptr(t.window),
+		NOTIFY_FOR_THIS_SESSION,
+	)
+	if boolRet == 0 {
+		return fmt.Errorf("failed to register for session notifications: %w", err)
+	}
+	return nil
+}
+
+func (t *winTray) unregisterSessionNotification() error {
+	if err := wtsUnRegisterSessionNotification(t.window); err != nil {
+		return fmt.Errorf("failed to unregister session notifications: %w", err)
+	}
+	return nil
+}
+
+func (t *winTray) handleSessionChange(wParam uintptr) {
+	switch wParam {
+	case WTS_SESSION_LOCK:
+		slog.Debug("session locked")
+		t.session.SetLocked(true)
+	case WTS_SESSION_UNLOCK:
+		slog.Debug("session unlocked")
+		t.session.SetLocked(false)
+	}
+}
+
+// handlePowerBroadcast tells the app when the system wakes from sleep.
+// PBT_APMRESUMEAUTOMATIC is sent on every resume, whether or not the user
+// woke it.
+func (t *winTray) handlePowerBroadcast(wParam uintptr) {
+	if wParam != PBT_APMRESUMEAUTOMATIC {
+		return
+	}
+	slog.Debug("system resumed")
+	sendCallback(t.callbacks.Resumed, "Resumed")()
+}
+
+// SessionActive reports whether the user is at an unlocked workstation and
+// not presenting, which is when it's acceptable to install updates
+func (t *winTray) SessionActive() bool {
+	t.session.SetPresenting(isPresenting())
+	return t.session.Active()
+}
+
+func isPresenting() bool {
+	state, err := shellNotificationState{}.notificationState()
+	if err != nil {
+		slog.Debug(err.Error())
+		return false
+	}
+	return state == QUNS_PRESENTATION_MODE
+}
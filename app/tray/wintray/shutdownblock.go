@@ -0,0 +1,80 @@
+//go:build windows
+
+package wintray
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// How often a held off log off checks whether the update is done
+var shutdownBlockPollInterval = time.Second
+
+// Set in WM_QUERYENDSESSION's lParam when an installer's Restart Manager is
+// closing the app rather than the session ending
+const ENDSESSION_CLOSEAPP = 0x1
+
+// SetUpdateBusy provides whether an update is downloading or an install is
+// being prepared, which holds off logging off or shutting down until it's
+// done
+func (t *winTray) SetUpdateBusy(busy func() bool) {
+	t.muShutdownBlock.Lock()
+	defer t.muShutdownBlock.Unlock()
+	t.updateBusy = busy
+}
+
+// queryEndSession answers WM_QUERYENDSESSION, returning FALSE with a reason
+// Windows shows the user while an update is underway. The block is
+// released once the update is done. An installer closing the app, our own
+// included, is always let through.
+// https://learn.microsoft.com/en-us/windows/win32/shutdown/wm-queryendsession
+func (t *winTray) queryEndSession(lParam uintptr) uintptr {
+	if lParam&ENDSESSION_CLOSEAPP != 0 {
+		slog.Debug("an installer is closing the app")
+		return 1 // TRUE
+	}
+	t.muShutdownBlock.Lock()
+	defer t.muShutdownBlock.Unlock()
+	if t.updateBusy == nil || !t.updateBusy() {
+		return 1 // TRUE
+	}
+	if !t.shutdownBlocked {
+		slog.Info("update in progress, asking Windows to wait before ending the session")
+		if err := shutdownBlockReasonCreate(t.window, shutdownBlockReason); err != nil {
+			slog.Warn(fmt.Sprintf("failed to set shutdown block reason: %s", err))
+		}
+		t.shutdownBlocked = true
+		go t.releaseShutdownBlock(shutdownBlockPollInterval)
+	}
+	return 0 // FALSE
+}
+
+// releaseShutdownBlock waits for the update to finish, then lets the
+// session end again
+func (t *winTray) releaseShutdownBlock(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		t.muShutdownBlock.Lock()
+		if t.shutdownBlocked && t.updateBusy() {
+			t.muShutdownBlock.Unlock()
+			continue
+		}
+		t.clearShutdownBlock()
+		t.muShutdownBlock.Unlock()
+		return
+	}
+}
+
+// clearShutdownBlock removes the shutdown block reason, if set. Lock must be
+// held.
+func (t *winTray) clearShutdownBlock() {
+	if !t.shutdownBlocked {
+		return
+	}
+	t.shutdownBlocked = false
+	if err := shutdownBlockReasonDestroy(t.window); err != nil {
+		slog.Warn(fmt.Sprintf("failed to clear shutdown block reason: %s", err))
+	}
+	slog.Info("update finished, no longer holding off the session ending")
+}
@@ -0,0 +1,118 @@
+//go:build windows
+
+package wintray
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-msg
+type msg struct {
+	WindowHandle windows.Handle
+	Message      uint32
+	Wparam       uintptr
+	Lparam       uintptr
+	Time         uint32
+	Pt           point
+	LPrivate     uint32
+}
+
+// Win32 calls made by the message loop and while handling window messages.
+// They are variables so tests can exercise wndProc without a real window.
+var (
+	getMessage = func(m *msg) (int32, error) {
+		ret, _, err := pGetMessage.Call(uintptr(unsafe.Pointer(m)), 0, 0, 0)
+		return int32(ret), err
+	}
+	translateMessage = func(m *msg) {
+		pTranslateMessage.Call(uintptr(unsafe.Pointer(m))) //nolint:errcheck
+	}
+	dispatchMessage = func(m *msg) {
+		pDispatchMessage.Call(uintptr(unsafe.Pointer(m))) //nolint:errcheck
+	}
+	defWindowProc = func(hWnd windows.Handle, message uint32, wParam, lParam uintptr) uintptr {
+		lResult, _, _ := pDefWindowProc.Call(uintptr(hWnd), uintptr(message), wParam, lParam)
+		return lResult
+	}
+	destroyWindow = func(hWnd windows.Handle) error {
+		boolRet, _, err := pDestroyWindow.Call(uintptr(hWnd))
+		if boolRet == 0 {
+			return err
+		}
+		return nil
+	}
+	postMessage = func(hWnd windows.Handle, message uint32, wParam, lParam uintptr) error {
+		boolRet, _, err := pPostMessage.Call(uintptr(hWnd), uintptr(message), wParam, lParam)
+		if boolRet == 0 {
+			return err
+		}
+		return nil
+	}
+	postQuitMessage = func(exitCode int32) {
+		pPostQuitMessage.Call(uintptr(exitCode)) //nolint:errcheck
+	}
+	shellNotifyIcon = func(message uint32, nid *notifyIconData) error {
+		res, _, err := pShellNotifyIcon.Call(uintptr(message), uintptr(unsafe.Pointer(nid)))
+		if res == 0 {
+			return err
+		}
+		return nil
+	}
+	unregisterClass = func(className *uint16, instance windows.Handle) error {
+		res, _, err := pUnregisterClass.Call(uintptr(unsafe.Pointer(className)), uintptr(instance))
+		if res == 0 {
+			return err
+		}
+		return nil
+	}
+	wtsUnRegisterSessionNotification = func(hWnd windows.Handle) error {
+		boolRet, _, err := pWTSUnRegisterSessionNotification.Call(uintptr(hWnd))
+		if boolRet == 0 {
+			return err
+		}
+		return nil
+	}
+	// https://learn.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-shutdownblockreasoncreate
+	shutdownBlockReasonCreate = func(hWnd windows.Handle, reason string) error {
+		reasonPtr, err := windows.UTF16PtrFromString(reason)
+		if err != nil {
+			return err
+		}
+		boolRet, _, err := pShutdownBlockReasonCreate.Call(uintptr(hWnd), uintptr(unsafe.Pointer(reasonPtr)))
+		if boolRet == 0 {
+			return err
+		}
+		return nil
+	}
+	shutdownBlockReasonDestroy = func(hWnd windows.Handle) error {
+		boolRet, _, err := pShutdownBlockReasonDestroy.Call(uintptr(hWnd))
+		if boolRet == 0 {
+			return err
+		}
+		return nil
+	}
+	// findWindow reports whether a top-level window of className exists
+	findWindow = func(className string) bool {
+		classNamePtr, err := windows.UTF16PtrFromString(className)
+		if err != nil {
+			return false
+		}
+		hWnd, _, _ := pFindWindow.Call(uintptr(unsafe.Pointer(classNamePtr)), 0)
+		return hWnd != 0
+	}
+	// messageBox shows a modal dialog and returns the ID of the button pressed
+	messageBox = func(hWnd windows.Handle, text, caption string, flags uint32) int32 {
+		textPtr, err := windows.UTF16PtrFromString(text)
+		if err != nil {
+			return 0
+		}
+		captionPtr, err := windows.UTF16PtrFromString(caption)
+		if err != nil {
+			return 0
+		}
+		ret, _, _ := pMessageBox.Call(uintptr(hWnd), uintptr(unsafe.Pointer(textPtr)), uintptr(unsafe.Pointer(captionPtr)), uintptr(flags))
+		return int32(ret)
+	}
+)
@@ -0,0 +1,162 @@
+//go:build windows
+
+package wintray
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// AppUserModelID identifies the app to the notification platform and
+// taskbar. The installer sets the same ID on the Start menu shortcut, which
+// toasts need.
+const AppUserModelID = "com.ollama.ollama"
+
+// How long to wait for the toast to be shown before falling back
+var toastShowTimeout = 10 * time.Second
+
+// How long a toast remains actionable
+var toastActivationTimeout = 5 * time.Minute
+
+// toastNotifier shows Windows 10+ toast notifications through the WinRT
+// ToastNotificationManager. PowerShell hosts the WinRT projection so we don't
+// need COM activation plumbing in the tray.
+type toastNotifier struct{}
+
+// Attributes this process's notifications and taskbar grouping to Ollama.
+// https://learn.microsoft.com/en-us/windows/win32/api/shobjidl_core/nf-shobjidl_core-setcurrentprocessexplicitappusermodelid
+func setAppUserModelID() {
+	if err := pSetCurrentProcessExplicitAppUserModelID.Find(); err != nil {
+		slog.Debug(fmt.Sprintf("unable to set app user model ID: %s", err))
+		return
+	}
+	idPtr, err := windows.UTF16PtrFromString(AppUserModelID)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("unable to set app user model ID: %s", err))
+		return
+	}
+	res, _, _ := pSetCurrentProcessExplicitAppUserModelID.Call(uintptr(unsafe.Pointer(idPtr)))
+	if res != 0 { // S_OK
+		slog.Warn(fmt.Sprintf("failed to set app user model ID: 0x%x", res))
+	}
+}
+
+// toastsAvailable reports whether toasts are enabled and supported
+func toastsAvailable() bool {
+	if os.Getenv("OLLAMA_TOAST_NOTIFICATIONS") == "" {
+		return false
+	}
+	return windows.RtlGetVersion().MajorVersion >= 10
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s)) //nolint:errcheck
+	return b.String()
+}
+
+func toastXML(title, message, action string) string {
+	return scenarioToastXML(title, message, action, "")
+}
+
+// scenarioToastXML sets the toast's scenario, where "reminder" keeps it on
+// screen until the user acts on it
+// https://learn.microsoft.com/en-us/windows/apps/design/shell/tiles-and-notifications/toast-schema#toastscenario
+func scenarioToastXML(title, message, action, scenario string) string {
+	var actions, attrs string
+	if action != "" {
+		actions = fmt.Sprintf(`<actions><action content="%s" arguments="action" activationType="foreground"/></actions>`, xmlEscape(action))
+	}
+	if scenario != "" {
+		attrs = fmt.Sprintf(` scenario="%s"`, xmlEscape(scenario))
+	}
+	return fmt.Sprintf(`<toast launch="action"%s><visual><binding template="ToastGeneric"><text>%s</text><text>%s</text></binding></visual>%s</toast>`,
+		attrs, xmlEscape(title), xmlEscape(message), actions)
+}
+
+const toastScript = `$ErrorActionPreference = 'Stop'
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null
+$xml = New-Object Windows.Data.Xml.Dom.XmlDocument
+$xml.LoadXml('%s')
+$toast = New-Object Windows.UI.Notifications.ToastNotification $xml
+Register-ObjectEvent -InputObject $toast -EventName Activated -SourceIdentifier OllamaToast | Out-Null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('%s').Show($toast)
+Write-Output 'shown'
+if (Wait-Event -SourceIdentifier OllamaToast -Timeout %d) { Write-Output 'activated' }
+`
+
+func (t toastNotifier) notify(title, message, action string, onAction func()) error {
+	return t.show(toastXML(title, message, action), onAction)
+}
+
+// notifyPersistent shows a reminder toast, which stays until it's acted on
+func (t toastNotifier) notifyPersistent(title, message, action string, onAction func()) error {
+	return t.show(scenarioToastXML(title, message, action, "reminder"), onAction)
+}
+
+func (toastNotifier) show(toast string, onAction func()) error {
+	powershell, err := exec.LookPath("powershell")
+	if err != nil {
+		return err
+	}
+	// Single quotes are the only thing that needs escaping in a PowerShell literal
+	script := fmt.Sprintf(toastScript,
+		strings.ReplaceAll(toast, "'", "''"),
+		AppUserModelID,
+		int(toastActivationTimeout.Seconds()),
+	)
+	cmd := exec.Command(powershell, "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: 0x08000000}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start toast notification: %w", err)
+	}
+
+	shown := make(chan bool, 1)
+	go func() {
+		defer cmd.Wait() //nolint:errcheck
+		scanner := bufio.NewScanner(stdout)
+		reported := false
+		for scanner.Scan() {
+			switch strings.TrimSpace(scanner.Text()) {
+			case "shown":
+				reported = true
+				shown <- true
+			case "activated":
+				if onAction != nil {
+					onAction()
+				}
+			}
+		}
+		if !reported {
+			shown <- false
+		}
+	}()
+
+	select {
+	case ok := <-shown:
+		if !ok {
+			return fmt.Errorf("toast notification failed to display")
+		}
+		slog.Debug("displayed toast notification")
+		return nil
+	case <-time.After(toastShowTimeout):
+		cmd.Process.Kill() //nolint:errcheck
+		return fmt.Errorf("timed out displaying toast notification")
+	}
+}
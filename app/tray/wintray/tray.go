@@ -11,9 +11,12 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/jmorganca/ollama/app/tray/commontray"
+	"github.com/jmorganca/ollama/version"
 	"golang.org/x/sys/windows"
 )
 
@@ -46,16 +49,63 @@ type winTray struct {
 	nid   *notifyIconData
 	muNID sync.RWMutex
 	wcex  *wndClassEx
+	// balloonAction runs when the last balloon is clicked, guarded by muNID
+	balloonAction func()
+	// Whether the icon is in the notification area and why adding it last
+	// failed, guarded by muNID
+	iconAdded  bool
+	lastAddErr error
+	// Set while the icon is being added again after Explorer restarted
+	readdingIcon atomic.Bool
 
 	wmSystrayMessage,
 	wmTaskbarCreated uint32
 
-	pendingUpdate  bool
-	updateNotified bool // Only pop up the notification once - TODO consider daily nag?
+	// Set by the updater and the menu refresh alike, guarded by
+	// muPendingUpdate
+	pendingUpdate   bool
+	updateNotified  bool // Only pop up the notification once - TODO consider daily nag?
+	muPendingUpdate sync.Mutex
+	session         commontray.SessionState
+
+	// Set once updates are permanently disabled, hiding all update UI
+	updatesDisabled atomic.Bool
+
+	// Set once shutdown starts, after which messages are ignored
+	closing atomic.Bool
+
+	rollbackVersions []string
+	muRollback       sync.Mutex
+
+	modelLister func() ([]string, string)
+	models      []string
+	muModels    sync.Mutex
+	// The last model list, refreshed in the background, guarded by muModels
+	cachedModels        []string
+	cachedActive        string
+	modelRefresh        chan struct{}
+	startModelRefreshes sync.Once
+
+	updateState   func() commontray.UpdateState
+	muUpdateState sync.Mutex
+
+	// notifier holds back non-critical notifications while the user is busy
+	notifier *quietNotifier
+
+	// Whether an update is underway, which holds off the session ending
+	updateBusy      func() bool
+	shutdownBlocked bool
+	muShutdownBlock sync.Mutex
+
 	// Callbacks
 	callbacks  commontray.Callbacks
 	normalIcon []byte
 	updateIcon []byte
+
+	// warningIcon is shown while the server isn't answering
+	warningIcon []byte
+	status      commontray.TrayStatus
+	muStatus    sync.Mutex
 }
 
 var wt winTray
@@ -64,13 +114,38 @@ func (t *winTray) GetCallbacks() commontray.Callbacks {
 	return t.callbacks
 }
 
-func InitTray(icon, updateIcon []byte) (*winTray, error) {
+func InitTray(icon, updateIcon, warningIcon []byte) (*winTray, error) {
 	wt.callbacks.Quit = make(chan struct{})
 	wt.callbacks.Update = make(chan struct{})
 	wt.callbacks.ShowLogs = make(chan struct{})
 	wt.callbacks.DoFirstUse = make(chan struct{})
+	wt.callbacks.RestartServer = make(chan struct{})
+	wt.callbacks.Rollback = make(chan string)
+	wt.callbacks.ReportIssue = make(chan struct{})
+	wt.callbacks.CheckUpdates = make(chan struct{})
+	wt.callbacks.CopyDiagnostics = make(chan struct{})
+	wt.callbacks.SetActiveModel = make(chan string)
+	wt.callbacks.CopyVersion = make(chan struct{})
+	wt.callbacks.UpdateDeclined = make(chan struct{})
+	wt.callbacks.ShowReleaseNotes = make(chan struct{})
+	wt.callbacks.DisableUpdates = make(chan struct{})
+	wt.callbacks.CopyUpdateURLs = make(chan struct{})
+	wt.callbacks.PinVersion = make(chan struct{})
+	wt.callbacks.Resumed = make(chan struct{})
+	wt.callbacks.SaveDiagnostics = make(chan struct{})
+	wt.callbacks.SetUpdateMode = make(chan commontray.UpdateMode)
+	wt.callbacks.PauseDownload = make(chan struct{})
+	wt.callbacks.ResumeDownload = make(chan struct{})
+	wt.callbacks.DiagnoseTray = make(chan struct{})
+	wt.callbacks.RestartApp = make(chan struct{})
 	wt.normalIcon = icon
 	wt.updateIcon = updateIcon
+	wt.warningIcon = warningIcon
+	var n notifier = balloonNotifier{t: &wt}
+	if toastsAvailable() {
+		n = fallbackNotifier{primary: toastNotifier{}, fallback: n}
+	}
+	wt.notifier = newQuietNotifier(n)
 	if err := wt.initInstance(); err != nil {
 		return nil, fmt.Errorf("Unable to init instance: %w\n", err)
 	}
@@ -176,6 +251,8 @@ func (t *winTray) initInstance() error {
 	}
 	t.window = windows.Handle(windowHandle)
 
+	setAppUserModelID()
+
 	pShowWindow.Call(uintptr(t.window), uintptr(SW_HIDE)) //nolint:errcheck
 
 	boolRet, _, err := pUpdateWindow.Call(uintptr(t.window))
@@ -183,17 +260,23 @@ func (t *winTray) initInstance() error {
 		slog.Error(fmt.Sprintf("failed to update window: %s", err))
 	}
 
+	// Not fatal, we just won't be able to defer updates while locked
+	if err := t.registerSessionNotification(); err != nil {
+		slog.Warn(err.Error())
+	}
+
 	t.muNID.Lock()
-	defer t.muNID.Unlock()
 	t.nid = &notifyIconData{
 		Wnd:             windows.Handle(t.window),
 		ID:              100,
-		Flags:           NIF_MESSAGE,
+		Flags:           NIF_MESSAGE | NIF_TIP,
 		CallbackMessage: t.wmSystrayMessage,
 	}
+	copyNIDText(t.nid.Tip[:], defaultTooltip())
 	t.nid.Size = uint32(unsafe.Sizeof(*t.nid))
+	t.muNID.Unlock()
 
-	return t.nid.add()
+	return t.addIcon()
 }
 
 func (t *winTray) createMenu() error {
@@ -238,6 +321,16 @@ type menuItemInfo struct {
 }
 
 func (t *winTray) addOrUpdateMenuItem(menuItemId uint32, parentId uint32, title string, disabled bool) error {
+	var state uint32
+	if disabled {
+		state |= MFS_DISABLED
+	}
+	return t.addOrUpdateMenuItemState(menuItemId, parentId, title, state)
+}
+
+// addOrUpdateMenuItemState is addOrUpdateMenuItem with explicit MFS_* state
+// flags, such as MFS_CHECKED
+func (t *winTray) addOrUpdateMenuItemState(menuItemId uint32, parentId uint32, title string, state uint32) error {
 	titlePtr, err := windows.UTF16PtrFromString(title)
 	if err != nil {
 		return err
@@ -246,14 +339,12 @@ func (t *winTray) addOrUpdateMenuItem(menuItemId uint32, parentId uint32, title
 	mi := menuItemInfo{
 		Mask:     MIIM_FTYPE | MIIM_STRING | MIIM_ID | MIIM_STATE,
 		Type:     MFT_STRING,
+		State:    state,
 		ID:       uint32(menuItemId),
 		TypeData: titlePtr,
 		Cch:      uint32(len(title)),
 	}
 	mi.Size = uint32(unsafe.Sizeof(mi))
-	if disabled {
-		mi.State |= MFS_DISABLED
-	}
 
 	var res uintptr
 	t.muMenus.RLock()
@@ -301,6 +392,67 @@ func (t *winTray) addOrUpdateMenuItem(menuItemId uint32, parentId uint32, title
 	return nil
 }
 
+// Creates a submenu and the item in parentId that opens it. Items are added
+// to the submenu by passing menuItemId as their parentId.
+func (t *winTray) addSubMenu(menuItemId, parentId uint32, title string) error {
+	menuHandle, _, err := pCreatePopupMenu.Call()
+	if menuHandle == 0 {
+		return err
+	}
+	t.muMenus.Lock()
+	t.menus[menuItemId] = windows.Handle(menuHandle)
+	t.muMenus.Unlock()
+	return t.addOrUpdateMenuItem(menuItemId, parentId, title, false)
+}
+
+// clearSubMenu removes all the items from a submenu so it can be rebuilt
+func (t *winTray) clearSubMenu(parentId uint32) error {
+	t.muMenus.RLock()
+	menu := uintptr(t.menus[parentId])
+	t.muMenus.RUnlock()
+
+	t.muVisibleItems.Lock()
+	items := t.visibleItems[parentId]
+	delete(t.visibleItems, parentId)
+	t.muVisibleItems.Unlock()
+
+	for _, id := range items {
+		res, _, err := pDeleteMenu.Call(menu, uintptr(id), MF_BYCOMMAND)
+		if res == 0 {
+			return fmt.Errorf("failed to delete menu item %d: %w", id, err)
+		}
+		t.muMenuOf.Lock()
+		delete(t.menuOf, id)
+		t.muMenuOf.Unlock()
+	}
+	return nil
+}
+
+// removeMenuItem deletes an item from parentId, along with any submenu it
+// opens. Items that aren't shown are ignored.
+func (t *winTray) removeMenuItem(menuItemId, parentId uint32) error {
+	if t.getVisibleItemIndex(parentId, menuItemId) == -1 {
+		return nil
+	}
+	t.muMenus.Lock()
+	menu := uintptr(t.menus[parentId])
+	delete(t.menus, menuItemId)
+	t.muMenus.Unlock()
+
+	res, _, err := pDeleteMenu.Call(menu, uintptr(menuItemId), MF_BYCOMMAND)
+	if res == 0 {
+		return fmt.Errorf("failed to delete menu item %d: %w", menuItemId, err)
+	}
+	t.delFromVisibleItems(parentId, menuItemId)
+	t.muVisibleItems.Lock()
+	delete(t.visibleItems, menuItemId)
+	t.muVisibleItems.Unlock()
+	t.muMenuOf.Lock()
+	delete(t.menuOf, menuItemId)
+	t.muMenuOf.Unlock()
+	return nil
+}
+
 func (t *winTray) addSeparatorMenuItem(menuItemId, parentId uint32) error {
 
 	mi := menuItemInfo{
@@ -359,6 +511,15 @@ func (t *winTray) showMenu() error {
 		slog.Warn(fmt.Sprintf("failed to bring menu to foreground: %s", err))
 	}
 
+	if err := t.refreshModelsMenu(); err != nil {
+		slog.Warn(fmt.Sprintf("failed to refresh models menu: %s", err))
+	}
+	// Ready for next time, in case a model was pulled since
+	t.requestModelRefresh()
+	if err := t.refreshUpdateMenu(); err != nil {
+		slog.Warn(fmt.Sprintf("failed to refresh update menu: %s", err))
+	}
+
 	boolRet, _, err = pTrackPopupMenu.Call(
 		uintptr(t.menus[0]),
 		TPM_BOTTOMALIGN|TPM_LEFTALIGN,
@@ -423,6 +584,35 @@ func iconBytesToFilePath(iconBytes []byte) (string, error) {
 	return iconFilePath, nil
 }
 
+// defaultTooltip is shown when hovering over the tray icon
+func defaultTooltip() string {
+	return fmt.Sprintf("%s %s", commontray.ToolTip, version.Version)
+}
+
+// copyNIDText fills dst, one of notifyIconData's text fields, with text,
+// truncated to fit with the terminating NUL
+func copyNIDText(dst []uint16, text string) {
+	clear(dst)
+	copy(dst[:len(dst)-1], windows.StringToUTF16(text))
+}
+
+// setTooltip changes the text shown when hovering over the tray icon
+func (t *winTray) setTooltip(text string) error {
+	t.muNID.Lock()
+	defer t.muNID.Unlock()
+	copyNIDText(t.nid.Tip[:], text)
+	t.nid.Flags |= NIF_TIP
+	t.nid.Size = uint32(unsafe.Sizeof(*t.nid))
+	return t.nid.modify()
+}
+
+func (t *winTray) SetTooltip(text string) error {
+	if text == "" {
+		text = defaultTooltip()
+	}
+	return t.setTooltip(text)
+}
+
 // Loads an image from file and shows it in tray.
 // Shell_NotifyIcon: https://msdn.microsoft.com/en-us/library/windows/desktop/bb762159(v=vs.85).aspx
 func (t *winTray) setIcon(src string) error {
@@ -474,12 +664,40 @@ func (t *winTray) loadIconFrom(src string) (windows.Handle, error) {
 }
 
 func (t *winTray) DisplayFirstUseNotification() error {
-	t.muNID.Lock()
-	defer t.muNID.Unlock()
-	copy(t.nid.InfoTitle[:], windows.StringToUTF16(firstTimeTitle))
-	copy(t.nid.Info[:], windows.StringToUTF16(firstTimeMessage))
-	t.nid.Flags |= NIF_INFO
-	t.nid.Size = uint32(unsafe.Sizeof(*wt.nid))
+	return t.notifier.notify(firstTimeTitle, firstTimeMessage, firstTimeActionTitle,
+		sendCallback(t.callbacks.DoFirstUse, "DoFirstUse"))
+}
 
-	return t.nid.modify()
+func (t *winTray) DisplayUpToDateNotification() error {
+	return t.notifier.notify(upToDateTitle, upToDateMessage, "", nil)
+}
+
+func (t *winTray) DisplayUpgradedNotification(ver string) error {
+	return t.notifier.notify(upgradedTitle, fmt.Sprintf(upgradedMessage, ver), upgradedActionTitle,
+		sendCallback(t.callbacks.ShowReleaseNotes, "ShowReleaseNotes"))
+}
+
+func (t *winTray) DisplayServerFailedNotification() error {
+	return t.notifier.notifyCritical(serverFailedTitle, serverFailedMessage, serverFailedActionTitle,
+		sendCallback(t.callbacks.ShowLogs, "ShowLogs"))
+}
+
+func (t *winTray) DisplayPleaseWaitNotification() error {
+	return t.notifier.notify(pleaseWaitTitle, pleaseWaitMessage, "", nil)
+}
+
+func (t *winTray) DisplayNotification(title, message string) error {
+	return t.notifier.notify(title, message, "", nil)
+}
+
+func (t *winTray) DisplayErrorNotification(title, message string) error {
+	return t.notifier.notifyCritical(title, message, "", nil)
+}
+
+func (t *winTray) SetQuietHours(quiet func(time.Time) bool) {
+	t.notifier.setQuietHours(quiet)
+}
+
+func (t *winTray) DisplayRebootPendingNotification(ver string) error {
+	return t.notifier.notify(rebootPendingTitle, fmt.Sprintf(rebootPendingMessage, ver), "", nil)
 }
@@ -0,0 +1,40 @@
+//go:build windows
+
+package wintray
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestCopyNIDText(t *testing.T) {
+	var tip [128]uint16
+	copyNIDText(tip[:], "Ollama 0.1.30")
+	assert.Equal(t, "Ollama 0.1.30", windows.UTF16ToString(tip[:]))
+
+	copyNIDText(tip[:], strings.Repeat("x", 200))
+	assert.Len(t, windows.UTF16ToString(tip[:]), 127, "should truncate and keep the terminating NUL")
+
+	copyNIDText(tip[:], "short")
+	assert.Equal(t, "short", windows.UTF16ToString(tip[:]))
+	assert.Equal(t, make([]uint16, 128-5), tip[5:], "what's left of a longer text is cleared")
+}
+
+func TestSetTooltip(t *testing.T) {
+	orig := shellNotifyIcon
+	t.Cleanup(func() { shellNotifyIcon = orig })
+	var tips []string
+	shellNotifyIcon = func(message uint32, nid *notifyIconData) error {
+		assert.Equal(t, uint32(1), message, "expected NIM_MODIFY")
+		tips = append(tips, windows.UTF16ToString(nid.Tip[:]))
+		return nil
+	}
+
+	tray := newTestTray()
+	assert.NoError(t, tray.SetTooltip("Ollama — update check failed"))
+	assert.NoError(t, tray.SetTooltip(""))
+	assert.Equal(t, []string{"Ollama — update check failed", defaultTooltip()}, tips)
+}
@@ -12,12 +12,15 @@ var (
 	k32 = windows.NewLazySystemDLL("Kernel32.dll")
 	u32 = windows.NewLazySystemDLL("User32.dll")
 	s32 = windows.NewLazySystemDLL("Shell32.dll")
+	wts = windows.NewLazySystemDLL("Wtsapi32.dll")
 
 	pCreatePopupMenu       = u32.NewProc("CreatePopupMenu")
 	pCreateWindowEx        = u32.NewProc("CreateWindowExW")
 	pDefWindowProc         = u32.NewProc("DefWindowProcW")
+	pDeleteMenu            = u32.NewProc("DeleteMenu")
 	pDestroyWindow         = u32.NewProc("DestroyWindow")
 	pDispatchMessage       = u32.NewProc("DispatchMessageW")
+	pFindWindow            = u32.NewProc("FindWindowW")
 	pGetCursorPos          = u32.NewProc("GetCursorPos")
 	pGetMessage            = u32.NewProc("GetMessageW")
 	pGetModuleHandle       = k32.NewProc("GetModuleHandleW")
@@ -25,6 +28,7 @@ var (
 	pLoadCursor            = u32.NewProc("LoadCursorW")
 	pLoadIcon              = u32.NewProc("LoadIconW")
 	pLoadImage             = u32.NewProc("LoadImageW")
+	pMessageBox            = u32.NewProc("MessageBoxW")
 	pPostMessage           = u32.NewProc("PostMessageW")
 	pPostQuitMessage       = u32.NewProc("PostQuitMessage")
 	pRegisterClass         = u32.NewProc("RegisterClassExW")
@@ -38,6 +42,14 @@ var (
 	pTranslateMessage      = u32.NewProc("TranslateMessage")
 	pUnregisterClass       = u32.NewProc("UnregisterClassW")
 	pUpdateWindow          = u32.NewProc("UpdateWindow")
+
+	pSetCurrentProcessExplicitAppUserModelID = s32.NewProc("SetCurrentProcessExplicitAppUserModelID")
+	pSHQueryUserNotificationState            = s32.NewProc("SHQueryUserNotificationState")
+	pWTSRegisterSessionNotification          = wts.NewProc("WTSRegisterSessionNotification")
+	pWTSUnRegisterSessionNotification        = wts.NewProc("WTSUnRegisterSessionNotification")
+
+	pShutdownBlockReasonCreate  = u32.NewProc("ShutdownBlockReasonCreate")
+	pShutdownBlockReasonDestroy = u32.NewProc("ShutdownBlockReasonDestroy")
 )
 
 const (
@@ -46,10 +58,14 @@ const (
 	CW_USEDEFAULT       = 0x80000000
 	IDC_ARROW           = 32512 // Standard arrow
 	IDI_APPLICATION     = 32512
+	IDYES               = 6
 	IMAGE_ICON          = 1          // Loads an icon
 	LR_DEFAULTSIZE      = 0x00000040 // Loads default-size icon for windows(SM_CXICON x SM_CYICON) if cx, cy are set to zero
 	LR_LOADFROMFILE     = 0x00000010 // Loads the stand-alone image from the file
+	MB_ICONWARNING      = 0x00000030
+	MB_YESNO            = 0x00000004
 	MF_BYCOMMAND        = 0x00000000
+	MFS_CHECKED         = 0x00000008
 	MFS_DISABLED        = 0x00000003
 	MFT_SEPARATOR       = 0x00000800
 	MFT_STRING          = 0x00000000
@@ -63,6 +79,7 @@ const (
 	NIF_ICON            = 0x00000002
 	NIF_INFO            = 0x00000010
 	NIF_MESSAGE         = 0x00000001
+	NIF_TIP             = 0x00000004
 	SW_HIDE             = 0
 	TPM_BOTTOMALIGN     = 0x0020
 	TPM_LEFTALIGN       = 0x0000
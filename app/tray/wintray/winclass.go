@@ -34,11 +34,7 @@ func (w *wndClassEx) register() error {
 // Unregisters a window class, freeing the memory required for the class.
 // https://msdn.microsoft.com/en-us/library/ms644899.aspx
 func (w *wndClassEx) unregister() error {
-	res, _, err := pUnregisterClass.Call(
-		uintptr(unsafe.Pointer(w.ClassName)),
-		uintptr(w.Instance),
-	)
-	if res == 0 {
+	if err := unregisterClass(w.ClassName, w.Instance); err != nil {
 		return err
 	}
 	return nil
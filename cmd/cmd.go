@@ -6,6 +6,7 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -30,6 +31,7 @@ import (
 	"golang.org/x/term"
 
 	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/app/store"
 	"github.com/jmorganca/ollama/format"
 	"github.com/jmorganca/ollama/parser"
 	"github.com/jmorganca/ollama/progress"
@@ -407,6 +409,51 @@ func CopyHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// AppDiagnoseHandler asks the running desktop app why its tray icon might
+// not be showing, through the app's control listener, so it still works when
+// the tray itself is broken
+func AppDiagnoseHandler(cmd *cobra.Command, args []string) error {
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	port, token := store.GetControlEndpoint()
+	if port == 0 {
+		return errors.New("the Ollama app isn't running")
+	}
+	req, err := http.NewRequestWithContext(cmd.Context(), http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/tray/diagnose", port), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't reach the Ollama app: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the Ollama app answered %s", resp.Status)
+	}
+
+	if asJSON {
+		_, err := os.Stdout.Write(body)
+		return err
+	}
+	var report struct {
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		return err
+	}
+	fmt.Println(report.Summary)
+	return nil
+}
+
 func PullHandler(cmd *cobra.Command, args []string) error {
 	insecure, err := cmd.Flags().GetBool("insecure")
 	if err != nil {
@@ -924,6 +971,20 @@ func NewCLI() *cobra.Command {
 		RunE:    DeleteHandler,
 	}
 
+	appCmd := &cobra.Command{
+		Use:   "app",
+		Short: "Manage the Ollama desktop app",
+	}
+
+	appDiagnoseCmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "Check why the app's tray icon isn't showing",
+		Args:  cobra.ExactArgs(0),
+		RunE:  AppDiagnoseHandler,
+	}
+	appDiagnoseCmd.Flags().Bool("json", false, "Show the individual checks as JSON")
+	appCmd.AddCommand(appDiagnoseCmd)
+
 	rootCmd.AddCommand(
 		serveCmd,
 		createCmd,
@@ -934,6 +995,7 @@ func NewCLI() *cobra.Command {
 		listCmd,
 		copyCmd,
 		deleteCmd,
+		appCmd,
 	)
 
 	return rootCmd